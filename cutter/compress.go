@@ -0,0 +1,138 @@
+// Transparent compression of input and output.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// If set, the compression format for output.
+var compressFormat string
+
+// compression describes one compressed format.  Formats the standard
+// library can't handle in one direction or the other go through the
+// command-line tool of the same name.
+type compression struct {
+	name   string
+	suffix string
+	magic  []byte
+}
+
+var compressions = []compression{
+	{"gzip", ".gz", []byte{0x1f, 0x8b}},
+	{"bzip2", ".bz2", []byte("BZh")},
+	{"xz", ".xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}},
+	{"zstd", ".zst", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// compressionNamed - the format with a name, if there is one
+func compressionNamed(name string) (compression, bool) {
+	for _, c := range compressions {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return compression{}, false
+}
+
+// compressionFor - the format a filename's suffix calls for, if any
+func compressionFor(filename string) (compression, bool) {
+	for _, c := range compressions {
+		if strings.HasSuffix(filename, c.suffix) {
+			return c, true
+		}
+	}
+	return compression{}, false
+}
+
+// filterReader reads the output of a decompressor running as a
+// separate process, reporting its failure at end of input.
+type filterReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (fr *filterReader) Read(p []byte) (int, error) {
+	n, err := fr.ReadCloser.Read(p)
+	if err == io.EOF {
+		if werr := fr.cmd.Wait(); werr != nil {
+			croakIO("%s failed on input: %v", fr.cmd.Path, werr)
+		}
+	}
+	return n, err
+}
+
+// decompress - recognize compressed input by its magic number and
+// return a reader of the uncompressed stream.  Other input is passed
+// through untouched.
+func decompress(rd io.Reader) io.Reader {
+	br := bufio.NewReader(rd)
+	for _, c := range compressions {
+		if head, _ := br.Peek(len(c.magic)); !bytes.Equal(head, c.magic) {
+			continue
+		}
+		switch c.name {
+		case "gzip":
+			gz, err := gzip.NewReader(br)
+			if err != nil {
+				croakParse("ill-formed gzip input: %v", err)
+			}
+			return gz
+		case "bzip2":
+			return bzip2.NewReader(br)
+		}
+		cmd := exec.Command(c.name, "-dc")
+		cmd.Stdin = br
+		cmd.Stderr = os.Stderr
+		pipe, err := cmd.StdoutPipe()
+		if err == nil {
+			err = cmd.Start()
+		}
+		if err != nil {
+			croakIO("could not run %s to decompress input: %v", c.name, err)
+		}
+		return &filterReader{pipe, cmd}
+	}
+	return br
+}
+
+// filterWriter feeds a compressor running as a separate process.
+type filterWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (fw *filterWriter) Close() error {
+	if err := fw.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return fw.cmd.Wait()
+}
+
+// compressOutput - return a writer that compresses onto w.  It must be
+// closed to finish the compressed stream.
+func compressOutput(w io.Writer, c compression) io.WriteCloser {
+	if c.name == "gzip" {
+		return gzip.NewWriter(w)
+	}
+	cmd := exec.Command(c.name, "-c")
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	pipe, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		croakIO("could not run %s to compress output: %v", c.name, err)
+	}
+	return &filterWriter{pipe, cmd}
+}
@@ -0,0 +1,300 @@
+// Per-user and per-directory defaults read at startup.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Pattern aliases from configuration, used as @NAME in place of a PATTERN.
+var patternAliases = make(map[string]string)
+
+// Named pipelines from configuration, run as script @NAME.
+var pipelines = make(map[string]string)
+
+// Options that say what a particular run reads, writes, or selects,
+// which it would be a trap to have a configuration file set for every
+// run.
+var perRunOptions = map[string]bool{
+	"range":       true,
+	"dates":       true,
+	"author":      true,
+	"infile":      true,
+	"output":      true,
+	"outfile":     true,
+	"expression":  true,
+	"logentries":  true,
+	"message-dir": true,
+	"load-map":    true,
+	"map-in":      true,
+	"save-map":    true,
+	"map-out":     true,
+}
+
+// configFiles - the configuration files to read, in order, so that
+// the per-directory one overrides the per-user one.  There are none
+// when REPOCUTTER_NOCONFIG is set, as it is for the test suite.
+func configFiles() []string {
+	if os.Getenv("REPOCUTTER_NOCONFIG") != "" {
+		return nil
+	}
+	files := make([]string, 0, 2)
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "repocutter.toml"))
+	}
+	return append(files, ".repocutter")
+}
+
+// loadConfig - read whatever configuration files exist.  Top-level
+// keys are long option names whose values become defaults, which must
+// be done before the command line is parsed so that it can override
+// them; the aliases and pipelines tables fill in the maps of those.
+func loadConfig() {
+	for _, filename := range configFiles() {
+		data, err := os.ReadFile(filename)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			croakIO("could not read configuration: %v", err)
+		}
+		tables := parseTOML(filename, string(data))
+		for key, value := range tables[""] {
+			option := flag.Lookup(key)
+			if option == nil || len(key) == 1 {
+				croakUsage("%s: no option %q to set a default for", filename, key)
+			}
+			if perRunOptions[key] {
+				croakUsage("%s: %s can only be given on the command line", filename, key)
+			}
+			var text string
+			switch v := value.(type) {
+			case []string:
+				croakUsage("%s: option %s can't take a list", filename, key)
+			case string:
+				text = v
+			default:
+				text = fmt.Sprint(v)
+			}
+			if err := flag.Set(key, text); err != nil {
+				croakUsage("%s: bad default for %s: %v", filename, key, err)
+			}
+		}
+		for table, store := range map[string]map[string]string{"aliases": patternAliases, "pipelines": pipelines} {
+			for key, value := range tables[table] {
+				if v, ok := value.(string); ok {
+					store[key] = v
+				} else if v, ok := value.([]string); ok && table == "pipelines" {
+					// A pipeline may be a list of commands.
+					store[key] = strings.Join(v, "\n")
+				} else {
+					croakUsage("%s: %s.%s must be a string", filename, table, key)
+				}
+			}
+		}
+		for table := range tables {
+			if table != "" && table != "aliases" && table != "pipelines" {
+				croakUsage("%s: unknown table [%s]", filename, table)
+			}
+		}
+	}
+}
+
+// expandAlias - the pattern an @NAME argument is an alias for.  Anything
+// else, including an @NAME with no alias, is its own pattern.
+func expandAlias(pattern string) string {
+	if strings.HasPrefix(pattern, "@") {
+		if expansion, ok := patternAliases[pattern[1:]]; ok {
+			return expansion
+		}
+	}
+	return pattern
+}
+
+// tomlParser reads the subset of TOML a configuration needs: tables of
+// keys whose values are strings, integers, booleans, or arrays of
+// strings.
+type tomlParser struct {
+	filename string
+	text     string
+	pos      int
+	line     int
+}
+
+func (p *tomlParser) fail(msg string, args ...interface{}) {
+	croakParse("%s:%d: %s", p.filename, p.line, fmt.Sprintf(msg, args...))
+}
+
+func (p *tomlParser) peek() byte {
+	if p.pos < len(p.text) {
+		return p.text[p.pos]
+	}
+	return 0
+}
+
+// skip - pass over blanks, and with newlines set over newlines and
+// comments too
+func (p *tomlParser) skip(newlines bool) {
+	for p.pos < len(p.text) {
+		switch c := p.text[p.pos]; {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case newlines && c == '\n':
+			p.line++
+			p.pos++
+		case newlines && c == '#':
+			for p.pos < len(p.text) && p.text[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// endLine - pass over the rest of a line, which may hold only a comment
+func (p *tomlParser) endLine() {
+	p.skip(false)
+	if p.peek() == '#' {
+		for p.pos < len(p.text) && p.text[p.pos] != '\n' {
+			p.pos++
+		}
+	}
+	if p.pos < len(p.text) && p.text[p.pos] != '\n' {
+		p.fail("unexpected %q", p.text[p.pos])
+	}
+}
+
+func (p *tomlParser) key() string {
+	if c := p.peek(); c == '"' || c == '\'' {
+		return p.str()
+	}
+	start := p.pos
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		if !(c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		p.fail("expected a key")
+	}
+	return p.text[start:p.pos]
+}
+
+// str - a basic string, in which backslash escapes are recognized, or
+// a literal string, in which they are not
+func (p *tomlParser) str() string {
+	quote := p.text[p.pos]
+	var out strings.Builder
+	for p.pos++; ; p.pos++ {
+		if p.pos >= len(p.text) || p.text[p.pos] == '\n' {
+			p.fail("unterminated string")
+		}
+		c := p.text[p.pos]
+		if c == quote {
+			p.pos++
+			return out.String()
+		}
+		if c == '\\' && quote == '"' && p.pos+1 < len(p.text) {
+			p.pos++
+			switch e := p.text[p.pos]; e {
+			case 'n':
+				c = '\n'
+			case 't':
+				c = '\t'
+			case '"', '\\':
+				c = e
+			default:
+				p.fail("unknown escape \\%c", e)
+			}
+		}
+		out.WriteByte(c)
+	}
+}
+
+func (p *tomlParser) value() interface{} {
+	switch c := p.peek(); {
+	case c == '"' || c == '\'':
+		return p.str()
+	case c == '[':
+		items := make([]string, 0)
+		for p.pos++; ; {
+			p.skip(true)
+			if p.peek() == ']' {
+				p.pos++
+				return items
+			}
+			if c := p.peek(); c != '"' && c != '\'' {
+				p.fail("arrays may hold only strings")
+			}
+			items = append(items, p.str())
+			p.skip(true)
+			if p.peek() == ',' {
+				p.pos++
+			} else if p.peek() != ']' {
+				p.fail("expected , or ] in array")
+			}
+		}
+	default:
+		start := p.pos
+		for p.pos < len(p.text) && strings.IndexByte(" \t\r\n#", p.text[p.pos]) == -1 {
+			p.pos++
+		}
+		word := p.text[start:p.pos]
+		if word == "true" || word == "false" {
+			return word == "true"
+		}
+		n, err := strconv.Atoi(strings.Replace(word, "_", "", -1))
+		if err != nil {
+			p.fail("unrecognized value %q", word)
+		}
+		return n
+	}
+}
+
+// parseTOML - the tables of a configuration, with the keys before
+// any table header under ""
+func parseTOML(filename string, text string) map[string]map[string]interface{} {
+	p := tomlParser{filename: filename, text: text, line: 1}
+	tables := map[string]map[string]interface{}{"": {}}
+	table := ""
+	for {
+		p.skip(true)
+		if p.pos >= len(p.text) {
+			return tables
+		}
+		if p.peek() == '[' {
+			end := strings.IndexByte(p.text[p.pos:], ']')
+			if end == -1 {
+				p.fail("unterminated table header")
+			}
+			table = strings.TrimSpace(p.text[p.pos+1 : p.pos+end])
+			p.pos += end + 1
+			if _, ok := tables[table]; ok {
+				p.fail("table [%s] defined twice", table)
+			}
+			tables[table] = make(map[string]interface{})
+		} else {
+			key := p.key()
+			p.skip(false)
+			if p.peek() != '=' {
+				p.fail("expected = after %s", key)
+			}
+			p.pos++
+			p.skip(false)
+			if _, ok := tables[table][key]; ok {
+				p.fail("key %s defined twice", key)
+			}
+			tables[table][key] = p.value()
+		}
+		p.endLine()
+	}
+}
@@ -0,0 +1,30 @@
+// Progress display on consoles that differ between platforms.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"runtime"
+	"strings"
+)
+
+// If set, the baton redraws its whole line after a carriage return
+// rather than backing up over what it last showed, because Windows
+// consoles don't reliably honor backspace.
+var lineRedraw = runtime.GOOS == "windows"
+
+// redraw - replace the status on display after the prompt, blanking
+// any left over from a longer one, and leave the cursor at its start
+func (baton *Baton) redraw(status string) {
+	width := len(status)
+	if baton.shown > width {
+		status += strings.Repeat(" ", baton.shown-width)
+	}
+	if lineRedraw {
+		baton.stream.WriteString("\r" + baton.line + status + "\r" + baton.line)
+	} else {
+		baton.stream.WriteString(status + strings.Repeat("\b", len(status)))
+	}
+	baton.shown = width
+}
@@ -0,0 +1,135 @@
+// Repair of copies whose source revision has been filtered out.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"strconv"
+	"strings"
+)
+
+// If set, Report rewrites copies from revisions that were not emitted.
+var fixCopyfrom bool
+
+// pathEvent is one change to whether a path exists in the emitted stream
+type pathEvent struct {
+	rev      int
+	seq      int
+	present  bool
+	frompath string
+	fromrev  int
+}
+
+// PathHistory records which paths exist in the emitted stream, enough
+// to tell whether a copy source is there to be copied from.  Paths
+// beneath a copied directory are found through the copy's source.
+type PathHistory struct {
+	first  int
+	seq    int
+	events map[string][]pathEvent
+}
+
+// NewPathHistory - create a history for a stream starting at a revision
+func NewPathHistory(first int) *PathHistory {
+	return &PathHistory{first: first, events: make(map[string][]pathEvent)}
+}
+
+// note - record an emitted node's effect on the tree
+func (ph *PathHistory) note(header StreamSection, rev int) {
+	path := string(header.payload("Node-path"))
+	action := string(header.payload("Node-action"))
+	if action == "delete" || action == "replace" {
+		ph.seq++
+		ph.events[path] = append(ph.events[path], pathEvent{rev: rev, seq: ph.seq})
+	}
+	if action == "add" || action == "replace" {
+		ev := pathEvent{rev: rev, present: true}
+		if frompath := header.payload("Node-copyfrom-path"); frompath != nil {
+			ev.frompath = string(frompath)
+			ev.fromrev, _ = strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+		}
+		ph.seq++
+		ev.seq = ph.seq
+		ph.events[path] = append(ph.events[path], ev)
+	}
+}
+
+// latest - the last event as of a revision on a path or any directory
+// above it, and the path it happened to
+func (ph *PathHistory) latest(path string, rev int) (*pathEvent, string) {
+	var latest *pathEvent
+	var owner string
+	for p := path; ; {
+		states := ph.events[p]
+		for i := len(states) - 1; i >= 0; i-- {
+			if states[i].rev <= rev {
+				if latest == nil || states[i].seq > latest.seq {
+					latest = &states[i]
+					owner = p
+				}
+				break
+			}
+		}
+		slash := strings.LastIndex(p, "/")
+		if slash == -1 {
+			break
+		}
+		p = p[:slash]
+	}
+	return latest, owner
+}
+
+// exists - does a path exist in the emitted stream as of a revision?
+func (ph *PathHistory) exists(path string, rev int) bool {
+	if path == "" {
+		return true
+	}
+	latest, owner := ph.latest(path, rev)
+	if latest == nil || !latest.present {
+		return false
+	}
+	if owner == path {
+		return true
+	}
+	// Only a directory copy brings in paths beneath it.
+	if latest.frompath == "" {
+		return false
+	}
+	return ph.exists(latest.frompath+path[len(owner):], latest.fromrev)
+}
+
+// origin - the copy source a path as of a revision derives from, if
+// it or a directory above it was last created by a copy.
+func (ph *PathHistory) origin(path string, rev int) (string, int, bool) {
+	latest, owner := ph.latest(path, rev)
+	if latest == nil || !latest.present || latest.frompath == "" {
+		return "", 0, false
+	}
+	return latest.frompath + path[len(owner):], latest.fromrev, true
+}
+
+// repairCopyfrom - point a copy from a revision that was not emitted at
+// the nearest earlier emitted revision that has its source, or failing
+// that turn it into a plain add.
+func (ds *DumpfileSource) repairCopyfrom(header StreamSection) StreamSection {
+	fromrev, err := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+	if err != nil || fromrev < ds.Paths.first || ds.EmittedRevisions[strconv.Itoa(fromrev)] {
+		return header
+	}
+	frompath := string(header.payload("Node-copyfrom-path"))
+	header = header.delete("Text-copy-source-md5:")
+	header = header.delete("Text-copy-source-sha1:")
+	for rev := fromrev - 1; rev >= ds.Paths.first; rev-- {
+		if ds.EmittedRevisions[strconv.Itoa(rev)] && ds.Paths.exists(frompath, rev) {
+			announce("r%s: copy from %s@%d moved back to r%d", ds.where(), frompath, fromrev, rev)
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+				return []byte(strconv.Itoa(rev))
+			})
+			return header
+		}
+	}
+	announce("r%s: copy from %s@%d has no emitted source, made a plain add", ds.where(), frompath, fromrev)
+	header = header.delete("Node-copyfrom-rev:")
+	return header.delete("Node-copyfrom-path:")
+}
@@ -0,0 +1,97 @@
+// Fatal error reporting, in text or as JSON records.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// errorClass is a kind of fatal error and the exit status it gives,
+// so a script driving repocutter can tell a malformed dump from a
+// full disk without reading the message.
+type errorClass struct {
+	name   string
+	status int
+}
+
+var (
+	errUsage   = errorClass{"usage", 2}
+	errParse   = errorClass{"parse", 3}
+	errIO      = errorClass{"io", 4}
+	errGeneral = errorClass{"error", 5}
+)
+
+// The exit status of diff and lint when they find something.  As with
+// diff(1), it is kept apart from the statuses of the errors above, so
+// finding differences or problems can't be mistaken for failing.
+const findingsStatus = 1
+
+// If set, fatal errors are reported as JSON records.
+var jsonErrors bool
+
+// The input most recently read from, which is where a parse error is.
+var inputPosition *LineBufferedSource
+
+// diagnostic is the JSON form of a fatal error.  The location members
+// are absent when no input has been read.
+type diagnostic struct {
+	Class    string `json:"class"`
+	Status   int    `json:"status"`
+	Message  string `json:"message"`
+	Revision *int   `json:"revision,omitempty"`
+	Line     *int   `json:"line,omitempty"`
+	Offset   *int   `json:"offset,omitempty"`
+}
+
+// Things to undo before exiting on a fatal error, such as output files
+// left half written.
+var failureCleanups []func()
+
+// onFailure - arrange for cleanup to run if a fatal error ends the run
+func onFailure(cleanup func()) {
+	failureCleanups = append(failureCleanups, cleanup)
+}
+
+// fail - report a fatal error of a class and exit with its status
+func fail(class errorClass, msg string, args ...interface{}) {
+	text := strings.TrimRight(fmt.Sprintf(msg, args...), "\n")
+	for _, cleanup := range failureCleanups {
+		cleanup()
+	}
+	if !jsonErrors {
+		fmt.Fprintf(os.Stderr, "repocutter%s: croaking, %s\n", tag, text)
+		os.Exit(class.status)
+	}
+	record := diagnostic{Class: class.name, Status: class.status, Message: text}
+	if lbs := inputPosition; lbs != nil {
+		revision, line, offset := lbs.revision, lbs.linenumber, lbs.Tell()
+		record.Revision, record.Line, record.Offset = &revision, &line, &offset
+	}
+	out, _ := json.Marshal(record)
+	os.Stderr.Write(append(out, '\n'))
+	os.Exit(class.status)
+}
+
+func croak(msg string, args ...interface{}) {
+	fail(errGeneral, msg, args...)
+}
+
+// croakUsage - the command line asks for something impossible
+func croakUsage(msg string, args ...interface{}) {
+	fail(errUsage, msg, args...)
+}
+
+// croakParse - the input is not a well-formed stream
+func croakParse(msg string, args ...interface{}) {
+	fail(errParse, msg, args...)
+}
+
+// croakIO - a file could not be opened, read, or written
+func croakIO(msg string, args ...interface{}) {
+	fail(errIO, msg, args...)
+}
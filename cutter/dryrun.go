@@ -0,0 +1,95 @@
+// Reporting what a transformation would change without emitting it.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// If set, Report counts what it would change instead of emitting the stream.
+var dryRun bool
+
+// Subcommands whose whole output goes through Report, which are the
+// ones a dry run can speak for.
+var dryRunCommands = newStringSet(
+	"checksum", "dateshift", "debranch", "dekeyword", "deselect", "eol",
+	"execfix", "expunge", "filecopy", "nodedelete", "obscure",
+	"pathrename", "pop", "propclean", "propdel", "proprename",
+	"propset", "propstrip", "push", "reduce", "reformat", "renumber",
+	"replace", "script", "select", "setcopyfrom", "setlog", "setpath",
+	"sift", "skipcopy", "strip")
+
+// changeCounts tallies the differences between the stream as read and
+// the stream as it would have been emitted.
+type changeCounts struct {
+	revisions         int
+	revisionsEmitted  int
+	revisionsModified int
+	nodes             int
+	nodesModified     int
+	nodesRemoved      int
+	properties        int // property blocks altered
+
+	renumbered      bool // the revision line about to be read was changed
+	revisionChanged bool
+}
+
+// watchRevisions - wrap a revhook so changes it makes are noticed
+func (cc *changeCounts) watchRevisions(revhook func(StreamSection) []byte) func(StreamSection) []byte {
+	return func(header StreamSection) []byte {
+		out := revhook(header)
+		if !bytes.Equal(out, header) {
+			cc.renumbered = true
+		}
+		return out
+	}
+}
+
+// startRevision - note a revision header read
+func (cc *changeCounts) startRevision() {
+	cc.revisions++
+	cc.revisionChanged = cc.renumbered
+	cc.renumbered = false
+}
+
+// emitRevision - note a revision header that would have been emitted
+func (cc *changeCounts) emitRevision() {
+	cc.revisionsEmitted++
+	if cc.revisionChanged {
+		cc.revisionsModified++
+	}
+}
+
+// noteProperties - note a property block before and after the prophook
+func (cc *changeCounts) noteProperties(before string, after string, revision bool) {
+	if before != after {
+		cc.properties++
+		if revision {
+			cc.revisionChanged = true
+		}
+	}
+}
+
+// noteNode - note a node as read and as it would have been emitted,
+// nil if it would have been dropped
+func (cc *changeCounts) noteNode(original []byte, emitted []byte) {
+	cc.nodes++
+	if emitted == nil {
+		cc.nodesRemoved++
+	} else if !bytes.Equal(original, emitted) {
+		cc.nodesModified++
+	}
+}
+
+// report - summarize the changes
+func (cc *changeCounts) report(out io.Writer) {
+	fmt.Fprintf(out, "revisions: %d read, %d modified, %d removed\n",
+		cc.revisions, cc.revisionsModified, cc.revisions-cc.revisionsEmitted)
+	fmt.Fprintf(out, "nodes: %d read, %d modified, %d removed\n",
+		cc.nodes, cc.nodesModified, cc.nodesRemoved)
+	fmt.Fprintf(out, "property blocks: %d modified\n", cc.properties)
+}
@@ -0,0 +1,477 @@
+// Reading git fast-import streams for the selection subcommands.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Commands that start a new section of a fast-import stream.  An ls
+// inside a commit is indistinguishable from one at top level, so it
+// is left out and stays with whatever command precedes it.
+var fastImportVerbs = []string{"blob", "commit", "tag", "reset", "feature", "option",
+	"progress", "checkpoint", "done", "alias", "get-mark", "cat-blob"}
+
+// isFastImport - does the input look like a git fast-import stream
+// rather than a Subversion dump?
+func (ds *DumpfileSource) isFastImport() bool {
+	if !ds.Lbs.HasLineBuffered() {
+		ds.Lbs.Peek()
+	}
+	first := string(ds.Lbs.Linebuffer)
+	return strings.HasPrefix(first, "#") || fastImportVerb(first) != ""
+}
+
+// fastImportVerb - the command a line starts, if any
+func fastImportVerb(line string) string {
+	verb := strings.Fields(line + " ")
+	if len(verb) == 0 {
+		return ""
+	}
+	for _, v := range fastImportVerbs {
+		if verb[0] == v {
+			return v
+		}
+	}
+	return ""
+}
+
+// FastImportSource reads a fast-import stream one command at a time.
+// Commits are numbered from 1 in stream order and play the part of
+// revisions; the file operations of each are its nodes.
+type FastImportSource struct {
+	Lbs      LineBufferedSource
+	Baton    *Baton
+	Revision int
+	Index    int
+	Out      io.Writer
+	// Where references to the marks of dropped commits now point,
+	// empty if there is no surviving ancestor.
+	remap map[string]string
+}
+
+// NewFastImportSource - take over the input of a dump source that has
+// turned out to be a fast-import stream
+func NewFastImportSource(ds DumpfileSource) *FastImportSource {
+	return &FastImportSource{
+		Lbs:   ds.Lbs,
+		Baton: ds.Baton,
+		Out:   ds.Out,
+		remap: make(map[string]string),
+	}
+}
+
+// fiCommit is a parsed commit.  Every element of header and ops is a
+// line, with the payload of any data command attached to it.
+type fiCommit struct {
+	header [][]byte
+	ops    [][]byte
+	props  Properties // svn:author, svn:date, and svn:log equivalents
+	mark   string
+	from   string
+}
+
+// readData - read the payload following a data line
+func (fi *FastImportSource) readData(line []byte) []byte {
+	arg := strings.TrimSpace(string(line[len("data "):]))
+	if strings.HasPrefix(arg, "<<") {
+		delim := arg[2:] + "\n"
+		payload := []byte{}
+		for {
+			text := fi.Lbs.Readline()
+			if len(text) == 0 {
+				croakParse("unexpected EOF in delimited data at commit %d", fi.Revision)
+			}
+			payload = append(payload, text...)
+			if string(text) == delim {
+				return payload
+			}
+		}
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		croakParse("ill-formed data line %q at commit %d", line, fi.Revision)
+	}
+	payload := fi.Lbs.Read(n)
+	if len(payload) < n {
+		croakParse("unexpected EOF in data at commit %d", fi.Revision)
+	}
+	return payload
+}
+
+// next - read the lines of the next command, nil at end of stream
+func (fi *FastImportSource) next() [][]byte {
+	lines := make([][]byte, 0)
+	for {
+		line := fi.Lbs.Readline()
+		if len(line) == 0 {
+			break
+		}
+		if len(lines) > 0 && fastImportVerb(string(line)) != "" {
+			fi.Lbs.Push(line)
+			break
+		}
+		if bytes.HasPrefix(line, []byte("data ")) {
+			line = append(line, fi.readData(line)...)
+			// Inline content belongs to the operation before it.
+			if n := len(lines); n > 0 && isFileOp(lines[n-1]) && !bytes.Contains(lines[n-1], []byte("\ndata ")) {
+				lines[n-1] = append(lines[n-1], line...)
+				continue
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	if fi.Baton != nil {
+		fi.Baton.Twirl("")
+	}
+	return lines
+}
+
+// isFileOp - is a commit line a file operation?
+func isFileOp(line []byte) bool {
+	for _, prefix := range []string{"M ", "D ", "C ", "R ", "N ", "deleteall"} {
+		if bytes.HasPrefix(line, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCommit - split a commit into header and operations
+func (fi *FastImportSource) parseCommit(lines [][]byte) *fiCommit {
+	commit := &fiCommit{props: Properties{properties: make(map[string]string)}}
+	for _, line := range lines {
+		if isFileOp(line) || (len(commit.ops) > 0 && string(line) == "\n") {
+			commit.ops = append(commit.ops, line)
+			continue
+		}
+		commit.header = append(commit.header, line)
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "mark":
+			commit.mark = fields[1]
+		case "from":
+			commit.from = fields[1]
+		case "author", "committer":
+			// The author, if there is one, is the one that counts.
+			if _, ok := commit.props.properties["svn:author"]; ok && fields[0] == "committer" {
+				continue
+			}
+			text := string(line)
+			if lt, gt := strings.Index(text, "<"), strings.Index(text, ">"); lt != -1 && gt > lt {
+				who := strings.TrimSpace(text[len(fields[0]):lt])
+				email := text[lt+1 : gt]
+				if at := strings.Index(email, "@"); at != -1 {
+					who = email[:at]
+				} else if email != "" {
+					who = email
+				}
+				commit.props.properties["svn:author"] = who
+				if when := strings.Fields(text[gt+1:]); len(when) > 0 {
+					if secs, err := strconv.ParseInt(when[0], 10, 64); err == nil {
+						commit.props.properties["svn:date"] = time.Unix(secs, 0).UTC().Format(time.RFC3339Nano)
+					}
+				}
+			}
+		case "data":
+			msg := line[bytes.IndexByte(line, '\n')+1:]
+			if strings.HasPrefix(fields[1], "<<") {
+				msg = msg[:len(msg)-len(fields[1])+1]
+			}
+			commit.props.properties["svn:log"] = string(msg)
+		}
+	}
+	return commit
+}
+
+// opPaths - the path a file operation acts on and, for a copy or
+// rename, its source
+func opPaths(op []byte) (string, string) {
+	line := string(op)
+	if nl := strings.IndexByte(line, '\n'); nl != -1 {
+		line = line[:nl]
+	}
+	// unquote - take a possibly quoted path off the front of s
+	unquote := func(s string, last bool) (string, string) {
+		if strings.HasPrefix(s, `"`) {
+			if prefix, err := strconv.QuotedPrefix(s); err == nil {
+				path, _ := strconv.Unquote(prefix)
+				return path, strings.TrimPrefix(s[len(prefix):], " ")
+			}
+		}
+		if last {
+			return s, ""
+		}
+		if sp := strings.IndexByte(s, ' '); sp != -1 {
+			return s[:sp], s[sp+1:]
+		}
+		return s, ""
+	}
+	switch line[0] {
+	case 'M':
+		fields := strings.SplitN(line, " ", 4)
+		if len(fields) < 4 {
+			return "", ""
+		}
+		path, _ := unquote(fields[3], true)
+		return path, ""
+	case 'D':
+		path, _ := unquote(line[2:], true)
+		return path, ""
+	case 'C', 'R':
+		from, rest := unquote(line[2:], false)
+		path, _ := unquote(rest, true)
+		return path, from
+	}
+	return "", ""
+}
+
+// fixRefs - point references to the marks of dropped commits at
+// their surviving ancestors, dropping references that have none
+func (fi *FastImportSource) fixRefs(lines [][]byte) [][]byte {
+	fixed := make([][]byte, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Fields(string(line))
+		if len(fields) == 2 && (fields[0] == "from" || fields[0] == "merge") {
+			if mark, ok := fi.remap[fields[1]]; ok {
+				if mark == "" {
+					continue
+				}
+				line = []byte(fields[0] + " " + mark + "\n")
+			}
+		}
+		fixed = append(fixed, line)
+	}
+	return fixed
+}
+
+// filter - copy the stream to output, keeping only the file
+// operations for which keep returns true.  Blobs are always kept.  A
+// commit left with no operations survives only if it had none to
+// begin with and keepEmpty says so.
+func (fi *FastImportSource) filter(keep func(op []byte) bool, keepEmpty func() bool) {
+	out := bufio.NewWriter(fi.Out)
+	defer out.Flush()
+	// The last surviving commit on each branch, which is what a
+	// commit without a from continues from.
+	tips := make(map[string]string)
+	for {
+		lines := fi.next()
+		if lines == nil {
+			break
+		}
+		verb := fastImportVerb(string(lines[0]))
+		if verb != "commit" {
+			lines = fi.fixRefs(lines)
+			if verb == "reset" {
+				ref := strings.TrimSpace(string(lines[0][len("reset "):]))
+				tips[ref] = ""
+				for _, line := range lines {
+					if bytes.HasPrefix(line, []byte("from ")) {
+						tips[ref] = strings.TrimSpace(string(line[len("from "):]))
+					}
+				}
+			}
+			for _, line := range lines {
+				out.Write(line)
+			}
+			continue
+		}
+		ref := strings.TrimSpace(string(lines[0][len("commit "):]))
+		fi.Revision++
+		fi.Index = 0
+		commit := fi.parseCommit(lines)
+		noteRevision(fi.Revision, &commit.props)
+		ops := make([][]byte, 0)
+		kept := 0
+		for _, op := range commit.ops {
+			if string(op) == "\n" {
+				ops = append(ops, op)
+				continue
+			}
+			fi.Index++
+			if keep(op) {
+				ops = append(ops, op)
+				kept++
+			}
+		}
+		had := fi.Index
+		fi.Index = 0
+		if kept == 0 && (had > 0 || !keepEmpty()) {
+			if commit.mark != "" {
+				parent := tips[ref]
+				if commit.from != "" {
+					parent = commit.from
+					if mark, ok := fi.remap[parent]; ok {
+						parent = mark
+					}
+				}
+				fi.remap[commit.mark] = parent
+			}
+			continue
+		}
+		for _, line := range fi.fixRefs(commit.header) {
+			out.Write(line)
+		}
+		for _, op := range ops {
+			out.Write(op)
+		}
+		tips[ref] = commit.mark
+	}
+}
+
+// fastImportSelect - select or deselect operations in a fast-import stream
+func fastImportSelect(fi *FastImportSource, selection SubversionRange, invert bool) {
+	fi.filter(func(op []byte) bool {
+		return selection.ContainsNode(fi.Revision, fi.Index) != invert
+	}, func() bool {
+		return selection.ContainsRevision(fi.Revision) != invert
+	})
+}
+
+// fastImportExpungeSift - drop or keep operations in a fast-import
+// stream by path.  Commits left with no operations are dropped.
+func fastImportExpungeSift(fi *FastImportSource, selection SubversionRange, expunge bool, fixed bool, patterns []string) {
+	matcher := NewSegmentMatcher(patterns, fixed)
+	fi.filter(func(op []byte) bool {
+		path, from := opPaths(op)
+		if !selection.ContainsNode(fi.Revision, fi.Index) || path == "" {
+			return true
+		}
+		matched := matcher.pathmatch(path)
+		if from != "" {
+			if expunge {
+				matched = matched || matcher.pathmatch(from)
+			} else {
+				matched = matched && matcher.pathmatch(from)
+			}
+		}
+		return matched != expunge
+	}, func() bool {
+		return true
+	})
+}
+
+// fastImportLog - report commits of a fast-import stream in the style of svn log
+func fastImportLog(fi *FastImportSource, selection SubversionRange, fixed bool, reverse bool, render func(*logRecord) string, patterns []string) {
+	var matcher SegmentMatcher
+	if len(patterns) > 0 {
+		matcher = NewSegmentMatcher(patterns, fixed)
+	}
+	entries := make([]string, 0)
+	for {
+		lines := fi.next()
+		if lines == nil {
+			break
+		}
+		if fastImportVerb(string(lines[0])) != "commit" {
+			continue
+		}
+		fi.Revision++
+		commit := fi.parseCommit(lines)
+		noteRevision(fi.Revision, &commit.props)
+		logentry := commit.props.properties["svn:log"]
+		if !selection.ContainsRevision(fi.Revision) || logentry == "" {
+			continue
+		}
+		matched := len(patterns) == 0
+		paths := make([]string, 0)
+		changes := make([]string, 0)
+		for _, op := range commit.ops {
+			if string(op) == "\n" {
+				continue
+			}
+			path, from := opPaths(op)
+			if len(patterns) > 0 && (matcher.pathmatch(path) || (from != "" && matcher.pathmatch(from))) {
+				matched = true
+			}
+			switch op[0] {
+			case 'M':
+				changes = append(changes, fmt.Sprintf("   M /%s", path))
+			case 'D':
+				changes = append(changes, fmt.Sprintf("   D /%s", path))
+			case 'C':
+				changes = append(changes, fmt.Sprintf("   A /%s (from /%s)", path, from))
+			case 'R':
+				changes = append(changes, fmt.Sprintf("   A /%s (from /%s)", path, from), fmt.Sprintf("   D /%s", from))
+				paths = append(paths, from)
+			default:
+				if bytes.HasPrefix(op, []byte("deleteall")) {
+					changes = append(changes, "   D /")
+				}
+			}
+			if path != "" {
+				paths = append(paths, path)
+			}
+		}
+		if !matched {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339Nano, commit.props.properties["svn:date"])
+		entry := render(&logRecord{
+			rev:      fi.Revision,
+			author:   commit.props.getAuthor(),
+			date:     date,
+			paths:    paths,
+			changes:  changes,
+			logentry: logentry,
+		})
+		if reverse {
+			entries = append(entries, entry)
+		} else {
+			io.WriteString(fi.Out, entry)
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		io.WriteString(fi.Out, entries[i])
+	}
+}
+
+// fastImportSee - report the file operations of a fast-import stream
+func fastImportSee(fi *FastImportSource, selection SubversionRange) {
+	for {
+		lines := fi.next()
+		if lines == nil {
+			break
+		}
+		if fastImportVerb(string(lines[0])) != "commit" {
+			continue
+		}
+		fi.Revision++
+		fi.Index = 0
+		commit := fi.parseCommit(lines)
+		noteRevision(fi.Revision, &commit.props)
+		for _, op := range commit.ops {
+			if string(op) == "\n" {
+				continue
+			}
+			fi.Index++
+			if !selection.ContainsNode(fi.Revision, fi.Index) {
+				continue
+			}
+			path, from := opPaths(op)
+			action := map[byte]string{'M': "modify", 'D': "delete", 'C': "copy", 'R': "rename", 'N': "note"}[op[0]]
+			if bytes.HasPrefix(op, []byte("deleteall")) {
+				action = "deleteall"
+			}
+			if from != "" {
+				path += " from " + from
+			}
+			fmt.Fprintf(fi.Out, "%-5s %-8s %s\n", fmt.Sprintf("%d.%d", fi.Revision, fi.Index), action, path)
+		}
+	}
+}
@@ -11,8 +11,13 @@ package main
 // SPDX-License-Identifier: BSD-2-Clause
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"math"
+	"sort"
+	"strconv"
+	"strings"
 )
 
 var phi float64
@@ -26,6 +31,7 @@ type NameSequence struct {
 	color       []string
 	item        []string
 	seenStrings map[string]string
+	usedNames   map[string]bool
 	modulus     int
 }
 
@@ -290,6 +296,7 @@ func NewNameSequence() NameSequence {
 	//    "Unicorn",         // 3 syllables
 
 	seq.seenStrings = make(map[string]string)
+	seq.usedNames = make(map[string]bool)
 
 	// Choose a prime close to (ncolors * nitems) / phi, where phi is the
 	// Golden Section ratio.  This is supposed to give the scramble better
@@ -319,11 +326,82 @@ func (seq *NameSequence) fancyName(n int) string {
 }
 
 func (seq *NameSequence) obscureString(s string) string {
+	return seq.obscureWidth(s, 0)
+}
+
+// obscureWidth is obscureString with the new names, if width is
+// nonzero, cut or padded to exactly that many characters.  A string
+// already given a name keeps it whatever its width.
+func (seq *NameSequence) obscureWidth(s string, width int) string {
 	v, ok := seq.seenStrings[s]
 	if ok {
 		return v
 	}
-	v = seq.fancyName(len(seq.seenStrings))
+	// Skip names a loaded mapping has already handed out, or that
+	// are the same as another once fitted to the width.  When the
+	// fancy names run out at that width, fall back to counting in
+	// base 36, going wider when the narrow numbers run out too.
+	wheelsize := len(seq.color) * len(seq.item)
+	for n := len(seq.seenStrings); ; n++ {
+		if width == 0 || n < len(seq.seenStrings)+wheelsize {
+			v = fitWidth(seq.fancyName(n), width)
+		} else {
+			if v = strconv.FormatInt(int64(n), 36); len(v) < width {
+				v = fitWidth(v, width)
+			}
+		}
+		if !seq.usedNames[v] {
+			break
+		}
+	}
 	seq.seenStrings[s] = v
+	seq.usedNames[v] = true
 	return v
 }
+
+// fitWidth - cut a name to width, or pad it by repeating it in lower
+// case; a width of 0 leaves it alone
+func fitWidth(name string, width int) string {
+	if width == 0 {
+		return name
+	}
+	for len(name) < width {
+		name += strings.ToLower(name)
+	}
+	return name[:width]
+}
+
+// load reads a mapping written by save, so that names stay the same
+// across runs.  Each line is an input string and its name, tab-separated.
+func (seq *NameSequence) load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			return fmt.Errorf("line %d: expected STRING<tab>NAME", lineno)
+		}
+		seq.seenStrings[fields[0]] = fields[1]
+		seq.usedNames[fields[1]] = true
+	}
+	return scanner.Err()
+}
+
+// save writes the mapping made so far, sorted by input string.
+func (seq *NameSequence) save(w io.Writer) error {
+	keys := make([]string, 0, len(seq.seenStrings))
+	for k := range seq.seenStrings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if strings.ContainsAny(k, "\t\n") {
+			return fmt.Errorf("can't save %q, which contains a tab or newline", k)
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", k, seq.seenStrings[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
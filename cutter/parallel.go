@@ -0,0 +1,64 @@
+// Transforming node content on several cores at once.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"io"
+	"runtime"
+)
+
+// How many node contents may be under transformation at once.
+var contentWorkers = runtime.NumCPU()
+
+// outputQueue keeps the filtered stream in order while the content of
+// some nodes is still being transformed.  Each piece of output gets a
+// slot in the queue when its place in the stream is known; a single
+// writer empties the slots in order as they are filled.
+type outputQueue struct {
+	slots   chan chan []byte
+	workers chan struct{}
+	done    chan struct{}
+}
+
+// newOutputQueue - start a queue writing to w with a pool of workers
+func newOutputQueue(w io.Writer, workers int) *outputQueue {
+	q := &outputQueue{
+		// Enough lookahead to keep every worker busy behind a slow node.
+		slots:   make(chan chan []byte, 4*workers),
+		workers: make(chan struct{}, workers),
+		done:    make(chan struct{}),
+	}
+	go func() {
+		for slot := range q.slots {
+			w.Write(<-slot)
+		}
+		close(q.done)
+	}()
+	return q
+}
+
+// put - queue text that is ready now
+func (q *outputQueue) put(text []byte) {
+	slot := make(chan []byte, 1)
+	slot <- text
+	q.slots <- slot
+}
+
+// later - queue the text a function will compute on a worker
+func (q *outputQueue) later(compute func() []byte) {
+	slot := make(chan []byte, 1)
+	q.slots <- slot
+	q.workers <- struct{}{}
+	go func() {
+		slot <- compute()
+		<-q.workers
+	}()
+}
+
+// drain - wait until everything queued has been written
+func (q *outputQueue) drain() {
+	close(q.slots)
+	<-q.done
+}
@@ -0,0 +1,83 @@
+// A first pass for selections that count from either end of the stream.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// streamShape is what a selection can need to know about a dump before
+// the stream goes by: its first and last revisions, and how many nodes
+// each revision has.
+type streamShape struct {
+	first int
+	last  int
+	nodes map[int]int
+}
+
+// The shape of the input; nil unless a selection counts from the end.
+var shape *streamShape
+
+// needsShape - does a selection specification count from either end?
+func needsShape(spec string) bool {
+	for _, s := range []string{"LAST", "BASE", "HEAD+", "HEAD-", ".-"} {
+		if strings.Contains(spec, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// prescan - learn the shape of a dump, returning a file positioned at
+// its start to read it again from.  Input that can't be rewound, such
+// as a pipe, is spooled to a temporary file as it is scanned.
+func prescan(input *os.File) *os.File {
+	var rd io.Reader = input
+	spool := input
+	st, err := input.Stat()
+	seekable := err == nil && st.Mode().IsRegular()
+	if !seekable {
+		spool, err = ioutil.TempFile("", "repocutter")
+		if err != nil {
+			croakIO("could not create spool file: %v", err)
+		}
+		// Unlinked now, the file lasts only as long as it is open.
+		os.Remove(spool.Name())
+		rd = io.TeeReader(input, spool)
+	}
+	source := NewDumpfileSource(decompress(rd), nil)
+	source.Out = ioutil.Discard
+	if source.isFastImport() {
+		croakUsage("revisions relative to BASE, HEAD or LAST, and negative node indices, apply only to Subversion dumps")
+	}
+	shape = &streamShape{first: -1, nodes: make(map[int]int)}
+	prophook := func(props *Properties) {
+		if source.Index == 0 {
+			if shape.first == -1 {
+				shape.first = source.Revision
+			}
+			shape.last = source.Revision
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Index > 0 {
+			shape.nodes[source.Revision] = source.Index
+		}
+		return nil
+	}
+	wasDry := dryRun
+	dryRun = false
+	source.Report(nil, prophook, headerhook, nil)
+	dryRun = wasDry
+	// Take in anything after the last revision, so the spool is whole.
+	io.Copy(ioutil.Discard, rd)
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		croakIO("could not rewind input after prescan: %v", err)
+	}
+	return spool
+}
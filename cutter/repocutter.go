@@ -7,16 +7,22 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
 	"math"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"text/template"
 	"time"
 
 	term "golang.org/x/term" // For IsTerminal()
@@ -24,6 +30,9 @@ import (
 
 const linesep = "\n"
 
+// Paths in a dump are separated by slashes whatever the host's separator.
+const pathsep = '/'
+
 var dochead = `repocutter - stream surgery on SVN dump files
 general usage: repocutter [-q] [-r SELECTION] SUBCOMMAND
 
@@ -33,7 +42,18 @@ or more comma-separated ranges.  A range may consist of an endpoint or a colon-
 separated pair of endpoints.  An endpoint may consist of an integer identifying
 a revision, the special name HEAD for the head (last) revision, or a node
 specification of the form rev.node where rev is an integer revision number and
-node in a 1-origin node index.
+node in a 1-origin node index.  A node index may be * for all nodes of the
+revision, as in 2.3:2.*, or negative to count back from its last node, so that
+2.-1 is the last node of revision 2; LAST is the same as -1.  LAST may also
+stand for the last revision in the dump, and unlike HEAD can begin a range;
+BASE stands for the first.  A revision may be followed by offsets such as +5
+or -100, so HEAD-100:HEAD is the last hundred and one revisions and BASE+10
+the eleventh.  Counting from either end takes a first pass over the dump,
+which is spooled to a temporary file if it comes from a pipe.
+
+A range of the form @FILE stands for the selection in FILE: the revisions
+it contains if it is a Subversion dump, otherwise the comma- or whitespace-
+separated ranges it lists.
 
 Filename PATTERN arguments are regular expressions to match pathnames,
 constrained so that each match must be a path segment or a sequence of path
@@ -43,12 +63,20 @@ of string.  With a leading ^ the match is constrained to be a leading
 sequence of the pathname; with a trailing $, a trailing one.
 
 The -f/-fixed option disables regexp compilation of PATTERN arguments, treating
-them as literal strings.
+them as literal strings.  The -g/--glob option makes them shell globs instead,
+in which * and ? match within a path segment, ** matches across segments, and
+a leading or trailing / anchors the glob to the start or end of the path.
+The -y/--ignore-case option makes PATTERN arguments, and the patterns of
+pathrename, match paths regardless of case.
 
 Normally, each subcommand produces a progress spinner on standard error; each
 turn means another revision has been filtered. The -q (or --quiet) option
 suppresses this.
 
+Defaults for options, @NAME aliases for PATTERN arguments, and pipelines to
+run as 'script @NAME' may be set in ~/.config/repocutter.toml and, overriding
+that, ./.repocutter, unless REPOCUTTER_NOCONFIG is set; see the manual page.
+
 Type 'repocutter help <subcommand>' for help on a specific subcommand.
 
 Available subcommands and help topics:
@@ -66,17 +94,174 @@ const debugPARSE = 2
 
 var quiet bool
 
+// When set, Report regenerates text checksums instead of trusting the input.
+var rehash bool
+
 var helpdict = map[string]struct {
 	oneliner string
 	text     string
 }{
+	"atomize": {
+		"Split revisions into single-node revisions",
+		`atomize: usage: repocutter atomize
+
+Explode each revision into a series of revisions carrying one node each,
+in the original order, so that a bisection can land between any two
+nodes. Every new revision keeps the author and date of the revision it
+came from, and its log message is the original one followed by a line
+giving the old revision and node as [REV.NODE]. Revisions without nodes
+pass through as they are. All revisions are renumbered; a
+Node-copyfrom-rev now names the last revision made from the old one,
+and mergeinfo ranges are widened to cover the whole of each old
+revision they mention. Any selection option is rejected.
+`},
+	"attribution": {
+		"Rewrite author properties from an author map",
+		`attribution: usage: repocutter [-r SELECTION] [-I PROPERTY] attribution MAPFILE
+
+Rewrite svn:author revision properties using an author map in the format
+reposurgeon's authors command reads: lines of the form
+
+    svnuser = Full Name <email> [timezone]
+
+with blank lines, # comments, and + alias lines ignored.  Usernames are
+matched without regard to case.  Each mapped svn:author is replaced by
+"Full Name <email>", which reposurgeon's Subversion reader takes as a
+complete attribution, so no separate author-map pass is needed after
+import.  Authors missing from the map are left alone and each is
+reported once.
+
+With -I (or -identity-property), the whole right-hand side of the
+mapping, timezone included, is also stored in the named revision
+property, which reposurgeon keeps among the commit's properties.
+This transform can be restricted by a selection set.
+`},
+	"authors": {
+		"Report activity per author",
+		`authors: usage: repocutter [-r SELECTION] authors [PREFIX...]
+
+List each distinct svn:author in the selection, sorted by name, with its
+commit count and the dates of its first and last commits.  Revisions
+without an author are counted under "(no author)".  With PREFIX
+arguments, each author line is followed by the number of that author's
+commits touching each prefix, counting a commit once per prefix however
+many of its nodes lie there.  Useful for building an author map and
+sizing the identity cleanup a conversion will need.
+`},
+	"checksum": {
+		"Recompute text checksums",
+		`checksum: usage: repocutter checksum
+
+Recompute the Text-content-md5 and Text-content-sha1 headers of every
+node with text content, replacing stale ones and inserting missing ones,
+so the output passes svnadmin load --validate-checksums again after
+commands such as replace and strip.  Nodes carrying deltas are left
+alone.  Takes no arguments and no selection.
+
+The -H (or --recompute-hashes) option does the same thing as a side
+effect of any other subcommand that edits the stream.
+`},
 	"closure": {
 		"Compute the transitive closure of a path set",
-		`closure: usage: repocutter [-q] closure PATH...
+		`closure: usage: repocutter [-q] [-r SELECTION] [-f|-fixed|-g|-glob] [-R|-revisions] closure PATTERN...
 
 The 'closure' subcommand computes the transitive closure of a path set under the
 relation 'copies from' - that is, with the smallest set of additional paths such
 that every copy-from source is in the set.
+
+The set starts as the node paths matching the PATTERN arguments (or, with -f,
+the literal paths given).  A copy whose target lies in the set brings in its
+whole source; a directory copy whose target lies above something in the set
+brings in only the corresponding part of its source.  The result is listed one
+path per line, sorted, leaving out paths beneath other listed paths, so it can
+be handed straight to 'repocutter -f sift' to carve out a subproject without
+breaking its copies.  With -R (or -revisions), the revisions those needed
+copies are made from are listed instead.  Only nodes within the selection
+are considered.
+`},
+	"coalesce": {
+		"Merge runs of revisions by one author",
+		`coalesce: usage: repocutter [-r SELECTION] coalesce [WINDOW]
+
+Merge each run of consecutive revisions that have the same author and
+the same log message into a single revision, as when cvs2svn has split
+one logical change over several commits. If a WINDOW is given, as a Go
+duration such as 5m or 1h, revisions by the same author made within
+that time of the one before also join the run even when their log
+messages differ; the distinct messages are then joined with blank lines.
+
+The merged revision carries the nodes of the whole run in order, and
+the date of its last revision. A revision that copies from one earlier
+in the run starts a new run instead, as it would otherwise copy from
+itself. With a selection, only selected revisions are merged. All
+revisions are renumbered, and Node-copyfrom-rev headers and mergeinfo
+ranges are patched to match.
+`},
+	"dateshift": {
+		"Offset revision dates",
+		`dateshift: usage: repocutter [-r SELECTION] dateshift OFFSET
+       repocutter dateshift SELECTION=OFFSET...
+
+Add an offset to the svn:date property of revisions.  An OFFSET is a
+signed duration such as -3h, +90m, or 1h30m15s; in the first form it
+applies to every revision in the selection, and in the second each
+SELECTION gets its own offset, the first matching one winning.  Use this
+to correct a period when a server clock was wrong.
+
+Every date touched is rewritten in Subversion's own format, in UTC with
+microseconds.  Dates carrying a zone offset, using a space instead of a
+T, or having no zone at all (taken as UTC), as some conversion tools
+leave behind, are accepted, so an OFFSET of 0 simply normalizes them.
+Property lengths are updated to match.  A warning is issued for each
+revision whose date ends up earlier than the one before it.
+`},
+	"debranch": {
+		"Dissolve a branch into another directory",
+		`debranch: usage: repocutter [-r SELECTION] debranch BRANCH [TARGET]
+
+Move the history of the directory BRANCH onto TARGET (trunk by
+default), as if every change made on the branch had been made there.
+Node-path and Node-copyfrom-path headers and mergeinfo paths under
+BRANCH are rewritten to lie under TARGET; with a selection, only
+headers in selected nodes are rewritten.
+
+The copy that created the branch then lands on TARGET. If TARGET does
+not exist at that point it becomes a plain add of TARGET from the same
+source. If TARGET exists and the branch was copied from it, the copy is
+dropped (or reduced to a property change) since TARGET already holds
+that tree; a warning is issued if TARGET changed after the revision the
+branch was copied from, as that work is now shared. A copy from
+anywhere else replaces TARGET. Changes made directly to TARGET while
+the branch was live are left alone, so for a clean result TARGET
+should be idle (or expunged) over that period.
+`},
+	"dedup": {
+		"Report identical blobs",
+		`dedup: usage: repocutter [-r SELECTION] dedup
+
+Hash the text content of every selected node and report each group of
+two or more identical blobs: its MD5 sum, size, and number of copies,
+the bytes wasted by all but the first, and the REV:PATH of each copy.
+Groups are listed most wasteful first, followed by the total.  Copies
+made with Subversion copy operations share storage and are not counted;
+this finds the same content committed more than once, as vendor drops
+and re-imports do.  Delta dumps are expanded to compare full texts.
+`},
+	"dekeyword": {
+		"Collapse expanded keywords in text content",
+		`dekeyword: usage: repocutter [-r SELECTION] [-f] dekeyword [PATTERN...]
+
+Rewrite expanded RCS and Subversion keywords such as $Id: ...$,
+$Revision: ...$, and $Date: ...$ in file content back to their
+unexpanded forms ($Id$, $Revision$, $Date$), so that the expansions
+don't show up as spurious differences after conversion.  The fixed-width
+$Keyword:: ...$ form is collapsed too.  The keywords recognized are Id,
+Header, Revision, Rev, LastChangedRevision, Date, LastChangedDate,
+Author, LastChangedBy, HeadURL, URL, Source, RCSfile, State, Locker,
+and Name; $Log$ histories are left alone.  With PATTERN arguments, only
+matching paths are processed.  Binary files are skipped as in eol.
+Length headers are updated and checksums recomputed.  This transform
+can be restricted by a selection set.
 `},
 	"deselect": {
 		"Deselecting revisions",
@@ -85,16 +270,127 @@ that every copy-from source is in the set.
 The 'deselect' subcommand selects a range and permits only revisions and nodes
 NOT in that range to pass to standard output.  Any mergeinfo properties in other
 revisions are updated so they no longer refer to dropped revisiomns.
+`},
+	"diff": {
+		"Structurally compare two dumps",
+		`diff: usage: repocutter [-V|-skip-volatile] diff FILE1 FILE2
+
+Compare two dump files revision by revision and node by node, reporting
+each divergence on a line of its own: revisions or nodes present in only
+one dump, differing node headers (paths, kinds, actions, copy sources),
+differing revision or node properties, and differing text content.
+Revisions are paired by number and nodes by their position within a
+revision; compare renumbered dumps with renumbered ones.  Content is
+compared by hash; delta content is expanded before comparison.  Length
+headers are never compared, as they follow from the content.
+
+With -V (or --skip-volatile), the checksum headers that commands such as
+replace and strip remove are ignored as well.  The exit status is 1 if
+any differences were found, 0 if none were, and greater than 1 if the
+comparison failed.
+`},
+	"emptydrop": {
+		"Drop revisions with no nodes",
+		`emptydrop: usage: repocutter [-F] emptydrop
+
+Remove every revision other than 0 that has no nodes, as expunge and
+sift tend to leave behind, and renumber the remaining revisions to be
+contiguous in the same pass.  Node-copyfrom-rev headers that name a
+dropped revision are pointed at the last kept revision before it, which
+has the same tree.  Mergeinfo ranges are narrowed to the kept revisions
+within them, and ranges that held only dropped revisions disappear.
+
+With -F (or -fold-logs), the log messages of dropped revisions are not
+lost but prepended, separated by blank lines, to the log of the next
+kept revision.  Takes no arguments and no selection.
+`},
+	"eol": {
+		"Normalize line endings in text content",
+		`eol: usage: repocutter [-r SELECTION] [-f] eol {lf|crlf} [PATTERN...]
+
+Convert the line endings in the content of file nodes to LF, or with
+crlf to CR-LF; lone CRs count as line endings too.  With PATTERN
+arguments, only matching paths are converted.  Files whose last
+svn:mime-type setting is anything but text/*, and any content containing
+NUL bytes, are treated as binary and left alone.  Length headers are
+updated and checksums recomputed.  This transform can be restricted by
+a selection set.
+`},
+	"execfix": {
+		"Set or clear the executable bit on files by name",
+		`execfix: usage: repocutter [-r SELECTION] execfix [!]GLOB...
+
+Set the svn:executable property on every file whose name matches one of
+the GLOB arguments, shell-style wildcards allowed, throughout the
+history; a GLOB prefixed with ! clears it instead, and takes precedence.
+A GLOB containing a slash is matched against the whole path, otherwise
+against the last path segment, so '*.sh' and 'configure' do what you
+would expect.
+
+Property sections that exist are amended.  Where a file is added, or
+copied from a file whose properties disagree, without a property
+section, one is inserted carrying whatever properties it would
+otherwise have had, and the length headers are fixed up.  Property
+deltas are expanded first.  This transform can be restricted by a
+selection set.
+`},
+	"export-git": {
+		"Convert a linear dump to a git fast-import stream",
+		`export-git: usage: repocutter [-r SELECTION] export-git [BRANCH]
+
+Do a lightweight conversion of a dump to a git fast-import stream on
+standard output, one commit per revision on a single branch (master
+unless BRANCH is given), with committer, date, and comment taken from
+the revision properties.  File adds and changes become modify
+operations, deletes become delete operations, and directory copies
+become modify operations for every file they bring in; empty
+directories vanish, as git has no way to represent them.  Files with
+svn:executable set get mode 100755 and those with svn:special set
+become symbolic links.  Revisions with no file operations are skipped.
+
+No attempt is made to recognize branches, tags, or merges, so this is
+for simple repositories or dumps that have already been cut down to
+one line of development with sift, pop, and the like; for anything
+more, use reposurgeon.  Nodes outside the selection are left out of
+the stream, but their content is still tracked.
 `},
 	"expunge": {
 		"Expunge operations by Node-path header",
-		`expunge: usage: repocutter [-r SELECTION ] [-f|-fixed] expunge PATTERN...
+		`expunge: usage: repocutter [-r SELECTION ] [-f|-fixed|-g|-glob] [-k KIND] [-a ACTION] expunge [PATTERN...]
 
 Delete all operations with Node-path or Node-copyfrom-path headers matching
 specified Golang regular expressions (opposite of 'sift').  Any revision
 left with no Node records after this filtering has its Revision record dropped as
 well. Mergeinfo properties in all revisions are updated so they no longer refer
 to dropped revisions.
+
+With -k (or --kind), only nodes of the given kinds (file, dir) are
+deleted; with -a (or --action), only nodes with the given actions (add,
+change, delete, replace).  Each takes a comma-separated list.  When
+either is given the PATTERN arguments are optional, and without them
+every node of the given kinds and actions is deleted; thus
+"repocutter -r 100:200 -k dir -a delete expunge" drops all directory
+deletes in r100:200.  Mergeinfo is then not removed by path.
+`},
+	"externals": {
+		"Report or rewrite svn:externals definitions",
+		`externals: usage: repocutter [-r SELECTION] externals [OLD=NEW...]
+
+With no arguments, report every svn:externals definition in the dump.
+For each directory and each span of revisions over which its property
+held one value, print the directory and span in selection syntax
+(REV:REV, or REV:HEAD if the value is live at the end of the dump)
+followed by one line per definition giving its local directory, its
+URL, and its pin: rREV for an operative revision, @PEG for a peg
+revision, or "unpinned". Both the pre-1.5 and later formats are read.
+Directory copies carry the externals of their source. With a
+selection, only spans beginning in selected revisions are listed.
+
+With OLD=NEW arguments, instead pass the dump through with
+repository-relative externals (those with URLs beginning ^/) rewritten,
+so that a URL under ^/OLD points under ^/NEW; use this alongside a
+pathrename or similar that moves the targets. Only the URL field is
+touched, and other forms of relative URL are left alone.
 `},
 	"filecopy": {
 		"Resolve filecopy operations on a stream.",
@@ -112,22 +408,205 @@ This may be required in order to extract filecopies from branches.
 Restricting the range holds down the memory requirement of this tool,
 which in the worst (and default) 1:$ case will keep a copy of evert blob
 in the repository until it's done processing the stream.
+`},
+	"flatten": {
+		"Replace copies with explicit adds of their content",
+		`flatten: usage: repocutter [-r SELECTION] [-f] flatten [PATTERN...]
+
+Replace each copy within the selection with explicit adds carrying the
+content and properties of the copy source as of the copied-from
+revision.  A file copy becomes an add (or replace) of the file; a
+directory copy becomes an add of the directory followed by adds of
+every directory and file beneath it.  Properties or content that the
+copy node set itself are kept.  If PATTERN arguments are given, only
+copies whose Node-copyfrom-path matches one of them are flattened;
+patterns are regular expressions unless -f is given, in which case they
+are literal strings.
+
+Use this before a sift or deselect that would remove copy sources, so
+the result stays self-contained.  Like filecopy, this keeps every blob
+in the repository in memory while it runs, and it must see the stream
+from revision 1 for the copy sources to be known.
+`},
+	"grep": {
+		"Search file content across history",
+		`grep: usage: repocutter [-r SELECTION] [-f] [-n] grep REGEXP [PATTERN...]
+
+Search the text of every file node within the selection for lines
+matching the Go regular expression REGEXP, and report each as
+REV:PATH:LINE.  Only content a node carries is searched, so each match
+is reported at the revisions where matching text was added or changed;
+the first report for a string tells when it entered history.  With -n
+(or --names-only), only REV:PATH is reported for each node with a match;
+binary content, containing NUL bytes, is always reported that way.
+
+If PATTERN arguments are given, only nodes whose Node-path matches one
+of them are searched; patterns are regular expressions unless -f is
+given, in which case they are literal strings (REGEXP is always a
+regular expression).
+`},
+	"inject": {
+		"Splice synthetic revisions into a dump",
+		`inject: usage: repocutter inject REV FILE
+
+Read one or more revision records (header, properties and nodes) from
+FILE and splice them into the stream immediately after revision REV.
+Any stream header and revision 0 in FILE are skipped.  The injected
+revisions are numbered REV+1 onward whatever their numbers in FILE, and
+all later revisions are renumbered to follow them, with
+Node-copyfrom-rev headers and mergeinfo ranges patched to match.
+Copy sources inside FILE are passed through unaltered, so they must
+refer to revisions as numbered in the output.  Useful for adding
+branch-creation revisions that a conversion lost.
+`},
+	"join": {
+		"Concatenate dumps into a single renumbered stream",
+		`join: usage: repocutter [-b BASE] join [PROJECT=]FILE...
+
+Concatenate the named dump files into a single stream on standard
+output, in the order given.  Revisions are renumbered contiguously from
+the -b base (default 0), and Node-copyfrom-rev headers and mergeinfo
+ranges are patched to match. Only the first file's preamble and
+revision 0 are kept.
+
+A file argument of the form PROJECT=FILE pushes the project directory
+onto every Node-path, Node-copyfrom-path and mergeinfo path from that
+file, and emits an add of the project directory in its first revision
+with content.  A FILE of - reads standard input.  Any selection option
+is rejected.
+`},
+	"linkfix": {
+		"Repair symlinks that disagree with svn:special",
+		`linkfix: usage: repocutter [-r SELECTION] linkfix [report]
+
+Subversion stores a symlink as a file with the svn:special property
+whose content is "link " followed by the target, on one line.  Find
+file nodes where the two disagree and repair them: content of that form
+without svn:special gets the property; svn:special on a bare one-line
+target has "link " prepended to the content; svn:special on anything
+else is removed.  Each repair is reported on stderr unless -q is given.
+Repaired nodes are rewritten with full text and properties.
+
+With the argument "report", nothing is repaired and no dump is written;
+each mismatch is listed on stdout instead.  Only nodes within the
+selection are checked.
+`},
+	"lastchange": {
+		"Report the last change to each path",
+		`lastchange: usage: repocutter [-r REVISION] lastchange [PATH...]
+
+For every path present as of a revision, report the last revision that
+changed it, with that revision's author and date, one path per line
+with tab-separated fields, sorted by path.  A directory counts as
+changed whenever anything beneath it was; a copy counts as a change to
+everything it brings in, and a deletion as a change to the directory it
+was made in.  The revision is the upper bound of the selection,
+defaulting to the last revision in the dump.  With PATH arguments,
+only those paths and what lies beneath them are reported.
+`},
+	"lint": {
+		"Check the structural integrity of a dump",
+		`lint: usage: repocutter lint
+
+Check that a dump is structurally sound: that Content-length matches
+Prop-content-length plus Text-content-length, that property blocks are
+well formed and exactly as long as their headers say, that revision
+numbers strictly increase, and that every Node-copyfrom-rev refers to
+an earlier revision present in the dump.  Each problem is reported on
+one line giving the revision and the byte offset of the record it was
+found in.  After a problem that loses sync with the stream, checking
+resumes at the next record header.  The exit status is 1 if any problems
+were found, 0 if none were, and greater than 1 if checking failed.
+Takes no arguments and no selection.
 `},
 	"log": {
 		"Extracting log entries",
-		`log: usage: repocutter [-r SELECTION] log
+		`log: usage: repocutter [-r SELECTION] [-f] [-e] [-v] [-T json | -u TEMPLATE] log [PATTERN...]
 
 Generate a log report, same format as the output of svn log on a
-repository, to standard output.
+repository, to standard output.  Entries are in stream order, oldest
+first; with -e (or --reverse) they come newest first, as svn log gives
+them.  With -v (or --verbose) each entry lists its changed paths, as
+svn log -v does.
+
+If PATTERN arguments are given, only revisions with a node whose
+Node-path matches one of them are reported; patterns are regular
+expressions unless -f is given, in which case they are literal strings.
+
+With -T json (or --format=json), each entry is instead one JSON object
+per line, with the fields rev, author, date, paths (the paths changed,
+without a leading slash), and logentry.  With -u (or --template), each
+entry is rendered through a Go text/template over the same fields,
+followed by a newline; date is a time, so it can be formatted with its
+Format method, and the functions join, trim, and firstline are
+available.  Naming a field that doesn't exist is an error.  For
+example, to make a changelog:
+
+    repocutter -e -u '{{.date.Format "2006-01-02"}} {{.author}}: {{firstline .logentry}}' log
+`},
+	"ls": {
+		"List the tree as of a revision",
+		`ls: usage: repocutter [-r REVISION] ls [PATH...]
+
+Reconstruct the directory tree as of a revision by replaying the adds,
+deletes, and copies in the dump up to it, and list the paths present,
+sorted, with a trailing / marking directories.  The revision is the
+upper bound of the selection, defaulting to the last revision in the
+dump.  With PATH arguments, only those paths and what lies beneath
+them are listed.  Useful for deciding what patterns to give sift and
+expunge on an unfamiliar dump.
+`},
+	"mergeinfo": {
+		"Canonicalize mergeinfo properties",
+		`mergeinfo: usage: repocutter [-r SELECTION] mergeinfo
+
+Rewrite the svn:mergeinfo (and svnmerge-integrated) properties of
+selected nodes in canonical form: source lines sorted by path, lines
+for the same path merged into one, and the revision ranges in each
+sorted with overlapping and adjacent ranges coalesced.  Lines naming a
+path that appears nowhere earlier in the dump, either as a node or
+beneath a copied directory, are dropped with a warning; a property
+left with no lines is removed.  Broken mergeinfo is a leading cause of
+spurious merge links in conversions.
+`},
+	"nodedelete": {
+		"Delete nodes by rev.node coordinates",
+		`nodedelete: usage: repocutter -r SELECTION nodedelete
+
+Delete the nodes in the selection, which must be given with a node part
+on every endpoint (for example -r 1234.3 or -r 1234.3:1234.5) so that
+no whole revision is removed by accident. Any revision left with no Node
+records has its Revision record dropped as well, and mergeinfo properties
+are updated so they no longer refer to dropped revisions. Unlike expunge,
+no path patterns are involved, so only the nodes named are touched.
 `},
 	"obscure": {
 		"Obscure pathnames",
-		`obscure: usage: repocutter [-r SELECTION] obscure
+		`obscure: usage: repocutter [-r SELECTION] [-m MAPFILE] [-M MAPFILE] obscure [--keep-extensions] [--keep-lengths]
 
 Replace path segments and committer IDs with arbitrary but consistent
 names in order to obscure them. The replacement algorithm is tuned to
 make the replacements readily distinguishable by eyeball.  This
 transform can be restricted by a selection set.
+
+Each path segment is replaced separately, so paths keep their depth.
+To make an anonymized dump that loads like the original, with
+--keep-extensions the extension of each segment, such as .c in
+main.c, is kept and only the part before it replaced; with
+--keep-lengths each new name is cut or padded to the length of what
+it replaces, going longer only when short names run out.  A string
+that already has a name, from earlier in the dump or a loaded map,
+keeps it whatever its length.
+
+With -M or --save-map, the mapping from original strings to
+replacement names is written to the named file when the run
+finishes, one tab-separated STRING NAME pair per line.  Path segments
+and committer IDs share a single mapping. With -m or --load-map, a
+mapping previously saved is read before the dump is processed, so
+strings already in it keep their replacement names; this allows
+several dumps from the same repository to be obscured consistently.
+The saved file can also be used to reverse the obscuring, or to apply
+it to logs and bug reports.
 `},
 	"pathlist": {
 		"List all distinct paths in a stream",
@@ -138,7 +617,7 @@ encountered.
 `},
 	"pathrename": {
 		"Transform path headers with a regexp replace",
-		`pathrename: usage: repocutter [-r SELECTION ] pathrename {FROM TO}+
+		`pathrename: usage: repocutter [-r SELECTION ] pathrename [--file MAP]... {FROM TO}*
 
 Modify Node-path headers, Node-copyfrom-path headers, and
 svn:mergeinfo properties matching the specified Golang regular
@@ -153,16 +632,36 @@ precede a / or be at end of string.  With a leading ^ the match is
 constrained to be a leading sequence of the pathname; with a trailing
 $, a trailing one.
 
-Multiple FROM/TO pairs may be specified and are applied in order.
-This transform can be restricted by a selection set.
+Multiple FROM/TO pairs may be specified and are applied in order, all
+in a single pass over the dump.  With --file, pairs are also read from
+the file MAP, one FROM TO pair to a line, quoted as in the shell if
+need be, with # beginning a comment; they are applied before those on
+the command line, so a large layout cleanup can be kept as a list of
+rules.  This transform can be restricted by a selection set.
 
 All mergeinfo properties are updated in accordance with the path renames,
+`},
+	"pathselect": {
+		"Select revisions by the paths they touch",
+		`pathselect: usage: repocutter [-r SELECTION] [-f] pathselect PATTERN...
+
+Pass through only those revisions, within the selection, containing at
+least one node whose Node-path matches one of the patterns, with all of
+their nodes.  Unlike sift, which filters nodes, this works on whole
+revisions. Patterns are regular expressions unless -f is given, in
+which case they are literal strings. Revision 0 and the dumpfile header
+are always kept. Mergeinfo properties are updated so they no longer
+refer to omitted revisions; copies from omitted revisions are not
+patched.
 `},
 	"pop": {
 		"Pop the first segment off each path",
-		`pop: usage: repocutter pop [-f|-fixed] [PATTERN]
+		`pop: usage: repocutter [-f|-fixed|-g|-glob] pop [COUNT] [PATTERN...]
 
-Pop initial segment off each path matching PATTERN - by default, all paths.
+Pop initial segment off each path matching any PATTERN - by default, all paths.
+With a COUNT, that many initial segments are popped instead of one.  Nodes
+whose paths are popped away entirely, such as the one creating the
+directory that held everything else, are dropped.
 
 May be useful after a sift command to turn a dump from a subproject
 stripped from a dump for a multiple-project repository into the normal
@@ -183,22 +682,40 @@ off.  The default property is svn:executable; some Subversion front ends spam it
 Another property may be set with the -p option.
 `},
 	"propdel": {
-		"Deleting revision properties",
-		`propdel: usage: repocutter [-r SELECTION] propdel PROPNAME...
+		"Deleting revision and node properties",
+		`propdel: usage: repocutter [-r SELECTION] propdel [--nodes] [--path PATTERN]... PROPNAME...
 
 Delete the property PROPNAME. May be restricted by a revision
 selection. You may specify multiple properties to be deleted.
+
+The --nodes and --path options confine deletion to node properties as
+they do for propset.
+`},
+	"proplist": {
+		"List the properties used in a dump",
+		`proplist: usage: repocutter [-r SELECTION] proplist [STEP]
+
+Report every distinct revision-property and node-property name used in
+the selected revisions, each with the number of property sections it
+appears in and the first value seen (quoted, and truncated if long).
+Revision properties and node properties are listed separately.
+
+If a STEP argument is given, the count for each property is also broken
+down by blocks of STEP revisions, one line per block in which it occurs.
 `},
 	"proprename": {
-		"Renaming revision properties",
-		`proprename: usage: repocutter [-r SELECTION] proprename OLDNAME->NEWNAME...
+		"Renaming revision and node properties",
+		`proprename: usage: repocutter [-r SELECTION] proprename [--nodes] [--path PATTERN]... OLDNAME->NEWNAME...
 
 Rename the property OLDNAME to NEWNAME. May be restricted by a
 revision selection. You may specify multiple properties to be renamed.
+
+The --nodes and --path options confine renaming to node properties as
+they do for propset.
 `},
 	"propset": {
-		"Setting revision properties",
-		`propset: usage: repocutter [-r SELECTION] propset PROPNAME=PROPVAL...
+		"Setting revision and node properties",
+		`propset: usage: repocutter [-r SELECTION] propset [--nodes] [--path PATTERN]... PROPNAME=PROPVAL...
 
 Set the property PROPNAME to PROPVAL.
 
@@ -206,53 +723,188 @@ May be restricted by a revision selection. Note that specifying only a revision
 will cause the property  to be seet on the revision properties and on all nodes
 in the rtevision; you'll probably want to specify a node index.
 
+With --nodes, only node properties are set.  Each --path option confines
+the setting to nodes whose paths match PATTERN, and implies --nodes.  In
+this mode a selected node with no property section, such as a copy or a
+content change, is given one carrying the properties it would otherwise
+have inherited, amended, and the length headers are fixed up; property
+deltas are expanded first.  Properties of files beneath a copied
+directory that have no node of their own are not touched.
+
+A PROPVAL of the form @FILE is the content of FILE, newlines and all,
+so that multi-line properties such as svn:ignore and svn:externals can
+be set.  The content is taken as it is, except that for svn:ignore,
+svn:global-ignores, svn:externals, and svn:auto-props, CR-LF line endings
+become LF and a missing final newline is supplied, as Subversion itself
+does.  To set a value that really begins with @, double it: @@foo sets
+@foo.  Only the first = separates the name from the value.
+
 You may specify multiple property settings.
+`},
+	"propstrip": {
+		"Strip housekeeping properties in bulk",
+		`propstrip: usage: repocutter [-r SELECTION] propstrip [[!]GLOB...]
+
+Delete every revision and node property whose name matches one of the
+GLOB arguments, shell-style wildcards allowed.  With no GLOBs to delete,
+the housekeeping properties svn:entry:*, svn:wc:*, and cvs2svn:* are
+removed.  A GLOB prefixed with ! names properties to keep even if another
+pattern matches them; for example, '!cvs2svn:cvs-rev' keeps the CVS
+revision stamps that reposurgeon turns into legacy IDs while the rest of
+the defaults go.  Change nodes left with no properties and no content
+are dropped.  This transform can be restricted by a selection set.
 `},
 	"push": {
 		"Push a first segment onto each matching path",
 		`push: usage: repocutter push [-s segment] [-f] [PATTERN...]
 
 Push an initial segment onto each matching path. Normally used to add a
-"trunk" prefix to every path in a flat repository.  The -s option can be used
-rton set a different initial segment.
+"trunk" prefix to every path in a flat repository, making it the inverse
+of pop.  The -s option can be used to set a different initial segment.
+
+A directory-creation node for the new segment is emitted just ahead of
+the first node that is pushed, so the result loads into an empty
+repository. A root node with an empty path becomes the creation of the
+segment instead.
 
 This transform cannot be restricted by a selection set, as it is not
-possible to guarantee that copyfro paths and mergeinfo properties will
+possible to guarantee that copyfrom paths and mergeinfo properties will
 be modified consistently in the presence of that kind of restriction.
 
-Mergeinfo properties in all revisions are updated toi refer to the
+Mergeinfo properties in all revisions are updated to refer to the
 new pathnames.
 `},
 	"reduce": {
 		"Topologically reduce a dump.",
-		`reduce: usage: repocutter [-r selection] reduce
+		`reduce: usage: repocutter [-r selection] reduce [FILE]
 
 Strip revisions out of a dump so the only parts left those likely to
 be relevant to a conversion problem. This is done by dropping every
 node that consists of a change on a file and has no property settings.
 Mergeinfo properties in all revisions are updated so they no longer refer
 to dropped revisions.
+
+The reduction is done in a single pass, since mergeinfo can only refer
+to revisions already seen, so the dump may come from a pipe. It is read
+from FILE if one is given, and from standard input if FILE is - or
+absent:
+
+    svnadmin dump repo | repocutter reduce - >reduced.svn
+`},
+	"reformat": {
+		"Convert to another dump format version",
+		`reformat: usage: repocutter reformat VERSION
+
+Convert a dump to format version 1, 2 or 3, rewriting the
+SVN-fs-dump-format-version header. Going to a version below 3, which
+can't express deltas, expands text and property deltas to full text
+and full property lists as -x does. Going to version 1 also drops the
+repository UUID, which that version lacks. Going up needs no change
+beyond the header, as full-text dumps are valid in every later version.
 `},
 	"renumber": {
 		"Renumber revisions so they're contiguous",
-		`renumber: usage: repocutter renumber
+		`renumber: usage: repocutter [-r SELECTION] [-m MAPFILE] [-M MAPFILE] renumber [--keep-gaps]
 
 Renumber all revisions, patching Node-copyfrom headers as required.
-Any selection option is ignored. Takes no arguments.  The -b option
-can be used to set the base to renumber from, defaulting to 0.
+The -b option can be used to set the base to renumber from, defaulting
+to 0.
+
+With --keep-gaps, each gap in the input numbering is carried over to the
+output, so that without a revision map revisions are only shifted by a
+constant offset.  Use this with -b to stitch a dump onto an existing
+repository at a known revision.
+
+With a selection, only the selected revisions are renumbered, each one
+past the revision before it; revisions outside the selection keep their
+numbers, and it is an error if that would make the numbering go
+backwards.  Use this to close the gaps in one stretch of history
+without disturbing the revision numbers elsewhere.  A selection can't
+be combined with -b, since the revisions outside it already say where
+the numbering stands.
+
+With -m or --map-in, an explicit revision map is read from the named
+file, one whitespace-separated OLD NEW pair per line.  Each revision
+named in it gets the given new number; revisions not named are
+numbered one past the revision before them, so a single entry is
+enough to open a gap.  New numbers must increase through the stream.
+With -M or --map-out, the mapping actually applied is written to the
+named file when the run finishes, as tab-separated OLD NEW pairs; use
+it to fix up references to revision numbers held elsewhere, such as
+in issue trackers.
+`},
+	"renames": {
+		"Report probable renames",
+		`renames: usage: repocutter [-r SELECTION] renames
+
+List probable renames: deletes paired with adds or copies in the same
+revision.  Each is reported on a line of the form "rREV OLD -> NEW
+(EVIDENCE)", directories with a trailing slash.  The evidence is
+"copy" when the new path was copied from the deleted one, as
+Subversion records a rename; "content" when a file was deleted and
+another added with identical content, preferring one with the same
+basename; or "name" when a delete and an add of the same kind share a
+basename and no other pairing is possible.  Only nodes within the
+selection are paired.
 `},
 	"replace": {
 		"Regexp replace in blobs",
-		`replace: usage: repocutter replace /REGEXP/REPLACE/
+		`replace: usage: repocutter [-r SELECTION] [-f|-fixed|-g|-glob] replace [--path PATTERN]... /REGEXP/REPLACE/[FLAGS]...
 
 Perform a regular expression search/replace on blob content. The first
 character of the argument (normally /) is treated as the end delimiter
 for the regular-expression and replacement parts. This transform can be
-restricted by a selection set.
+restricted by a selection set, and to the nodes whose paths match any
+of the patterns given with --path options, which come first:
+
+    repocutter replace --path '.*\.[ch]$' /foo/bar/ <in >out
+
+Several transforms may be given; each is applied in order to the result
+of the ones before it, all in a single pass over the dump.  The closing
+delimiter may be followed by flags: i makes the match case-insensitive,
+m makes ^ and $ match at the beginnings and ends of lines, and s lets .
+match a newline.  A REPLACE of the form @FILE is the content of FILE,
+taken literally rather than expanding $ references, so that a whole
+block of text such as a corrected license header can be swapped in,
+here with | as the delimiter since the pattern contains slashes:
+
+    repocutter replace '|/\* Copyright.*?\*/\n|@newheader.txt|s' <in >out
+`},
+	"script": {
+		"Run several transformations in one pass",
+		`script: usage: repocutter [-r SELECTION] [-f] [-b BASE] [-E TEXT] script [FILE|@NAME]
+
+Run a sequence of transformations over the dump in a single pass,
+saving the cost of parsing it again for each, as a pipeline of
+repocutter invocations would.  The commands are read from FILE, or
+given as TEXT with -E (or --expression), and are separated by newlines
+or semicolons, as in
+
+    repocutter -E 'propdel svn:keywords; pathrename ^old new; renumber' script
+
+A FILE of the form @NAME runs the pipeline of that name from the
+configuration file.  Each command is a subcommand name and its
+arguments, quoted as in the shell if need be; a # begins a comment.
+A command may start with its own -r selection, -f, or -b base; those
+given on the command line apply to commands that have none.  The subcommands that can be used
+are select, deselect, expunge, sift, pathrename, propdel, propset,
+proprename, replace, strip, and renumber.
+
+A command of the form 'define NAME SELECTION' names a selection, so
+that a later command can use -r @NAME; a SELECTION may itself refer
+to names defined before it, or to a file as @FILE, as in
+
+    define kept @closure-revisions.txt
+    define early 0:100
+    -r @early,@kept strip
+
+Each node passes through the commands in order, each seeing what the
+ones before it left, just as in a pipeline; a renumber after a command
+that drops whole revisions numbers only the revisions that are left.
 `},
 	"see": {
 		"Report only essential topological information",
-		`see: usage: repocutter [-r SELECTION] see
+		`see: usage: repocutter [-r SELECTION] [-T json [-c]] see
 
 Render a very condensed report on the repository node structure, mainly
 useful for examining strange and pathological repositories.  File content
@@ -262,6 +914,15 @@ Directory paths are distinguished by a trailing slash.  The 'copy'
 operation is really an 'add' with a directory source and target;
 the display name is changed to make them easier to see. This report
 can be restricted by a selection set.
+
+With -T json (or --format=json), the report is instead one JSON object
+per line for each node, with the fields revision, index, action (add,
+change, delete, or replace), kind (file or dir), path, copyfrom (an
+object with path and revision, or null), and propchange and textchange,
+which tell whether the node carries a property section or text content.
+Revision properties are not reported in this form.  With -c (or
+--copy-chain), each copy also gets a copychain field listing, nearest
+first, the copies its source came from, each as a path and revision.
 `},
 	"select": {
 		"Selecting revisions",
@@ -274,19 +935,36 @@ updated so they no longer refer to omitted revisions.
 `},
 	"setcopyfrom": {
 		"Set the copyfrom path.",
-		`setcopyfrom: usage: repocutter {-r SELECTION} setcopyfrom PATH
-
-In the specified revisions, replace the Node-copyfrom-path with the specified PATH.
-Does not alter mergeinfo properties as a side effect.  Terminates with error if any
-selected node is not a copy.
+		`setcopyfrom: usage: repocutter [-f] {-r SELECTION} setcopyfrom PATH[@REV] [PATTERN...]
+
+In the specified revisions, replace the Node-copyfrom-path with the
+specified PATH.  If @REV is appended, the Node-copyfrom-rev is set to
+REV as well; giving only @REV changes the revision and leaves the path
+alone.  REV must be earlier than the revision of each altered node.
+Any Text-copy-source checksums on an altered node are removed, as they
+described the old copy source.
+
+If path patterns follow, only copy nodes whose Node-path matches one
+of them are altered; other nodes pass through unchanged. Without
+patterns, terminates with error if any selected node is not a copy.
+Patterns are regular expressions unless -f is given, in which case
+they are literal strings. Does not alter mergeinfo properties as a
+side effect.
 `},
 	"setlog": {
 		"Mutating log entries",
-		`setlog: usage: repocutter [-r SELECTION] -logentries=LOGFILE setlog
+		`setlog: usage: repocutter [-r SELECTION] {-logentries=LOGFILE|-message-dir=DIR} setlog
 
 Replace the log entries in the input dumpfile with the corresponding entries
 in the LOGFILE, which should be in the format of an svn log output.
 Replacements may be restricted to a specified range.
+
+Alternatively, with -L or --message-dir, the replacements are taken
+from a directory holding one file per revision, named by the revision
+number with an optional extension (for example 1234 or 1234.txt).  The
+whole content of each file becomes the svn:log of its revision; files
+with other names are ignored.  No author check is made, and there is no
+delimiter line to clash with message text.
 `},
 	"setpath": {
 		"Set the node path.",
@@ -297,7 +975,7 @@ Does not alter mergeinfo properties as a side effect.
 `},
 	"sift": {
 		"Sift for operations by Node-path header",
-		`sift: usage: repocutter [-r SELECTION] [-f|-fixed] sift PATTERN...
+		`sift: usage: repocutter [-r SELECTION] [-f|-fixed|-g|-glob] [-k KIND] [-a ACTION] sift [PATTERN...]
 
 Delete all operations with either Node-path or Node-copyfrom-path headers *not*
 matching specified Golang regular expressions (opposite of 'expunge').
@@ -305,7 +983,23 @@ Any revision left with no Node records after this filtering has its Revision rec
 removed as well. Mergeinfo properties in all revisions are updated so they no longer refer
 to dropped revisions.
 
+The -k (or --kind) and -a (or --action) options work as for expunge:
+nodes within the selection whose kind or action is not listed are
+deleted as well, and the PATTERN arguments become optional.
+
 This transform can be restricted by a selection set.
+`},
+	"sizes": {
+		"Report the largest blobs and revisions",
+		`sizes: usage: repocutter [-r SELECTION] sizes [COUNT]
+
+List the COUNT (default 10) largest blobs in the selection, biggest
+first, each with its size in bytes, revision, path, and the path's last
+svn:mime-type setting (- if none), then the COUNT revisions carrying
+the most content bytes, with their node counts.  Useful for finding the
+accidentally committed disk images and tarballs that stall conversions.
+Sizes are as stored in the dump, so for delta nodes they are the sizes
+of the deltas.
 `},
 	"skipcopy": {
 		"Skip an intermediate copy chain between specified revisions",
@@ -315,10 +1009,74 @@ Replace the source revision and path of a copy at the upper end of the selection
 with the source revisions and path of a copy at the lower end. Fails unless both
 revisions are copies.  Used to remove an unwanted intermediate copy or
 copies.
+`},
+	"split": {
+		"Split a multiproject dump into per-project dumps",
+		`split: usage: repocutter [-b BASE] [-o TEMPLATE] split PREFIX...
+
+Partition a dump into one output dump per top-level path prefix, in a
+single pass over the input.  Each node goes to the output whose PREFIX
+is a leading segment sequence of its Node-path; nodes matching no prefix
+are dropped.  Each output file is named by substituting the prefix (with
+any / changed to -) for %s in the -o template, which defaults to %s.svn.
+
+Revision 0 and the dump preamble are copied to every output.  Any other
+revision with no nodes for a project is omitted from that project's
+output, and the revisions in each output are renumbered from the -b base
+(default 0), patching Node-copyfrom-rev headers as 'renumber' does.
+Mergeinfo entries are renumbered likewise, and entries naming paths in
+other projects are dropped.  A copy whose source lies outside the
+node's own project cannot be represented in a split dump and is a fatal
+error.  Any selection option is rejected.
+`},
+	"squash": {
+		"Merge a range of revisions into one",
+		`squash: usage: repocutter -r SELECTION squash
+
+Merge the revisions in a single selected range into one revision, which
+takes the number of the first of them.  The node lists are combined, with
+later operations on a path overriding earlier ones: an add followed by a
+delete vanishes, a delete followed by an add becomes a replace, and a
+change folds into the add or change before it.  Log messages are joined
+in order with blank lines between them; the other revision properties,
+including author and date, are taken from the last revision in the range.
+
+Revisions after the range are renumbered to close the gap, and
+Node-copyfrom-rev headers and mergeinfo properties are patched to match.
+A copy inside the range whose source was changed earlier in the range
+cannot be expressed and is an error.  Delta dumps must be expanded first.
+`},
+	"stats": {
+		"Report summary statistics",
+		`stats: usage: repocutter [-r SELECTION] stats
+
+Report summary statistics on a dump in a single pass: the number of
+revisions (not counting revision 0), the number of distinct authors, the
+earliest and latest commit dates, node counts broken down by kind and
+action, the number of copies, the total bytes of text content, and the
+bytes of revision and node properties. Only revisions and nodes within
+the selection are counted, so this can be used to profile sections of a
+large dump before surgery.
+`},
+	"stitch": {
+		"Append incremental dumps to a base dump",
+		`stitch: usage: repocutter stitch BASE INCREMENT...
+
+Emit the BASE dump followed by each INCREMENT in turn as one stream.
+An increment is a dump made with svnadmin dump --incremental, whose
+first revision assumes the state left by the previous file. The stream
+header, UUID and any revision 0 of each increment are dropped, and
+revisions within each file must be contiguous.
+
+An increment should begin with the revision after the last one before
+it. If it doesn't (as when it has been renumbered) it is renumbered to
+follow on, with a warning, and its Node-copyfrom-rev headers and
+mergeinfo ranges are patched to match; references to revisions before
+its start can't be corrected and draw a warning.
 `},
 	"strip": {
 		"Replace content with unique cookies, preserving structure",
-		`strip: usage: repocutter [-r SELECTION] strip [-f|-fixed] [PATTERN...]
+		`strip: usage: repocutter [-r SELECTION] [-f|-fixed|-g|-glob] strip [--digest] [PATTERN...]
 
 Replace content with unique generated cookies on all node paths matching
 the specified regular expressions; if no expressions are given, match all
@@ -326,10 +1084,36 @@ paths.
 
 This command is useful for reducing the bulk of a stream without touching
 its metadata, so you can doio test conversions more quickly.
+
+Normally a cookie names the revision and path of its node.  With --digest
+it is instead the first 16 hex digits of the SHA-1 hash of the original
+content and a newline, so every cookie has the same length, identical
+content gets identical cookies wherever it appears, and stripped dumps
+made from two versions of a pipeline can be compared with diff to see
+where their content diverges.
+`},
+	"structure": {
+		"Propose a branch and tag layout",
+		`structure: usage: repocutter [-r SELECTION] structure
+
+Analyze directory creations and copies and report the branch structure
+they imply.  First come layout lines: "layout standard" for top-level
+trunk, branches, and tags; "layout project P" for each directory P
+holding a trunk, branches, or tags of its own, which can be carved out
+with 'repocutter sift P'; "layout swapped P" for each project P found
+in the layout-first form, as trunk/P copied from another trunk or
+branches/P/NAME, which 'repocutter swap' straightens out; or
+"layout none".
+
+Then each detected trunk, branch, and tag is listed with its kind, path,
+creation revision, copy source if any, and the revision it was deleted
+in if it was.  Directory copies fitting none of these are listed with
+kind "copy" as a sign of unusual nesting; copies made inside a branch
+are ordinary content and are not listed.
 `},
 	"swap": {
 		"Swap first two components of pathnames",
-		`swap: usage: repocutter [-r SELECTION] swap [-f|-fixed] [PATTERN]
+		`swap: usage: repocutter [-r SELECTION] swap [-f|-fixed|-g|-glob] [PATTERN]
 
 Swap the top two elements of each pathname in every revision in the
 selection set. Useful following a sift operation for straightening out
@@ -339,7 +1123,7 @@ only paths matching it are swapped.
 `},
 	"swapsvn": {
 		"Subversion structure-aware swap",
-		`swapsvn: usage: repocutter [-r SELECTION] swapsvn [-f|-fixed] [PATTERN]
+		`swapsvn: usage: repocutter [-r SELECTION] swapsvn [-f|-fixed|-g|-glob] [PATTERN]
 
 Like swap, but is aware of Subversion structure.  Used for transforming
 multiproject repositories into a standard layout with trunk, tags, and
@@ -350,7 +1134,7 @@ or "tags", or the path consists of a single segment that is a top-level
 project directory; passes through all paths for this is not so unaltered.
 
 Top-level project directories with properties or comments make this command
-die (return status 1) with an error message on stderr; otherwise these
+die (return status 5) with an error message on stderr; otherwise these
 directories are silently discarded.
 
 Otherwise, swaps "trunk" and the top-level (project) directory
@@ -384,9 +1168,10 @@ Parallel rename sequences are also coalesced.
 
 If a PATTERN argument is given, only paths matching the pattern are swapped.
 
-Note that the result of swapping does not have initial trunk/branches/tags
-directory creations and can thus not be fed directly to svnload. reposurgeon
-copes with this, but Subversion will not.
+The top-level trunk, branches, and tags directories, and the directory
+of each branch and tag, are created by synthesized add nodes in the
+revision where a swapped path first needs them, so the result can be
+fed directly to svnload.
 
 Merfeinfo propertied are updated to use the swapped path names.
 
@@ -394,13 +1179,19 @@ This transform can be restricted by a selection set.
 `},
 	"testify": {
 		"Massage a stream file into a neutralized test load",
-		`testify: usage: repocutter [-r SELECTION] testify
+		`testify: usage: repocutter testify [--preserve-deltas] [--start DATE]
 
 Replace commit timestamps with a monotonically increasing clock tick
 starting at the Unix epoch and advancing by 10 seconds per commit.
 Replace all attributions with 'fred'.  Discard the repository UUID.
 Use this to neutralize procedurally-generated streams so they can be
-compared. This transform can be restricted by a selection set.
+compared.
+
+With --preserve-deltas, each timestamp instead keeps its original
+distance from the first one, so test cases that depend on how commits
+cluster in time still exercise the same behavior.  With --start, the
+clock starts at DATE, a day such as 2014-01-01 or an RFC3339 timestamp,
+rather than at the epoch.
 `},
 	"version": {
 		"Report repocutter's version",
@@ -413,38 +1204,75 @@ Report major and minor repocutter version.
 var narrativeOrder []string = []string{
 	"select",
 	"deselect",
+	"pathselect",
 	"see",
+	"stats",
+	"authors",
+	"dedup",
+	"sizes",
+	"structure",
+	"attribution",
+	"lint",
+	"diff",
 	"renumber",
+	"renames",
+	"emptydrop",
+	"join",
+	"inject",
+	"stitch",
+	"dateshift",
 
 	"log",
 	"setlog",
+	"grep",
 
+	"mergeinfo",
+	"proplist",
 	"propdel",
 	"proprename",
 	"propset",
 	"propclean",
+	"propstrip",
+	"execfix",
+	"linkfix",
 
+	"nodedelete",
 	"expunge",
+	"externals",
 	"sift",
 	"closure",
+	"split",
+	"squash",
+	"coalesce",
+	"atomize",
 
 	"pathlist",
+	"ls",
+	"lastchange",
 	"pathrename",
+	"debranch",
 	"setpath",
 	"setcopyfrom",
 	"pop",
 	"push",
 	"filecopy",
+	"flatten",
 	"skipcopy",
 
 	"swap",
 	"swapsvn",
 
 	"replace",
+	"checksum",
+	"reformat",
+	"eol",
+	"dekeyword",
 	"strip",
 	"obscure",
 	"reduce",
 	"testify",
+	"export-git",
+	"script",
 
 	"version",
 }
@@ -452,7 +1280,7 @@ var narrativeOrder []string = []string{
 func dumpDocs() {
 	if len(narrativeOrder) != len(helpdict) {
 		os.Stderr.WriteString("repocutter: documentation sanity check failed.\n")
-		os.Exit(1)
+		os.Exit(errGeneral.status)
 	}
 	re := regexp.MustCompile("([a-z][a-z]*):[^\n]*\n")
 	for _, item := range narrativeOrder {
@@ -468,10 +1296,16 @@ var tag string
 
 // Baton - ship progress indications to stderr
 type Baton struct {
-	stream *os.File
-	count  int
-	endmsg string
-	time   time.Time
+	done     int64 // input bytes read so far; first for atomic alignment
+	stream   *os.File
+	count    int
+	endmsg   string
+	time     time.Time
+	total    int64 // size of the input, when it is a file
+	revision int
+	line     string // what is on display before the progress message
+	shown    int    // length of the progress message on display
+	last     time.Time
 }
 
 // NewBaton - create a new Baton object with specified start and end messages
@@ -481,14 +1315,71 @@ func NewBaton(prompt string, endmsg string) *Baton {
 		endmsg: endmsg,
 		time:   time.Now(),
 	}
-	baton.stream.WriteString(prompt + "...")
-	if term.IsTerminal(int(baton.stream.Fd())) {
+	baton.line = prompt + "..."
+	baton.stream.WriteString(baton.line)
+	if term.IsTerminal(int(baton.stream.Fd())) && !lineRedraw {
 		baton.stream.WriteString(" \b")
 	}
 	//baton.stream.Flush()
 	return &baton
 }
 
+// meteredReader counts the bytes read through it for a baton.
+type meteredReader struct {
+	io.Reader
+	baton *Baton
+}
+
+func (mr meteredReader) Read(p []byte) (int, error) {
+	n, err := mr.Reader.Read(p)
+	atomic.AddInt64(&mr.baton.done, int64(n))
+	return n, err
+}
+
+// meter - if the input is a file of known size, have the baton count
+// its way through it so progress can be shown as a fraction of the
+// whole rather than with a spinner.
+func (baton *Baton) meter(fp *os.File) io.Reader {
+	if baton == nil {
+		return fp
+	}
+	st, err := fp.Stat()
+	if err != nil || !st.Mode().IsRegular() || st.Size() == 0 {
+		return fp
+	}
+	baton.total = st.Size()
+	return meteredReader{fp, baton}
+}
+
+// humanBytes - a byte count in the largest unit that keeps it above 1
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// progress - how far through the input a metered baton is, and a
+// guess at how long the rest will take given the time so far
+func (baton *Baton) progress(done int64, elapsed time.Duration) string {
+	msg := fmt.Sprintf("%.1f%% %s/%s", 100*float64(done)/float64(baton.total),
+		humanBytes(done), humanBytes(baton.total))
+	if baton.revision > 0 {
+		msg += fmt.Sprintf(" r%d", baton.revision)
+	}
+	if done > 0 && done < baton.total {
+		eta := time.Duration(float64(elapsed) * float64(baton.total-done) / float64(done))
+		msg += " ETA " + eta.Round(time.Second).String()
+	}
+	return msg
+}
+
 // Twirl - twirl the baton indicating progress
 func (baton *Baton) Twirl(ch string) {
 	if baton.stream == nil {
@@ -497,9 +1388,17 @@ func (baton *Baton) Twirl(ch string) {
 	if term.IsTerminal(int(baton.stream.Fd())) {
 		if ch != "" {
 			baton.stream.WriteString(ch)
+			baton.line += ch
+		} else if baton.total > 0 {
+			// Redrawing on every revision would cost more than the
+			// work on small ones, so only a few times a second.
+			if time.Since(baton.last) >= 200*time.Millisecond {
+				baton.last = time.Now()
+				msg := baton.progress(atomic.LoadInt64(&baton.done), time.Since(baton.time))
+				baton.redraw(msg)
+			}
 		} else {
-			baton.stream.Write([]byte{"-/|\\"[baton.count%4]})
-			baton.stream.WriteString("\b")
+			baton.redraw(string("-/|\\"[baton.count%4]))
 		}
 	}
 	baton.count++
@@ -510,15 +1409,12 @@ func (baton *Baton) End(msg string) {
 	if msg == "" {
 		msg = baton.endmsg
 	}
+	if baton.shown > 0 {
+		baton.redraw("")
+	}
 	fmt.Fprintf(baton.stream, "...(%s) %s.\n", time.Since(baton.time), msg)
 }
 
-func croak(msg string, args ...interface{}) {
-	legend := "repocutter" + tag + ": croaking, " + msg + "\n"
-	fmt.Fprintf(os.Stderr, legend, args...)
-	os.Exit(1)
-}
-
 func announce(msg string, args ...interface{}) {
 	if !quiet {
 		content := fmt.Sprintf(msg, args...)
@@ -533,6 +1429,8 @@ type LineBufferedSource struct {
 	reader     *bufio.Reader
 	stream     *os.File
 	linenumber int
+	offset     int // bytes consumed from the reader
+	revision   int // of the last Revision-number line read
 }
 
 // NewLineBufferedSource - create a new source
@@ -559,6 +1457,7 @@ func (lbs *LineBufferedSource) Rewind() {
 			fmt.Fprintf(os.Stderr, "<Rewind>\n")
 		}
 		lbs.stream.Seek(0, 0)
+		lbs.offset = 0
 	}
 }
 
@@ -574,6 +1473,9 @@ func (lbs *LineBufferedSource) Readline() (line []byte) {
 	}
 	line, err := lbs.reader.ReadBytes('\n')
 	lbs.linenumber++
+	lbs.offset += len(line)
+	lbs.noteRevision(line)
+	inputPosition = lbs
 	if debug >= debugPARSE {
 		fmt.Fprintf(os.Stderr, "<Readline %d: read %q>\n", lbs.linenumber, line)
 	}
@@ -581,7 +1483,7 @@ func (lbs *LineBufferedSource) Readline() (line []byte) {
 		return []byte{}
 	}
 	if err != nil {
-		croak("I/O error in Readline of LineBufferedSource")
+		croakIO("I/O error in Readline of LineBufferedSource: %v", err)
 	}
 	return
 }
@@ -596,16 +1498,19 @@ func (lbs *LineBufferedSource) Read(rlen int) []byte {
 	for {
 		n, err := lbs.reader.Read(chunk)
 		if err != nil && err != io.EOF {
-			croak("I/O error in Read of LineBufferedSource")
+			croakIO("I/O error in Read of LineBufferedSource: %v", err)
 		}
 		text = append(text, chunk[0:n]...)
-		if n == rlen {
+		lbs.offset += n
+		// Return short on a truncated source rather than spinning.
+		if n == rlen || err == io.EOF {
 			break
 		}
 		rlen -= n
 		chunk = chunk[:rlen]
 	}
 	lbs.linenumber += strings.Count(string(text), linesep)
+	inputPosition = lbs
 	return text
 }
 
@@ -614,8 +1519,11 @@ func (lbs *LineBufferedSource) Peek() []byte {
 	//assert(lbs.Linebuffer is None)
 	nxtline, err := lbs.reader.ReadBytes('\n')
 	lbs.linenumber++
+	lbs.offset += len(nxtline)
+	lbs.noteRevision(nxtline)
+	inputPosition = lbs
 	if err != nil && err != io.EOF {
-		croak("I/O error in Peek of LineBufferedSource: %s", err)
+		croakIO("I/O error in Peek of LineBufferedSource: %s", err)
 	}
 	if debug >= debugPARSE {
 		fmt.Fprintf(os.Stderr, "<Peek %d: buffer=%q + next=%q>\n",
@@ -625,6 +1533,13 @@ func (lbs *LineBufferedSource) Peek() []byte {
 	return lbs.Linebuffer
 }
 
+// noteRevision - keep track of the revision being read, for diagnostics
+func (lbs *LineBufferedSource) noteRevision(line []byte) {
+	if bytes.HasPrefix(line, []byte("Revision-number: ")) {
+		lbs.revision, _ = strconv.Atoi(string(bytes.TrimSpace(line[17:])))
+	}
+}
+
 // Flush - get the contents of the line buffer, clearing it.
 func (lbs *LineBufferedSource) Flush() []byte {
 	//assert(lbs.Linebuffer is not None)
@@ -642,6 +1557,11 @@ func (lbs *LineBufferedSource) Push(line []byte) {
 	lbs.Linebuffer = line
 }
 
+// Tell - byte offset of the next unread data, counting any pushed-back line as unread
+func (lbs *LineBufferedSource) Tell() int {
+	return lbs.offset - len(lbs.Linebuffer)
+}
+
 // HasLineBuffered - do we have one ready to go?
 func (lbs *LineBufferedSource) HasLineBuffered() bool {
 	return len(lbs.Linebuffer) != 0
@@ -651,14 +1571,119 @@ func (lbs *LineBufferedSource) HasLineBuffered() bool {
 
 // SubversionEndpoint - represent as Subversion revision or revision.node spec
 type SubversionEndpoint struct {
-	rev  int
-	node int
+	rev    int
+	node   int // 0 for all nodes, negative to count back from the last
+	anchor int // what rev counts from
+}
+
+// Revision anchors.  A revision relative to the first or last revision
+// of the input can't be known until the input has been scanned.
+const (
+	anchorZero = iota
+	anchorBase // first revision in the input
+	anchorLast // last revision in the input
+)
+
+// resolve - the endpoint with any revision relative to the input's
+// first or last, and any negative node index, replaced by the revision
+// and node they stand for.  A negative index reaching back past the
+// first node stands for the first node.
+func (s SubversionEndpoint) resolve() SubversionEndpoint {
+	if shape == nil {
+		return s
+	}
+	switch s.anchor {
+	case anchorBase:
+		s.rev += shape.first
+	case anchorLast:
+		s.rev += shape.last
+	}
+	s.anchor = anchorZero
+	if s.node < 0 {
+		s.node += shape.nodes[s.rev] + 1
+		if s.node < 1 {
+			s.node = 1
+		}
+	}
+	return s
+}
+
+// parseRevision - parse a revision expression, a number or one of HEAD,
+// LAST and BASE followed by any number of +N and -N offsets, into an
+// offset and what it counts from.
+func (e *SubversionEndpoint) parseRevision(txt string, upper bool) {
+	end := strings.IndexAny(txt, "+-")
+	if end == -1 {
+		end = len(txt)
+	}
+	term, offsets := txt[:end], txt[end:]
+	switch term {
+	case "HEAD", "LAST":
+		if term == "HEAD" && offsets == "" {
+			if !upper {
+				croakUsage("can't accept HEAD as lower bound of a range; use LAST.")
+			}
+			// Be on safe side - could be a 32-bit machine
+			e.rev = math.MaxInt32
+			return
+		}
+		e.anchor = anchorLast
+	case "BASE":
+		e.anchor = anchorBase
+	default:
+		if strings.Contains(offsets, "-") {
+			croakUsage("use ':' for version ranges instead of '-'")
+		}
+		var err error
+		if e.rev, err = strconv.Atoi(term); err != nil || e.rev < 0 {
+			croakUsage("ill-formed revision expression %q", txt)
+		}
+	}
+	for offsets != "" {
+		sign := 1
+		if offsets[0] == '-' {
+			sign = -1
+		}
+		offsets = offsets[1:]
+		end := strings.IndexAny(offsets, "+-")
+		if end == -1 {
+			end = len(offsets)
+		}
+		n, err := strconv.Atoi(offsets[:end])
+		if err != nil || n < 0 {
+			croakUsage("ill-formed revision expression %q", txt)
+		}
+		e.rev += sign * n
+		offsets = offsets[end:]
+	}
+}
+
+// parseEndpoint - parse REV or REV.NODE, where REV is a revision
+// expression and NODE may be negative, LAST, or * for all nodes.
+func parseEndpoint(txt string, upper bool) SubversionEndpoint {
+	var e SubversionEndpoint
+	fields := strings.SplitN(txt, ".", 2)
+	e.parseRevision(fields[0], upper)
+	if len(fields) > 1 {
+		switch fields[1] {
+		case "*":
+			e.node = 0
+		case "LAST":
+			e.node = -1
+		default:
+			var err error
+			if e.node, err = strconv.Atoi(fields[1]); err != nil {
+				croakUsage("ill-formed node index %q", txt)
+			}
+		}
+	}
+	return e
 }
 
 // Equals - are the components of two endoints equal?
 func (s SubversionEndpoint) Equals(t SubversionEndpoint) bool {
 	if s.node == 0 || t.node == 0 {
-		croak("comparing %v=%v a full node specification with node index is required", t, s)
+		croakUsage("comparing %v=%v a full node specification with node index is required", t, s)
 	}
 	return s.rev == t.rev && s.node == t.node
 }
@@ -666,6 +1691,15 @@ func (s SubversionEndpoint) Equals(t SubversionEndpoint) bool {
 // Stringer is the textualization method for interval endpoints
 func (s SubversionEndpoint) Stringer() string {
 	out := fmt.Sprintf("%d", s.rev)
+	if s.anchor != anchorZero {
+		out = "BASE"
+		if s.anchor == anchorLast {
+			out = "LAST"
+		}
+		if s.rev != 0 {
+			out += fmt.Sprintf("%+d", s.rev)
+		}
+	}
 	if s.node != 0 {
 		out += fmt.Sprintf(".%d", s.node)
 	}
@@ -675,6 +1709,97 @@ func (s SubversionEndpoint) Stringer() string {
 // SubversionRange - represent a polyrange of Subversion commit numbers
 type SubversionRange struct {
 	intervals [][2]SubversionEndpoint
+	dates     *DateWindow
+	author    *regexp.Regexp
+}
+
+// DateWindow - further restrict a range to revisions with svn:date in
+// an interval.  Dates can't be known before the stream is read, so they
+// are evaluated lazily against revisionDates as each revision goes by.
+type DateWindow struct {
+	lower time.Time
+	upper time.Time
+}
+
+// Dates of the revisions seen so far; nil unless a DateWindow is in use.
+var revisionDates map[int]time.Time
+
+// NewDateWindow - parse a window of the form DATE:DATE, either end optional
+func NewDateWindow(txt string) *DateWindow {
+	parse := func(txt string, end bool) (time.Time, bool) {
+		if txt == "" {
+			if end {
+				return time.Unix(1<<62, 0), true
+			}
+			return time.Time{}, true
+		}
+		if date, err := time.Parse(time.RFC3339Nano, txt); err == nil {
+			return date, true
+		}
+		date, err := time.Parse("2006-01-02", txt)
+		if err != nil {
+			return date, false
+		}
+		// A bare day as the upper end includes all of that day.
+		if end {
+			date = date.Add(24*time.Hour - time.Nanosecond)
+		}
+		return date, true
+	}
+	// Timestamps have colons of their own, so try each one as the
+	// separator until both sides make sense.
+	for i, c := range txt {
+		if c != ':' {
+			continue
+		}
+		lower, lok := parse(txt[:i], false)
+		upper, uok := parse(txt[i+1:], true)
+		if lok && uok {
+			if revisionDates == nil {
+				revisionDates = make(map[int]time.Time)
+			}
+			return &DateWindow{lower, upper}
+		}
+	}
+	croakUsage("ill-formed date window %q, expected DATE:DATE", txt)
+	return nil
+}
+
+// Contains - was a revision made within the window?  A revision whose
+// date is unknown (not yet read, or missing) is outside it.
+func (w *DateWindow) Contains(rev int) bool {
+	date, ok := revisionDates[rev]
+	return ok && !date.Before(w.lower) && !date.After(w.upper)
+}
+
+// Authors of the revisions seen so far; nil unless an author filter is in use.
+var revisionAuthors map[int]string
+
+// noteRevision - record the date and author of a revision for
+// DateWindow and author filter checks
+func noteRevision(rev int, props *Properties) {
+	if revisionDates != nil {
+		if rdate, ok := props.properties["svn:date"]; ok {
+			if date, err := time.Parse(time.RFC3339Nano, rdate); err == nil {
+				revisionDates[rev] = date
+			}
+		}
+	}
+	if revisionAuthors != nil {
+		revisionAuthors[rev] = props.properties["svn:author"]
+	}
+}
+
+// filtered - is a revision excluded by the date window or author filter?
+func (s *SubversionRange) filtered(rev int) bool {
+	if s.dates != nil && !s.dates.Contains(rev) {
+		return true
+	}
+	if s.author != nil {
+		author, ok := revisionAuthors[rev]
+		return !ok || !s.author.MatchString(author)
+	}
+	return false
 }
 
 // NewSubversionRange - create a new polyrange object
@@ -687,52 +1812,51 @@ func NewSubversionRange(txt string) SubversionRange {
 	}
 	for _, item := range strings.Split(txt, ",") {
 		var parts [2]SubversionEndpoint
-		if strings.Contains(item, "-") {
-			croak("use ':' for version ranges instead of '-'")
-		}
-
 		if strings.Contains(item, ":") {
 			fields := strings.Split(item, ":")
-			if fields[0] == "HEAD" {
-				croak("can't accept HEAD as lower bound of a range.")
-			}
-			subfields := strings.Split(fields[0], ".")
-			parts[0].rev, _ = strconv.Atoi(subfields[0])
-			if len(subfields) > 1 {
-				parts[0].node, _ = strconv.Atoi(subfields[1])
-			}
-			if fields[1] == "HEAD" {
-				// Be on safe side - could be a 32-bit machine
-				parts[1].rev = math.MaxInt32
-			} else {
-				subfields = strings.Split(fields[1], ".")
-				parts[1].rev, _ = strconv.Atoi(subfields[0])
-				if len(subfields) > 1 {
-					parts[1].node, _ = strconv.Atoi(subfields[1])
-				}
+			if len(fields) != 2 {
+				croakUsage("ill-formed range specification %q", item)
 			}
+			parts[0] = parseEndpoint(fields[0], false)
+			parts[1] = parseEndpoint(fields[1], true)
 		} else {
-			fields := strings.Split(item, ".")
-			parts[0].rev, _ = strconv.Atoi(fields[0])
-			parts[1].rev, _ = strconv.Atoi(fields[0])
-			if len(fields) > 1 {
-				parts[0].node, _ = strconv.Atoi(fields[1])
-				parts[1].node, _ = strconv.Atoi(fields[1])
-			}
+			parts[0] = parseEndpoint(item, false)
+			parts[1] = parts[0]
 		}
-		if parts[0].rev >= upperbound {
+		// A revision relative to the input's first or last can't
+		// be checked for order until the input has been scanned.
+		if parts[0].anchor == anchorZero {
+			if parts[0].rev < upperbound {
+				croakUsage("ill-formed range specification")
+			}
 			upperbound = parts[0].rev
-		} else {
-			croak("ill-formed range specification")
 		}
 		s.intervals = append(s.intervals, parts)
 	}
 	return s
 }
 
+// whole - does the range select every revision, as the default one does?
+func (s *SubversionRange) whole() bool {
+	if s.dates != nil || s.author != nil || len(s.intervals) != 1 {
+		return false
+	}
+	lower, upper := s.intervals[0][0], s.intervals[0][1]
+	return lower == SubversionEndpoint{} && upper == SubversionEndpoint{rev: math.MaxInt32}
+}
+
+// interval - the ith interval with its endpoints resolved
+func (s *SubversionRange) interval(i int) [2]SubversionEndpoint {
+	return [2]SubversionEndpoint{s.intervals[i][0].resolve(), s.intervals[i][1].resolve()}
+}
+
 // ContainsRevision - does this range contain a specified revision?
 func (s *SubversionRange) ContainsRevision(rev int) bool {
-	for _, interval := range s.intervals {
+	if s.filtered(rev) {
+		return false
+	}
+	for i := range s.intervals {
+		interval := s.interval(i)
 		if rev >= interval[0].rev && rev <= interval[1].rev {
 			return true
 		}
@@ -742,8 +1866,11 @@ func (s *SubversionRange) ContainsRevision(rev int) bool {
 
 // ContainsNode - does this range contain a specified revision and node?
 func (s *SubversionRange) ContainsNode(rev int, node int) bool {
-	var interval [2]SubversionEndpoint
-	for _, interval = range s.intervals {
+	if s.filtered(rev) {
+		return false
+	}
+	for i := range s.intervals {
+		interval := s.interval(i)
 		if rev >= interval[0].rev && rev <= interval[1].rev {
 			if rev == interval[0].rev && node < interval[0].node {
 				continue
@@ -762,12 +1889,12 @@ func (s *SubversionRange) ContainsNode(rev int, node int) bool {
 
 // Lowerbound - what is the lowest revision in the spec?
 func (s *SubversionRange) Lowerbound() SubversionEndpoint {
-	return s.intervals[0][0]
+	return s.intervals[0][0].resolve()
 }
 
 // Upperbound - what is the uppermost revision in the spec?
 func (s *SubversionRange) Upperbound() SubversionEndpoint {
-	return s.intervals[len(s.intervals)-1][1]
+	return s.intervals[len(s.intervals)-1][1].resolve()
 }
 
 // dump exists because there are two different textualizations,
@@ -848,6 +1975,9 @@ func NewProperties(source *DumpfileSource) Properties {
 		props.propkeys = append(props.propkeys, key)
 	}
 	source.Lbs.Flush()
+	if source.Index == 0 {
+		noteRevision(source.Revision, &props)
+	}
 	return props
 }
 
@@ -927,7 +2057,7 @@ func (props *Properties) MutateMergeinfo(mutator func(string, string) (string, s
 						lastidx := strings.LastIndex(line, ":")
 						path, revrange := line[:lastidx], line[lastidx+1:]
 						rooted := false
-						if path[0] == os.PathSeparator {
+						if path[0] == pathsep {
 							rooted = true
 							path = path[1:]
 						}
@@ -936,7 +2066,7 @@ func (props *Properties) MutateMergeinfo(mutator func(string, string) (string, s
 							continue
 						}
 						if rooted {
-							buffer.WriteByte(byte(os.PathSeparator))
+							buffer.WriteByte(byte(pathsep))
 						}
 						buffer.WriteString(newpath)
 						buffer.WriteString(":")
@@ -1028,6 +2158,26 @@ func (s *MergeinfoRange) Optimize() {
 	}
 }
 
+// Canonicalize sorts a range and merges overlapping intervals,
+// which Optimize leaves alone.
+func (s *MergeinfoRange) Canonicalize() {
+	sort.SliceStable(s.intervals, func(i, j int) bool {
+		return s.intervals[i].Lower < s.intervals[j].Lower
+	})
+	merged := s.intervals[:0]
+	for _, interval := range s.intervals {
+		if n := len(merged); n > 0 && merged[n-1].NonInheritable == interval.NonInheritable &&
+			interval.Lower <= merged[n-1].Upper+1 {
+			if interval.Upper > merged[n-1].Upper {
+				merged[n-1].Upper = interval.Upper
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	s.intervals = merged
+}
+
 // Stringer is a serializer as usual.
 func (interval MergeinfoInterval) Stringer() string {
 	out := ""
@@ -1068,6 +2218,20 @@ func SetLength(header string, data []byte, val int) []byte {
 	return data
 }
 
+// If set, PATTERN arguments are shell globs rather than regexps.
+var globPatterns bool
+
+// If set, PATTERN arguments match paths regardless of case.
+var ignoreCase bool
+
+// caseFold - make a regexp for a path pattern ignore case if asked to
+func caseFold(re string) string {
+	if ignoreCase {
+		return "(?i)" + re
+	}
+	return re
+}
+
 // SegmentMatcher is strate for a path segment matcher
 type SegmentMatcher struct {
 	regexps []*regexp.Regexp
@@ -1078,10 +2242,13 @@ func NewSegmentMatcher(patterns []string, fixed bool) SegmentMatcher {
 	var s SegmentMatcher
 	s.regexps = make([]*regexp.Regexp, len(patterns))
 	for i, pattern := range patterns {
+		pattern = expandAlias(pattern)
 		if fixed {
-			s.regexps[i] = regexp.MustCompile(segmentize(regexp.QuoteMeta(pattern)))
+			s.regexps[i] = regexp.MustCompile(caseFold(segmentize(regexp.QuoteMeta(pattern))))
+		} else if globPatterns {
+			s.regexps[i] = regexp.MustCompile(caseFold(segmentize(globToRegexp(pattern))))
 		} else {
-			s.regexps[i] = regexp.MustCompile(segmentize(pattern))
+			s.regexps[i] = regexp.MustCompile(caseFold(segmentize(pattern)))
 		}
 	}
 	return s
@@ -1101,6 +2268,7 @@ func (s SegmentMatcher) pathmatch(path string) bool {
 var revisionLine *regexp.Regexp = regexp.MustCompile("Revision-number: ([0-9]+)")
 var textContentLength *regexp.Regexp = regexp.MustCompile("Text-content-length: ([1-9][0-9]*)")
 var nodeCopyfrom *regexp.Regexp = regexp.MustCompile("Node-copyfrom-rev: ([1-9][0-9]*)")
+var expandedKeyword *regexp.Regexp = regexp.MustCompile(`\$(Id|Header|Revision|Rev|LastChangedRevision|Date|LastChangedDate|Author|LastChangedBy|HeadURL|URL|Source|RCSfile|State|Locker|Name)::? [^$\n]*\$`)
 
 // DumpfileSource - this class knows about Subversion dumpfile format.
 type DumpfileSource struct {
@@ -1112,6 +2280,12 @@ type DumpfileSource struct {
 	NodeProps        Properties
 	EmittedRevisions map[string]bool
 	DirTracking      map[string]bool
+	Deltas           *DeltaHistory // nil until a delta has to be expanded
+	Paths            *PathHistory  // nil unless copies are being repaired
+	Out              io.Writer     // where Report sends the filtered stream
+	contentjob       func() func(content []byte) []byte
+	queue            *outputQueue  // nil unless content goes to workers
+	Changes          *changeCounts // nil unless this is a dry run
 }
 
 // NewDumpfileSource - declare a new dumpfile source object with implied parsing
@@ -1122,6 +2296,7 @@ func NewDumpfileSource(rd io.Reader, baton *Baton) DumpfileSource {
 		Revision:         0,
 		EmittedRevisions: make(map[string]bool),
 		DirTracking:      make(map[string]bool),
+		Out:              os.Stdout,
 	}
 	//runtime.SetFinalizer(&ds, func (s DumpfileSource) {s.Baton.End("")})
 }
@@ -1130,7 +2305,7 @@ func NewDumpfileSource(rd io.Reader, baton *Baton) DumpfileSource {
 func (ds *DumpfileSource) Require(prefix string) []byte {
 	line := ds.Lbs.Readline()
 	if !strings.HasPrefix(string(line), prefix) {
-		croak("required prefix '%s' not seen on %q after line %d (r%v)", prefix, line, ds.Lbs.linenumber, ds.Revision)
+		croakParse("required prefix '%s' not seen on %q after line %d (r%v)", prefix, line, ds.Lbs.linenumber, ds.Revision)
 	}
 	//if debug >= debugPARSE {
 	//	fmt.Fprintf(os.Stderr, "<Require %s -> %q>\n", strconv.Quote(prefix), viline)
@@ -1152,8 +2327,18 @@ func (ds *DumpfileSource) say(text []byte) {
 	matches := revisionLine.FindSubmatch(text)
 	if len(matches) > 1 {
 		ds.EmittedRevisions[string(matches[1])] = true
+		if ds.Changes != nil {
+			ds.Changes.emitRevision()
+		}
+	}
+	if ds.Changes != nil {
+		return
+	}
+	if ds.queue != nil {
+		ds.queue.put(text)
+		return
 	}
-	os.Stdout.Write(text)
+	ds.Out.Write(text)
 }
 
 // where - format reference to current node for error logging and see().
@@ -1176,6 +2361,167 @@ func (ds *DumpfileSource) patchMergeinfo(revrange string) string {
 	return outspan.dump()
 }
 
+// skipPreamble - consume the stream header and revision 0, leaving
+// the source positioned at the first revision with content.
+func (ds *DumpfileSource) skipPreamble() {
+	for {
+		line := ds.Lbs.Readline()
+		if len(line) == 0 {
+			return
+		}
+		if strings.HasPrefix(string(line), "Revision-number:") {
+			if string(bytes.Fields(line)[1]) != "0" {
+				ds.Lbs.Push(line)
+				return
+			}
+			ds.Require("Prop-content-length:")
+			ds.Require("Content-length:")
+			ds.Require(linesep)
+			NewProperties(ds)
+		}
+	}
+}
+
+// Walker is the set of callbacks walk hands the parts of a dump to, for
+// transformations that must see a revision whole or rebuild it, which
+// Report's section-at-a-time filtering can't do.  A nil member ignores
+// its part.
+type Walker struct {
+	preamble func(line []byte)
+	revision func(header []byte, props Properties)
+	blank    func(line []byte)
+	node     func(header StreamSection, props *Properties, content []byte)
+	done     func()
+}
+
+// walk - read a dump through to its end, handing each part of it to
+// the walker: the lines before the first revision one at a time, then
+// for each revision its header, from Revision-number through the blank
+// line, with its properties, and its nodes, each with its properties
+// or nil if it has no property section, and its text.  Blank lines
+// between sections are handed over as they come, and done is called
+// after the last node of each revision.
+func (ds *DumpfileSource) walk(w Walker) {
+	for {
+		line := ds.Lbs.Readline()
+		if len(line) == 0 {
+			break
+		}
+		if strings.HasPrefix(string(line), "Revision-number:") {
+			ds.Lbs.Push(line)
+			break
+		}
+		if w.preamble != nil {
+			w.preamble(line)
+		}
+	}
+
+	for ds.Lbs.HasLineBuffered() {
+		header := ds.Require("Revision-number:")
+		rev, err := strconv.Atoi(string(bytes.Fields(header)[1]))
+		if err != nil {
+			croakParse("invalid revision number at line %d", ds.Lbs.linenumber)
+		}
+		ds.Revision = rev
+		ds.Index = 0
+		header = append(header, ds.Require("Prop-content-length:")...)
+		header = append(header, ds.Require("Content-length:")...)
+		header = append(header, ds.Require(linesep)...)
+		revprops := NewProperties(ds)
+		if ds.Baton != nil {
+			ds.Baton.Twirl("")
+		}
+		if w.revision != nil {
+			w.revision(header, revprops)
+		}
+		for {
+			line := ds.Lbs.Readline()
+			if len(line) == 0 {
+				break
+			}
+			if string(line) == linesep {
+				if w.blank != nil {
+					w.blank(line)
+				}
+				continue
+			}
+			if strings.HasPrefix(string(line), "Revision-number:") {
+				ds.Lbs.Push(line)
+				break
+			}
+			if !strings.HasPrefix(string(line), "Node-path: ") {
+				croakParse("at <%d>, line %d: parse of %q doesn't look right, aborting!", ds.Revision, ds.Lbs.linenumber, string(line))
+			}
+			ds.Index++
+			ds.NodePath = string(line[11 : len(line)-1])
+			nodeheader := StreamSection(line)
+			for {
+				line := ds.Lbs.Readline()
+				if len(line) == 0 {
+					croakParse("unexpected EOF in node header at %s", ds.where())
+				}
+				nodeheader = append(nodeheader, line...)
+				if string(line) == linesep {
+					break
+				}
+			}
+			if p := nodeheader.payload("Node-kind"); p != nil {
+				ds.DirTracking[ds.NodePath] = bytes.Equal(p, []byte("dir"))
+			}
+			var props *Properties
+			ds.NodeProps = Properties{properties: make(map[string]string)}
+			if nodeheader.payload("Prop-content-length") != nil {
+				nodeprops := NewProperties(ds)
+				props = &nodeprops
+				ds.NodeProps = nodeprops
+			}
+			content := []byte{}
+			if cl := textContentLength.FindSubmatch(nodeheader); len(cl) > 1 {
+				n, _ := strconv.Atoi(string(cl[1]))
+				content = ds.Lbs.Read(n)
+			}
+			if w.node != nil {
+				w.node(nodeheader, props, content)
+			}
+		}
+		if w.done != nil {
+			w.done()
+		}
+	}
+}
+
+// Hooks is the set of hooks a single-pass transformation hands to
+// Report.  A nil member passes its section through unaltered.
+//
+// A contentjob is the alternative to a contenthook for transformations
+// expensive enough to be worth spreading across cores.  It is called
+// in stream order on each node that will be emitted, after the
+// headerhook, and returns the function to apply to that node's
+// content, or nil to leave the content alone.  That function runs on
+// a worker, concurrently with those of other nodes, so it must not
+// look at the DumpfileSource; anything it needs about the node has to
+// be captured when the job is made.
+type Hooks struct {
+	revhook     func(header StreamSection) []byte
+	prophook    func(properties *Properties)
+	headerhook  func(header StreamSection) []byte
+	contenthook func(content []byte) []byte
+	contentjob  func() func(content []byte) []byte
+}
+
+// apply - run a set of hooks over the stream
+func (ds *DumpfileSource) apply(hooks Hooks) {
+	ds.contentjob = hooks.contentjob
+	if ds.contentjob != nil && contentWorkers > 1 && !dryRun {
+		ds.queue = newOutputQueue(ds.Out, contentWorkers)
+		defer func() {
+			ds.queue.drain()
+			ds.queue = nil
+		}()
+	}
+	ds.Report(hooks.revhook, hooks.prophook, hooks.headerhook, hooks.contenthook)
+}
+
 // Report - simpler reporting of a filtered portion of content.
 func (ds *DumpfileSource) Report(
 	revhook func(header StreamSection) []byte,
@@ -1204,6 +2550,17 @@ func (ds *DumpfileSource) Report(
 	// All hooks can count on the DumpfileSource members to be up to
 	// date, including NodePath and Revision and Index, because those.
 	// are acquired before the properties or node content are parsed.
+	//
+	// In a dry run nothing is emitted; what would have changed is
+	// counted and summarized at the end instead.
+
+	if dryRun {
+		ds.Changes = new(changeCounts)
+		defer ds.Changes.report(ds.Out)
+		if revhook != nil {
+			revhook = ds.Changes.watchRevisions(revhook)
+		}
+	}
 
 	var passthrough bool
 	prestash := []byte{}
@@ -1212,9 +2569,6 @@ func (ds *DumpfileSource) Report(
 		if len(line) == 0 {
 			break
 		} else if strings.HasPrefix(string(line), "Revision-number:") {
-			if revhook != nil {
-				line = revhook(StreamSection(line))
-			}
 			ds.Lbs.Push(line)
 			break
 		}
@@ -1250,15 +2604,25 @@ func (ds *DumpfileSource) Report(
 		rev := string(bytes.Fields(stash)[1])
 		rval, err := strconv.Atoi(rev)
 		if err != nil {
-			fmt.Printf("repocutter: invalid revision number %s at line %d\n", rev, ds.Lbs.linenumber)
-			os.Exit(1)
+			croakParse("invalid revision number %s at line %d", rev, ds.Lbs.linenumber)
 		}
 		ds.Revision = rval
+		// Renumbering waits until the revision before this one has
+		// been emitted or dropped, and leaves ds.Revision the input
+		// number every hook's selection is written against.
+		if revhook != nil {
+			stash = revhook(stash)
+		}
+		if ds.Changes != nil {
+			ds.Changes.startRevision()
+		}
+		if fixCopyfrom && ds.Paths == nil {
+			ds.Paths = NewPathHistory(rval)
+		}
 		if debugline := ds.Optional("Debug-level:"); debugline != nil {
 			debug, err = strconv.Atoi(string(bytes.Fields(debugline)[1]))
 			if err != nil {
-				fmt.Printf("repocutter: invalid debug level %s at line %d\n", rev, ds.Lbs.linenumber)
-				os.Exit(1)
+				croakParse("invalid debug level %s at line %d", rev, ds.Lbs.linenumber)
 			}
 		}
 		stash = append(stash, ds.Require("Prop-content-length:")...)
@@ -1268,7 +2632,14 @@ func (ds *DumpfileSource) Report(
 		// Process per-revision properties
 		props := NewProperties(ds)
 		if prophook != nil {
+			var before string
+			if ds.Changes != nil {
+				before = props.Stringer()
+			}
 			prophook(&props)
+			if ds.Changes != nil {
+				ds.Changes.noteProperties(before, props.Stringer(), true)
+			}
 			proplen := len(props.Stringer())
 			stash = SetLength("Prop-content", stash, proplen)
 			stash = SetLength("Content", stash, proplen)
@@ -1282,6 +2653,7 @@ func (ds *DumpfileSource) Report(
 			stash = append(stash, ds.Lbs.Readline()...)
 		}
 		if ds.Baton != nil {
+			ds.Baton.revision = ds.Revision
 			ds.Baton.Twirl("")
 		}
 		if debug >= debugPARSE {
@@ -1303,17 +2675,13 @@ func (ds *DumpfileSource) Report(
 					if debug >= debugPARSE {
 						fmt.Fprintf(os.Stderr, "<passthrough dump: %q>\n", line)
 					}
-					os.Stdout.Write(line)
+					ds.say(line)
 				}
 				continue
 			}
 			if strings.HasPrefix(string(line), "Revision-number:") {
 				// Putting this check here rather than at the top of the look
 				// guarantees it won't firte on revision 0
-				if revhook != nil {
-					line = revhook(StreamSection(line))
-				}
-				ds.Lbs.Push(line)
 				if len(stash) != 0 && ds.Index == 0 {
 					if passthrough {
 						if debug >= debugPARSE {
@@ -1322,6 +2690,7 @@ func (ds *DumpfileSource) Report(
 						ds.say(stash)
 					}
 				}
+				ds.Lbs.Push(line)
 				ds.Index = 0
 				break
 			}
@@ -1339,8 +2708,7 @@ func (ds *DumpfileSource) Report(
 				for {
 					line := ds.Lbs.Readline()
 					if len(line) == 0 {
-						fmt.Fprintf(os.Stderr, "repocutter: unexpected EOF in node header\n")
-						os.Exit(1)
+						croakParse("unexpected EOF in node header at %s", ds.where())
 					}
 					m := nodeCopyfrom.FindSubmatch(line)
 					if m != nil {
@@ -1369,12 +2737,47 @@ func (ds *DumpfileSource) Report(
 				if debug >= debugPARSE {
 					fmt.Fprintf(os.Stderr, "<READ NODE ENDS>\n")
 				}
+				var original []byte
+				if ds.Changes != nil {
+					original = append([]byte{}, rawHeader...)
+					if bytes.Contains(rawHeader, []byte("Prop-content-length")) {
+						original = append(original, ds.NodeProps.Stringer()...)
+					}
+					original = append(original, content...)
+				}
 
 				header := StreamSection(rawHeader)
 				if p := header.payload("Node-kind"); p != nil {
 					ds.DirTracking[string(header.payload("Node-path"))] = bytes.Equal(p, []byte("dir"))
 				}
 
+				// Delta content is expanded whenever a content hook needs
+				// to see full text. History tracking starts at the first
+				// delta, which in dumps made with --deltas is the first text.
+				// Property deltas are expanded along with text deltas.
+				delta := string(header.payload("Text-delta")) == "true"
+				propdelta := string(header.payload("Prop-delta")) == "true"
+				if (delta || propdelta) && ds.Deltas == nil && (contenthook != nil || ds.contentjob != nil || expandDeltas) {
+					ds.Deltas = NewDeltaHistory()
+				}
+				if ds.Deltas != nil {
+					fulltext, err := ds.Deltas.expand(ds, header, content)
+					if err != nil {
+						croakParse("r%s: delta expansion failed: %v", ds.where(), err)
+					}
+					if delta {
+						proplen, _ := strconv.Atoi(string(header.payload("Prop-content-length")))
+						content = fulltext
+						header = header.fullText(proplen, len(content))
+					}
+					if ds.Deltas.expandProps(ds, header) {
+						proplen := len(ds.NodeProps.Stringer())
+						header = header.delete("Prop-delta:")
+						header = header.setLength("Prop-content", proplen)
+						header = header.setLength("Content", proplen+len(content))
+					}
+				}
+
 				if debug >= debugPARSE {
 					fmt.Fprintf(os.Stderr, "<header before hooks: %q>\n", header)
 					fmt.Fprintf(os.Stderr, "<properties before hooks: %q>\n", ds.NodeProps)
@@ -1391,7 +2794,14 @@ func (ds *DumpfileSource) Report(
 				properties := ""
 				if bytes.Contains(header, []byte("Prop-content-length")) {
 					if prophook != nil {
+						var before string
+						if ds.Changes != nil {
+							before = ds.NodeProps.Stringer()
+						}
 						prophook(&ds.NodeProps)
+						if ds.Changes != nil {
+							ds.Changes.noteProperties(before, ds.NodeProps.Stringer(), false)
+						}
 					}
 					properties = ds.NodeProps.Stringer()
 					if prophook != nil {
@@ -1411,47 +2821,85 @@ func (ds *DumpfileSource) Report(
 				// that didn't turn up any matches.
 				if len(header) == 0 {
 					emit = false
+					if ds.Changes != nil {
+						ds.Changes.noteNode(original, nil)
+					}
 				} else {
+					emit = true
+					if ds.Paths != nil && header.payload("Node-copyfrom-rev") != nil {
+						header = ds.repairCopyfrom(header)
+					}
 					if contenthook != nil {
 						if debug >= debugPARSE {
 							fmt.Fprintf(os.Stderr, "<r%s: contenthook called with>\n",
 								ds.where())
 						}
-						newcontent := contenthook(content)
-						if string(content) != string(newcontent) {
-							header = header.stripChecksums()
-							header = header.setLength("Text-content", len(newcontent))
-							header = header.setLength("Content", len(properties)+len(newcontent))
-						}
-						content = newcontent
+						header, content = transformContent(header, properties, content, contenthook)
 					}
-
-					nodetxt := append(header, append([]byte(properties), content...)...)
-					if debug >= debugPARSE {
-						fmt.Fprintf(os.Stderr, "<nodetxt: %q>\n", nodetxt)
+					if ds.Paths != nil {
+						ds.Paths.note(header, ds.Revision)
 					}
-					emit = len(nodetxt) > 0
-					if emit {
-						if len(stash) > 0 {
-							if debug >= debugPARSE {
-								fmt.Fprintf(os.Stderr, "<appending to: %q>\n", stash)
-							}
-							nodetxt = append(stash, nodetxt...)
-							stash = []byte{}
-						}
+					if len(stash) > 0 {
 						if debug >= debugPARSE {
-							fmt.Fprintf(os.Stderr, "<node dump: %q>\n", nodetxt)
+							fmt.Fprintf(os.Stderr, "<appending to: %q>\n", stash)
+						}
+						ds.say(stash)
+						stash = []byte{}
+					}
+					var job func([]byte) []byte
+					if ds.contentjob != nil {
+						job = ds.contentjob()
+					}
+					if job != nil {
+						if ds.queue != nil {
+							// Only the header length and checksum lines can
+							// change, so the node's effect on the tree is
+							// already known; the text can come later.
+							ds.queue.later(func() []byte {
+								header, content := transformContent(header, properties, content, job)
+								return nodeText(header, properties, content)
+							})
+							continue
 						}
-						ds.say(nodetxt)
+						header, content = transformContent(header, properties, content, job)
 					}
+					nodetxt := nodeText(header, properties, content)
+					if debug >= debugPARSE {
+						fmt.Fprintf(os.Stderr, "<node dump: %q>\n", nodetxt)
+					}
+					if ds.Changes != nil {
+						ds.Changes.noteNode(original, nodetxt)
+					}
+					ds.say(nodetxt)
 				}
 				continue
 			}
-			croak("at <%d>, line %d: parse of %q doesn't look right, aborting!", ds.Revision, ds.Lbs.linenumber, string(line))
+			croakParse("at <%d>, line %d: parse of %q doesn't look right, aborting!", ds.Revision, ds.Lbs.linenumber, string(line))
 		}
 	}
 }
 
+// transformContent - apply a content transformation to a node, fixing
+// up the lengths and checksums in its header to match
+func transformContent(header StreamSection, properties string, content []byte, transform func([]byte) []byte) (StreamSection, []byte) {
+	newcontent := transform(content)
+	if string(content) != string(newcontent) {
+		header = header.stripChecksums()
+		header = header.setLength("Text-content", len(newcontent))
+		header = header.setLength("Content", len(properties)+len(newcontent))
+	}
+	return header, newcontent
+}
+
+// nodeText - assemble a node for output
+func nodeText(header StreamSection, properties string, content []byte) []byte {
+	// Deltas can't be checksummed without the base text.
+	if rehash && header.hasContent() && header.payload("Text-delta") == nil {
+		header = header.setChecksums(content)
+	}
+	return append(header, append([]byte(properties), content...)...)
+}
+
 // Logentry - parsed form of a Subversion log entry for a revision
 type Logentry struct {
 	author []byte
@@ -1521,8 +2969,7 @@ func NewLogfile(readable io.Reader, restrict *SubversionRange) *Logfile {
 				continue
 			}
 			if !re.Match(line) {
-				fmt.Fprintf(os.Stderr, "line %d: repocutter did not see a comment header where one was expected\n", lineno)
-				os.Exit(1)
+				croakParse("line %d of log entries: did not see a comment header where one was expected", lineno)
 			}
 			fields := bytes.Split(line, []byte("|"))
 			revstr := bytes.TrimSpace(fields[0])
@@ -1607,6 +3054,34 @@ func (ss StreamSection) stripChecksums() StreamSection {
 	return StreamSection(header)
 }
 
+// setChecksums - set the text checksums of a blob header from its content,
+// updating existing headers in place and adding missing ones after Text-content-length.
+func (ss StreamSection) setChecksums(content []byte) StreamSection {
+	header := ss.clone()
+	for _, sum := range []struct {
+		htype string
+		value string
+	}{
+		{"Text-content-sha1", fmt.Sprintf("%x", sha1.Sum(content))},
+		{"Text-content-md5", fmt.Sprintf("%x", md5.Sum(content))},
+	} {
+		if header.payload(sum.htype) != nil {
+			header, _, _ = header.replaceHook(sum.htype, func(hd string, in []byte) []byte {
+				return []byte(sum.value)
+			})
+			continue
+		}
+		offs := header.index("Text-content-length: ")
+		if offs == -1 {
+			break
+		}
+		offs += bytes.Index(header[offs:], []byte(linesep)) + 1
+		line := []byte(sum.htype + ": " + sum.value + linesep)
+		header = append(header[:offs:offs], append(line, header[offs:]...)...)
+	}
+	return header
+}
+
 // delete - method to delete a specified header
 func (ss StreamSection) delete(htype string) StreamSection {
 	offs := ss.index(htype)
@@ -1638,6 +3113,15 @@ func (ss StreamSection) hasContent() bool {
 // Helpers
 
 func doSelect(source DumpfileSource, selection SubversionRange, invert bool) {
+	if source.isFastImport() {
+		fastImportSelect(NewFastImportSource(source), selection, invert)
+		return
+	}
+	source.apply(doSelectHooks(&source, selection, invert))
+}
+
+// doSelectHooks - the hooks that keep or drop nodes by selection
+func doSelectHooks(source *DumpfileSource, selection SubversionRange, invert bool) Hooks {
 	if debug >= debugPARSE {
 		fmt.Fprintf(os.Stderr, "<entering select>")
 	}
@@ -1656,11 +3140,16 @@ func doSelect(source DumpfileSource, selection SubversionRange, invert bool) {
 		return nil
 	}
 
-	source.Report(nil, prophook, headerhook, nil)
+	return Hooks{prophook: prophook, headerhook: headerhook}
 }
 
 // Hack paths by applying a specified transformation.
 func mutatePaths(source DumpfileSource, selection SubversionRange, pathMutator func(string, []byte) []byte, nameMutator func(string) string, contentMutator func([]byte) []byte) {
+	source.apply(mutatePathsHooks(&source, selection, pathMutator, nameMutator, contentMutator))
+}
+
+// mutatePathsHooks - the hooks that apply a path transformation
+func mutatePathsHooks(source *DumpfileSource, selection SubversionRange, pathMutator func(string, []byte) []byte, nameMutator func(string) string, contentMutator func([]byte) []byte) Hooks {
 	prophook := func(props *Properties) {
 		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
 			return string(pathMutator("Mergeinfo", []byte(path))), revrange
@@ -1680,7 +3169,7 @@ func mutatePaths(source DumpfileSource, selection SubversionRange, pathMutator f
 		}
 		return []byte(header)
 	}
-	source.Report(nil, prophook, headerhook, contentMutator)
+	return Hooks{prophook: prophook, headerhook: headerhook, contenthook: contentMutator}
 }
 
 func segmentize(pattern string) string {
@@ -1694,216 +3183,2925 @@ func segmentize(pattern string) string {
 	return "(?P<start>^|/)" + pattern + "(?P<end>/|$)"
 }
 
-// The commands proper
-
-func closure(source DumpfileSource, selection SubversionRange, paths []string) {
-	copiesFrom := make(map[string][]string)
-	headerhook := func(header StreamSection) []byte {
-		if selection.ContainsNode(source.Revision, source.Index) && source.NodePath != "" {
-			copysource := header.payload("Node-copyfrom-path")
-			if copysource != nil {
-				copiesFrom[source.NodePath] = append(copiesFrom[source.NodePath], string(copysource))
+// globToRegexp - translate a shell glob into a regexp for segmentize.
+// A * or ? matches within a path segment and ** across segments; a
+// leading / anchors the glob at the start of the path and a trailing
+// / at its end.
+func globToRegexp(glob string) string {
+	var re strings.Builder
+	if strings.HasPrefix(glob, "/") {
+		re.WriteString("^")
+		glob = glob[1:]
+	}
+	anchorEnd := strings.HasSuffix(glob, "/")
+	glob = strings.TrimSuffix(glob, "/")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
 			}
-		}
-		return nil
-	}
-	source.Report(nil, nil, headerhook, nil)
-	s := newStringSet(paths...)
-	for {
-		count := s.Len()
-		for target := range s.store {
-			for _, source := range copiesFrom[target] {
-				s.Add(source)
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end == -1 {
+				croakUsage("unterminated character class in glob %q", glob)
 			}
-		}
-		if count == s.Len() {
-			break
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			re.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
 		}
 	}
-	for _, path := range s.toOrderedStringSet() {
-		fmt.Println(path)
+	if anchorEnd {
+		re.WriteString("$")
 	}
+	if re.Len() == 0 {
+		croakUsage("empty glob")
+	}
+	return re.String()
 }
 
-// Select a portion of the dump file defined by a revision selection.
-func deselect(source DumpfileSource, selection SubversionRange) {
-	doSelect(source, selection, true)
-}
-
-// Drop or retain ops defined by a revision selection and a path regexp.
-func expungesift(source DumpfileSource, selection SubversionRange, expunge bool, fixed bool, patterns []string) {
-	matcher := NewSegmentMatcher(patterns, fixed)
+// Apply a transformation to the content of selected text files, treating
+// as binary any file whose last svn:mime-type setting is not text/* and
+// any content containing NULs.
+func transformText(source DumpfileSource, selection SubversionRange, fixed bool, patterns []string, transform func([]byte) []byte) {
+	var matcher SegmentMatcher
+	if len(patterns) > 0 {
+		matcher = NewSegmentMatcher(patterns, fixed)
+	}
+	// Content is changed, so recompute checksums rather than just
+	// dropping them.
+	rehash = true
+	// The mime type of a file is only stated when its properties are,
+	// so remember the last one seen for each path.
+	mimetypes := make(map[string]string)
+	prophook := func(props *Properties) {
+		if source.Index == 0 {
+			return
+		}
+		if mimetype, ok := props.properties["svn:mime-type"]; ok {
+			mimetypes[source.NodePath] = mimetype
+		} else {
+			delete(mimetypes, source.NodePath)
+		}
+	}
+	convert := false
 	headerhook := func(header StreamSection) []byte {
-		if !selection.ContainsNode(source.Revision, source.Index) || source.Revision == 0 {
+		convert = false
+		if source.Index == 0 {
 			return []byte(header)
 		}
-		matched := !expunge
-		for _, hd := range []string{"Node-path", "Node-copyfrom-path"} {
-			nodepath := header.payload(hd)
-			if debug >= debugLOGIC {
-				fmt.Fprintf(os.Stderr, "<%s: %s is %q>\n", source.where(), hd, nodepath)
-			}
-			if nodepath != nil {
-				if expunge {
-					matched = matched || matcher.pathmatch(string(nodepath))
-				} else {
-					matched = matched && matcher.pathmatch(string(nodepath))
-				}
+		if frompath := header.payload("Node-copyfrom-path"); frompath != nil && !header.hasProperties() {
+			if mimetype, ok := mimetypes[string(frompath)]; ok {
+				mimetypes[source.NodePath] = mimetype
 			}
 		}
-		if matched != expunge {
+		if mimetype, ok := mimetypes[source.NodePath]; ok && !strings.HasPrefix(mimetype, "text/") {
 			return []byte(header)
 		}
-		return nil
+		convert = selection.ContainsNode(source.Revision, source.Index) &&
+			!header.isDir(source) &&
+			(len(patterns) == 0 || matcher.pathmatch(source.NodePath))
+		return []byte(header)
 	}
-	prophook := func(props *Properties) {
-		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
-			if matcher.pathmatch(path) == expunge {
-				return "", ""
-			}
-			revrange = source.patchMergeinfo(revrange)
-			return path, revrange
-		})
+	contenthook := func(content []byte) []byte {
+		if !convert || bytes.IndexByte(content, 0) != -1 {
+			return content
+		}
+		return transform(content)
 	}
-	source.Report(nil, prophook, headerhook, nil)
+	source.Report(nil, prophook, headerhook, contenthook)
 }
 
-// Replace file copy operations with explicit add/change operation
-func filecopy(source DumpfileSource, selection SubversionRange, byBasename bool, matchpaths []string) {
-	type trackCopy struct {
-		revision int
-		content  []byte
-	}
-	values := make(map[string][]trackCopy)
-	var replacement []byte
-	var nodePath string
-	headerhook := func(header StreamSection) []byte {
-		nodePath = source.NodePath
-		if debug >= debugLOGIC {
-			fmt.Fprintf(os.Stderr,
-				"<r%s: filecopy investigates this revision>\n",
-				source.where())
-		}
-		if _, ok := values[nodePath]; !ok {
-			values[nodePath] = make([]trackCopy, 0)
-		}
-		if byBasename {
-			if len(matchpaths) > 0 {
-				nodePath = matchpaths[0]
-			} else {
-				nodePath = filepath.Base(nodePath)
-			}
+// The commands proper
+
+// Explode each revision into a series of single-node revisions.
+func atomize(source DumpfileSource) {
+	// Old revision numbers seen, in order, and the new numbers of the
+	// first and last revisions each became.
+	olds := make([]int, 0)
+	firsts := make(map[int]int)
+	lasts := make(map[int]int)
+	// Map a reference to the last revision made from the highest
+	// old revision at or below it, leaving earlier ones alone.
+	mapDown := func(n int) int {
+		if i := sort.SearchInts(olds, n+1) - 1; i >= 0 {
+			return lasts[olds[i]]
 		}
-		replacement = nil
-		// The logic here is a bit more complex than might seem necessary
-		// because for some inexplicable reason Subversion occasionally generates nodes
-		// which have copyfrom information *and* the copy already performed - that is,
-		// the node content is non-nil and should be used.  In that case we want to strip
-		// out the copyfrom information without modifyinmg the content.
-		if !selection.ContainsNode(source.Revision, source.Index) || source.Revision == 0 {
-			return []byte(header)
+		return n
+	}
+	mapUp := func(n int) int {
+		if i := sort.SearchInts(olds, n); i < len(olds) {
+			return firsts[olds[i]]
 		}
-		if copypath := header.payload("Node-copyfrom-path"); copypath != nil {
-			if byBasename {
-				copypath = []byte(filepath.Base(string(copypath)))
+		return n
+	}
+	counter := 0
+	out := bufio.NewWriter(source.Out)
+	var stash []byte
+	var revprops Properties
+	var logentry string
+	// One revision record goes out ahead of each node, or just one if
+	// there are no nodes.
+	emitRevision := func() {
+		rev := source.Revision
+		props := revprops
+		if source.Index > 0 {
+			props.properties = make(map[string]string)
+			for key, value := range revprops.properties {
+				props.properties[key] = value
 			}
-			if debug >= debugLOGIC {
-				fmt.Fprintf(os.Stderr, "<r%s: filecopy investigates %s>\n",
-					source.where(), copypath)
+			if !props.Contains("svn:log") {
+				props.propkeys = append(append([]string{}, props.propkeys...), "svn:log")
 			}
-			if header.hasContent() {
-				header = header.delete("Node-copyfrom-path")
-				header = header.delete("Node-copyfrom-rev")
-				header = header.stripChecksums()
-			} else {
-				copyrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
-				if sources, ok := values[string(copypath)]; ok {
-					for i := len(sources) - 1; i >= 0; i-- {
-						if sources[i].revision <= copyrev {
-							header = header.delete("Node-copyfrom-path")
-							header = header.delete("Node-copyfrom-rev")
-							header = header.stripChecksums()
-							replacement = sources[i].content
-							if debug >= debugLOGIC {
-								fmt.Fprintf(os.Stderr, "    <r%s replacement is '%q'>\n", source.where(), replacement)
-							}
-							break
-						}
+			props.properties["svn:log"] = strings.TrimLeft(fmt.Sprintf("%s\n\n[r%d.%d]\n", logentry, rev, source.Index), "\n")
+		}
+		properties := props.Stringer()
+		header := StreamSection(stash).clone()
+		header, _, _ = header.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+			return []byte(strconv.Itoa(counter))
+		})
+		header = StreamSection(SetLength("Prop-content", header, len(properties)))
+		header = StreamSection(SetLength("Content", header, len(properties)))
+		lasts[rev] = counter
+		counter++
+		out.Write(header)
+		out.WriteString(properties)
+		out.WriteString(linesep)
+	}
+	source.walk(Walker{
+		preamble: func(line []byte) {
+			out.Write(line)
+		},
+		revision: func(header []byte, props Properties) {
+			stash, revprops = header, props
+			logentry = strings.TrimRight(revprops.properties["svn:log"], "\n")
+			firsts[source.Revision] = counter
+			olds = append(olds, source.Revision)
+		},
+		node: func(header StreamSection, props *Properties, content []byte) {
+			emitRevision()
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+				oldnum, _ := strconv.Atoi(string(in))
+				return []byte(strconv.Itoa(mapDown(oldnum)))
+			})
+			if props != nil {
+				props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+					span := parseMergeinfoRange(revrange)
+					for i := range span.intervals {
+						span.intervals[i].Lower = mapUp(span.intervals[i].Lower)
+						span.intervals[i].Upper = mapDown(span.intervals[i].Upper)
 					}
-				} else if debug >= debugLOGIC {
-					fmt.Fprintf(os.Stderr, "  <no path match found>\n")
-				}
+					return path, span.dump()
+				})
+				properties := props.Stringer()
+				header = header.setLength("Prop-content", len(properties))
+				header = header.setLength("Content", len(properties)+len(content))
+				header = append(header, []byte(properties)...)
 			}
+			out.Write(header)
+			out.Write(content)
+			out.WriteString(linesep + linesep)
+		},
+		done: func() {
+			if source.Index == 0 {
+				emitRevision()
+			}
+		},
+	})
+	if err := out.Flush(); err != nil {
+		croakIO("atomize write failed: %v", err)
+	}
+}
+
+// Rewrite svn:author properties from an author map.
+func attribution(source DumpfileSource, selection SubversionRange, mapfile string, identityProperty string) {
+	fp, err := os.Open(mapfile)
+	if err != nil {
+		croakIO("attribution could not open %s: %v", mapfile, err)
+	}
+	defer fp.Close()
+	type identity struct {
+		attribution string
+		full        string
+	}
+	authormap := make(map[string]identity)
+	scanner := bufio.NewScanner(fp)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		// Alias lines are for reposurgeon's benefit; they don't
+		// name Subversion users.
+		if line == "" || line[0] == '#' || line[0] == '+' {
+			continue
 		}
-		return []byte(header)
+		fields := strings.SplitN(line, "=", 2)
+		if len(fields) != 2 {
+			croakParse("%s:%d: expected 'svnuser = Full Name <email>'", mapfile, lineno)
+		}
+		local := strings.ToLower(strings.TrimSpace(fields[0]))
+		full := strings.TrimSpace(fields[1])
+		end := strings.Index(full, ">")
+		if end == -1 || !strings.Contains(full[:end], "<") {
+			croakParse("%s:%d: can't recognize address in %q", mapfile, lineno, full)
+		}
+		authormap[local] = identity{full[:end+1], full}
 	}
-	contenthook := func(content []byte) []byte {
-		if replacement != nil {
-			content = replacement
-			if debug >= debugLOGIC {
-				fmt.Fprintf(os.Stderr, "  <r%s replacing with %q>\n", source.where(), content)
+	if err := scanner.Err(); err != nil {
+		croakIO("attribution could not read %s: %v", mapfile, err)
+	}
+
+	unmapped := newStringSet()
+	prophook := func(props *Properties) {
+		if source.Index != 0 || source.Revision == 0 || !selection.ContainsRevision(source.Revision) {
+			return
+		}
+		author, ok := props.properties["svn:author"]
+		if !ok {
+			return
+		}
+		mapped, ok := authormap[strings.ToLower(author)]
+		if !ok {
+			if !unmapped.Contains(author) {
+				unmapped.Add(author)
+				announce("r%d: no mapping for author %s", source.Revision, author)
 			}
+			return
 		}
-		if content != nil && len(content) > 0 {
-			trampoline := values[nodePath]
-			trampoline = append(trampoline, trackCopy{source.Revision, content})
-			values[nodePath] = trampoline
-			if debug >= debugLOGIC {
-				fmt.Fprintf(os.Stderr, "<r%s: for %s, stashed content %q>\n",
-					source.where(), nodePath, content)
+		props.properties["svn:author"] = mapped.attribution
+		if identityProperty != "" {
+			if !props.Contains(identityProperty) {
+				props.propkeys = append(props.propkeys, identityProperty)
 			}
+			props.properties[identityProperty] = mapped.full
 		}
-		return content
 	}
-
-	source.Report(nil, nil, headerhook, contenthook)
+	source.Report(nil, prophook, nil, nil)
 }
 
-// Extract log entries
-func log(source DumpfileSource, selection SubversionRange) {
-	SVNTimeParse := func(rdate string) time.Time {
-		// Parse a date in the Subversion variant of RFC3339 format
-		// An example date in SVN format is '2011-11-30T16:40:02.180831Z'
-		date, ok := time.Parse(time.RFC3339Nano, rdate)
-		if ok != nil {
-			fmt.Fprintf(os.Stderr, "ill-formed date '%s': %v\n", rdate, ok)
-			os.Exit(1)
+// Report commit counts and activity ranges per author.
+func authors(source DumpfileSource, selection SubversionRange, prefixes []string) {
+	out := source.Out
+	type authorRecord struct {
+		commits  int
+		first    string
+		last     string
+		prefixes map[string]int
+	}
+	for i := range prefixes {
+		prefixes[i] = strings.Trim(prefixes[i], "/")
+	}
+	records := make(map[string]*authorRecord)
+	var current *authorRecord
+	touched := newStringSet()
+	prophook := func(props *Properties) {
+		if source.Index != 0 {
+			return
 		}
-		return date
+		current = nil
+		touched = newStringSet()
+		if source.Revision == 0 || !selection.ContainsRevision(source.Revision) {
+			return
+		}
+		author := props.getAuthor()
+		record, ok := records[author]
+		if !ok {
+			record = &authorRecord{prefixes: make(map[string]int)}
+			records[author] = record
+		}
+		record.commits++
+		if date, ok := props.properties["svn:date"]; ok {
+			if record.first == "" || date < record.first {
+				record.first = date
+			}
+			if date > record.last {
+				record.last = date
+			}
+		}
+		current = record
 	}
-
-	prophook := func(prop *Properties) {
-		if selection.ContainsRevision(source.Revision) {
-			// This test implicitly excludes r0 metadata from being dumped.
-			// It is not certain this is the right thing.
-			if logentry := prop.properties["svn:log"]; logentry != "" {
-				os.Stdout.Write([]byte(delim + "\n"))
-				author := prop.getAuthor()
-				date := SVNTimeParse(prop.properties["svn:date"])
-				drep := date.Format("2006-01-02 15:04:05 +0000 (Mon, 02 Jan 2006)")
-				fmt.Printf("r%d | %s | %s | %d lines\n",
-					source.Revision,
-					author,
-					drep,
-					strings.Count(logentry, "\n"))
-				os.Stdout.WriteString("\n" + logentry + "\n")
+	headerhook := func(header StreamSection) []byte {
+		if current == nil || source.Index == 0 || !selection.ContainsNode(source.Revision, source.Index) {
+			return nil
+		}
+		for _, prefix := range prefixes {
+			if !touched.Contains(prefix) && (source.NodePath == prefix || strings.HasPrefix(source.NodePath, prefix+"/")) {
+				touched.Add(prefix)
+				current.prefixes[prefix]++
 			}
 		}
+		return nil
 	}
-	headerhook := func(header StreamSection) []byte { return nil }
 	source.Report(nil, prophook, headerhook, nil)
-}
 
-// Hack pathnames to obscure them.
-func obscure(seq NameSequence, source DumpfileSource, selection SubversionRange) {
-	pathMutator := func(hd string, s []byte) []byte {
-		parts := strings.Split(filepath.ToSlash(string(s)), "/")
-		for i := range parts {
-			if parts[i] != "trunk" && parts[i] != "tags" && parts[i] != "branches" && parts[i] != "" {
-				parts[i] = seq.obscureString(parts[i])
+	names := make([]string, 0, len(records))
+	for name := range records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		record := records[name]
+		fmt.Fprintf(out, "%-16s %6d %s %s\n", name, record.commits, record.first, record.last)
+		for _, prefix := range prefixes {
+			if count := record.prefixes[prefix]; count > 0 {
+				fmt.Fprintf(out, "  %-14s %6d\n", prefix, count)
 			}
 		}
-		return []byte(filepath.FromSlash(strings.Join(parts, "/")))
+	}
+}
+
+func closure(source DumpfileSource, selection SubversionRange, fixed bool, patterns []string, reportRevisions bool) {
+	out := source.Out
+	if len(patterns) == 0 {
+		croakUsage("closure requires at least one path pattern")
+	}
+	matcher := NewSegmentMatcher(patterns, fixed)
+	type copyRecord struct {
+		target  string
+		source  string
+		fromrev int
+	}
+	copies := make([]copyRecord, 0)
+	roots := newStringSet()
+	if fixed {
+		for _, path := range patterns {
+			roots.Add(path)
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		if selection.ContainsNode(source.Revision, source.Index) && source.NodePath != "" {
+			if matcher.pathmatch(source.NodePath) {
+				roots.Add(source.NodePath)
+			}
+			if copysource := header.payload("Node-copyfrom-path"); copysource != nil {
+				fromrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+				copies = append(copies, copyRecord{source.NodePath, string(copysource), fromrev})
+			}
+		}
+		return nil
+	}
+	source.Report(nil, nil, headerhook, nil)
+
+	within := func(path string, dir string) bool {
+		return path == dir || strings.HasPrefix(path, dir+"/")
+	}
+	// Drop paths lying beneath other paths in the set.
+	minimize := func(s stringSet) stringSet {
+		out := newStringSet()
+		for path := range s.store {
+			covered := false
+			for other := range s.store {
+				if other != path && within(path, other) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				out.Add(path)
+			}
+		}
+		return out
+	}
+	// A copy matters if its target is inside the set, in which case its
+	// whole source is needed, or if it is a directory above something in
+	// the set, in which case only the corresponding part of the source is.
+	revisions := make(map[int]bool)
+	roots = minimize(roots)
+	for {
+		count := roots.Len()
+		for _, c := range copies {
+			for root := range roots.store {
+				if within(c.target, root) {
+					roots.Add(c.source)
+					revisions[c.fromrev] = true
+				} else if within(root, c.target) {
+					roots.Add(c.source + root[len(c.target):])
+					revisions[c.fromrev] = true
+				}
+			}
+		}
+		roots = minimize(roots)
+		if count == roots.Len() {
+			break
+		}
+	}
+	if reportRevisions {
+		revs := make([]int, 0, len(revisions))
+		for rev := range revisions {
+			revs = append(revs, rev)
+		}
+		sort.Ints(revs)
+		for _, rev := range revs {
+			fmt.Fprintln(out, rev)
+		}
+		return
+	}
+	for _, path := range roots.toOrderedStringSet() {
+		fmt.Fprintln(out, path)
+	}
+}
+
+// Recompute text checksums.
+func checksum(source DumpfileSource) {
+	rehash = true
+	source.Report(nil, nil, nil, nil)
+}
+
+// Merge runs of consecutive revisions by one author into single revisions.
+func coalesce(source DumpfileSource, selection SubversionRange, window time.Duration) {
+	// Old revision numbers seen, in order, and their new numbers.
+	olds := make([]int, 0)
+	renumbering := make(map[int]int)
+	mapDown := func(n int) int {
+		if i := sort.SearchInts(olds, n+1) - 1; i >= 0 {
+			return renumbering[olds[i]]
+		}
+		return n
+	}
+	// The run being built, held back until a revision that can't join it.
+	var runStash []byte
+	var runProps Properties
+	var runNodes bytes.Buffer
+	runStart, runNumber := -1, -1
+	var runDate time.Time
+	out := bufio.NewWriter(source.Out)
+	flush := func() {
+		if runStart == -1 {
+			return
+		}
+		properties := runProps.Stringer()
+		header := StreamSection(runStash)
+		header, _, _ = header.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+			return []byte(strconv.Itoa(runNumber))
+		})
+		header = StreamSection(SetLength("Prop-content", header, len(properties)))
+		header = StreamSection(SetLength("Content", header, len(properties)))
+		out.Write(header)
+		out.WriteString(properties)
+		out.WriteString(linesep)
+		out.Write(runNodes.Bytes())
+		runNodes.Reset()
+	}
+	var stash []byte
+	var revprops Properties
+	// The nodes of a revision, and whether any copies from the run,
+	// which would leave it copying from itself.
+	var nodes bytes.Buffer
+	selfcopy := false
+	source.walk(Walker{
+		preamble: func(line []byte) {
+			out.Write(line)
+		},
+		revision: func(header []byte, props Properties) {
+			stash, revprops = header, props
+			nodes.Reset()
+			selfcopy = false
+		},
+		node: func(header StreamSection, props *Properties, content []byte) {
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+				oldnum, _ := strconv.Atoi(string(in))
+				if runStart != -1 && oldnum >= runStart {
+					selfcopy = true
+				}
+				return []byte(strconv.Itoa(mapDown(oldnum)))
+			})
+			if props != nil {
+				props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+					span := parseMergeinfoRange(revrange)
+					for i := range span.intervals {
+						span.intervals[i].Lower = mapDown(span.intervals[i].Lower)
+						span.intervals[i].Upper = mapDown(span.intervals[i].Upper)
+					}
+					span.Optimize()
+					return path, span.dump()
+				})
+				properties := props.Stringer()
+				header = header.setLength("Prop-content", len(properties))
+				header = header.setLength("Content", len(properties)+len(content))
+				header = append(header, []byte(properties)...)
+			}
+			nodes.Write(header)
+			nodes.Write(content)
+			nodes.WriteString(linesep + linesep)
+		},
+		done: func() {
+			rev := source.Revision
+			date, _ := time.Parse(time.RFC3339Nano, revprops.properties["svn:date"])
+			joins := runStart > 0 && !selfcopy &&
+				selection.ContainsRevision(runStart) && selection.ContainsRevision(rev) &&
+				revprops.getAuthor() == runProps.getAuthor()
+			if joins {
+				samelog := revprops.properties["svn:log"] == runProps.properties["svn:log"]
+				joins = samelog || (window > 0 && date.Sub(runDate) <= window)
+				if joins && !samelog {
+					runProps.properties["svn:log"] = strings.TrimRight(runProps.properties["svn:log"], "\n") + "\n\n" + revprops.properties["svn:log"]
+				}
+			}
+			if joins {
+				// The last revision of a run supplies its date.
+				if rdate, ok := revprops.properties["svn:date"]; ok {
+					if !runProps.Contains("svn:date") {
+						runProps.propkeys = append(runProps.propkeys, "svn:date")
+					}
+					runProps.properties["svn:date"] = rdate
+				}
+			} else {
+				flush()
+				runStart, runNumber = rev, runNumber+1
+				runStash, runProps = stash, revprops
+			}
+			runDate = date
+			olds = append(olds, rev)
+			renumbering[rev] = runNumber
+			runNodes.Write(nodes.Bytes())
+		},
+	})
+	flush()
+	if err := out.Flush(); err != nil {
+		croakIO("coalesce write failed: %v", err)
+	}
+}
+
+// Shift svn:date values by constant or per-range offsets.
+func dateshift(source DumpfileSource, selection SubversionRange, args []string) {
+	if len(args) == 0 {
+		croakUsage("dateshift requires an offset")
+	}
+	type shift struct {
+		selection SubversionRange
+		offset    time.Duration
+	}
+	parseOffset := func(txt string) time.Duration {
+		if txt == "0" {
+			return 0
+		}
+		offset, err := time.ParseDuration(strings.TrimPrefix(txt, "+"))
+		if err != nil {
+			croakUsage("ill-formed date offset %q", txt)
+		}
+		return offset
+	}
+	shifts := make([]shift, 0, len(args))
+	if len(args) == 1 && !strings.Contains(args[0], "=") {
+		shifts = append(shifts, shift{selection, parseOffset(args[0])})
+	} else {
+		for _, arg := range args {
+			fields := strings.SplitN(arg, "=", 2)
+			if len(fields) != 2 {
+				croakUsage("dateshift expects SELECTION=OFFSET, not %q", arg)
+			}
+			shifts = append(shifts, shift{NewSubversionRange(fields[0]), parseOffset(fields[1])})
+		}
+	}
+	// Subversion writes UTC with microseconds; conversions from other
+	// systems sometimes leave zone offsets, spaces, or no zone at all.
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02 15:04:05.999999999",
+	}
+	parseDate := func(rdate string) (time.Time, bool) {
+		for _, layout := range layouts {
+			if date, err := time.Parse(layout, strings.TrimSpace(rdate)); err == nil {
+				return date, true
+			}
+		}
+		return time.Time{}, false
+	}
+	var previous time.Time
+	prophook := func(props *Properties) {
+		if source.Index != 0 {
+			return
+		}
+		rdate, ok := props.properties["svn:date"]
+		if !ok {
+			return
+		}
+		date, ok := parseDate(rdate)
+		for _, s := range shifts {
+			if s.selection.ContainsRevision(source.Revision) {
+				if !ok {
+					croakParse("r%d: ill-formed date %q", source.Revision, rdate)
+				}
+				date = date.Add(s.offset)
+				props.properties["svn:date"] = date.UTC().Format("2006-01-02T15:04:05.000000Z")
+				break
+			}
+		}
+		if !ok {
+			return
+		}
+		if date.Before(previous) {
+			announce("r%d: date %s is earlier than the previous revision's", source.Revision, props.properties["svn:date"])
+		}
+		previous = date
+	}
+	source.Report(nil, prophook, nil, nil)
+}
+
+// Structurally compare two dumps.
+func diff(filenames []string, skipVolatile bool, baton *Baton, out io.Writer) int {
+	if len(filenames) != 2 {
+		croakUsage("diff requires exactly two dump files")
+	}
+	type diffNode struct {
+		fields  map[string]string
+		keys    []string
+		props   *Properties
+		hasText bool
+		hash    [md5.Size]byte
+	}
+	type diffRevision struct {
+		rev   int
+		props Properties
+		nodes []*diffNode
+	}
+	volatile := func(key string) bool {
+		return strings.HasSuffix(key, "-length") ||
+			(skipVolatile && (strings.HasSuffix(key, "-md5") || strings.HasSuffix(key, "-sha1")))
+	}
+	digest := func(filename string) []*diffRevision {
+		fp, err := os.Open(filename)
+		if err != nil {
+			croakIO("diff could not open %s: %v", filename, err)
+		}
+		defer fp.Close()
+		source := NewDumpfileSource(decompress(fp), baton)
+		source.Out = io.Discard
+		revisions := make([]*diffRevision, 0)
+		var nodeprops *Properties
+		var current *diffNode
+		prophook := func(props *Properties) {
+			if source.Index == 0 {
+				revisions = append(revisions, &diffRevision{rev: source.Revision, props: *props})
+				return
+			}
+			nodeprops = props
+		}
+		headerhook := func(header StreamSection) []byte {
+			if source.Index == 0 || len(revisions) == 0 {
+				return []byte(header)
+			}
+			current = &diffNode{fields: make(map[string]string)}
+			for _, line := range strings.Split(strings.TrimRight(string(header), linesep), linesep) {
+				if fields := strings.SplitN(line, ": ", 2); len(fields) == 2 && !volatile(fields[0]) {
+					current.fields[fields[0]] = fields[1]
+					current.keys = append(current.keys, fields[0])
+				}
+			}
+			if header.payload("Prop-content-length") != nil && nodeprops != nil {
+				copied := *nodeprops
+				current.props = &copied
+			}
+			current.hasText = header.hasContent()
+			last := revisions[len(revisions)-1]
+			last.nodes = append(last.nodes, current)
+			return []byte(header)
+		}
+		contenthook := func(content []byte) []byte {
+			if current != nil {
+				current.hash = md5.Sum(content)
+			}
+			return content
+		}
+		source.Report(nil, prophook, headerhook, contenthook)
+		return revisions
+	}
+	left, right := digest(filenames[0]), digest(filenames[1])
+
+	differences := 0
+	report := func(where string, msg string, args ...interface{}) {
+		fmt.Fprintf(out, "%s: %s\n", where, fmt.Sprintf(msg, args...))
+		differences++
+	}
+	diffProps := func(where string, a *Properties, b *Properties) {
+		keys := newOrderedStringSet()
+		for _, props := range []*Properties{a, b} {
+			if props != nil {
+				for _, key := range props.propkeys {
+					keys.Add(key)
+				}
+				for _, key := range props.propdelkeys {
+					keys.Add("-" + key)
+				}
+			}
+		}
+		lookup := func(props *Properties, key string) (string, bool) {
+			if props == nil {
+				return "", false
+			}
+			if strings.HasPrefix(key, "-") {
+				for _, deleted := range props.propdelkeys {
+					if "-"+deleted == key {
+						return "(deleted)", true
+					}
+				}
+				return "", false
+			}
+			value, ok := props.properties[key]
+			return value, ok
+		}
+		for _, key := range keys {
+			av, aok := lookup(a, key)
+			bv, bok := lookup(b, key)
+			name := strings.TrimPrefix(key, "-")
+			switch {
+			case aok && !bok:
+				report(where, "property %s only in first dump", name)
+			case !aok && bok:
+				report(where, "property %s only in second dump", name)
+			case av != bv:
+				report(where, "property %s differs: %q vs. %q", name, av, bv)
+			}
+		}
+	}
+	// Revisions are paired by number, so a dropped revision is reported
+	// once rather than throwing off the comparison of everything after it.
+	for i, j := 0, 0; i < len(left) || j < len(right); {
+		if j >= len(right) || (i < len(left) && left[i].rev < right[j].rev) {
+			report(fmt.Sprintf("r%d", left[i].rev), "revision only in first dump")
+			i++
+			continue
+		}
+		if i >= len(left) || right[j].rev < left[i].rev {
+			report(fmt.Sprintf("r%d", right[j].rev), "revision only in second dump")
+			j++
+			continue
+		}
+		a, b := left[i], right[j]
+		i++
+		j++
+		where := fmt.Sprintf("r%d", a.rev)
+		diffProps(where, &a.props, &b.props)
+		for j := 0; j < len(a.nodes) || j < len(b.nodes); j++ {
+			where := fmt.Sprintf("r%d.%d", a.rev, j+1)
+			if j >= len(a.nodes) {
+				report(where, "node %s only in second dump", b.nodes[j].fields["Node-path"])
+				continue
+			}
+			if j >= len(b.nodes) {
+				report(where, "node %s only in first dump", a.nodes[j].fields["Node-path"])
+				continue
+			}
+			an, bn := a.nodes[j], b.nodes[j]
+			keys := newOrderedStringSet(an.keys...)
+			for _, key := range bn.keys {
+				keys.Add(key)
+			}
+			for _, key := range keys {
+				av, aok := an.fields[key]
+				bv, bok := bn.fields[key]
+				switch {
+				case aok && !bok:
+					report(where, "%s only in first dump", key)
+				case !aok && bok:
+					report(where, "%s only in second dump", key)
+				case av != bv:
+					report(where, "%s differs: %s vs. %s", key, av, bv)
+				}
+			}
+			diffProps(where, an.props, bn.props)
+			if an.hasText != bn.hasText || an.hash != bn.hash {
+				report(where, "content differs")
+			}
+		}
+	}
+	return differences
+}
+
+// Dissolve a branch by moving its history onto another directory.
+func debranch(source DumpfileSource, selection SubversionRange, branch string, target string) {
+	branch, target = strings.Trim(branch, "/"), strings.Trim(target, "/")
+	if branch == "" || target == "" || branch == target {
+		croakUsage("debranch needs distinct branch and target directories")
+	}
+	within := func(path string, dir string) bool {
+		return path == dir || strings.HasPrefix(path, dir+"/")
+	}
+	mutator := func(hd string, path []byte) []byte {
+		if within(string(path), branch) {
+			return []byte(target + string(path)[len(branch):])
+		}
+		return path
+	}
+	// Whether the target exists, and when anything under it last changed.
+	exists, touched := false, 0
+	prophook := func(props *Properties) {
+		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+			trimmed := strings.TrimPrefix(path, "/")
+			return path[:len(path)-len(trimmed)] + string(mutator("Mergeinfo", []byte(trimmed))), revrange
+		})
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Index == 0 {
+			return []byte(header)
+		}
+		if selection.ContainsNode(source.Revision, source.Index) {
+			for _, htype := range []string{"Node-path", "Node-copyfrom-path"} {
+				header, _, _ = header.replaceHook(htype, mutator)
+			}
+		}
+		path := string(header.payload("Node-path"))
+		action := string(header.payload("Node-action"))
+		if path == target && action == "add" && header.payload("Node-copyfrom-path") != nil && exists {
+			// The copy that made the branch lands on the target
+			// itself. A copy of the target is a no-op, provided
+			// nothing has changed there since; anything else
+			// replaces it.
+			fromrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+			if string(header.payload("Node-copyfrom-path")) == target {
+				if touched > fromrev {
+					announce("r%d: %s changed after r%d, which the branch was copied from", source.Revision, target, fromrev)
+				}
+				if !header.hasProperties() {
+					return nil
+				}
+				header, _, _ = header.replaceHook("Node-action", func(hd string, in []byte) []byte {
+					return []byte("change")
+				})
+				header = header.delete("Node-copyfrom-rev:")
+				header = header.delete("Node-copyfrom-path:")
+			} else {
+				header, _, _ = header.replaceHook("Node-action", func(hd string, in []byte) []byte {
+					return []byte("replace")
+				})
+			}
+		}
+		// Both the target and the branch may have been deleted.
+		if path == target && action == "delete" && !exists {
+			return nil
+		}
+		if within(path, target) {
+			touched = source.Revision
+		}
+		if within(target, path) {
+			// A copy of a parent is assumed to bring the target with it.
+			created := path == target || header.payload("Node-copyfrom-path") != nil
+			switch action {
+			case "delete":
+				exists = false
+			case "add":
+				exists = exists || created
+			case "replace":
+				exists = created
+			}
+		}
+		return []byte(header)
+	}
+	source.Report(nil, prophook, headerhook, nil)
+}
+
+// Report groups of identical blobs.
+func dedup(source DumpfileSource, selection SubversionRange) {
+	out := source.Out
+	type blobGroup struct {
+		sum    string
+		size   int
+		places []string
+	}
+	groups := make(map[string]*blobGroup)
+	order := make([]*blobGroup, 0)
+	contenthook := func(content []byte) []byte {
+		if source.Index == 0 || !selection.ContainsNode(source.Revision, source.Index) || len(content) == 0 {
+			return content
+		}
+		sum := fmt.Sprintf("%x", md5.Sum(content))
+		group, ok := groups[sum]
+		if !ok {
+			group = &blobGroup{sum: sum, size: len(content)}
+			groups[sum] = group
+			order = append(order, group)
+		}
+		group.places = append(group.places, fmt.Sprintf("%d:%s", source.Revision, source.NodePath))
+		return content
+	}
+	source.Out = io.Discard
+	source.Report(nil, nil, nil, contenthook)
+
+	duplicates := make([]*blobGroup, 0)
+	for _, group := range order {
+		if len(group.places) > 1 {
+			duplicates = append(duplicates, group)
+		}
+	}
+	wasted := func(group *blobGroup) int {
+		return group.size * (len(group.places) - 1)
+	}
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return wasted(duplicates[i]) > wasted(duplicates[j])
+	})
+	total := 0
+	for _, group := range duplicates {
+		fmt.Fprintf(out, "%s %d bytes x %d, %d wasted\n", group.sum, group.size, len(group.places), wasted(group))
+		for _, place := range group.places {
+			fmt.Fprintf(out, "  %s\n", place)
+		}
+		total += wasted(group)
+	}
+	fmt.Fprintf(out, "%d bytes wasted in %d groups\n", total, len(duplicates))
+}
+
+// Collapse expanded RCS and Subversion keywords.
+func dekeyword(source DumpfileSource, selection SubversionRange, fixed bool, patterns []string) {
+	transformText(source, selection, fixed, patterns, func(content []byte) []byte {
+		return expandedKeyword.ReplaceAll(content, []byte("$$$1$$"))
+	})
+}
+
+// Select a portion of the dump file defined by a revision selection.
+func deselect(source DumpfileSource, selection SubversionRange) {
+	doSelect(source, selection, true)
+}
+
+// Drop revisions with no nodes, renumbering the rest.
+func emptydrop(source DumpfileSource, foldLogs bool) {
+	// Old numbers of the revisions kept, in order; the new number of
+	// each is its index.
+	kept := make([]int, 0)
+	// New number of the last kept revision at or below n.  The tree
+	// at a dropped revision is the same as there.
+	mapDown := func(n int) int {
+		return sort.SearchInts(kept, n+1) - 1
+	}
+	// New number of the first kept revision at or above n, or -1.
+	mapUp := func(n int) int {
+		if i := sort.SearchInts(kept, n); i < len(kept) {
+			return i
+		}
+		return -1
+	}
+	pending := make([]string, 0)
+	out := bufio.NewWriter(source.Out)
+	var stash []byte
+	var revprops Properties
+	// The revision header is held back until a node shows up.
+	emitted := false
+	trailer := []byte{}
+	emitRevision := func() {
+		if foldLogs && len(pending) > 0 {
+			logs := pending
+			if logentry := strings.TrimRight(revprops.properties["svn:log"], "\n"); logentry != "" {
+				logs = append(logs, logentry)
+			}
+			if !revprops.Contains("svn:log") {
+				revprops.propkeys = append(revprops.propkeys, "svn:log")
+			}
+			revprops.properties["svn:log"] = strings.Join(logs, "\n\n") + "\n"
+			pending = pending[:0]
+		}
+		properties := revprops.Stringer()
+		header := StreamSection(stash)
+		header, _, _ = header.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+			return []byte(strconv.Itoa(len(kept)))
+		})
+		header = StreamSection(SetLength("Prop-content", header, len(properties)))
+		header = StreamSection(SetLength("Content", header, len(properties)))
+		kept = append(kept, source.Revision)
+		out.Write(header)
+		out.WriteString(properties)
+		out.Write(trailer)
+		emitted = true
+	}
+	source.walk(Walker{
+		preamble: func(line []byte) {
+			out.Write(line)
+		},
+		revision: func(header []byte, props Properties) {
+			stash, revprops = header, props
+			emitted, trailer = false, []byte{}
+			if source.Revision == 0 {
+				emitRevision()
+			}
+		},
+		blank: func(line []byte) {
+			if emitted {
+				out.Write(line)
+			} else {
+				trailer = append(trailer, line...)
+			}
+		},
+		node: func(header StreamSection, props *Properties, content []byte) {
+			if !emitted {
+				emitRevision()
+			}
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+				oldnum, _ := strconv.Atoi(string(in))
+				return []byte(strconv.Itoa(mapDown(oldnum)))
+			})
+			if props != nil {
+				// A merged range keeps only the kept revisions within it.
+				props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+					span := parseMergeinfoRange(revrange)
+					intervals := span.intervals[:0]
+					for _, interval := range span.intervals {
+						lower, upper := mapUp(interval.Lower), mapDown(interval.Upper)
+						if lower == -1 || lower > upper {
+							continue
+						}
+						interval.Lower, interval.Upper = lower, upper
+						intervals = append(intervals, interval)
+					}
+					span.intervals = intervals
+					span.Optimize()
+					return path, span.dump()
+				})
+				properties := props.Stringer()
+				header = header.setLength("Prop-content", len(properties))
+				header = header.setLength("Content", len(properties)+len(content))
+				header = append(header, []byte(properties)...)
+			}
+			out.Write(header)
+			out.Write(content)
+		},
+		done: func() {
+			if !emitted && foldLogs {
+				if logentry := strings.TrimRight(revprops.properties["svn:log"], "\n"); logentry != "" {
+					pending = append(pending, logentry)
+				}
+			}
+		},
+	})
+	if len(pending) > 0 {
+		announce("%d log message(s) from trailing empty revisions had nowhere to go", len(pending))
+	}
+	if err := out.Flush(); err != nil {
+		croakIO("emptydrop write failed: %v", err)
+	}
+}
+
+// Normalize line endings in text content.
+func eol(source DumpfileSource, selection SubversionRange, fixed bool, style string, patterns []string) {
+	if style != "lf" && style != "crlf" {
+		croakUsage("eol style must be lf or crlf, not %q", style)
+	}
+	transformText(source, selection, fixed, patterns, func(content []byte) []byte {
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		content = bytes.ReplaceAll(content, []byte("\r"), []byte("\n"))
+		if style == "crlf" {
+			content = bytes.ReplaceAll(content, []byte("\n"), []byte("\r\n"))
+		}
+		return content
+	})
+}
+
+// Set or clear the executable property on files matching glob patterns.
+func execfix(source DumpfileSource, selection SubversionRange, patterns []string) {
+	const executable = "svn:executable"
+	set := make([]string, 0)
+	clear := make([]string, 0)
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			clear = append(clear, pattern[1:])
+		} else {
+			set = append(set, pattern)
+		}
+	}
+	for _, pattern := range append(set, clear...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			croakUsage("ill-formed path pattern %q", pattern)
+		}
+	}
+	// A glob containing a slash is matched against the whole path,
+	// otherwise against the last segment.
+	matches := func(globs []string, path string) bool {
+		for _, glob := range globs {
+			name := path
+			if !strings.Contains(glob, "/") {
+				name = filepath.Base(path)
+			}
+			if ok, _ := filepath.Match(glob, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	// Wanted state of the property: +1 set, -1 clear, 0 leave alone.
+	want := func(path string) int {
+		if !selection.ContainsNode(source.Revision, source.Index) || source.DirTracking[path] {
+			return 0
+		}
+		if matches(clear, path) {
+			return -1
+		}
+		if matches(set, path) {
+			return 1
+		}
+		return 0
+	}
+	selected := func(path string) bool {
+		return want(path) != 0
+	}
+	edit := func(props *Properties) {
+		if want(source.NodePath) == 1 {
+			if !props.Contains(executable) {
+				props.propkeys = append(props.propkeys, executable)
+			}
+			props.properties[executable] = "*"
+		} else {
+			props.Delete(executable)
+		}
+	}
+	source.apply(nodePropHooks(&source, selected, edit))
+}
+
+// nodePropHooks - the hooks that apply an edit to the properties of
+// every node for which selected is true.  Node properties are tracked
+// so that a node without a property section can be given the ones it
+// inherits, amended, when the edit would change them.
+func nodePropHooks(source *DumpfileSource, selected func(path string) bool, edit func(props *Properties)) Hooks {
+	// Inherited properties can't be known through a property delta.
+	expandDeltas = true
+	history := NewDeltaHistory()
+	prophook := func(props *Properties) {
+		if source.Index > 0 && selected(source.NodePath) {
+			edit(props)
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Revision == 0 {
+			return []byte(header)
+		}
+		path := source.NodePath
+		action := string(header.payload("Node-action"))
+		if action == "delete" || action == "replace" {
+			history.remove(path, source.Revision)
+			if action == "delete" {
+				return []byte(header)
+			}
+		}
+		if frompath := header.payload("Node-copyfrom-path"); frompath != nil {
+			fromrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+			if header.isDir(*source) {
+				history.copyTree(string(frompath), fromrev, path, source.Revision)
+			} else if props := history.lookupProps(string(frompath), fromrev); props != nil {
+				history.recordProps(path, source.Revision, props)
+			}
+		}
+		if header.payload("Prop-content-length") != nil {
+			props := make(map[string]string)
+			for _, key := range source.NodeProps.propkeys {
+				props[key] = source.NodeProps.properties[key]
+			}
+			history.recordProps(path, source.Revision, props)
+			return []byte(header)
+		}
+		// No property section, so the node keeps what it had or
+		// inherited. Supply a section if the edit changes that.
+		if !selected(path) {
+			return []byte(header)
+		}
+		var props Properties
+		props.properties = make(map[string]string)
+		for key, value := range history.lookupProps(path, source.Revision) {
+			props.properties[key] = value
+			props.propkeys = append(props.propkeys, key)
+		}
+		sort.Strings(props.propkeys)
+		before := props.Stringer()
+		edit(&props)
+		properties := props.Stringer()
+		if properties == before {
+			return []byte(header)
+		}
+		history.recordProps(path, source.Revision, props.properties)
+		if offs := header.index("Text-content-length:"); offs != -1 {
+			line := fmt.Sprintf("Prop-content-length: %d\n", len(properties))
+			header = StreamSection(append(header[:offs:offs], append([]byte(line), header[offs:]...)...))
+		} else {
+			header = StreamSection(header.setLength("Prop-content", len(properties)))
+		}
+		textlen := 0
+		if cl := textContentLength.FindSubmatch(header); len(cl) > 1 {
+			textlen, _ = strconv.Atoi(string(cl[1]))
+		}
+		header = StreamSection(header.setLength("Content", len(properties)+textlen))
+		return append([]byte(header), properties...)
+	}
+	return Hooks{prophook: prophook, headerhook: headerhook}
+}
+
+// Convert a linear dump to a git fast-import stream.
+func exportGit(source DumpfileSource, selection SubversionRange, branch string) {
+	// Tracking content from the start means copies can be turned into
+	// explicit file modifications.
+	source.Deltas = NewDeltaHistory()
+	out := bufio.NewWriter(source.Out)
+	source.Out = io.Discard
+	defer out.Flush()
+	quote := func(path string) string {
+		if strings.HasPrefix(path, `"`) || strings.ContainsAny(path, "\n") {
+			return strconv.Quote(path)
+		}
+		return path
+	}
+	marks := 0
+	blobs := make(map[[md5.Size]byte]int)
+	blob := func(content []byte) int {
+		sum := md5.Sum(content)
+		if mark, ok := blobs[sum]; ok {
+			return mark
+		}
+		marks++
+		blobs[sum] = marks
+		fmt.Fprintf(out, "blob\nmark :%d\ndata %d\n", marks, len(content))
+		out.Write(content)
+		out.WriteString("\n")
+		return marks
+	}
+	var revprops Properties
+	ops := make([]string, 0)
+	// A path modified more than once in a revision, as by a
+	// directory copy and then a change to a file in it, keeps only
+	// its final content.
+	modified := make(map[string]int)
+	modify := func(path string, rev int) {
+		content, _ := source.Deltas.lookup(path, rev)
+		props := source.Deltas.lookupProps(path, rev)
+		mode := "100644"
+		if _, ok := props["svn:special"]; ok && bytes.HasPrefix(content, []byte("link ")) {
+			mode = "120000"
+			content = content[5:]
+		} else if _, ok := props["svn:executable"]; ok {
+			mode = "100755"
+		}
+		op := fmt.Sprintf("M %s :%d %s\n", mode, blob(content), quote(path))
+		if i, ok := modified[path]; ok {
+			ops[i] = op
+		} else {
+			modified[path] = len(ops)
+			ops = append(ops, op)
+		}
+	}
+
+	parent := 0
+	commit := func(rev int) {
+		defer func() {
+			ops = ops[:0]
+			modified = make(map[string]int)
+		}()
+		if rev == 0 || len(ops) == 0 {
+			return
+		}
+		when := int64(0)
+		if date, err := time.Parse(time.RFC3339Nano, revprops.properties["svn:date"]); err == nil {
+			when = date.Unix()
+		}
+		author, ok := revprops.properties["svn:author"]
+		if !ok {
+			author = "no-author"
+		}
+		msg := revprops.properties["svn:log"]
+		if !strings.HasSuffix(msg, "\n") {
+			msg += "\n"
+		}
+		marks++
+		fmt.Fprintf(out, "commit refs/heads/%s\nmark :%d\ncommitter %s <%s> %d +0000\ndata %d\n%s",
+			branch, marks, author, author, when, len(msg), msg)
+		if parent > 0 {
+			fmt.Fprintf(out, "from :%d\n", parent)
+		}
+		for _, op := range ops {
+			out.WriteString(op)
+		}
+		out.WriteString("\n")
+		parent = marks
+	}
+	current := 0
+	prophook := func(props *Properties) {
+		if source.Index == 0 {
+			commit(current)
+			current = source.Revision
+			revprops = *props
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		rev := source.Revision
+		if rev == 0 || !selection.ContainsNode(rev, source.Index) {
+			return header
+		}
+		path := string(header.payload("Node-path"))
+		action := string(header.payload("Node-action"))
+		if action == "delete" || action == "replace" {
+			ops = append(ops, fmt.Sprintf("D %s\n", quote(path)))
+			for p := range modified {
+				if p == path || strings.HasPrefix(p, path+"/") {
+					delete(modified, p)
+				}
+			}
+		}
+		if action == "delete" {
+			return header
+		}
+		if !header.isDir(source) {
+			modify(path, rev)
+			return header
+		}
+		// A directory copy brings in everything beneath it.
+		if header.payload("Node-copyfrom-path") != nil {
+			below := make([]string, 0)
+			for p := range source.Deltas.paths {
+				if _, ok := source.Deltas.lookup(p, rev); ok && strings.HasPrefix(p, path+"/") {
+					below = append(below, p)
+				}
+			}
+			sort.Strings(below)
+			for _, p := range below {
+				modify(p, rev)
+			}
+		}
+		return header
+	}
+	source.Report(nil, prophook, headerhook, nil)
+	commit(current)
+}
+
+// Drop or retain ops defined by a revision selection and a path regexp.
+func expungesift(source DumpfileSource, selection SubversionRange, expunge bool, fixed bool, kinds []string, actions []string, patterns []string) {
+	if source.isFastImport() {
+		if len(kinds) > 0 || len(actions) > 0 {
+			croakUsage("kind and action filters do not apply to fast-import streams")
+		}
+		fastImportExpungeSift(NewFastImportSource(source), selection, expunge, fixed, patterns)
+		return
+	}
+	source.apply(expungesiftHooks(&source, selection, expunge, fixed, kinds, actions, patterns))
+}
+
+// expungesiftHooks - the hooks that drop or retain nodes by path
+func expungesiftHooks(source *DumpfileSource, selection SubversionRange, expunge bool, fixed bool, kinds []string, actions []string, patterns []string) Hooks {
+	matcher := NewSegmentMatcher(patterns, fixed)
+	// Kind and action filters narrow which nodes the patterns act on;
+	// with no patterns they act on every node.
+	filtering := len(kinds) > 0 || len(actions) > 0
+	contains := func(list []string, s string) bool {
+		for _, item := range list {
+			if item == s {
+				return true
+			}
+		}
+		return false
+	}
+	headerhook := func(header StreamSection) []byte {
+		if !selection.ContainsNode(source.Revision, source.Index) || source.Revision == 0 {
+			return []byte(header)
+		}
+		if filtering {
+			kind := "file"
+			if header.isDir(*source) {
+				kind = "dir"
+			}
+			if (len(kinds) > 0 && !contains(kinds, kind)) || (len(actions) > 0 && !contains(actions, string(header.payload("Node-action")))) {
+				if expunge {
+					return []byte(header)
+				}
+				return nil
+			}
+			if len(patterns) == 0 {
+				if expunge {
+					return nil
+				}
+				return []byte(header)
+			}
+		}
+		matched := !expunge
+		for _, hd := range []string{"Node-path", "Node-copyfrom-path"} {
+			nodepath := header.payload(hd)
+			if debug >= debugLOGIC {
+				fmt.Fprintf(os.Stderr, "<%s: %s is %q>\n", source.where(), hd, nodepath)
+			}
+			if nodepath != nil {
+				if expunge {
+					matched = matched || matcher.pathmatch(string(nodepath))
+				} else {
+					matched = matched && matcher.pathmatch(string(nodepath))
+				}
+			}
+		}
+		if matched != expunge {
+			return []byte(header)
+		}
+		return nil
+	}
+	prophook := func(props *Properties) {
+		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+			// Paths only partly filtered keep their mergeinfo.
+			if !filtering && matcher.pathmatch(path) == expunge {
+				return "", ""
+			}
+			revrange = source.patchMergeinfo(revrange)
+			return path, revrange
+		})
+	}
+	return Hooks{prophook: prophook, headerhook: headerhook}
+}
+
+// externalsItem is one definition in an svn:externals property.
+type externalsItem struct {
+	dir      string
+	url      string
+	rev      string
+	peg      string
+	urlField int
+}
+
+// parseExternals - parse the lines of an svn:externals property, in either
+// the pre-1.5 DIR [-r N] URL form or the later [-r N] URL[@PEG] DIR form.
+// Returns one entry per line, nil for blank lines and comments.
+func parseExternals(value string) []*externalsItem {
+	isURL := func(field string) bool {
+		for _, prefix := range []string{"^/", "../", "/"} {
+			if strings.HasPrefix(field, prefix) {
+				return true
+			}
+		}
+		return strings.Contains(field, "://")
+	}
+	items := make([]*externalsItem, 0)
+	for _, line := range strings.Split(value, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			items = append(items, nil)
+			continue
+		}
+		item := new(externalsItem)
+		var revfields []string
+		last := len(fields) - 1
+		if isURL(fields[last]) && !isURL(fields[0]) {
+			item.dir, item.urlField = fields[0], last
+			revfields = fields[1:last]
+		} else {
+			item.dir, item.urlField = fields[last], -1
+			for i, field := range fields[:last] {
+				if isURL(field) {
+					item.urlField = i
+					break
+				}
+			}
+			if item.urlField == -1 {
+				items = append(items, nil)
+				continue
+			}
+			revfields = fields[:item.urlField]
+		}
+		item.url = fields[item.urlField]
+		if at := strings.LastIndex(item.url, "@"); at != -1 && !strings.Contains(item.url[at:], "/") {
+			item.url, item.peg = item.url[:at], item.url[at+1:]
+		}
+		for i, field := range revfields {
+			if field == "-r" && i+1 < len(revfields) {
+				item.rev = revfields[i+1]
+			} else if strings.HasPrefix(field, "-r") {
+				item.rev = field[2:]
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// Report svn:externals definitions, or rewrite repository-relative ones.
+func externals(source DumpfileSource, selection SubversionRange, renames []string) {
+	out := source.Out
+	if len(renames) > 0 {
+		type rename struct {
+			from string
+			to   string
+		}
+		rewrites := make([]rename, 0)
+		for _, arg := range renames {
+			eq := strings.Index(arg, "=")
+			if eq == -1 {
+				croakUsage("externals rewrite %q is not of the form OLD=NEW", arg)
+			}
+			rewrites = append(rewrites, rename{strings.Trim(arg[:eq], "/"), strings.Trim(arg[eq+1:], "/")})
+		}
+		prophook := func(props *Properties) {
+			value, ok := props.properties["svn:externals"]
+			if !ok || source.Index == 0 || !selection.ContainsNode(source.Revision, source.Index) {
+				return
+			}
+			lines := strings.Split(value, "\n")
+			for i, item := range parseExternals(value) {
+				if item == nil || !strings.HasPrefix(item.url, "^/") {
+					continue
+				}
+				for _, r := range rewrites {
+					path := item.url[2:]
+					if path == r.from || strings.HasPrefix(path, r.from+"/") {
+						fields := strings.Fields(lines[i])
+						field := fields[item.urlField]
+						lines[i] = strings.Replace(lines[i], field, "^/"+r.to+field[2+len(r.from):], 1)
+						break
+					}
+				}
+			}
+			props.properties["svn:externals"] = strings.Join(lines, "\n")
+		}
+		source.Report(nil, prophook, nil, nil)
+		return
+	}
+
+	// A span of revisions over which a directory had one value of the property.
+	type span struct {
+		path  string
+		start int
+		end   int
+		value string
+	}
+	spans := make([]*span, 0)
+	open := make(map[string]*span)
+	covers := func(sp *span, rev int) bool {
+		return sp.start <= rev && (sp.end == -1 || rev <= sp.end)
+	}
+	closeSpans := func(dir string, rev int) {
+		for path, sp := range open {
+			if path == dir || strings.HasPrefix(path, dir+"/") {
+				sp.end = rev - 1
+				delete(open, path)
+			}
+		}
+	}
+	begin := func(path string, rev int, value string) {
+		sp := &span{path, rev, -1, value}
+		spans = append(spans, sp)
+		open[path] = sp
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Index == 0 {
+			return nil
+		}
+		rev, path := source.Revision, source.NodePath
+		action := string(header.payload("Node-action"))
+		if action == "delete" || action == "replace" {
+			closeSpans(path, rev)
+		}
+		if !header.isDir(source) {
+			return nil
+		}
+		if frompath := header.payload("Node-copyfrom-path"); frompath != nil {
+			fromrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+			from := string(frompath)
+			for _, sp := range spans[:len(spans):len(spans)] {
+				if (sp.path == from || strings.HasPrefix(sp.path, from+"/")) && covers(sp, fromrev) {
+					begin(path+sp.path[len(from):], rev, sp.value)
+				}
+			}
+		}
+		if header.payload("Prop-content-length") != nil {
+			value, ok := source.NodeProps.properties["svn:externals"]
+			if sp, present := open[path]; present && (!ok || sp.value != value) {
+				sp.end = rev - 1
+				delete(open, path)
+			}
+			if _, present := open[path]; ok && !present {
+				begin(path, rev, value)
+			}
+		}
+		return nil
+	}
+	source.Report(nil, nil, headerhook, nil)
+
+	sort.SliceStable(spans, func(i, j int) bool {
+		if spans[i].path != spans[j].path {
+			return spans[i].path < spans[j].path
+		}
+		return spans[i].start < spans[j].start
+	})
+	for _, sp := range spans {
+		if !selection.ContainsRevision(sp.start) {
+			continue
+		}
+		end := "HEAD"
+		if sp.end != -1 {
+			end = strconv.Itoa(sp.end)
+		}
+		fmt.Fprintf(out, "%s %d:%s\n", sp.path, sp.start, end)
+		for _, item := range parseExternals(sp.value) {
+			if item == nil {
+				continue
+			}
+			pin := "unpinned"
+			if item.rev != "" && item.peg != "" {
+				pin = "r" + item.rev + "@" + item.peg
+			} else if item.rev != "" {
+				pin = "r" + item.rev
+			} else if item.peg != "" {
+				pin = "@" + item.peg
+			}
+			fmt.Fprintf(out, "    %-20s %s %s\n", item.dir, item.url, pin)
+		}
+	}
+}
+
+// Replace file copy operations with explicit add/change operation
+func filecopy(source DumpfileSource, selection SubversionRange, byBasename bool, matchpaths []string) {
+	type trackCopy struct {
+		revision int
+		content  []byte
+	}
+	values := make(map[string][]trackCopy)
+	var replacement []byte
+	var nodePath string
+	headerhook := func(header StreamSection) []byte {
+		nodePath = source.NodePath
+		if debug >= debugLOGIC {
+			fmt.Fprintf(os.Stderr,
+				"<r%s: filecopy investigates this revision>\n",
+				source.where())
+		}
+		if _, ok := values[nodePath]; !ok {
+			values[nodePath] = make([]trackCopy, 0)
+		}
+		if byBasename {
+			if len(matchpaths) > 0 {
+				nodePath = matchpaths[0]
+			} else {
+				nodePath = filepath.Base(nodePath)
+			}
+		}
+		replacement = nil
+		// The logic here is a bit more complex than might seem necessary
+		// because for some inexplicable reason Subversion occasionally generates nodes
+		// which have copyfrom information *and* the copy already performed - that is,
+		// the node content is non-nil and should be used.  In that case we want to strip
+		// out the copyfrom information without modifyinmg the content.
+		if !selection.ContainsNode(source.Revision, source.Index) || source.Revision == 0 {
+			return []byte(header)
+		}
+		if copypath := header.payload("Node-copyfrom-path"); copypath != nil {
+			if byBasename {
+				copypath = []byte(filepath.Base(string(copypath)))
+			}
+			if debug >= debugLOGIC {
+				fmt.Fprintf(os.Stderr, "<r%s: filecopy investigates %s>\n",
+					source.where(), copypath)
+			}
+			if header.hasContent() {
+				header = header.delete("Node-copyfrom-path")
+				header = header.delete("Node-copyfrom-rev")
+				header = header.stripChecksums()
+			} else {
+				copyrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+				if sources, ok := values[string(copypath)]; ok {
+					for i := len(sources) - 1; i >= 0; i-- {
+						if sources[i].revision <= copyrev {
+							header = header.delete("Node-copyfrom-path")
+							header = header.delete("Node-copyfrom-rev")
+							header = header.stripChecksums()
+							replacement = sources[i].content
+							if debug >= debugLOGIC {
+								fmt.Fprintf(os.Stderr, "    <r%s replacement is '%q'>\n", source.where(), replacement)
+							}
+							break
+						}
+					}
+				} else if debug >= debugLOGIC {
+					fmt.Fprintf(os.Stderr, "  <no path match found>\n")
+				}
+			}
+		}
+		return []byte(header)
+	}
+	contenthook := func(content []byte) []byte {
+		if replacement != nil {
+			content = replacement
+			if debug >= debugLOGIC {
+				fmt.Fprintf(os.Stderr, "  <r%s replacing with %q>\n", source.where(), content)
+			}
+		}
+		if content != nil && len(content) > 0 {
+			trampoline := values[nodePath]
+			trampoline = append(trampoline, trackCopy{source.Revision, content})
+			values[nodePath] = trampoline
+			if debug >= debugLOGIC {
+				fmt.Fprintf(os.Stderr, "<r%s: for %s, stashed content %q>\n",
+					source.where(), nodePath, content)
+			}
+		}
+		return content
+	}
+
+	source.Report(nil, nil, headerhook, contenthook)
+}
+
+// Replace copies with explicit adds of the content they copy.
+func flatten(source DumpfileSource, selection SubversionRange, fixed bool, patterns []string) {
+	var matcher SegmentMatcher
+	if len(patterns) > 0 {
+		matcher = NewSegmentMatcher(patterns, fixed)
+	}
+	// Content and properties of every path are kept from the start;
+	// directories without properties are tracked with an empty set so
+	// the history knows they exist.
+	history := NewDeltaHistory()
+	out := bufio.NewWriter(source.Out)
+	propsText := func(props map[string]string) string {
+		var p Properties
+		p.properties = props
+		for key := range props {
+			p.propkeys = append(p.propkeys, key)
+		}
+		sort.Strings(p.propkeys)
+		return p.Stringer()
+	}
+	// An add of one path in its state as of the current revision.
+	// A nil content marks a directory.
+	nodeText := func(path string, action string, properties string, content []byte) []byte {
+		kind := "file"
+		if content == nil {
+			kind = "dir"
+		}
+		header := StreamSection(fmt.Sprintf("Node-path: %s\nNode-kind: %s\nNode-action: %s\nProp-content-length: %d\n",
+			path, kind, action, len(properties)))
+		if content != nil {
+			header = append(header, fmt.Sprintf("Text-content-length: %d\n", len(content))...)
+			header = header.setChecksums(content)
+		}
+		header = append(header, fmt.Sprintf("Content-length: %d\n\n", len(properties)+len(content))...)
+		return append(append(header, properties...), content...)
+	}
+	source.walk(Walker{
+		preamble: func(line []byte) {
+			out.Write(line)
+		},
+		revision: func(header []byte, props Properties) {
+			out.Write(header)
+			out.WriteString(props.Stringer())
+		},
+		blank: func(line []byte) {
+			out.Write(line)
+		},
+		node: func(header StreamSection, props *Properties, content []byte) {
+			rev := source.Revision
+			properties := ""
+			if props != nil {
+				properties = props.Stringer()
+			}
+
+			if _, err := history.expand(&source, header, content); err != nil {
+				croakParse("r%s: delta expansion failed: %v", source.where(), err)
+			}
+			history.expandProps(&source, header)
+			action := string(header.payload("Node-action"))
+			frompath := header.payload("Node-copyfrom-path")
+			if action == "add" || action == "replace" {
+				if header.isDir(source) {
+					if history.lookupProps(source.NodePath, rev) == nil {
+						history.recordProps(source.NodePath, rev, nil)
+					}
+				} else if _, ok := history.lookup(source.NodePath, rev); !ok {
+					history.record(source.NodePath, rev, []byte{})
+				}
+			}
+
+			if frompath == nil || !selection.ContainsNode(rev, source.Index) || (len(patterns) > 0 && !matcher.pathmatch(string(frompath))) {
+				out.Write(header)
+				out.WriteString(properties)
+				out.Write(content)
+				return
+			}
+			if debug >= debugLOGIC {
+				fmt.Fprintf(os.Stderr, "<r%s: flattening copy of %s>\n", source.where(), frompath)
+			}
+			// The copy node itself keeps its action and, if it
+			// set any, its own properties.
+			if header.payload("Prop-content-length") != nil {
+				properties = source.NodeProps.Stringer()
+			} else {
+				properties = propsText(history.lookupProps(source.NodePath, rev))
+			}
+			if !header.isDir(source) {
+				text, _ := history.lookup(source.NodePath, rev)
+				if text == nil {
+					text = []byte{}
+				}
+				out.Write(nodeText(source.NodePath, action, properties, text))
+				return
+			}
+			out.Write(nodeText(source.NodePath, action, properties, nil))
+			// Then everything beneath it, parents first.
+			below := make([]string, 0)
+			for p := range history.props {
+				if strings.HasPrefix(p, source.NodePath+"/") && history.lookupProps(p, rev) != nil {
+					below = append(below, p)
+				}
+			}
+			for p := range history.paths {
+				if _, ok := history.lookup(p, rev); ok && strings.HasPrefix(p, source.NodePath+"/") && history.lookupProps(p, rev) == nil {
+					below = append(below, p)
+				}
+			}
+			sort.Strings(below)
+			for _, p := range below {
+				var text []byte
+				if t, ok := history.lookup(p, rev); ok {
+					text = t
+					if text == nil {
+						text = []byte{}
+					}
+				}
+				out.WriteString(linesep + linesep)
+				out.Write(nodeText(p, "add", propsText(history.lookupProps(p, rev)), text))
+			}
+		},
+	})
+	if err := out.Flush(); err != nil {
+		croakIO("flatten write failed: %v", err)
+	}
+}
+
+// Search file content across history for a regular expression.
+func grep(source DumpfileSource, selection SubversionRange, fixed bool, namesOnly bool, expr string, patterns []string) {
+	out := source.Out
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		croakUsage("ill-formed search expression: %v", err)
+	}
+	var matcher SegmentMatcher
+	if len(patterns) > 0 {
+		matcher = NewSegmentMatcher(patterns, fixed)
+	}
+	searching := false
+	headerhook := func(header StreamSection) []byte {
+		searching = selection.ContainsNode(source.Revision, source.Index) &&
+			(len(patterns) == 0 || matcher.pathmatch(source.NodePath))
+		return []byte(header)
+	}
+	contenthook := func(content []byte) []byte {
+		if !searching || len(content) == 0 {
+			return content
+		}
+		// Like grep, don't print lines of binary content.
+		if namesOnly || bytes.IndexByte(content, 0) != -1 {
+			if re.Match(content) {
+				fmt.Fprintf(out, "%d:%s\n", source.Revision, source.NodePath)
+			}
+			return content
+		}
+		for _, line := range bytes.SplitAfter(content, []byte(linesep)) {
+			line = bytes.TrimSuffix(line, []byte(linesep))
+			if re.Match(line) {
+				fmt.Fprintf(out, "%d:%s:%s\n", source.Revision, source.NodePath, line)
+			}
+		}
+		return content
+	}
+	source.Out = io.Discard
+	source.Report(nil, nil, headerhook, contenthook)
+}
+
+// Splice the revisions in a side file into a dump after a given revision.
+func inject(source DumpfileSource, after int, filename string) {
+	fp, err := os.Open(filename)
+	if err != nil {
+		croakIO("inject could not open %s: %v", filename, err)
+	}
+	// Renumber the injected revisions to follow the insertion point.
+	side := NewDumpfileSource(decompress(fp), nil)
+	side.skipPreamble()
+	var injected bytes.Buffer
+	side.Out = &injected
+	count := 0
+	side.Report(func(header StreamSection) []byte {
+		newhdr, _, _ := header.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+			count++
+			return []byte(strconv.Itoa(after + count))
+		})
+		return newhdr
+	}, nil, nil, nil)
+	fp.Close()
+	if count == 0 {
+		croakParse("inject found no revisions in %s", filename)
+	}
+
+	shift := func(n int) int {
+		if n > after {
+			return n + count
+		}
+		return n
+	}
+	pending := false
+	emit := func() {
+		source.Out.Write(injected.Bytes())
+		for i := 1; i <= count; i++ {
+			source.EmittedRevisions[strconv.Itoa(after+i)] = true
+		}
+		pending = false
+	}
+	revhook := func(header StreamSection) []byte {
+		newhdr, _, _ := header.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+			oldnum, _ := strconv.Atoi(string(in))
+			if oldnum == after+1 {
+				pending = true
+			}
+			return []byte(strconv.Itoa(shift(oldnum)))
+		})
+		return newhdr
+	}
+	prophook := func(props *Properties) {
+		// The revision properties of the first revision after the
+		// insertion point are read only when everything before it
+		// has been written, so the injected revisions go out here.
+		if source.Index == 0 && pending {
+			emit()
+		}
+		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+			span := parseMergeinfoRange(revrange)
+			for i := range span.intervals {
+				span.intervals[i].Lower = shift(span.intervals[i].Lower)
+				span.intervals[i].Upper = shift(span.intervals[i].Upper)
+			}
+			return path, span.dump()
+		})
+	}
+	headerhook := func(header StreamSection) []byte {
+		header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+			oldnum, _ := strconv.Atoi(string(in))
+			return []byte(strconv.Itoa(shift(oldnum)))
+		})
+		return []byte(header)
+	}
+	source.Report(revhook, prophook, headerhook, nil)
+	if source.Revision < after {
+		croakUsage("inject point %d is past the end of the dump", after)
+	}
+	if source.Revision == after {
+		emit()
+	}
+}
+
+// Concatenate dumps into one stream, renumbering and optionally prefixing paths.
+func join(sources []string, counter int, baton *Baton, out io.Writer) {
+	if len(sources) == 0 {
+		croakUsage("join requires at least one dump file")
+	}
+	for i, spec := range sources {
+		var project string
+		filename := spec
+		if eq := strings.Index(spec, "="); eq != -1 {
+			project, filename = strings.Trim(spec[:eq], "/"), spec[eq+1:]
+		}
+		fp := os.Stdin
+		if filename != "-" {
+			var err error
+			if fp, err = os.Open(filename); err != nil {
+				croakIO("join could not open %s: %v", filename, err)
+			}
+		}
+		source := NewDumpfileSource(decompress(fp), baton)
+		source.Out = out
+		// Only the first dump contributes its preamble and revision 0.
+		if i > 0 {
+			source.skipPreamble()
+		}
+
+		renumbering := make(map[int]int)
+		renumberBack := func(n int) int {
+			if v, ok := renumbering[n]; ok {
+				return v
+			}
+			m := 0
+			for r := range renumbering {
+				if r <= n && r > m {
+					m = r
+				}
+			}
+			return renumbering[m]
+		}
+		prefix := func(path []byte) []byte {
+			if project == "" {
+				return path
+			}
+			if len(path) == 0 {
+				return []byte(project)
+			}
+			return []byte(project + "/" + string(path))
+		}
+		created := project == ""
+
+		revhook := func(header StreamSection) []byte {
+			newhdr, _, _ := header.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+				oldnum, _ := strconv.Atoi(string(in))
+				renumbering[oldnum] = counter
+				counter++
+				return []byte(strconv.Itoa(renumbering[oldnum]))
+			})
+			return newhdr
+		}
+		prophook := func(props *Properties) {
+			props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+				span := parseMergeinfoRange(revrange)
+				for i := range span.intervals {
+					span.intervals[i].Lower = renumberBack(span.intervals[i].Lower)
+					span.intervals[i].Upper = renumberBack(span.intervals[i].Upper)
+				}
+				span.Optimize()
+				return string(prefix([]byte(path))), span.dump()
+			})
+		}
+		headerhook := func(header StreamSection) []byte {
+			// Suppress the preamble of all dumps after the first,
+			// but without turning off passthrough.
+			if source.Revision == 0 && source.Index == 0 {
+				if i > 0 {
+					return []byte{}
+				}
+				return []byte(header)
+			}
+			// A dump whose root node already stands for the project
+			// directory (as pop leaves behind) needs no extra add.
+			mkdir := !created && len(header.payload("Node-path")) > 0
+			created = true
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+				oldnum, _ := strconv.Atoi(string(in))
+				return []byte(strconv.Itoa(renumberBack(oldnum)))
+			})
+			for _, htype := range []string{"Node-path", "Node-copyfrom-path"} {
+				header, _, _ = header.replaceHook(htype, func(hd string, in []byte) []byte {
+					return prefix(in)
+				})
+			}
+			if mkdir {
+				node := fmt.Sprintf("Node-path: %s\nNode-kind: dir\nNode-action: add\nProp-content-length: 10\nContent-length: 10\n\nPROPS-END\n\n\n", project)
+				return append([]byte(node), header...)
+			}
+			return []byte(header)
+		}
+		source.Report(revhook, prophook, headerhook, nil)
+		fp.Close()
+	}
+}
+
+// Repair mismatches between symlink content and the svn:special property.
+func linkfix(source DumpfileSource, selection SubversionRange, reportOnly bool) {
+	const special = "svn:special"
+	history := NewDeltaHistory()
+	out := bufio.NewWriter(source.Out)
+	// A symlink body is "link TARGET" on one line with no newline.
+	target := func(content []byte) bool {
+		return len(content) > 0 && !bytes.ContainsAny(content, "\n\r\x00")
+	}
+	source.walk(Walker{
+		preamble: func(line []byte) {
+			if !reportOnly {
+				out.Write(line)
+			}
+		},
+		revision: func(header []byte, props Properties) {
+			if !reportOnly {
+				out.Write(header)
+				out.WriteString(props.Stringer())
+			}
+		},
+		blank: func(line []byte) {
+			if !reportOnly {
+				out.Write(line)
+			}
+		},
+		node: func(header StreamSection, nodeprops *Properties, content []byte) {
+			rev := source.Revision
+			properties := ""
+			if nodeprops != nil {
+				properties = nodeprops.Stringer()
+			}
+			fulltext, err := history.expand(&source, header, content)
+			if err != nil {
+				croakParse("r%s: delta expansion failed: %v", source.where(), err)
+			}
+			history.expandProps(&source, header)
+
+			// Only file nodes that set text or properties can
+			// introduce a mismatch; copies inherit their source's
+			// state, which has already been checked.
+			touched := header.hasContent() || header.payload("Prop-content-length") != nil
+			if header.isDir(source) || !touched || !selection.ContainsNode(rev, source.Index) {
+				if !reportOnly {
+					out.Write(header)
+					out.WriteString(properties)
+					out.Write(content)
+				}
+				return
+			}
+			text, _ := history.lookup(source.NodePath, rev)
+			props := history.lookupProps(source.NodePath, rev)
+			_, isSpecial := props[special]
+			isLink := bytes.HasPrefix(text, []byte("link ")) && target(text[5:])
+			var problem string
+			newtext, newprops := text, props
+			switch {
+			case isLink && !isSpecial:
+				problem = "symlink content without svn:special"
+				newprops = make(map[string]string)
+				for key, value := range props {
+					newprops[key] = value
+				}
+				newprops[special] = "*"
+			case isSpecial && !bytes.HasPrefix(text, []byte("link ")) && target(text):
+				problem = "svn:special on a bare link target"
+				newtext = append([]byte("link "), text...)
+			case isSpecial && !isLink:
+				problem = "svn:special on content that is not a symlink"
+				newprops = make(map[string]string)
+				for key, value := range props {
+					if key != special {
+						newprops[key] = value
+					}
+				}
+			}
+			if problem == "" {
+				if !reportOnly {
+					out.Write(header)
+					out.WriteString(properties)
+					out.Write(content)
+				}
+				return
+			}
+			// Later nodes see the repaired state, so a report lists
+			// exactly what a repair would change.
+			history.record(source.NodePath, rev, newtext)
+			history.recordProps(source.NodePath, rev, newprops)
+			if reportOnly {
+				fmt.Fprintf(out, "r%s %s: %s\n", source.where(), source.NodePath, problem)
+				return
+			}
+			announce("r%s %s: fixed %s", source.where(), source.NodePath, problem)
+			// Rewrite the node with full properties and text so the
+			// repaired state stands on its own.
+			var p Properties
+			p.properties = newprops
+			for key := range newprops {
+				p.propkeys = append(p.propkeys, key)
+			}
+			sort.Strings(p.propkeys)
+			properties = p.Stringer()
+			header = header.delete("Prop-delta:")
+			header = header.delete("Text-copy-source-md5:")
+			header = header.delete("Text-copy-source-sha1:")
+			if header.payload("Text-delta") != nil {
+				header = header.fullText(0, len(fulltext))
+			}
+			header = header.stripChecksums()
+			if header.payload("Prop-content-length") == nil {
+				offs := header.index("Text-content-length:")
+				if offs == -1 {
+					offs = header.index("Content-length:")
+				}
+				if offs == -1 {
+					offs = len(header) - 1
+				}
+				line := fmt.Sprintf("Prop-content-length: %d\n", len(properties))
+				header = StreamSection(append(header[:offs:offs], append([]byte(line), header[offs:]...)...))
+			}
+			header = StreamSection(header.setLength("Prop-content", len(properties)))
+			if header.payload("Text-content-length") == nil {
+				offs := header.index("Content-length:")
+				if offs == -1 {
+					offs = len(header) - 1
+				}
+				line := fmt.Sprintf("Text-content-length: %d\n", len(newtext))
+				header = StreamSection(append(header[:offs:offs], append([]byte(line), header[offs:]...)...))
+			}
+			header = StreamSection(header.setLength("Text-content", len(newtext)))
+			header = StreamSection(header.setLength("Content", len(properties)+len(newtext)))
+			header = header.setChecksums(newtext)
+			out.Write(header)
+			out.WriteString(properties)
+			out.Write(newtext)
+		},
+	})
+	if err := out.Flush(); err != nil {
+		croakIO("linkfix write failed: %v", err)
+	}
+}
+
+// Check the structural integrity of a dump, reporting one problem per line.
+func lint(source DumpfileSource) int {
+	out := source.Out
+	lbs := &source.Lbs
+	problems := 0
+	var recordStart int
+	complain := func(msg string, args ...interface{}) {
+		fmt.Fprintf(out, "r%d at byte %d: %s\n", source.Revision, recordStart, fmt.Sprintf(msg, args...))
+		problems++
+	}
+	// Read a block of RFC-2822-style headers, up to a blank line.
+	readHeaders := func() (StreamSection, bool) {
+		header := []byte{}
+		for {
+			line := lbs.Readline()
+			if len(line) == 0 {
+				complain("unexpected EOF in header")
+				return nil, false
+			}
+			if string(line) == linesep {
+				return header, true
+			}
+			if !bytes.Contains(line, []byte(": ")) {
+				complain("malformed header line %q", line)
+			}
+			header = append(header, line...)
+		}
+	}
+	length := func(header StreamSection, htype string) int {
+		payload := header.payload(htype)
+		if payload == nil {
+			return -1
+		}
+		n, err := strconv.Atoi(string(payload))
+		if err != nil || n < 0 {
+			complain("invalid %s %q", htype, payload)
+			return -1
+		}
+		return n
+	}
+	// Check the syntax of a property section.
+	checkProps := func(block []byte) string {
+		pos := 0
+		field := func(prefix string) (int, bool) {
+			end := bytes.IndexByte(block[pos:], '\n')
+			if end == -1 || !bytes.HasPrefix(block[pos:], []byte(prefix)) {
+				return 0, false
+			}
+			n, err := strconv.Atoi(string(block[pos+len(prefix) : pos+end]))
+			pos += end + 1
+			return n, err == nil
+		}
+		value := func(n int) bool {
+			if pos+n+1 > len(block) || block[pos+n] != '\n' {
+				return false
+			}
+			pos += n + 1
+			return true
+		}
+		for pos < len(block) {
+			if bytes.Equal(block[pos:], []byte("PROPS-END\n")) {
+				return ""
+			}
+			isDelete := bytes.HasPrefix(block[pos:], []byte("D "))
+			prefix := "K "
+			if isDelete {
+				prefix = "D "
+			}
+			n, ok := field(prefix)
+			if !ok || !value(n) {
+				return fmt.Sprintf("malformed property key at offset %d of property block", pos)
+			}
+			if isDelete {
+				continue
+			}
+			if n, ok = field("V "); !ok || !value(n) {
+				return fmt.Sprintf("malformed property value at offset %d of property block", pos)
+			}
+		}
+		return "property block does not end with PROPS-END"
+	}
+	// Skip to the next record header after a problem that loses sync.
+	resync := func() {
+		for {
+			line := lbs.Readline()
+			if len(line) == 0 {
+				return
+			}
+			if bytes.HasPrefix(line, []byte("Revision-number: ")) || bytes.HasPrefix(line, []byte("Node-path: ")) {
+				lbs.Push(line)
+				return
+			}
+		}
+	}
+
+	if line := lbs.Readline(); !bytes.HasPrefix(line, []byte("SVN-fs-dump-format-version: ")) {
+		complain("missing SVN-fs-dump-format-version header")
+		lbs.Push(line)
+	}
+	emitted := make(map[int]bool)
+	for {
+		recordStart = lbs.Tell()
+		line := lbs.Readline()
+		if len(line) == 0 {
+			break
+		}
+		// Before the first revision, allow the UUID header and the
+		// description comments used in the reposurgeon test suite.
+		if string(line) == linesep || (len(emitted) == 0 && (bytes.HasPrefix(line, []byte("UUID: ")) || bytes.HasPrefix(bytes.TrimLeft(line, " "), []byte("#")))) {
+			continue
+		}
+		// Subversion doesn't guarantee that Node-path comes first.
+		isRevision := bytes.HasPrefix(line, []byte("Revision-number: "))
+		if !isRevision && !bytes.HasPrefix(line, []byte("Node-")) {
+			complain("unexpected data %q where a record was expected", line)
+			resync()
+			continue
+		}
+		lbs.Push(line)
+		header, ok := readHeaders()
+		if !ok {
+			break
+		}
+		if isRevision {
+			rev, err := strconv.Atoi(string(header.payload("Revision-number")))
+			if err != nil {
+				complain("invalid Revision-number %q", header.payload("Revision-number"))
+			} else {
+				if len(emitted) > 0 && rev <= source.Revision {
+					source.Revision = rev
+					complain("revision number does not increase")
+				}
+				source.Revision = rev
+				emitted[rev] = true
+			}
+			source.Index = 0
+		} else {
+			if len(emitted) == 0 {
+				complain("node before first revision")
+			}
+			source.Index++
+			if header.payload("Node-path") == nil {
+				complain("node has no Node-path")
+			}
+			if header.payload("Node-action") == nil {
+				complain("node %s has no Node-action", header.payload("Node-path"))
+			}
+			copyrev, copypath := header.payload("Node-copyfrom-rev"), header.payload("Node-copyfrom-path")
+			if (copyrev == nil) != (copypath == nil) {
+				complain("node %s has only one of Node-copyfrom-rev and Node-copyfrom-path", header.payload("Node-path"))
+			} else if copyrev != nil {
+				if n, err := strconv.Atoi(string(copyrev)); err != nil || n >= source.Revision || !emitted[n] {
+					complain("node %s copies from r%s, which is not an earlier revision in the dump", header.payload("Node-path"), copyrev)
+				}
+			}
+		}
+
+		proplen := length(header, "Prop-content-length")
+		textlen := length(header, "Text-content-length")
+		contentlen := length(header, "Content-length")
+		if isRevision && textlen != -1 {
+			complain("revision record has a Text-content-length")
+		}
+		total := 0
+		if proplen > 0 {
+			total += proplen
+		}
+		if textlen > 0 {
+			total += textlen
+		}
+		if contentlen == -1 && total > 0 {
+			complain("missing Content-length")
+		} else if contentlen != -1 && contentlen != total {
+			complain("Content-length %d does not match Prop-content-length plus Text-content-length (%d)", contentlen, total)
+		}
+		if proplen > 0 {
+			block := lbs.Read(proplen)
+			if len(block) < proplen {
+				complain("unexpected EOF in property block")
+				break
+			}
+			if msg := checkProps(block); msg != "" {
+				complain("%s (is Prop-content-length %d right?)", msg, proplen)
+				resync()
+				continue
+			}
+		}
+		if textlen > 0 {
+			if text := lbs.Read(textlen); len(text) < textlen {
+				complain("unexpected EOF in text content")
+				break
+			}
+		}
+		// Content must be followed by a blank line, another record, or EOF.
+		if next := lbs.Peek(); len(next) > 0 && string(next) != linesep &&
+			!bytes.HasPrefix(next, []byte("Revision-number: ")) && !bytes.HasPrefix(next, []byte("Node-")) {
+			complain("unexpected data %q after record (are the length headers right?)", lbs.Flush())
+			resync()
+		}
+		if source.Baton != nil && isRevision {
+			source.Baton.Twirl("")
+		}
+	}
+	return problems
+}
+
+// List the tree as of a revision.
+func ls(source DumpfileSource, selection SubversionRange, paths []string) {
+	out := source.Out
+	type lsState struct {
+		rev     int
+		dir     bool
+		present bool
+	}
+	// Keeping the history of each path, not just its latest state,
+	// lets copies from older revisions be replayed.
+	history := make(map[string][]lsState)
+	lookup := func(path string, rev int) (lsState, bool) {
+		states := history[path]
+		for i := len(states) - 1; i >= 0; i-- {
+			if states[i].rev <= rev {
+				return states[i], states[i].present
+			}
+		}
+		return lsState{}, false
+	}
+	remove := func(path string, rev int) {
+		for p := range history {
+			if p == path || strings.HasPrefix(p, path+"/") {
+				if _, ok := lookup(p, rev); ok {
+					history[p] = append(history[p], lsState{rev: rev})
+				}
+			}
+		}
+	}
+	target := selection.Upperbound().rev
+	headerhook := func(header StreamSection) []byte {
+		if source.Revision == 0 || source.Revision > target {
+			return nil
+		}
+		path := string(header.payload("Node-path"))
+		action := string(header.payload("Node-action"))
+		if action == "delete" || action == "replace" {
+			remove(path, source.Revision)
+		}
+		if action != "add" && action != "replace" {
+			return nil
+		}
+		history[path] = append(history[path], lsState{source.Revision, header.isDir(source), true})
+		if frompath := header.payload("Node-copyfrom-path"); frompath != nil && header.isDir(source) {
+			fromrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+			from := string(frompath)
+			copies := make(map[string]bool)
+			for p := range history {
+				if strings.HasPrefix(p, from+"/") {
+					if state, ok := lookup(p, fromrev); ok {
+						copies[path+p[len(from):]] = state.dir
+					}
+				}
+			}
+			for p, dir := range copies {
+				history[p] = append(history[p], lsState{source.Revision, dir, true})
+			}
+		}
+		return nil
+	}
+	source.Report(nil, nil, headerhook, nil)
+
+	listing := make([]string, 0)
+	for p := range history {
+		state, ok := lookup(p, target)
+		if !ok {
+			continue
+		}
+		if len(paths) > 0 {
+			wanted := false
+			for _, prefix := range paths {
+				prefix = strings.Trim(prefix, "/")
+				if p == prefix || strings.HasPrefix(p, prefix+"/") {
+					wanted = true
+					break
+				}
+			}
+			if !wanted {
+				continue
+			}
+		}
+		if state.dir {
+			p += string(pathsep)
+		}
+		listing = append(listing, p)
+	}
+	sort.Strings(listing)
+	for _, p := range listing {
+		fmt.Fprintln(out, p)
+	}
+}
+
+// Report the last revision to change each path alive as of a revision.
+func lastchange(source DumpfileSource, selection SubversionRange, paths []string) {
+	out := source.Out
+	type lcState struct {
+		rev     int
+		dir     bool
+		present bool
+		changed int
+	}
+	// As in ls, the whole history of each path is kept so copies from
+	// older revisions can be replayed.
+	history := make(map[string][]lcState)
+	lookup := func(path string, rev int) (lcState, bool) {
+		states := history[path]
+		for i := len(states) - 1; i >= 0; i-- {
+			if states[i].rev <= rev {
+				return states[i], states[i].present
+			}
+		}
+		return lcState{}, false
+	}
+	remove := func(path string, rev int) {
+		for p := range history {
+			if p == path || strings.HasPrefix(p, path+"/") {
+				if _, ok := lookup(p, rev); ok {
+					history[p] = append(history[p], lcState{rev: rev})
+				}
+			}
+		}
+	}
+	authors := make(map[int]string)
+	dates := make(map[int]string)
+	target := selection.Upperbound().rev
+	prophook := func(props *Properties) {
+		if source.Index != 0 {
+			return
+		}
+		authors[source.Revision] = props.getAuthor()
+		if date, err := time.Parse(time.RFC3339Nano, props.properties["svn:date"]); err == nil {
+			dates[source.Revision] = date.UTC().Format(time.RFC3339)
+		} else {
+			dates[source.Revision] = "(no date)"
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Revision == 0 || source.Revision > target {
+			return nil
+		}
+		path := string(header.payload("Node-path"))
+		action := string(header.payload("Node-action"))
+		if action == "change" {
+			if state, ok := lookup(path, source.Revision); ok {
+				history[path] = append(history[path], lcState{source.Revision, state.dir, true, source.Revision})
+			}
+			return nil
+		}
+		if action == "delete" || action == "replace" {
+			remove(path, source.Revision)
+		}
+		// A deletion changes the directory it was made in.
+		if slash := strings.LastIndex(path, "/"); action == "delete" && slash != -1 {
+			if state, ok := lookup(path[:slash], source.Revision); ok {
+				history[path[:slash]] = append(history[path[:slash]], lcState{source.Revision, state.dir, true, source.Revision})
+			}
+		}
+		if action != "add" && action != "replace" {
+			return nil
+		}
+		history[path] = append(history[path], lcState{source.Revision, header.isDir(source), true, source.Revision})
+		if frompath := header.payload("Node-copyfrom-path"); frompath != nil && header.isDir(source) {
+			fromrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+			from := string(frompath)
+			copies := make(map[string]bool)
+			for p := range history {
+				if strings.HasPrefix(p, from+"/") {
+					if state, ok := lookup(p, fromrev); ok {
+						copies[path+p[len(from):]] = state.dir
+					}
+				}
+			}
+			for p, dir := range copies {
+				history[p] = append(history[p], lcState{source.Revision, dir, true, source.Revision})
+			}
+		}
+		return nil
+	}
+	source.Report(nil, prophook, headerhook, nil)
+
+	// A directory was last changed when anything beneath it was.
+	alive := make(map[string]lcState)
+	for p := range history {
+		if state, ok := lookup(p, target); ok {
+			alive[p] = state
+		}
+	}
+	changed := make(map[string]int)
+	for p, state := range alive {
+		if state.changed > changed[p] {
+			changed[p] = state.changed
+		}
+		for slash := strings.LastIndex(p, "/"); slash != -1; slash = strings.LastIndex(p[:slash], "/") {
+			if parent := p[:slash]; state.changed > changed[parent] {
+				if _, ok := alive[parent]; ok {
+					changed[parent] = state.changed
+				}
+			}
+		}
+	}
+
+	listing := make([]string, 0)
+	for p, state := range alive {
+		if len(paths) > 0 {
+			wanted := false
+			for _, prefix := range paths {
+				prefix = strings.Trim(prefix, "/")
+				if p == prefix || strings.HasPrefix(p, prefix+"/") {
+					wanted = true
+					break
+				}
+			}
+			if !wanted {
+				continue
+			}
+		}
+		rev := changed[p]
+		name := p
+		if state.dir {
+			name += string(pathsep)
+		}
+		listing = append(listing, fmt.Sprintf("%s\t%d\t%s\t%s", name, rev, authors[rev], dates[rev]))
+	}
+	sort.Strings(listing)
+	for _, line := range listing {
+		fmt.Fprintln(out, line)
+	}
+}
+
+// logRecord is what a log entry reports about a revision.
+type logRecord struct {
+	rev      int
+	author   string
+	date     time.Time
+	paths    []string // the paths changed
+	changes  []string // the same, as svn log -v lists them
+	logentry string
+}
+
+// logRenderer - the function that turns a log record into text: by
+// default an entry in the style of svn log, with format json one
+// object per line, and with a template whatever that makes of the
+// fields rev, author, date, paths, and logentry.
+func logRenderer(format string, tmpl string, verbose bool) func(rec *logRecord) string {
+	fields := func(rec *logRecord) map[string]interface{} {
+		return map[string]interface{}{
+			"rev":      rec.rev,
+			"author":   rec.author,
+			"date":     rec.date,
+			"paths":    rec.paths,
+			"logentry": rec.logentry,
+		}
+	}
+	if tmpl != "" {
+		if format != "" {
+			croakUsage("log takes a template or a format, not both")
+		}
+		funcs := template.FuncMap{
+			"join": strings.Join,
+			"trim": strings.TrimSpace,
+			"firstline": func(s string) string {
+				return strings.SplitN(strings.TrimLeft(s, "\n"), "\n", 2)[0]
+			},
+		}
+		t, err := template.New("log").Funcs(funcs).Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			croakUsage("ill-formed log template: %v", err)
+		}
+		return func(rec *logRecord) string {
+			var b strings.Builder
+			if err := t.Execute(&b, fields(rec)); err != nil {
+				croak("log template failed at r%d: %v", rec.rev, err)
+			}
+			return b.String() + "\n"
+		}
+	}
+	switch format {
+	case "":
+		return func(rec *logRecord) string {
+			text := delim + "\n" + fmt.Sprintf("r%d | %s | %s | %d lines\n",
+				rec.rev,
+				rec.author,
+				rec.date.Format("2006-01-02 15:04:05 +0000 (Mon, 02 Jan 2006)"),
+				strings.Count(rec.logentry, "\n"))
+			if verbose {
+				text += "Changed paths:\n" + strings.Join(rec.changes, "\n") + "\n"
+			}
+			return text + "\n" + rec.logentry + "\n"
+		}
+	case "json":
+		return func(rec *logRecord) string {
+			out, err := json.Marshal(fields(rec))
+			if err != nil {
+				croak("could not encode log entry for r%d: %v", rec.rev, err)
+			}
+			return string(out) + "\n"
+		}
+	}
+	croakUsage("unknown log format %q", format)
+	return nil
+}
+
+// Extract log entries
+func log(source DumpfileSource, selection SubversionRange, fixed bool, reverse bool, render func(*logRecord) string, patterns []string) {
+	out := source.Out
+	if source.isFastImport() {
+		fastImportLog(NewFastImportSource(source), selection, fixed, reverse, render, patterns)
+		return
+	}
+	SVNTimeParse := func(rdate string) time.Time {
+		// Parse a date in the Subversion variant of RFC3339 format
+		// An example date in SVN format is '2011-11-30T16:40:02.180831Z'
+		date, ok := time.Parse(time.RFC3339Nano, rdate)
+		if ok != nil {
+			croakParse("ill-formed date '%s': %v", rdate, ok)
+		}
+		return date
+	}
+	var matcher SegmentMatcher
+	if len(patterns) > 0 {
+		matcher = NewSegmentMatcher(patterns, fixed)
+	}
+	type logEntry struct {
+		logRecord
+		matched bool
+	}
+	// Entries are held until their nodes have been seen, and all of
+	// them when the order is reversed.
+	entries := make([]*logEntry, 0)
+	var current *logEntry
+	flush := func() {
+		if current != nil && (len(patterns) == 0 || current.matched) {
+			entries = append(entries, current)
+		}
+		current = nil
+		if reverse {
+			return
+		}
+		for _, entry := range entries {
+			io.WriteString(out, render(&entry.logRecord))
+		}
+		entries = entries[:0]
+	}
+
+	prophook := func(prop *Properties) {
+		if source.Index != 0 {
+			return
+		}
+		flush()
+		if selection.ContainsRevision(source.Revision) {
+			// This test implicitly excludes r0 metadata from being dumped.
+			// It is not certain this is the right thing.
+			if logentry := prop.properties["svn:log"]; logentry != "" {
+				current = &logEntry{logRecord: logRecord{
+					rev:      source.Revision,
+					author:   prop.getAuthor(),
+					date:     SVNTimeParse(prop.properties["svn:date"]),
+					paths:    make([]string, 0),
+					logentry: logentry,
+				}}
+			}
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		if current == nil {
+			return nil
+		}
+		path := string(header.payload("Node-path"))
+		if len(patterns) > 0 && matcher.pathmatch(path) {
+			current.matched = true
+		}
+		letter := map[string]string{"add": "A", "change": "M", "delete": "D", "replace": "R"}[string(header.payload("Node-action"))]
+		line := fmt.Sprintf("   %s /%s", letter, path)
+		if frompath := header.payload("Node-copyfrom-path"); frompath != nil {
+			line += fmt.Sprintf(" (from /%s:%s)", frompath, header.payload("Node-copyfrom-rev"))
+		}
+		current.paths = append(current.paths, path)
+		current.changes = append(current.changes, line)
+		return nil
+	}
+	source.Report(nil, prophook, headerhook, nil)
+	flush()
+	for i := len(entries) - 1; i >= 0; i-- {
+		io.WriteString(out, render(&entries[i].logRecord))
+	}
+}
+
+// Canonicalize and repair mergeinfo properties.
+func mergeinfo(source DumpfileSource, selection SubversionRange) {
+	// Mergeinfo can only name paths from earlier revisions, so the
+	// paths seen so far are enough to spot sources that never existed.
+	// Anything under a copied directory might have come with it.
+	seen := newStringSet()
+	copied := newStringSet()
+	exists := func(path string) bool {
+		if seen.Contains(path) {
+			return true
+		}
+		for dir := path; strings.Contains(dir, "/"); {
+			dir = dir[:strings.LastIndex(dir, "/")]
+			if copied.Contains(dir) {
+				return true
+			}
+		}
+		return false
+	}
+	prophook := func(props *Properties) {
+		if source.Index == 0 || !selection.ContainsNode(source.Revision, source.Index) {
+			return
+		}
+		seen.Add(source.NodePath)
+		for _, mergeproperty := range []string{"svn:mergeinfo", "svnmerge-integrated"} {
+			oldval, present := props.properties[mergeproperty]
+			if !present {
+				continue
+			}
+			spans := make(map[string]*MergeinfoRange)
+			for _, line := range strings.Split(oldval, "\n") {
+				lastidx := strings.LastIndex(line, ":")
+				if lastidx == -1 {
+					continue
+				}
+				path := line[:lastidx]
+				if !exists(strings.Trim(path, "/")) {
+					announce("r%s: dropping mergeinfo for nonexistent %s", source.where(), path)
+					continue
+				}
+				span := parseMergeinfoRange(line[lastidx+1:])
+				if old, ok := spans[path]; ok {
+					old.intervals = append(old.intervals, span.intervals...)
+				} else {
+					spans[path] = &span
+				}
+			}
+			paths := make([]string, 0, len(spans))
+			for path, span := range spans {
+				span.Canonicalize()
+				if len(span.intervals) > 0 {
+					paths = append(paths, path)
+				}
+			}
+			sort.Strings(paths)
+			lines := make([]string, 0, len(paths))
+			for _, path := range paths {
+				lines = append(lines, path+":"+spans[path].dump())
+			}
+			if len(lines) == 0 {
+				props.Delete(mergeproperty)
+			} else {
+				props.properties[mergeproperty] = strings.Join(lines, linesep)
+			}
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Index > 0 {
+			seen.Add(source.NodePath)
+			if header.payload("Node-copyfrom-path") != nil && header.isDir(source) {
+				copied.Add(source.NodePath)
+			}
+		}
+		return []byte(header)
+	}
+	source.Report(nil, prophook, headerhook, nil)
+}
+
+// Delete individual nodes by rev.node coordinates.
+func nodedelete(source DumpfileSource, selection SubversionRange) {
+	prophook := func(props *Properties) {
+		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+			return path, source.patchMergeinfo(revrange)
+		})
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Index > 0 && selection.ContainsNode(source.Revision, source.Index) {
+			return nil
+		}
+		return []byte(header)
+	}
+	source.Report(nil, prophook, headerhook, nil)
+}
+
+// Hack pathnames to obscure them.
+func obscure(seq NameSequence, source DumpfileSource, selection SubversionRange, keepExtensions bool, keepLengths bool) {
+	segmentMutator := func(segment string) string {
+		stem, ext := segment, ""
+		if keepExtensions {
+			// A dotfile's name is all extension, so it has none.
+			if ext = path.Ext(segment); ext == segment {
+				ext = ""
+			}
+			stem = segment[:len(segment)-len(ext)]
+		}
+		width := 0
+		if keepLengths {
+			width = len(stem)
+		}
+		return seq.obscureWidth(stem, width) + ext
+	}
+	pathMutator := func(hd string, s []byte) []byte {
+		parts := strings.Split(string(s), string(pathsep))
+		for i := range parts {
+			if parts[i] != "trunk" && parts[i] != "tags" && parts[i] != "branches" && parts[i] != "" {
+				parts[i] = segmentMutator(parts[i])
+			}
+		}
+		return []byte(strings.Join(parts, string(pathsep)))
 	}
 
 	nameMutator := func(s string) string {
@@ -1938,6 +6136,7 @@ func obscure(seq NameSequence, source DumpfileSource, selection SubversionRange)
 }
 
 func pathlist(source DumpfileSource, selection SubversionRange) {
+	out := source.Out
 	pathList := newOrderedStringSet()
 	headerhook := func(header StreamSection) []byte {
 		if selection.ContainsNode(source.Revision, source.Index) {
@@ -1949,32 +6148,63 @@ func pathlist(source DumpfileSource, selection SubversionRange) {
 	}
 	source.Report(nil, nil, headerhook, nil)
 	for _, item := range pathList.Iterate() {
-		os.Stdout.WriteString(item + linesep)
+		io.WriteString(out, item+linesep)
 	}
 }
 
 // Hack paths by applying regexp transformations on segment sequences.
 func pathrename(source DumpfileSource, selection SubversionRange, patterns []string) {
+	source.apply(pathrenameHooks(&source, selection, patterns))
+}
+
+// pathrenameHooks - the hooks that apply path renames
+func pathrenameHooks(source *DumpfileSource, selection SubversionRange, args []string) Hooks {
+	// Rules from --file options come first, in order.
+	patterns := make([]string, 0)
+	for len(args) > 0 && (args[0] == "--file" || args[0] == "-file") {
+		if len(args) < 2 {
+			croakUsage("pathrename option %s requires a file", args[0])
+		}
+		patterns = append(patterns, readRenames(args[1])...)
+		args = args[2:]
+	}
+	patterns = append(patterns, args...)
+	if len(patterns) == 0 {
+		croakUsage("pathrename requires at least one FROM TO pair")
+	}
 	if len(patterns)%2 == 1 {
-		croak("pathrename can't have odd number of arguments")
+		croakUsage("pathrename can't have odd number of arguments")
 	}
 	type transform struct {
 		re *regexp.Regexp
 		to []byte
 	}
+	for i := 0; i < len(patterns); i += 2 {
+		patterns[i] = expandAlias(patterns[i])
+		if patterns[i] == "" {
+			croakUsage("pathrename can't rename from an empty pattern")
+		}
+	}
+	compile := func(re string) *regexp.Regexp {
+		compiled, err := regexp.Compile(caseFold(re))
+		if err != nil {
+			croakUsage("illegal regular expression in pathrename: %v", err)
+		}
+		return compiled
+	}
 	ops := make([]transform, 0)
 	for i := 0; i < len(patterns)/2; i++ {
 		if patterns[i*2][0] == '^' && patterns[i*2][len(patterns[i*2])-1] == '$' {
-			ops = append(ops, transform{regexp.MustCompile(patterns[i*2]),
+			ops = append(ops, transform{compile(patterns[i*2]),
 				[]byte(patterns[i*2+1])})
 		} else if patterns[i*2][0] == '^' {
-			ops = append(ops, transform{regexp.MustCompile(patterns[i*2] + "(?P<end>/|$)"),
+			ops = append(ops, transform{compile(patterns[i*2] + "(?P<end>/|$)"),
 				append([]byte(patterns[i*2+1]), []byte("${end}")...)})
 		} else if patterns[i*2][len(patterns[i*2])-1] == '$' {
-			ops = append(ops, transform{regexp.MustCompile("(?P<start>^|/)" + patterns[i*2]),
+			ops = append(ops, transform{compile("(?P<start>^|/)" + patterns[i*2]),
 				append([]byte("${start}"), []byte(patterns[i*2+1])...)})
 		} else {
-			ops = append(ops, transform{regexp.MustCompile("(?P<start>^|/)" + patterns[i*2] + "(?P<end>/|$)"),
+			ops = append(ops, transform{compile("(?P<start>^|/)" + patterns[i*2] + "(?P<end>/|$)"),
 				append([]byte("${start}"), append([]byte(patterns[i*2+1]), []byte("${end}")...)...)})
 		}
 	}
@@ -1985,20 +6215,80 @@ func pathrename(source DumpfileSource, selection SubversionRange, patterns []str
 		return s
 	}
 
-	mutatePaths(source, selection, mutator, nil, nil)
+	return mutatePathsHooks(source, selection, mutator, nil, nil)
+}
+
+// readRenames - the FROM and TO patterns of a pathrename rules file,
+// one pair to a line, quoted and commented as in a script
+func readRenames(filename string) []string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		croakIO("could not read pathrename rules: %v", err)
+	}
+	patterns := make([]string, 0)
+	for _, rule := range parseScript(string(data)) {
+		if len(rule) != 2 {
+			croakParse("%s: expected FROM TO, not %q", filename, strings.Join(rule, " "))
+		}
+		patterns = append(patterns, rule...)
+	}
+	return patterns
+}
+
+// Select whole revisions by the paths their nodes touch.
+func pathselect(source DumpfileSource, selection SubversionRange, fixed bool, patterns []string) {
+	if len(patterns) == 0 {
+		croakUsage("pathselect requires at least one path pattern")
+	}
+	matcher := NewSegmentMatcher(patterns, fixed)
+	// Each revision is held back until its last node has been seen,
+	// which is when the properties of the next one are read.
+	out := source.Out
+	var held bytes.Buffer
+	source.Out = &held
+	heldRev, keep := -1, true
+	flush := func() {
+		if keep {
+			out.Write(held.Bytes())
+		} else {
+			delete(source.EmittedRevisions, strconv.Itoa(heldRev))
+		}
+		held.Reset()
+	}
+	prophook := func(props *Properties) {
+		if source.Index == 0 {
+			flush()
+			heldRev, keep = source.Revision, source.Revision == 0
+			return
+		}
+		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+			return path, source.patchMergeinfo(revrange)
+		})
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Index > 0 && selection.ContainsRevision(source.Revision) && matcher.pathmatch(source.NodePath) {
+			keep = true
+		}
+		return []byte(header)
+	}
+	source.Report(nil, prophook, headerhook, nil)
+	flush()
 }
 
 // Pop the top segment off each pathname in an input dump
-func pop(source DumpfileSource, fixed bool, patterns []string) {
+func pop(source DumpfileSource, fixed bool, count int, patterns []string) {
 	var matcher SegmentMatcher
 	if len(patterns) > 0 {
 		matcher = NewSegmentMatcher(patterns, fixed)
 	}
 	popSegment := func(ins string) string {
-		if strings.Contains(ins, "/") {
-			return ins[strings.Index(ins, "/")+1:]
+		for i := 0; i < count; i++ {
+			if !strings.Contains(ins, "/") {
+				return ""
+			}
+			ins = ins[strings.Index(ins, "/")+1:]
 		}
-		return ""
+		return ins
 	}
 	prophook := func(props *Properties) {
 		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
@@ -2017,21 +6307,75 @@ func pop(source DumpfileSource, fixed bool, patterns []string) {
 				return in
 			})
 		}
+		// A node for a directory that has been popped away entirely
+		// has nothing left to act on.
+		if source.Index > 0 && len(header.payload("Node-path")) == 0 {
+			return nil
+		}
 		return []byte(header)
 	}
 	source.Report(nil, prophook, headerhook, nil)
 }
 
+// propTargets - strip the leading --nodes and --path PATTERN options
+// of a property command.  Either confines it to node properties, and
+// patterns further confine it to nodes with matching paths; then the
+// predicate returned says which nodes to edit.  Otherwise it is nil.
+func propTargets(source *DumpfileSource, selection SubversionRange, fixed bool, command string, args []string) (func(string) bool, []string) {
+	nodes := false
+	patterns := make([]string, 0)
+	for len(args) > 0 {
+		if args[0] == "--nodes" || args[0] == "-nodes" {
+			nodes = true
+			args = args[1:]
+		} else if args[0] == "--path" || args[0] == "-path" {
+			if len(args) < 2 {
+				croakUsage("%s option %s requires a pattern", command, args[0])
+			}
+			patterns = append(patterns, args[1])
+			args = args[2:]
+		} else {
+			break
+		}
+	}
+	if len(args) == 0 {
+		croakUsage("%s requires at least one property argument", command)
+	}
+	if !nodes && len(patterns) == 0 {
+		return nil, args
+	}
+	var matcher SegmentMatcher
+	if len(patterns) > 0 {
+		matcher = NewSegmentMatcher(patterns, fixed)
+	}
+	selected := func(path string) bool {
+		return selection.ContainsNode(source.Revision, source.Index) && (len(patterns) == 0 || matcher.pathmatch(path))
+	}
+	return selected, args
+}
+
 // propdel - Delete properties
-func propdel(source DumpfileSource, propnames []string, selection SubversionRange) {
+func propdel(source DumpfileSource, selection SubversionRange, fixed bool, args []string) {
+	source.apply(propdelHooks(&source, selection, fixed, args))
+}
+
+// propdelHooks - the hooks that delete properties
+func propdelHooks(source *DumpfileSource, selection SubversionRange, fixed bool, args []string) Hooks {
+	selected, propnames := propTargets(source, selection, fixed, "propdel", args)
+	remove := func(props *Properties) {
+		for _, propname := range propnames {
+			props.Delete(propname)
+		}
+	}
+	if selected != nil {
+		return nodePropHooks(source, selected, remove)
+	}
 	var propsNuked bool
 	prophook := func(props *Properties) {
 		propsNuked = false
 		if selection.ContainsNode(source.Revision, source.Index) {
 			hadProps := props.NonEmpty()
-			for _, propname := range propnames {
-				props.Delete(propname)
-			}
+			remove(props)
 			propsNuked = hadProps && !props.NonEmpty()
 		}
 	}
@@ -2042,23 +6386,139 @@ func propdel(source DumpfileSource, propnames []string, selection SubversionRang
 		}
 		return []byte(header)
 	}
+	return Hooks{prophook: prophook, headerhook: headerhook}
+}
+
+// List the property names in use, with counts and sample values.
+func proplist(source DumpfileSource, selection SubversionRange, step int) {
+	out := source.Out
+	type propRecord struct {
+		count   int
+		example string
+		buckets map[int]int
+	}
+	revprops := make(map[string]*propRecord)
+	nodeprops := make(map[string]*propRecord)
+	prophook := func(props *Properties) {
+		if !selection.ContainsNode(source.Revision, source.Index) {
+			return
+		}
+		records := nodeprops
+		if source.Index == 0 {
+			records = revprops
+		}
+		for _, key := range props.propkeys {
+			record, ok := records[key]
+			if !ok {
+				record = &propRecord{example: props.properties[key], buckets: make(map[int]int)}
+				records[key] = record
+			}
+			record.count++
+			if step > 0 {
+				record.buckets[source.Revision/step]++
+			}
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		return nil
+	}
 	source.Report(nil, prophook, headerhook, nil)
+
+	list := func(title string, records map[string]*propRecord) {
+		if len(records) == 0 {
+			return
+		}
+		fmt.Fprintf(out, "%s:\n", title)
+		names := make([]string, 0, len(records))
+		for name := range records {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			record := records[name]
+			example := record.example
+			if len(example) > 40 {
+				example = example[:40] + "..."
+			}
+			fmt.Fprintf(out, "  %-24s %6d  %q\n", name, record.count, example)
+			buckets := make([]int, 0, len(record.buckets))
+			for bucket := range record.buckets {
+				buckets = append(buckets, bucket)
+			}
+			sort.Ints(buckets)
+			for _, bucket := range buckets {
+				span := fmt.Sprintf("%d-%d", bucket*step, (bucket+1)*step-1)
+				fmt.Fprintf(out, "    %-22s %6d\n", span, record.buckets[bucket])
+			}
+		}
+	}
+	list("revision properties", revprops)
+	list("node properties", nodeprops)
 }
 
 // Set properties.
-func propset(source DumpfileSource, propnames []string, selection SubversionRange) {
+func propset(source DumpfileSource, selection SubversionRange, fixed bool, args []string) {
+	source.apply(propsetHooks(&source, selection, fixed, args))
+}
+
+// Properties whose values are lists of lines, which Subversion keeps
+// with LF line endings and a final newline.
+var lineListProperties = newStringSet("svn:ignore", "svn:global-ignores", "svn:externals", "svn:auto-props")
+
+// propValue - the value a propset argument gives a property: the text
+// after the =, or if that is @FILE the content of FILE, canonicalized
+// the way Subversion does for list-valued properties.  A leading @@
+// stands for a literal @.
+func propValue(name string, spec string) string {
+	if !strings.HasPrefix(spec, "@") {
+		return spec
+	}
+	if strings.HasPrefix(spec, "@@") {
+		return spec[1:]
+	}
+	data, err := os.ReadFile(spec[1:])
+	if err != nil {
+		croakIO("could not read value of %s: %v", name, err)
+	}
+	value := string(data)
+	if lineListProperties.Contains(name) {
+		value = strings.ReplaceAll(value, "\r\n", "\n")
+		if value != "" && !strings.HasSuffix(value, "\n") {
+			value += "\n"
+		}
+	}
+	return value
+}
+
+// propsetHooks - the hooks that set properties
+func propsetHooks(source *DumpfileSource, selection SubversionRange, fixed bool, args []string) Hooks {
+	selected, settings := propTargets(source, selection, fixed, "propset", args)
+	names := make([]string, len(settings))
+	values := make([]string, len(settings))
+	for i, setting := range settings {
+		fields := strings.SplitN(setting, "=", 2)
+		if len(fields) < 2 || fields[0] == "" {
+			croakUsage("propset needs NAME=VALUE, not %q", setting)
+		}
+		names[i], values[i] = fields[0], propValue(fields[0], fields[1])
+	}
+	set := func(props *Properties) {
+		for i, name := range names {
+			if _, present := props.properties[name]; !present {
+				props.propkeys = append(props.propkeys, name)
+			}
+			props.properties[name] = values[i]
+		}
+	}
+	if selected != nil {
+		return nodePropHooks(source, selected, set)
+	}
 	prophook := func(props *Properties) {
 		if selection.ContainsNode(source.Revision, source.Index) {
-			for _, propname := range propnames {
-				fields := strings.Split(propname, "=")
-				if _, present := props.properties[fields[0]]; !present {
-					props.propkeys = append(props.propkeys, fields[0])
-				}
-				props.properties[fields[0]] = fields[1]
-			}
+			set(props)
 		}
 	}
-	source.Report(nil, prophook, nil, nil)
+	return Hooks{prophook: prophook}
 }
 
 // Turn off property by suffix, defaulting to svn:executable
@@ -2087,30 +6547,98 @@ func propclean(source DumpfileSource, property string, suffixes []string, select
 	source.Report(nil, prophook, headerhook, nil)
 }
 
-// Rename properties.
-func proprename(source DumpfileSource, propnames []string, selection SubversionRange) {
+// Strip housekeeping properties matching glob patterns.
+func propstrip(source DumpfileSource, selection SubversionRange, patterns []string) {
+	deny := make([]string, 0)
+	allow := make([]string, 0)
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			allow = append(allow, pattern[1:])
+		} else {
+			deny = append(deny, pattern)
+		}
+	}
+	if len(deny) == 0 {
+		deny = []string{"svn:entry:*", "svn:wc:*", "cvs2svn:*"}
+	}
+	for _, pattern := range append(deny, allow...) {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			croakUsage("ill-formed property pattern %q", pattern)
+		}
+	}
+	matches := func(globs []string, name string) bool {
+		for _, glob := range globs {
+			if ok, _ := filepath.Match(glob, name); ok {
+				return true
+			}
+		}
+		return false
+	}
+	var propsNuked bool
 	prophook := func(props *Properties) {
-		if selection.ContainsNode(source.Revision, source.Index) {
-			for _, propname := range propnames {
-				fields := strings.Split(propname, "->")
-				if _, present := props.properties[fields[0]]; present {
-					props.properties[fields[1]] = props.properties[fields[0]]
-					props.properties[fields[0]] = ""
-					for i, item := range props.propkeys {
-						if item == fields[0] {
-							props.propkeys[i] = fields[1]
-						}
+		propsNuked = false
+		if !selection.ContainsNode(source.Revision, source.Index) {
+			return
+		}
+		hadProps := props.NonEmpty()
+		for _, key := range append([]string{}, props.propkeys...) {
+			if matches(deny, key) && !matches(allow, key) {
+				props.Delete(key)
+			}
+		}
+		propsNuked = hadProps && !props.NonEmpty()
+	}
+	headerhook := func(header StreamSection) []byte {
+		// Drop empty nodes left behind by the deletions
+		if !header.hasContent() && propsNuked && bytes.Equal(header.payload("Node-action"), []byte("change")) {
+			return nil
+		}
+		return []byte(header)
+	}
+	source.Report(nil, prophook, headerhook, nil)
+}
+
+// Rename properties.
+func proprename(source DumpfileSource, selection SubversionRange, fixed bool, args []string) {
+	source.apply(proprenameHooks(&source, selection, fixed, args))
+}
+
+// proprenameHooks - the hooks that rename properties
+func proprenameHooks(source *DumpfileSource, selection SubversionRange, fixed bool, args []string) Hooks {
+	selected, propnames := propTargets(source, selection, fixed, "proprename", args)
+	for _, propname := range propnames {
+		if !strings.Contains(propname, "->") {
+			croakUsage("proprename needs OLD->NEW, not %q", propname)
+		}
+	}
+	rename := func(props *Properties) {
+		for _, propname := range propnames {
+			fields := strings.Split(propname, "->")
+			if _, present := props.properties[fields[0]]; present {
+				props.properties[fields[1]] = props.properties[fields[0]]
+				props.properties[fields[0]] = ""
+				for i, item := range props.propkeys {
+					if item == fields[0] {
+						props.propkeys[i] = fields[1]
 					}
-					for i, item := range props.propdelkeys {
-						if item == fields[0] {
-							props.propdelkeys[i] = fields[1]
-						}
+				}
+				for i, item := range props.propdelkeys {
+					if item == fields[0] {
+						props.propdelkeys[i] = fields[1]
 					}
 				}
 			}
 		}
 	}
-	source.Report(nil, prophook, nil, nil)
+	if selected != nil {
+		return nodePropHooks(source, selected, rename)
+	}
+	prophook := func(props *Properties) {
+		if selection.ContainsNode(source.Revision, source.Index) {
+			rename(props)
+		}
+	}
+	return Hooks{prophook: prophook}
 }
 
 // Push a prefix segment onto each pathname in an input dump
@@ -2122,20 +6650,48 @@ func push(source DumpfileSource, segment string, fixed bool, patterns []string)
 	prophook := func(props *Properties) {
 		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
 			if len(patterns) == 0 || matcher.pathmatch(path) {
-				path = segment + string(os.PathSeparator) + path
+				path = segment + string(pathsep) + path
 			}
 			return path, revrange
 		})
 	}
+	pushed := func(in []byte) []byte {
+		if len(in) == 0 {
+			return []byte(segment)
+		}
+		return []byte(segment + string(pathsep) + string(in))
+	}
+	created := false
 	headerhook := func(header StreamSection) []byte {
+		if source.Revision == 0 {
+			return []byte(header)
+		}
+		path := header.payload("Node-path")
+		if len(patterns) > 0 && !matcher.pathmatch(string(path)) {
+			header, _, _ = header.replaceHook("Node-copyfrom-path", func(hd string, in []byte) []byte {
+				if matcher.pathmatch(string(in)) {
+					return pushed(in)
+				}
+				return in
+			})
+			return []byte(header)
+		}
+		// The new segment has to exist before anything is put under it.
+		// A root node becomes its creation; otherwise synthesize one.
+		mkdir := !created && len(path) > 0
+		created = true
 		for _, htype := range []string{"Node-path", "Node-copyfrom-path"} {
 			header, _, _ = header.replaceHook(htype, func(hd string, in []byte) []byte {
 				if len(patterns) == 0 || matcher.pathmatch(string(in)) {
-					in = []byte(segment + string(os.PathSeparator) + string(in))
+					return pushed(in)
 				}
 				return in
 			})
 		}
+		if mkdir {
+			node := fmt.Sprintf("Node-path: %s\nNode-kind: dir\nNode-action: add\nProp-content-length: 10\nContent-length: 10\n\nPROPS-END\n\n\n", segment)
+			return append([]byte(node), header...)
+		}
 		return []byte(header)
 	}
 	source.Report(nil, prophook, headerhook, nil)
@@ -2163,8 +6719,43 @@ func reduce(source DumpfileSource, selection SubversionRange) {
 	source.Report(nil, prophook, headerhook, nil)
 }
 
+// Convert a dump to another dump format version.
+func reformat(source DumpfileSource, version int) {
+	// Versions before 3 have no deltas, so expand them to full text.
+	if version < 3 {
+		expandDeltas = true
+	}
+	versionLine := regexp.MustCompile("SVN-fs-dump-format-version: [0-9]+\n")
+	uuidLine := regexp.MustCompile("UUID: .*\n\n?")
+	headerhook := func(header StreamSection) []byte {
+		if source.Index > 0 {
+			return []byte(header)
+		}
+		if !versionLine.Match(header) {
+			croakParse("reformat found no SVN-fs-dump-format-version header")
+		}
+		header = versionLine.ReplaceAll(header, []byte(fmt.Sprintf("SVN-fs-dump-format-version: %d\n", version)))
+		// Version 1 dumps predate repository UUIDs.
+		if version < 2 {
+			header = uuidLine.ReplaceAll(header, []byte{})
+		}
+		return []byte(header)
+	}
+	source.Report(nil, nil, headerhook, nil)
+}
+
 // Renumber all revisions.
-func renumber(source DumpfileSource, counter int) {
+func renumber(source DumpfileSource, selection SubversionRange, counter int, keepGaps bool, explicit map[int]int) map[int]int {
+	hooks, renumbering := renumberHooks(&source, selection, counter, keepGaps, explicit)
+	source.apply(hooks)
+	return renumbering
+}
+
+// renumberHooks - the hooks that renumber revisions, and the
+// renumbering they fill in as the stream goes by.  Revisions outside
+// the selection keep their numbers; with keepGaps, the gaps between
+// revisions are kept too.
+func renumberHooks(source *DumpfileSource, selection SubversionRange, counter int, keepGaps bool, explicit map[int]int) (Hooks, map[int]int) {
 	renumbering := make(map[int]int)
 
 	renumberBack := func(n int) int {
@@ -2181,10 +6772,32 @@ func renumber(source DumpfileSource, counter int) {
 		return renumbering[m]
 	}
 
+	previous, last := -1, -1
 	revhook := func(header StreamSection) []byte {
 		newhdr, _, _ := header.replaceHook("Revision-number", func(hd string, in []byte) []byte {
 			oldnum, _ := strconv.Atoi(string(in))
+			if keepGaps && previous != -1 {
+				counter += oldnum - previous - 1
+			} else if previous != -1 && !source.EmittedRevisions[strconv.Itoa(renumbering[previous])] {
+				// An earlier stage of a script dropped the last
+				// revision, so its number is free for this one.
+				counter = renumbering[previous]
+				delete(renumbering, previous)
+			}
+			previous = oldnum
+			if !selection.ContainsRevision(oldnum) {
+				if oldnum <= last {
+					croak("r%d is outside the selection but would come before the r%d already emitted", oldnum, last)
+				}
+				counter = oldnum
+			} else if n, ok := explicit[oldnum]; ok {
+				if n <= last {
+					croak("revision map sends r%d to r%d, before the r%d already emitted", oldnum, n, last)
+				}
+				counter = n
+			}
 			newnum := counter
+			last = newnum
 			counter++
 			renumbering[oldnum] = newnum
 			return []byte(fmt.Sprintf("%d", newnum))
@@ -2225,30 +6838,266 @@ func renumber(source DumpfileSource, counter int) {
 		})
 	}
 
-	source.Report(revhook, prophook, headerhook, nil)
+	return Hooks{revhook: revhook, prophook: prophook, headerhook: headerhook}, renumbering
 }
 
-func replace(source DumpfileSource, selection SubversionRange, transform string) {
-	patternParts := strings.Split(transform[1:], transform[0:1])
-	if len(patternParts) != 3 || patternParts[2] != "" {
-		croak("ill-formed transform specification")
+// Read a revision map of OLD NEW pairs, one per line.
+func loadRevisionMap(r io.Reader) (map[int]int, error) {
+	revmap := make(map[int]int)
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected OLD NEW", lineno)
+		}
+		oldrev, err1 := strconv.Atoi(fields[0])
+		newrev, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil || oldrev < 0 || newrev < 0 {
+			return nil, fmt.Errorf("line %d: revisions must be nonnegative integers", lineno)
+		}
+		revmap[oldrev] = newrev
 	}
-	tre, err := regexp.Compile(patternParts[0])
-	if err != nil {
-		croak("illegal regular expression: %v", err)
+	return revmap, scanner.Err()
+}
+
+// Write a revision map as tab-separated OLD NEW pairs in order.
+func saveRevisionMap(w io.Writer, revmap map[int]int) error {
+	olds := make([]int, 0, len(revmap))
+	for oldrev := range revmap {
+		olds = append(olds, oldrev)
+	}
+	sort.Ints(olds)
+	for _, oldrev := range olds {
+		if _, err := fmt.Fprintf(w, "%d\t%d\n", oldrev, revmap[oldrev]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Report probable renames from deletes paired with adds in one revision.
+func renames(source DumpfileSource, selection SubversionRange) {
+	out := source.Out
+	type renameNode struct {
+		path     string
+		isDir    bool
+		frompath string
+		sum      string
+		paired   bool
+	}
+	// Latest content digest of each file, so a delete can be matched
+	// by the content it removes.
+	sums := make(map[string]string)
+	var deletes, adds []*renameNode
+	var current *renameNode
+	revision := 0
+	flush := func() {
+		report := func(from *renameNode, to *renameNode, evidence string) {
+			from.paired = true
+			to.paired = true
+			suffix := ""
+			if to.isDir {
+				suffix = "/"
+			}
+			fmt.Fprintf(out, "r%d %s%s -> %s%s (%s)\n", revision, from.path, suffix, to.path, suffix, evidence)
+		}
+		// A copy from a path deleted in the same revision is a
+		// rename as Subversion itself records one.
+		for _, to := range adds {
+			for _, from := range deletes {
+				if !from.paired && to.frompath == from.path && from.path != to.path {
+					report(from, to, "copy")
+					break
+				}
+			}
+		}
+		// Then identical content, preferring the same basename.
+		for _, to := range adds {
+			if to.paired || to.sum == "" {
+				continue
+			}
+			var best *renameNode
+			for _, from := range deletes {
+				if from.paired || from.sum != to.sum || from.path == to.path {
+					continue
+				}
+				if best == nil || (filepath.Base(from.path) == filepath.Base(to.path) && filepath.Base(best.path) != filepath.Base(to.path)) {
+					best = from
+				}
+			}
+			if best != nil {
+				report(best, to, "content")
+			}
+		}
+		// Finally the same basename and kind, if that is unambiguous.
+		for _, to := range adds {
+			if to.paired || to.frompath != "" {
+				continue
+			}
+			var match *renameNode
+			count := 0
+			for _, from := range deletes {
+				if !from.paired && from.isDir == to.isDir && from.path != to.path && filepath.Base(from.path) == filepath.Base(to.path) {
+					match = from
+					count++
+				}
+			}
+			if count == 1 {
+				report(match, to, "name")
+			}
+		}
+		deletes, adds = nil, nil
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Revision != revision {
+			flush()
+			revision = source.Revision
+		}
+		current = nil
+		path := string(header.payload("Node-path"))
+		action := string(header.payload("Node-action"))
+		selected := selection.ContainsNode(source.Revision, source.Index)
+		if action == "delete" || action == "replace" {
+			if selected {
+				deletes = append(deletes, &renameNode{path: path, isDir: header.isDir(source), sum: sums[path]})
+			}
+			delete(sums, path)
+		}
+		if action == "add" || action == "replace" || action == "change" {
+			node := &renameNode{path: path, isDir: header.isDir(source)}
+			if frompath := header.payload("Node-copyfrom-path"); frompath != nil {
+				node.frompath = string(frompath)
+				node.sum = sums[node.frompath]
+			}
+			if !node.isDir && node.sum != "" {
+				sums[path] = node.sum
+			}
+			current = node
+			if selected && action != "change" {
+				adds = append(adds, node)
+			}
+		}
+		return []byte(header)
+	}
+	contenthook := func(content []byte) []byte {
+		if current != nil && !current.isDir && (len(content) > 0 || current.frompath == "") {
+			current.sum = fmt.Sprintf("%x", md5.Sum(content))
+			sums[current.path] = current.sum
+		}
+		return content
+	}
+	source.Out = io.Discard
+	source.Report(nil, nil, headerhook, contenthook)
+	flush()
+}
+
+func replace(source DumpfileSource, selection SubversionRange, fixed bool, args []string) {
+	source.apply(replaceHooks(&source, selection, fixed, args))
+}
+
+// substitution is one /REGEXP/REPLACEMENT/ of a replace.
+type substitution struct {
+	re          *regexp.Regexp
+	replacement []byte
+	literal     bool // replacement is not expanded, as when read from a file
+}
+
+// parseSubstitution - parse /REGEXP/REPLACEMENT/FLAGS, where FLAGS may
+// be any of i for case-insensitive matching, m for ^ and $ to match at
+// line boundaries, and s for . to match newline.  A REPLACEMENT of the
+// form @FILE is the content of FILE, taken literally.
+func parseSubstitution(transform string) substitution {
+	if transform == "" {
+		croakUsage("ill-formed transform specification")
+	}
+	parts := strings.Split(transform[1:], transform[0:1])
+	if len(parts) != 3 {
+		croakUsage("ill-formed transform specification")
+	}
+	pattern, flags := parts[0], parts[2]
+	if strings.Trim(flags, "ims") != "" {
+		croakUsage("unknown flag in transform specification %q", transform)
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	var sub substitution
+	var err error
+	if sub.re, err = regexp.Compile(pattern); err != nil {
+		croakUsage("illegal regular expression: %v", err)
+	}
+	if strings.HasPrefix(parts[1], "@") {
+		if sub.replacement, err = os.ReadFile(parts[1][1:]); err != nil {
+			croakIO("could not read replacement text: %v", err)
+		}
+		sub.literal = true
+	} else {
+		sub.replacement = []byte(parts[1])
 	}
+	return sub
+}
 
+// replaceHooks - the hooks that apply regexp substitutions to content.
+// The transforms may be preceded by --path PATTERN options, restricting
+// them to nodes with matching paths.
+func replaceHooks(source *DumpfileSource, selection SubversionRange, fixed bool, args []string) Hooks {
+	patterns := make([]string, 0)
+	for len(args) > 0 && (args[0] == "--path" || args[0] == "-path") {
+		if len(args) < 2 {
+			croakUsage("replace option %s requires a pattern", args[0])
+		}
+		patterns = append(patterns, args[1])
+		args = args[2:]
+	}
+	transforms := args
+	if len(transforms) == 0 {
+		croakUsage("replace requires at least one transform specification")
+	}
+	var matcher SegmentMatcher
+	if len(patterns) > 0 {
+		matcher = NewSegmentMatcher(patterns, fixed)
+	}
+	subs := make([]substitution, len(transforms))
+	for i, transform := range transforms {
+		subs[i] = parseSubstitution(transform)
+	}
 	headerhook := func(header StreamSection) []byte {
 		return []byte(header)
 	}
-	contenthook := func(content []byte) []byte {
-		return tre.ReplaceAll(content, []byte(patternParts[1]))
+	substitute := func(content []byte) []byte {
+		for _, sub := range subs {
+			if sub.literal {
+				content = sub.re.ReplaceAllLiteral(content, sub.replacement)
+			} else {
+				content = sub.re.ReplaceAll(content, sub.replacement)
+			}
+		}
+		return content
+	}
+	contentjob := func() func([]byte) []byte {
+		if !selection.ContainsNode(source.Revision, source.Index) {
+			return nil
+		}
+		if len(patterns) > 0 && !matcher.pathmatch(source.NodePath) {
+			return nil
+		}
+		return substitute
 	}
-	source.Report(nil, nil, headerhook, contenthook)
+	return Hooks{headerhook: headerhook, contentjob: contentjob}
 }
 
 // Strip out ops defined by a revision selection and a path regexp.
 func see(source DumpfileSource, selection SubversionRange) {
+	out := source.Out
+	if source.isFastImport() {
+		fastImportSee(NewFastImportSource(source), selection)
+		return
+	}
 	seenode := func(header StreamSection) []byte {
 		if !selection.ContainsNode(source.Revision, source.Index) || source.Revision == 0 {
 			return nil
@@ -2258,19 +7107,19 @@ func see(source DumpfileSource, selection SubversionRange) {
 		}
 		path := header.payload("Node-path")
 		if header.isDir(source) {
-			path = append(path, os.PathSeparator)
+			path = append(path, pathsep)
 		}
 		frompath := header.payload("Node-copyfrom-path")
 		fromrev := header.payload("Node-copyfrom-rev")
 		action := header.payload("Node-action")
 		if frompath != nil && fromrev != nil {
 			if header.isDir(source) {
-				frompath = append(frompath, os.PathSeparator)
+				frompath = append(frompath, pathsep)
 			}
 			path = append(path, []byte(fmt.Sprintf(" from %s:%s", fromrev, frompath))...)
 			action = []byte("copy")
 		}
-		fmt.Printf("%-5s %-8s %s\n", source.where(), action, path)
+		fmt.Fprintf(out, "%-5s %-8s %s\n", source.where(), action, path)
 		return nil
 	}
 	seeprops := func(properties *Properties) {
@@ -2284,24 +7133,129 @@ func see(source DumpfileSource, selection SubversionRange) {
 		}
 		props := properties.String()
 		if props != "" {
-			fmt.Printf("%-5s %-8s %s\n", source.where(), "propset", props)
+			fmt.Fprintf(out, "%-5s %-8s %s\n", source.where(), "propset", props)
 		}
 	}
 	source.Report(nil, seeprops, seenode, nil)
 }
 
+// seeCopy is a copy source in the JSON form of see
+type seeCopy struct {
+	Path     string `json:"path"`
+	Revision int    `json:"revision"`
+}
+
+// seeNode is one node in the JSON form of see
+type seeNode struct {
+	Revision   int       `json:"revision"`
+	Index      int       `json:"index"`
+	Action     string    `json:"action"`
+	Kind       string    `json:"kind"`
+	Path       string    `json:"path"`
+	Copyfrom   *seeCopy  `json:"copyfrom"`
+	PropChange bool      `json:"propchange"`
+	TextChange bool      `json:"textchange"`
+	CopyChain  []seeCopy `json:"copychain,omitempty"`
+}
+
+// Report node structure as one JSON object per node.
+func seeJSON(source DumpfileSource, selection SubversionRange, chains bool) {
+	out := source.Out
+	if source.isFastImport() {
+		croakUsage("JSON output is not available for fast-import streams")
+	}
+	// Every node is noted, selected or not, so copy chains can be
+	// traced back through the whole history.
+	history := NewPathHistory(0)
+	encoder := json.NewEncoder(out)
+	seenode := func(header StreamSection) []byte {
+		if source.Revision == 0 {
+			return nil
+		}
+		if selection.ContainsNode(source.Revision, source.Index) {
+			node := seeNode{
+				Revision:   source.Revision,
+				Index:      source.Index,
+				Action:     string(header.payload("Node-action")),
+				Kind:       "file",
+				Path:       string(header.payload("Node-path")),
+				PropChange: header.payload("Prop-content-length") != nil,
+				TextChange: header.payload("Text-content-length") != nil,
+			}
+			if header.isDir(source) {
+				node.Kind = "dir"
+			}
+			if frompath := header.payload("Node-copyfrom-path"); frompath != nil {
+				fromrev, _ := strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+				node.Copyfrom = &seeCopy{string(frompath), fromrev}
+				if chains {
+					node.CopyChain = make([]seeCopy, 0)
+					path, rev := node.Copyfrom.Path, node.Copyfrom.Revision
+					// The length bound guards against malformed
+					// streams that copy a path from itself.
+					for len(node.CopyChain) <= source.Revision {
+						var ok bool
+						if path, rev, ok = history.origin(path, rev); !ok {
+							break
+						}
+						node.CopyChain = append(node.CopyChain, seeCopy{path, rev})
+					}
+				}
+			}
+			if err := encoder.Encode(node); err != nil {
+				croakIO("see could not write JSON: %v", err)
+			}
+		}
+		history.note(header, source.Revision)
+		return nil
+	}
+	source.Report(nil, nil, seenode, nil)
+}
+
 // Set the copyfrom path
-func setcopyfrom(source DumpfileSource, selection SubversionRange, newpath string) {
+func setcopyfrom(source DumpfileSource, selection SubversionRange, fixed bool, target string, patterns []string) {
+	newpath, newrev := target, ""
+	if at := strings.LastIndex(target, "@"); at != -1 {
+		newpath, newrev = target[:at], target[at+1:]
+		if n, err := strconv.Atoi(newrev); err != nil || n < 0 {
+			croakUsage("setcopyfrom: invalid revision in %q", target)
+		}
+	}
+	if newpath == "" && newrev == "" {
+		croakUsage("setcopyfrom requires a new path, a new revision, or both")
+	}
+	var matcher SegmentMatcher
+	if len(patterns) > 0 {
+		matcher = NewSegmentMatcher(patterns, fixed)
+	}
 	headerhook := func(header StreamSection) []byte {
 		if !selection.ContainsNode(source.Revision, source.Index) {
 			return []byte(header)
 		}
-		if header.payload("Node-copyfrom-path") == nil {
+		if len(patterns) > 0 {
+			if header.payload("Node-copyfrom-path") == nil || !matcher.pathmatch(source.NodePath) {
+				return []byte(header)
+			}
+		} else if header.payload("Node-copyfrom-path") == nil {
 			croak("setcopyfrom applied to a non-copy node %s", source.where())
 		}
-		header, _, _ = header.replaceHook("Node-copyfrom-path", func(hdr string, in []byte) []byte {
-			return []byte(newpath)
-		})
+		if newpath != "" {
+			header, _, _ = header.replaceHook("Node-copyfrom-path", func(hdr string, in []byte) []byte {
+				return []byte(newpath)
+			})
+		}
+		if newrev != "" {
+			if n, _ := strconv.Atoi(newrev); n >= source.Revision {
+				croak("setcopyfrom would make %s copy from a future revision", source.where())
+			}
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hdr string, in []byte) []byte {
+				return []byte(newrev)
+			})
+		}
+		// The copy source checksums describe the old source, which
+		// may no longer be the one being copied.
+		header = header.delete("Text-copy-source-md5:")
+		header = header.delete("Text-copy-source-sha1:")
 		return []byte(header)
 	}
 	source.Report(nil, nil, headerhook, nil)
@@ -2316,7 +7270,7 @@ func sselect(source DumpfileSource, selection SubversionRange) {
 func setlog(source DumpfileSource, logpath string, selection SubversionRange) {
 	fd, ok := os.Open(logpath)
 	if ok != nil {
-		croak("couldn't open " + logpath)
+		croakIO("couldn't open " + logpath)
 	}
 	logpatch := NewLogfile(fd, &selection)
 	prophook := func(prop *Properties) {
@@ -2324,64 +7278,763 @@ func setlog(source DumpfileSource, logpath string, selection SubversionRange) {
 			if _, haslog := prop.properties["svn:log"]; haslog && logpatch.Contains(source.Revision) {
 				logentry := logpatch.comments[source.Revision]
 				if string(logentry.author) != prop.getAuthor() {
-					croak("author of revision %d doesn't look right, aborting!\n", source.Revision)
+					croakParse("author of revision %d doesn't look right, aborting!\n", source.Revision)
 				}
 				prop.properties["svn:log"] = string(logentry.text)
 			}
 		}
 	}
-	source.Report(nil, prophook, nil, nil)
-}
-
-// Set the node path
-func setpath(source DumpfileSource, selection SubversionRange, newpath string) {
+	source.Report(nil, prophook, nil, nil)
+}
+
+// Replace log entries from a directory of files named by revision.
+func setlogdir(source DumpfileSource, dirpath string, selection SubversionRange) {
+	files, err := os.ReadDir(dirpath)
+	if err != nil {
+		croakIO("couldn't read message directory: %v", err)
+	}
+	// A file is named by its revision, optionally with an extension.
+	messages := make(map[int]string)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		stem := strings.SplitN(file.Name(), ".", 2)[0]
+		rev, err := strconv.Atoi(stem)
+		if err != nil || rev < 0 {
+			continue
+		}
+		if _, dup := messages[rev]; dup {
+			croak("more than one message file for revision %d", rev)
+		}
+		text, err := os.ReadFile(filepath.Join(dirpath, file.Name()))
+		if err != nil {
+			croakIO("couldn't read message file: %v", err)
+		}
+		messages[rev] = string(text)
+	}
+	prophook := func(prop *Properties) {
+		if selection.ContainsRevision(source.Revision) && source.Index == 0 {
+			if text, ok := messages[source.Revision]; ok {
+				if !prop.Contains("svn:log") {
+					prop.propkeys = append(prop.propkeys, "svn:log")
+				}
+				prop.properties["svn:log"] = text
+			}
+		}
+	}
+	source.Report(nil, prophook, nil, nil)
+}
+
+// Set the node path
+func setpath(source DumpfileSource, selection SubversionRange, newpath string) {
+	headerhook := func(header StreamSection) []byte {
+		if !selection.ContainsNode(source.Revision, source.Index) {
+			return []byte(header)
+		}
+		header, _, _ = header.replaceHook("Node-path", func(hdr string, in []byte) []byte {
+			return []byte(newpath)
+		})
+		return []byte(header)
+	}
+	source.Report(nil, nil, headerhook, nil)
+}
+
+// Report the largest blobs and heaviest revisions.
+func sizes(source DumpfileSource, selection SubversionRange, count int) {
+	out := source.Out
+	type blob struct {
+		rev      int
+		path     string
+		size     int
+		mimetype string
+	}
+	type revision struct {
+		rev   int
+		size  int
+		nodes int
+	}
+	blobs := make([]blob, 0)
+	revisions := make([]revision, 0)
+	mimetypes := make(map[string]string)
+	prophook := func(props *Properties) {
+		if source.Index == 0 {
+			return
+		}
+		if mimetype, ok := props.properties["svn:mime-type"]; ok {
+			mimetypes[source.NodePath] = mimetype
+		} else {
+			delete(mimetypes, source.NodePath)
+		}
+	}
+	headerhook := func(header StreamSection) []byte {
+		if source.Index == 0 || !selection.ContainsNode(source.Revision, source.Index) {
+			return nil
+		}
+		length := header.payload("Text-content-length")
+		if length == nil {
+			return nil
+		}
+		size, _ := strconv.Atoi(string(length))
+		blobs = append(blobs, blob{source.Revision, source.NodePath, size, mimetypes[source.NodePath]})
+		if n := len(revisions); n == 0 || revisions[n-1].rev != source.Revision {
+			revisions = append(revisions, revision{rev: source.Revision})
+		}
+		revisions[len(revisions)-1].size += size
+		revisions[len(revisions)-1].nodes++
+		return nil
+	}
+	source.Report(nil, prophook, headerhook, nil)
+
+	sort.SliceStable(blobs, func(i, j int) bool { return blobs[i].size > blobs[j].size })
+	sort.SliceStable(revisions, func(i, j int) bool { return revisions[i].size > revisions[j].size })
+	fmt.Fprintln(out, "largest blobs")
+	for i := 0; i < count && i < len(blobs); i++ {
+		mimetype := blobs[i].mimetype
+		if mimetype == "" {
+			mimetype = "-"
+		}
+		fmt.Fprintf(out, "  %10d %6d %s %s\n", blobs[i].size, blobs[i].rev, blobs[i].path, mimetype)
+	}
+	fmt.Fprintln(out, "heaviest revisions")
+	for i := 0; i < count && i < len(revisions); i++ {
+		fmt.Fprintf(out, "  %10d %6d %d nodes\n", revisions[i].size, revisions[i].rev, revisions[i].nodes)
+	}
+}
+
+// Skip unwanted copies between specified revisions
+func skipcopy(source DumpfileSource, selection SubversionRange) {
+	//within := false
+	var stashPath []byte
+	var stashRev []byte
+	headerhook := func(header StreamSection) []byte {
+		if source.Revision == 0 {
+			return []byte(header)
+		}
+		if selection.Lowerbound().Equals(SubversionEndpoint{rev: source.Revision, node: source.Index}) {
+			stashRev = header.payload("Node-copyfrom-rev")
+			stashPath = header.payload("Node-copyfrom-path")
+			if stashRev == nil || stashPath == nil {
+				croak("r%s: early node of skipcopy is not a copy", source.where())
+			}
+			//within = true
+		}
+		if selection.Upperbound().Equals(SubversionEndpoint{rev: source.Revision, node: source.Index}) {
+			//within = false
+			if header.payload("Node-copyfrom-rev") == nil || header.payload("Node-copyfrom-path") == nil {
+				croak("r%s: late node of skipcopy is not a copy", source.where())
+			}
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+				return stashRev
+			})
+			header, _, _ = header.replaceHook("Node-copyfrom-path", func(hd string, in []byte) []byte {
+				return stashPath
+			})
+		}
+		return []byte(header)
+	}
+	source.Report(nil, nil, headerhook, nil)
+}
+
+// Split a dump into one renumbered dump per top-level project prefix.
+func split(source DumpfileSource, base int, template string, prefixes []string) {
+	if len(prefixes) == 0 {
+		croakUsage("split requires at least one path prefix")
+	}
+	if !strings.Contains(template, "%s") {
+		croakUsage("split output template %q has no %%s", template)
+	}
+	type splitTarget struct {
+		prefix      string
+		filename    string
+		fp          *os.File
+		out         *bufio.Writer
+		counter     int
+		renumbering map[int]int
+		pending     []byte
+	}
+	targets := make([]*splitTarget, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		prefix = strings.Trim(prefix, "/")
+		filename := strings.Replace(template, "%s", strings.Replace(prefix, "/", "-", -1), -1)
+		// Each output is written under a temporary name and only
+		// renamed into place once the whole split has succeeded.
+		fp, err := os.Create(filename + ".tmp")
+		if err != nil {
+			croakIO("split could not create %s: %v", filename, err)
+		}
+		targets = append(targets, &splitTarget{
+			prefix:      prefix,
+			filename:    filename,
+			fp:          fp,
+			out:         bufio.NewWriter(fp),
+			counter:     base,
+			renumbering: make(map[int]int),
+		})
+	}
+	onFailure(func() {
+		for _, target := range targets {
+			target.fp.Close()
+			os.Remove(target.filename + ".tmp")
+		}
+	})
+	owner := func(path string) *splitTarget {
+		path = strings.TrimPrefix(path, "/")
+		for _, target := range targets {
+			if path == target.prefix || strings.HasPrefix(path, target.prefix+"/") {
+				return target
+			}
+		}
+		return nil
+	}
+	// Same rule as renumber: a revision that was not emitted maps to
+	// the nearest emitted one below it.
+	renumberBack := func(target *splitTarget, n int) int {
+		if v, ok := target.renumbering[n]; ok {
+			return v
+		}
+		m := 0
+		for r := range target.renumbering {
+			if r <= n && r > m {
+				m = r
+			}
+		}
+		return target.renumbering[m]
+	}
+
+	// Blank lines are passed through to wherever the preceding section
+	// went; those after a dropped node go nowhere.
+	var stash []byte
+	var trailer *[]byte
+	discard := []byte{}
+	source.walk(Walker{
+		preamble: func(line []byte) {
+			for _, target := range targets {
+				target.out.Write(line)
+			}
+		},
+		revision: func(header []byte, props Properties) {
+			stash = append(header, []byte(props.Stringer())...)
+			trailer = &stash
+		},
+		blank: func(line []byte) {
+			*trailer = append(*trailer, line...)
+		},
+		node: func(header StreamSection, props *Properties, content []byte) {
+			target := owner(source.NodePath)
+			if target == nil {
+				discard = discard[:0]
+				trailer = &discard
+				return
+			}
+			if copysource := header.payload("Node-copyfrom-path"); copysource != nil && owner(string(copysource)) != target {
+				croak("r%s: copy from %s crosses the %s project boundary", source.where(), copysource, target.prefix)
+			}
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+				oldnum, _ := strconv.Atoi(string(in))
+				return []byte(strconv.Itoa(renumberBack(target, oldnum)))
+			})
+			properties := ""
+			if props != nil {
+				props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+					if owner(path) != target {
+						return "", ""
+					}
+					span := parseMergeinfoRange(revrange)
+					for i := range span.intervals {
+						span.intervals[i].Lower = renumberBack(target, span.intervals[i].Lower)
+						span.intervals[i].Upper = renumberBack(target, span.intervals[i].Upper)
+					}
+					span.Optimize()
+					return path, span.dump()
+				})
+				properties = props.Stringer()
+				header = header.setLength("Prop-content", len(properties))
+				header = header.setLength("Content", len(properties)+len(content))
+			}
+			if len(target.pending) == 0 {
+				target.pending = append(target.pending, stash...)
+			}
+			target.pending = append(target.pending, header...)
+			target.pending = append(target.pending, []byte(properties)...)
+			target.pending = append(target.pending, content...)
+			trailer = &target.pending
+		},
+		done: func() {
+			for _, target := range targets {
+				if len(target.pending) == 0 && source.Revision != 0 {
+					continue
+				}
+				revision := StreamSection(target.pending)
+				if len(revision) == 0 {
+					revision = StreamSection(stash).clone()
+				}
+				renumbered, _, _ := revision.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+					return []byte(strconv.Itoa(target.counter))
+				})
+				target.renumbering[source.Revision] = target.counter
+				target.counter++
+				target.out.Write(renumbered)
+				target.pending = nil
+			}
+		},
+	})
+
+	for _, target := range targets {
+		if err := target.out.Flush(); err != nil {
+			croakIO("split write failed: %v", err)
+		}
+		if err := target.fp.Close(); err != nil {
+			croakIO("split write failed: %v", err)
+		}
+	}
+	for _, target := range targets {
+		if err := os.Rename(target.filename+".tmp", target.filename); err != nil {
+			croakIO("split could not rename %s: %v", target.filename, err)
+		}
+	}
+}
+
+// Merge a range of revisions into one, renumbering those after it.
+func squash(source DumpfileSource, selection SubversionRange) {
+	if len(selection.intervals) != 1 {
+		croakUsage("squash requires a single revision range")
+	}
+	lo, hi := selection.Lowerbound().rev, selection.Upperbound().rev
+	if lo < 1 {
+		lo = 1
+	}
+	if hi <= lo {
+		croakUsage("squash needs a range of at least two revisions")
+	}
+	renumber := func(rev int) int {
+		if rev > hi {
+			return rev - (hi - lo)
+		}
+		if rev > lo {
+			return lo
+		}
+		return rev
+	}
+	within := func(path string, dir string) bool {
+		return path == dir || strings.HasPrefix(path, dir+"/")
+	}
+
+	// One merged operation per path, kept in order of first appearance.
+	type squashNode struct {
+		path    string
+		kind    string
+		action  string
+		header  StreamSection
+		props   *Properties
+		content []byte
+		hasText bool
+	}
+	type touch struct {
+		rev    int
+		path   string
+		action string
+	}
+	merged := make([]*squashNode, 0)
+	touched := make([]touch, 0)
+	var squashProps *Properties
+	logs := make([]string, 0)
+
+	lookup := func(path string) int {
+		for i, node := range merged {
+			if node.path == path {
+				return i
+			}
+		}
+		return -1
+	}
+	prune := func(dir string) {
+		kept := merged[:0]
+		for _, node := range merged {
+			if !strings.HasPrefix(node.path, dir+"/") {
+				kept = append(kept, node)
+			}
+		}
+		merged = kept
+	}
+	// A copy made inside the range is only safe if nothing it reads from
+	// was touched earlier in the range, since it then sees the same tree
+	// at the revision just before the range.
+	checkCopy := func(frompath string, fromrev int) {
+		for _, t := range touched {
+			if t.rev <= fromrev && (within(t.path, frompath) || (within(frompath, t.path) && t.action != "change")) {
+				croak("r%d: copy from %s@%d depends on changes being squashed", source.Revision, frompath, fromrev)
+			}
+		}
+	}
+	mergeNode := func(incoming *squashNode) {
+		i := lookup(incoming.path)
+		switch incoming.action {
+		case "delete":
+			prune(incoming.path)
+			i = lookup(incoming.path)
+			if i == -1 {
+				merged = append(merged, incoming)
+			} else if merged[i].action == "add" {
+				merged = append(merged[:i], merged[i+1:]...)
+			} else {
+				merged[i] = incoming
+			}
+		case "add", "replace":
+			prune(incoming.path)
+			if i == -1 {
+				merged = append(merged, incoming)
+				break
+			}
+			switch merged[i].action {
+			case "add":
+				incoming.action = "add"
+			default:
+				incoming.action = "replace"
+			}
+			merged[i] = incoming
+		case "change":
+			if i == -1 {
+				merged = append(merged, incoming)
+				break
+			}
+			if merged[i].action == "delete" {
+				croak("r%d: change to deleted path %s", source.Revision, incoming.path)
+			}
+			if incoming.props != nil {
+				merged[i].props = incoming.props
+			}
+			if incoming.hasText {
+				merged[i].content = incoming.content
+				merged[i].hasText = true
+			}
+		default:
+			croak("r%d: unknown action %q on %s", source.Revision, incoming.action, incoming.path)
+		}
+	}
+	// Rebuild a node header from the merged fields.
+	emitNode := func(node *squashNode) []byte {
+		var b bytes.Buffer
+		fmt.Fprintf(&b, "Node-path: %s\n", node.path)
+		if node.kind != "" {
+			fmt.Fprintf(&b, "Node-kind: %s\n", node.kind)
+		}
+		fmt.Fprintf(&b, "Node-action: %s\n", node.action)
+		if node.action == "delete" {
+			b.WriteString("\n\n")
+			return b.Bytes()
+		}
+		if frompath := node.header.payload("Node-copyfrom-path"); frompath != nil {
+			fmt.Fprintf(&b, "Node-copyfrom-rev: %s\n", node.header.payload("Node-copyfrom-rev"))
+			fmt.Fprintf(&b, "Node-copyfrom-path: %s\n", frompath)
+		}
+		properties := ""
+		if node.props != nil {
+			properties = node.props.Stringer()
+			fmt.Fprintf(&b, "Prop-content-length: %d\n", len(properties))
+		}
+		if node.hasText {
+			fmt.Fprintf(&b, "Text-content-length: %d\n", len(node.content))
+			fmt.Fprintf(&b, "Text-content-md5: %x\n", md5.Sum(node.content))
+			fmt.Fprintf(&b, "Text-content-sha1: %x\n", sha1.Sum(node.content))
+		}
+		fmt.Fprintf(&b, "Content-length: %d\n\n", len(properties)+len(node.content))
+		b.WriteString(properties)
+		b.Write(node.content)
+		b.WriteString("\n\n")
+		return b.Bytes()
+	}
+	patchMergeinfo := func(props *Properties) {
+		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+			span := parseMergeinfoRange(revrange)
+			for i := range span.intervals {
+				span.intervals[i].Lower = renumber(span.intervals[i].Lower)
+				span.intervals[i].Upper = renumber(span.intervals[i].Upper)
+			}
+			span.Optimize()
+			return path, span.dump()
+		})
+	}
+
+	out := bufio.NewWriter(source.Out)
+	flushSquash := func() {
+		if squashProps == nil {
+			return
+		}
+		if len(logs) > 0 {
+			if !squashProps.Contains("svn:log") {
+				squashProps.propkeys = append(squashProps.propkeys, "svn:log")
+			}
+			squashProps.properties["svn:log"] = strings.Join(logs, "\n\n") + "\n"
+		}
+		properties := squashProps.Stringer()
+		fmt.Fprintf(out, "Revision-number: %d\nProp-content-length: %d\nContent-length: %d\n\n%s\n",
+			lo, len(properties), len(properties), properties)
+		for _, node := range merged {
+			out.Write(emitNode(node))
+		}
+		squashProps = nil
+	}
+
+	var squashing bool
+	source.walk(Walker{
+		preamble: func(line []byte) {
+			out.Write(line)
+		},
+		revision: func(header []byte, revprops Properties) {
+			rev := source.Revision
+			if rev > hi {
+				flushSquash()
+			}
+			squashing = rev >= lo && rev <= hi
+			if squashing {
+				if logentry := strings.TrimRight(revprops.properties["svn:log"], "\n"); logentry != "" {
+					logs = append(logs, logentry)
+				}
+				if squashProps == nil {
+					squashProps = &revprops
+				} else {
+					// Later revisions win for everything but the log.
+					for _, key := range revprops.propkeys {
+						if !squashProps.Contains(key) {
+							squashProps.propkeys = append(squashProps.propkeys, key)
+						}
+						squashProps.properties[key] = revprops.properties[key]
+					}
+				}
+			} else {
+				revheader := StreamSection(header)
+				revheader, _, _ = revheader.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+					return []byte(strconv.Itoa(renumber(rev)))
+				})
+				out.Write(revheader)
+				out.WriteString(revprops.Stringer())
+			}
+		},
+		blank: func(line []byte) {
+			if !squashing {
+				out.Write(line)
+			}
+		},
+		node: func(header StreamSection, props *Properties, content []byte) {
+			rev := source.Revision
+			if props != nil {
+				patchMergeinfo(props)
+			}
+			if fromrev := header.payload("Node-copyfrom-rev"); fromrev != nil {
+				oldnum, _ := strconv.Atoi(string(fromrev))
+				if squashing && oldnum >= lo {
+					checkCopy(string(header.payload("Node-copyfrom-path")), oldnum)
+					oldnum = lo - 1
+				}
+				header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+					return []byte(strconv.Itoa(renumber(oldnum)))
+				})
+			}
+			if !squashing {
+				if props != nil {
+					properties := props.Stringer()
+					header = header.setLength("Prop-content", len(properties))
+					header = header.setLength("Content", len(properties)+len(content))
+					header = append(header, []byte(properties)...)
+				}
+				out.Write(header)
+				out.Write(content)
+				return
+			}
+			if string(header.payload("Text-delta")) == "true" {
+				croak("r%d: squash cannot merge delta node %s", source.Revision, source.NodePath)
+			}
+			action := string(header.payload("Node-action"))
+			kind := string(header.payload("Node-kind"))
+			if i := lookup(source.NodePath); kind == "" && i != -1 {
+				kind = merged[i].kind
+			}
+			mergeNode(&squashNode{
+				path:    source.NodePath,
+				kind:    kind,
+				action:  action,
+				header:  header.clone(),
+				props:   props,
+				content: content,
+				hasText: header.hasContent(),
+			})
+			touched = append(touched, touch{rev, source.NodePath, action})
+		},
+	})
+	flushSquash()
+	if err := out.Flush(); err != nil {
+		croakIO("squash write failed: %v", err)
+	}
+}
+
+// Report summary statistics on a dump.
+func stats(source DumpfileSource, selection SubversionRange) {
+	out := source.Out
+	var revisions, copies, blobBytes, revpropBytes, nodepropBytes int
+	var first, last string
+	authors := newStringSet()
+	kinds := []string{"file", "dir"}
+	actions := []string{"add", "change", "delete", "replace"}
+	nodecounts := make(map[string]int)
+	prophook := func(props *Properties) {
+		if !selection.ContainsNode(source.Revision, source.Index) {
+			return
+		}
+		if source.Index > 0 {
+			nodepropBytes += len(props.Stringer())
+			return
+		}
+		revpropBytes += len(props.Stringer())
+		if source.Revision == 0 {
+			return
+		}
+		revisions++
+		if author, ok := props.properties["svn:author"]; ok {
+			authors.Add(author)
+		}
+		if date, ok := props.properties["svn:date"]; ok {
+			if first == "" || date < first {
+				first = date
+			}
+			if date > last {
+				last = date
+			}
+		}
+	}
 	headerhook := func(header StreamSection) []byte {
-		if !selection.ContainsNode(source.Revision, source.Index) {
-			return []byte(header)
+		if source.Index == 0 || !selection.ContainsNode(source.Revision, source.Index) {
+			return nil
 		}
-		header, _, _ = header.replaceHook("Node-path", func(hdr string, in []byte) []byte {
-			return []byte(newpath)
-		})
-		return []byte(header)
+		kind := "file"
+		if header.isDir(source) {
+			kind = "dir"
+		}
+		nodecounts[kind+" "+string(header.payload("Node-action"))]++
+		if header.payload("Node-copyfrom-path") != nil {
+			copies++
+		}
+		if length := header.payload("Text-content-length"); length != nil {
+			n, _ := strconv.Atoi(string(length))
+			blobBytes += n
+		}
+		return nil
 	}
-	source.Report(nil, nil, headerhook, nil)
+	source.Report(nil, prophook, headerhook, nil)
+
+	nodes := 0
+	for _, count := range nodecounts {
+		nodes += count
+	}
+	fmt.Fprintf(out, "%-16s %d\n", "revisions", revisions)
+	fmt.Fprintf(out, "%-16s %d\n", "authors", authors.Len())
+	if first != "" {
+		fmt.Fprintf(out, "%-16s %s\n", "first date", first)
+		fmt.Fprintf(out, "%-16s %s\n", "last date", last)
+	}
+	fmt.Fprintf(out, "%-16s %d\n", "nodes", nodes)
+	for _, kind := range kinds {
+		for _, action := range actions {
+			if count := nodecounts[kind+" "+action]; count > 0 {
+				fmt.Fprintf(out, "  %-14s %d\n", kind+" "+action, count)
+			}
+		}
+	}
+	fmt.Fprintf(out, "%-16s %d\n", "copies", copies)
+	fmt.Fprintf(out, "%-16s %d\n", "blob bytes", blobBytes)
+	fmt.Fprintf(out, "%-16s %d\n", "property bytes", revpropBytes+nodepropBytes)
+	fmt.Fprintf(out, "  %-14s %d\n", "revision", revpropBytes)
+	fmt.Fprintf(out, "  %-14s %d\n", "node", nodepropBytes)
 }
 
-// Skip unwanted copies between specified revisions
-func skipcopy(source DumpfileSource, selection SubversionRange) {
-	//within := false
-	var stashPath []byte
-	var stashRev []byte
-	headerhook := func(header StreamSection) []byte {
-		if source.Revision == 0 {
-			return []byte(header)
+// Append incremental dumps to a base dump.
+func stitch(sources []string, baton *Baton, out io.Writer) {
+	if len(sources) < 2 {
+		croakUsage("stitch requires a base dump and at least one increment")
+	}
+	next := -1
+	for i, filename := range sources {
+		fp, err := os.Open(filename)
+		if err != nil {
+			croakIO("stitch could not open %s: %v", filename, err)
 		}
-		if selection.Lowerbound().Equals(SubversionEndpoint{source.Revision, source.Index}) {
-			stashRev = header.payload("Node-copyfrom-rev")
-			stashPath = header.payload("Node-copyfrom-path")
-			if stashRev == nil || stashPath == nil {
-				croak("r%s: early node of skipcopy is not a copy", source.where())
+		source := NewDumpfileSource(decompress(fp), baton)
+		source.Out = out
+		// Increments keep neither their stream header nor a revision 0.
+		if i > 0 {
+			source.skipPreamble()
+		}
+		first, offset := -1, 0
+		warned := false
+		revhook := func(header StreamSection) []byte {
+			newhdr, _, _ := header.replaceHook("Revision-number", func(hd string, in []byte) []byte {
+				oldnum, _ := strconv.Atoi(string(in))
+				if first == -1 {
+					first = oldnum
+					if next == -1 {
+						next = oldnum
+					} else if oldnum != next {
+						announce("%s starts at r%d, renumbering to follow r%d", filename, oldnum, next-1)
+					}
+					offset = next - oldnum
+				}
+				if oldnum+offset != next {
+					croakParse("%s: r%d is out of sequence, expected r%d", filename, oldnum, next-offset)
+				}
+				next++
+				return []byte(strconv.Itoa(oldnum + offset))
+			})
+			return newhdr
+		}
+		// References into an increment move with it; references to
+		// revisions before it can't be corrected if it was renumbered.
+		shift := func(n int) int {
+			if n >= first {
+				return n + offset
 			}
-			//within = true
+			if offset != 0 && !warned {
+				announce("%s refers to r%d, before its first revision; left unchanged", filename, n)
+				warned = true
+			}
+			return n
 		}
-		if selection.Upperbound().Equals(SubversionEndpoint{source.Revision, source.Index}) {
-			//within = false
-			if header.payload("Node-copyfrom-rev") == nil || header.payload("Node-copyfrom-path") == nil {
-				croak("r%s: late node of skipcopy is not a copy", source.where())
+		prophook := func(props *Properties) {
+			if offset == 0 {
+				return
 			}
-			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
-				return stashRev
+			props.MutateMergeinfo(func(path string, revrange string) (string, string) {
+				span := parseMergeinfoRange(revrange)
+				for i := range span.intervals {
+					span.intervals[i].Lower = shift(span.intervals[i].Lower)
+					span.intervals[i].Upper = shift(span.intervals[i].Upper)
+				}
+				return path, span.dump()
 			})
-			header, _, _ = header.replaceHook("Node-copyfrom-path", func(hd string, in []byte) []byte {
-				return stashPath
+		}
+		headerhook := func(header StreamSection) []byte {
+			header, _, _ = header.replaceHook("Node-copyfrom-rev", func(hd string, in []byte) []byte {
+				oldnum, _ := strconv.Atoi(string(in))
+				return []byte(strconv.Itoa(shift(oldnum)))
 			})
+			return []byte(header)
 		}
-		return []byte(header)
+		source.Report(revhook, prophook, headerhook, nil)
+		fp.Close()
 	}
-	source.Report(nil, nil, headerhook, nil)
 }
 
-func strip(source DumpfileSource, selection SubversionRange, fixed bool, patterns []string) {
+func strip(source DumpfileSource, selection SubversionRange, fixed bool, args []string) {
+	source.apply(stripHooks(&source, selection, fixed, args))
+}
+
+// stripHooks - the hooks that replace content with a short identifying
+// string, or with --digest a fixed-width digest of the content
+func stripHooks(source *DumpfileSource, selection SubversionRange, fixed bool, args []string) Hooks {
+	digest := len(args) > 0 && (args[0] == "--digest" || args[0] == "-digest")
+	patterns := args
+	if digest {
+		patterns = args[1:]
+	}
 	var matcher SegmentMatcher
 	if len(patterns) > 0 {
 		matcher = NewSegmentMatcher(patterns, fixed)
@@ -2394,25 +8047,153 @@ func strip(source DumpfileSource, selection SubversionRange, fixed bool, pattern
 		}
 		return []byte(header)
 	}
-	contenthook := func(content []byte) []byte {
-		if stripIt {
+	contentjob := func() func([]byte) []byte {
+		if !stripIt {
+			return nil
+		}
+		tell := fmt.Sprintf("Revision is %d, file path is %s.\n",
+			source.Revision, source.NodePath)
+		return func(content []byte) []byte {
 			if len(content) > 0 { //len([]nil == 0)
 				// Avoid replacing symlinks, a reposurgeon sanity check barfs.
-				if !bytes.HasPrefix(content, []byte("link ")) {
-					tell := fmt.Sprintf("Revision is %d, file path is %s.\n",
-						source.Revision, source.NodePath)
-					content = []byte(tell)
+				if bytes.HasPrefix(content, []byte("link ")) {
+					return content
 				}
+				if digest {
+					// Same content, same cookie, whatever the revision.
+					sum := sha1.Sum(content)
+					return []byte(fmt.Sprintf("%x\n", sum[:8]))
+				}
+				content = []byte(tell)
 			}
+			return content
 		}
-		return content
 	}
-	source.Report(nil, nil, headerhook, contenthook)
+	return Hooks{headerhook: headerhook, contentjob: contentjob}
+}
+
+// Propose a branch and tag layout from directory creations and copies.
+func structure(source DumpfileSource, selection SubversionRange) {
+	out := source.Out
+	type structureEntry struct {
+		kind    string
+		path    string
+		rev     int
+		from    string
+		fromrev int
+		deleted int
+	}
+	within := func(path string, dir string) bool {
+		return path == dir || strings.HasPrefix(path, dir+"/")
+	}
+	split := func(path string) (string, string) {
+		if i := strings.LastIndex(path, "/"); i != -1 {
+			return path[:i], path[i+1:]
+		}
+		return "", path
+	}
+	entries := make([]*structureEntry, 0)
+	roots := newOrderedStringSet()
+	// Directories under branches or tags created by plain adds rather
+	// than copies, which can be projects in a layout-first repository.
+	plain := newStringSet()
+	swapped := newOrderedStringSet()
+	headerhook := func(header StreamSection) []byte {
+		if source.Index == 0 || !selection.ContainsNode(source.Revision, source.Index) {
+			return nil
+		}
+		path := source.NodePath
+		action := string(header.payload("Node-action"))
+		if action == "delete" || action == "replace" {
+			for _, entry := range entries {
+				if entry.deleted == 0 && within(entry.path, path) {
+					entry.deleted = source.Revision
+				}
+			}
+			if action == "delete" {
+				return nil
+			}
+		}
+		if !header.isDir(source) {
+			return nil
+		}
+		parent, base := split(path)
+		grandparent, project := split(parent)
+		_, layout := split(parent)
+		if base == "trunk" || base == "branches" || base == "tags" {
+			roots.Add(parent)
+		}
+		frompath := header.payload("Node-copyfrom-path")
+		if frompath == nil {
+			if layout == "branches" || layout == "tags" {
+				plain.Add(path)
+			}
+			if base == "trunk" {
+				entries = append(entries, &structureEntry{kind: "trunk", path: path, rev: source.Revision})
+			}
+			return nil
+		}
+		entry := &structureEntry{path: path, rev: source.Revision, from: string(frompath)}
+		entry.fromrev, _ = strconv.Atoi(string(header.payload("Node-copyfrom-rev")))
+		switch {
+		case base == "trunk":
+			entry.kind = "trunk"
+		case parent == "trunk" && strings.HasSuffix("/"+entry.from, "/trunk"):
+			// trunk/PROJECT copied from another trunk, the other half
+			// of the layout-first form
+			entry.kind = "trunk"
+			swapped.Add(base)
+		case layout == "branches":
+			entry.kind = "branch"
+		case layout == "tags":
+			entry.kind = "tag"
+		case plain.Contains(parent) && (grandparent == "branches" || grandparent == "tags"):
+			// branches/PROJECT/NAME, the form swap straightens out
+			entry.kind = map[string]string{"branches": "branch", "tags": "tag"}[grandparent]
+			swapped.Add(project)
+		default:
+			// Copies below a branch are ordinary content, not structure.
+			for _, other := range entries {
+				if other.kind != "copy" && other.deleted == 0 && strings.HasPrefix(path, other.path+"/") {
+					return nil
+				}
+			}
+			entry.kind = "copy"
+		}
+		entries = append(entries, entry)
+		return nil
+	}
+	source.Report(nil, nil, headerhook, nil)
+
+	if len(roots) == 0 {
+		fmt.Fprintln(out, "layout none")
+	}
+	for _, root := range roots {
+		if root == "" {
+			fmt.Fprintln(out, "layout standard")
+		} else if _, layout := split(root); layout != "branches" && layout != "tags" {
+			fmt.Fprintf(out, "layout project %s\n", root)
+		}
+	}
+	for _, project := range swapped {
+		fmt.Fprintf(out, "layout swapped %s\n", project)
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(out, "%-6s %s r%d", entry.kind, entry.path, entry.rev)
+		if entry.from != "" {
+			fmt.Fprintf(out, " from %s@%d", entry.from, entry.fromrev)
+		}
+		if entry.deleted != 0 {
+			fmt.Fprintf(out, " deleted r%d", entry.deleted)
+		}
+		fmt.Fprintln(out)
+	}
 }
 
 // Hack paths by swapping the top two components - if "structural" is on, be Subversion-aware
 // and also attempt to merge spans of partial branch creations.
 func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns []string, structural bool) {
+	out := source.Out
 	var matcher SegmentMatcher
 	if len(patterns) > 0 {
 		matcher = NewSegmentMatcher(patterns, fixed)
@@ -2463,12 +8244,12 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 	swapper := func(sourcehdr string, path []byte, parsed parsedNode) []byte {
 		// mergeinfo paths are rooted - leading slash should
 		// be ignored, then restored.
-		rooted := len(path) > 0 && (path[0] == byte(os.PathSeparator))
+		rooted := len(path) > 0 && (path[0] == byte(pathsep))
 		if rooted {
 			path = path[1:]
 		}
 		originalPath := path
-		parts := bytes.Split(path, []byte{os.PathSeparator})
+		parts := bytes.Split(path, []byte{pathsep})
 		if len(parts) >= 2 {
 			// Swapping logic
 			project := string(parts[0])
@@ -2494,7 +8275,7 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 							// This is where we capture information about what
 							// branches and tags exist under a specified project
 							// directory.
-							key := project + string(os.PathSeparator) + under
+							key := project + string(pathsep) + under
 							subbranch := string(parts[2])
 							switch parsed.role {
 							case "add":
@@ -2552,7 +8333,7 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 									parts = append(parts, []byte(project))
 								}
 							case "mergeinfo":
-								croak("r$s: unexpected mergeinfo of path %s",
+								croak("r%s: unexpected mergeinfo of path %s",
 									source.where(), path)
 							default:
 								croak("r%s: unexpected action %s on path %s",
@@ -2563,11 +8344,11 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 				}
 			}
 			if debug >= debugLOGIC {
-				new := bytes.Join(parts, []byte{os.PathSeparator})
+				new := bytes.Join(parts, []byte{pathsep})
 				fmt.Fprintf(os.Stderr, "<r%s: swap of %s %s %s -> %s>\n",
 					source.where(), parsed.role, sourcehdr, originalPath, new)
 			}
-			swapped := string(bytes.Join(parts, []byte{os.PathSeparator}))
+			swapped := string(bytes.Join(parts, []byte{pathsep}))
 			copyable := func(parts [][]byte) bool {
 				if len(parts) == 2 && string(parts[0]) == "trunk" {
 					return true
@@ -2580,7 +8361,7 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 			if structural && !stdlayout(path) && parsed.isDir && copyable(parts) {
 				var old []byte
 				if debug >= debugLOGIC {
-					old = bytes.Join(parts, []byte{os.PathSeparator})
+					old = bytes.Join(parts, []byte{pathsep})
 				}
 				if sourcehdr == "Node-path" {
 					if parsed.isCopy {
@@ -2597,7 +8378,7 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 						}
 						if debug >= debugLOGIC {
 							fmt.Fprintf(os.Stderr, "<r%s: from %s deleting %s>\n",
-								source.where(), source.NodePath, bytes.Join(parts, []byte{os.PathSeparator}))
+								source.where(), source.NodePath, bytes.Join(parts, []byte{pathsep}))
 						}
 						lastPromotedSource = ""
 					}
@@ -2610,16 +8391,16 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 					}
 				}
 				if debug >= debugLOGIC {
-					new := bytes.Join(parts, []byte{os.PathSeparator})
+					new := bytes.Join(parts, []byte{pathsep})
 					fmt.Fprintf(os.Stderr, "<r%s: trim of %s %s -> %s>\n",
 						source.where(), sourcehdr, old, new)
 				}
 			}
 		}
 		if rooted {
-			parts[0] = append([]byte{os.PathSeparator}, parts[0]...)
+			parts[0] = append([]byte{pathsep}, parts[0]...)
 		}
-		return bytes.Join(parts, []byte{os.PathSeparator})
+		return bytes.Join(parts, []byte{pathsep})
 	}
 	prophook := func(props *Properties) {
 		props.MutateMergeinfo(func(path string, revrange string) (string, string) {
@@ -2628,9 +8409,59 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 			return string(swapper("", []byte(path), dummy)), revrange
 		})
 	}
+	// In the structural case the swapped hierarchy needs top-level
+	// trunk/branches/tags directories, and a directory for each branch
+	// and tag, that the original never created. Track which exist in the
+	// output and synthesize adds for missing ones just before the first
+	// node that needs them.
+	structure := make(map[string]bool)
+	structurePath := func(path string) bool {
+		parts := strings.Split(path, "/")
+		if parts[0] == "trunk" {
+			return len(parts) == 1
+		}
+		return (parts[0] == "branches" || parts[0] == "tags") && len(parts) <= 2
+	}
+	noteStructure := func(header StreamSection) {
+		path := string(header.payload("Node-path"))
+		if !structurePath(path) {
+			return
+		}
+		if bytes.Equal(header.payload("Node-action"), []byte("delete")) {
+			for dir := range structure {
+				if dir == path || strings.HasPrefix(dir, path+"/") {
+					delete(structure, dir)
+				}
+			}
+		} else if header.isDir(source) {
+			structure[path] = true
+		}
+	}
+	mkdirs := func(header StreamSection) []byte {
+		parts := strings.Split(string(header.payload("Node-path")), "/")
+		depth := 1
+		if parts[0] == "branches" || parts[0] == "tags" {
+			depth = 2
+		} else if parts[0] != "trunk" {
+			return nil
+		}
+		var out []byte
+		for i := 1; i <= depth && i < len(parts); i++ {
+			dir := strings.Join(parts[:i], "/")
+			if !structure[dir] {
+				structure[dir] = true
+				out = append(out, fmt.Sprintf("Node-path: %s\nNode-kind: dir\nNode-action: add\nProp-content-length: 10\nContent-length: 10\n\nPROPS-END\n\n\n", dir)...)
+			}
+		}
+		noteStructure(header)
+		return out
+	}
 	var oldval, newval []byte
 	headerhook := func(header StreamSection) []byte {
 		if !selection.ContainsNode(source.Revision, source.Index) || source.Revision == 0 {
+			if source.Revision > 0 {
+				noteStructure(header)
+			}
 			return []byte(header)
 		}
 		nodePath := header.payload("Node-path")
@@ -2648,7 +8479,7 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 		// All operations, includung copies.
 		if len(patterns) == 0 || matcher.pathmatch(string(nodePath)) {
 			// Special handling of operations on bare project directories
-			if structural && bytes.Count(nodePath, []byte{os.PathSeparator}) == 0 {
+			if structural && bytes.Count(nodePath, []byte{pathsep}) == 0 {
 				// Top-level copies must be split
 				if parsed.role == "copy" {
 					if header.hasProperties() {
@@ -2670,17 +8501,21 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 						}
 						return append(out, '\n')
 					}
-					os.Stdout.Write(prefixer(header, "trunk/"))
+					trunkcopy := prefixer(header, "trunk/")
+					out.Write(mkdirs(trunkcopy))
+					out.Write(trunkcopy)
 					for _, under := range [2]string{"branches", "tags"} {
 						copyfrom := string(header.payload("Node-copyfrom-path"))
-						key := copyfrom + string(os.PathSeparator) + under
+						key := copyfrom + string(pathsep) + under
 						for _, subpart := range wildcards[key] {
 							// Add to tracking set in case of future copies from here
-							key := source.NodePath + string(os.PathSeparator) + string(under)
+							key := source.NodePath + string(pathsep) + string(under)
 							trackSet := wildcards[key]
 							trackSet.Add(subpart)
 							wildcards[key] = trackSet
-							os.Stdout.Write(prefixer(header, under+"/"+subpart+"/"))
+							subcopy := prefixer(header, under+"/"+subpart+"/")
+							out.Write(mkdirs(subcopy))
+							out.Write(subcopy)
 						}
 					}
 					return nil
@@ -2723,13 +8558,16 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 			})
 			if bytes.Contains(newval, []byte{wildcardMark}) {
 				header, _, _ = header.replaceHook("Node-path", func(hd string, in []byte) []byte {
-					return append(in, os.PathSeparator, wildcardMark)
+					return append(in, pathsep, wildcardMark)
 				})
 			}
 		}
 
 		if wildcardKey == "" {
-			return []byte(header)
+			if !structural {
+				return []byte(header)
+			}
+			return append(mkdirs(header), header...)
 		}
 		all := make([]byte, 0)
 		for _, subbranch := range wildcards[wildcardKey].Iterate() {
@@ -2738,6 +8576,7 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 				-1))
 			clone = clone.delete("Prop-content-length")
 			clone = clone.delete("Content-length")
+			all = append(all, mkdirs(clone)...)
 			all = append(all, []byte(clone)...)
 		}
 		return all
@@ -2746,7 +8585,12 @@ func swap(source DumpfileSource, selection SubversionRange, fixed bool, patterns
 }
 
 // Neutralize the input test load
-func testify(source DumpfileSource, counter int) {
+func testify(source DumpfileSource, counter int, preserveDeltas bool, start time.Time) {
+	out := source.Out
+	// With preserveDeltas, the date of the first revision, from which
+	// the others are offset.
+	var origin time.Time
+	originSeen := false
 	const NeutralUser = "fred"
 	const NeutralUserLen = len(NeutralUser)
 	var p []byte
@@ -2806,16 +8650,26 @@ func testify(source DumpfileSource, counter int) {
 			line = []byte(NeutralUser + linesep)
 			state = 0
 		} else if state == 6 {
-			t := time.Unix(int64((counter-1)*10), 0).UTC().Format(time.RFC3339)
-			t2 := t[:19] + ".000000Z"
-			line = []byte(t2 + linesep)
+			stamp := start.Add(time.Duration(counter-1) * 10 * time.Second)
+			if preserveDeltas {
+				date, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(line)))
+				if err != nil {
+					croakParse("ill-formed svn:date %q at line %d", bytes.TrimSpace(line), source.Lbs.linenumber)
+				}
+				if !originSeen {
+					origin, originSeen = date, true
+				}
+				stamp = start.Add(date.Sub(origin))
+			}
+			// Subversion's format, so the property length is unchanged.
+			line = []byte(stamp.UTC().Format("2006-01-02T15:04:05.000000Z") + linesep)
 			state = 0
 		}
 
 		if saveToHeaderBuf {
 			headerBuf = append(headerBuf, line...)
 		} else {
-			os.Stdout.Write(line)
+			out.Write(line)
 		}
 
 		if state >= 2 {
@@ -2829,6 +8683,24 @@ func main() {
 	var base int
 	var fixed bool
 	var logentries string
+	var closureRevisions bool
+	var foldLogs bool
+	var namesOnly bool
+	var format string
+	var logTemplate string
+	var copyChains bool
+	var messageDir string
+	var reverse bool
+	var verbose bool
+	var kindstr string
+	var actionstr string
+	var loadMap string
+	var saveMap string
+	var datestr string
+	var authorstr string
+	var identityProperty string
+	var skipVolatile bool
+	var output string
 	var property string
 	var rangestr string
 	var segment string
@@ -2836,38 +8708,128 @@ func main() {
 	input := os.Stdin
 	flag.IntVar(&base, "b", 0, "base value to renumber from")
 	flag.IntVar(&base, "base", 0, "base value to renumber from")
+	flag.BoolVar(&verbose, "v", false, "list changed paths in log entries")
+	flag.BoolVar(&verbose, "verbose", false, "list changed paths in log entries")
+	flag.StringVar(&datestr, "D", "", "set selection date window")
+	flag.StringVar(&datestr, "dates", "", "set selection date window")
+	flag.StringVar(&authorstr, "A", "", "set selection author filter")
+	flag.StringVar(&authorstr, "author", "", "set selection author filter")
 	flag.IntVar(&debug, "d", 0, "enable debug messages")
 	flag.IntVar(&debug, "debug", 0, "enable debug messages")
+	flag.BoolVar(&expandDeltas, "x", false, "expand deltas to full text")
+	flag.BoolVar(&expandDeltas, "expand-deltas", false, "expand deltas to full text")
+	flag.StringVar(&actionstr, "a", "", "set node actions for sift or expunge")
+	flag.StringVar(&actionstr, "action", "", "set node actions for sift or expunge")
+	flag.StringVar(&kindstr, "k", "", "set node kinds for sift or expunge")
+	flag.StringVar(&kindstr, "kind", "", "set node kinds for sift or expunge")
+	flag.BoolVar(&copyChains, "c", false, "show copy chains in see output")
+	flag.BoolVar(&copyChains, "copy-chain", false, "show copy chains in see output")
+	flag.BoolVar(&fixCopyfrom, "C", false, "repair copies from revisions not emitted")
+	flag.BoolVar(&fixCopyfrom, "fix-copyfrom", false, "repair copies from revisions not emitted")
+	flag.BoolVar(&reverse, "e", false, "reverse the order of log entries")
+	flag.BoolVar(&reverse, "reverse", false, "reverse the order of log entries")
+	flag.BoolVar(&foldLogs, "F", false, "fold logs of dropped revisions into the next")
+	flag.BoolVar(&foldLogs, "fold-logs", false, "fold logs of dropped revisions into the next")
+	flag.StringVar(&compressFormat, "z", "", "compress output with gzip, bzip2, xz, or zstd")
+	flag.StringVar(&compressFormat, "compress", "", "compress output with gzip, bzip2, xz, or zstd")
+	flag.StringVar(&scriptText, "E", "", "give script commands on the command line")
+	flag.StringVar(&scriptText, "expression", "", "give script commands on the command line")
 	flag.BoolVar(&fixed, "f", false, "disable regexp interpretation")
 	flag.BoolVar(&fixed, "fixed", false, "disable regexp interpretation")
+	flag.BoolVar(&globPatterns, "g", false, "interpret patterns as shell globs")
+	flag.BoolVar(&globPatterns, "glob", false, "interpret patterns as shell globs")
+	flag.BoolVar(&ignoreCase, "y", false, "match path patterns regardless of case")
+	flag.BoolVar(&ignoreCase, "ignore-case", false, "match path patterns regardless of case")
+	flag.BoolVar(&rehash, "H", false, "recompute text checksums")
+	flag.BoolVar(&rehash, "recompute-hashes", false, "recompute text checksums")
+	flag.StringVar(&format, "T", "", "set output format for see or log")
+	flag.StringVar(&format, "format", "", "set output format for see or log")
+	flag.StringVar(&logTemplate, "u", "", "set template for log entries")
+	flag.StringVar(&logTemplate, "template", "", "set template for log entries")
+	flag.StringVar(&identityProperty, "I", "", "set property to stash full author identity in")
+	flag.StringVar(&identityProperty, "identity-property", "", "set property to stash full author identity in")
 	flag.StringVar(&infile, "i", "", "set input file")
 	flag.StringVar(&infile, "infile", "", "set input file")
 	flag.StringVar(&logentries, "l", "", "pass in log patch")
 	flag.StringVar(&logentries, "logentries", "", "pass in log patch")
+	flag.StringVar(&messageDir, "L", "", "pass in a directory of log messages")
+	flag.StringVar(&messageDir, "message-dir", "", "pass in a directory of log messages")
+	flag.StringVar(&loadMap, "m", "", "load name mapping for obscure or revision mapping for renumber")
+	flag.StringVar(&loadMap, "load-map", "", "load name mapping for obscure or revision mapping for renumber")
+	flag.StringVar(&loadMap, "map-in", "", "load name mapping for obscure or revision mapping for renumber")
+	flag.StringVar(&saveMap, "M", "", "save name mapping from obscure or revision mapping from renumber")
+	flag.StringVar(&saveMap, "save-map", "", "save name mapping from obscure or revision mapping from renumber")
+	flag.StringVar(&saveMap, "map-out", "", "save name mapping from obscure or revision mapping from renumber")
+	flag.BoolVar(&namesOnly, "n", false, "report only revisions and paths from grep")
+	flag.BoolVar(&namesOnly, "names-only", false, "report only revisions and paths from grep")
+	flag.StringVar(&output, "o", "", "set output file, or output filename template for split")
+	flag.StringVar(&output, "output", "", "set output file, or output filename template for split")
+	flag.StringVar(&output, "outfile", "", "set output file, or output filename template for split")
 	flag.StringVar(&property, "p", "svn:executable", "set property to be cleaned")
 	flag.StringVar(&property, "property", "svn:executable", "set property to be cleaned")
 	flag.BoolVar(&quiet, "q", false, "disable progress messages")
 	flag.BoolVar(&quiet, "quiet", false, "disable progress messages")
+	flag.BoolVar(&jsonErrors, "J", false, "report fatal errors as JSON")
+	flag.BoolVar(&dryRun, "N", false, "count what would change, emitting nothing")
+	flag.BoolVar(&dryRun, "dry-run", false, "count what would change, emitting nothing")
+	flag.BoolVar(&jsonErrors, "json-errors", false, "report fatal errors as JSON")
+	flag.BoolVar(&closureRevisions, "R", false, "report revisions from closure")
+	flag.BoolVar(&closureRevisions, "revisions", false, "report revisions from closure")
 	flag.StringVar(&rangestr, "r", "", "set selection range")
 	flag.StringVar(&rangestr, "range", "", "set selection range")
 	flag.StringVar(&segment, "s", "trunk", "set set segment for push operation")
 	flag.StringVar(&segment, "segment", "trunk", "set set segment for push operation")
+	flag.BoolVar(&skipVolatile, "V", false, "ignore checksums in diff")
+	flag.BoolVar(&skipVolatile, "skip-volatile", false, "ignore checksums in diff")
 	flag.StringVar(&tag, "t", "", "set error tag")
 	flag.StringVar(&tag, "tag", "", "set error tag")
+	loadConfig()
 	flag.Parse()
 
 	if tag != "" {
 		tag = "(" + tag + ")"
 	}
+	if fixed && globPatterns {
+		croakUsage("-f and -g are mutually exclusive")
+	}
 	if rangestr != "" {
+		rangestr = expandSelection(rangestr, nil)
 		selection = NewSubversionRange(rangestr)
 	}
+	// Selections counting from the end need a first pass over the input.
+	shapeNeeded := needsShape(rangestr)
+	if datestr != "" {
+		selection.dates = NewDateWindow(datestr)
+	}
+	if authorstr != "" {
+		var err error
+		if selection.author, err = regexp.Compile(authorstr); err != nil {
+			croakUsage("ill-formed author filter: %v", err)
+		}
+		revisionAuthors = make(map[int]string)
+	}
+	var kinds, actions []string
+	if kindstr != "" {
+		kinds = strings.Split(kindstr, ",")
+		for _, kind := range kinds {
+			if kind != "file" && kind != "dir" {
+				croakUsage("unknown node kind %q", kind)
+			}
+		}
+	}
+	if actionstr != "" {
+		actions = strings.Split(actionstr, ",")
+		for _, action := range actions {
+			if action != "add" && action != "change" && action != "delete" && action != "replace" {
+				croakUsage("unknown node action %q", action)
+			}
+		}
+	}
 	if infile != "" {
 		var err error
 		input, err = os.Open(infile)
 		if err != nil {
-			fmt.Fprint(os.Stderr, "Input file open failed.\n")
-			os.Exit(1)
+			croakIO("input file open failed: %v", err)
 		}
 	}
 	if debug >= debugPARSE {
@@ -2875,11 +8837,13 @@ func main() {
 	}
 
 	if flag.NArg() == 0 {
-		fmt.Fprint(os.Stderr, "Type 'repocutter help' for usage.\n")
-		os.Exit(1)
+		croakUsage("no subcommand given; type 'repocutter help' for usage")
 	} else if debug >= debugPARSE {
 		fmt.Fprintf(os.Stderr, "<command=%s>\n", flag.Arg(0))
 	}
+	if dryRun && !dryRunCommands.Contains(flag.Arg(0)) {
+		croakUsage("%s does not support a dry run", flag.Arg(0))
+	}
 	var baton *Baton
 	if flag.Arg(0) != "help" && flag.Arg(0) != "version" {
 		if !quiet {
@@ -2889,15 +8853,76 @@ func main() {
 		}
 	}
 
+	// Output goes to standard output unless -o names a file; split
+	// takes -o as the template for its own output files instead.
+	// It is compressed if -z says so or the file's suffix implies it.
+	var out io.Writer = os.Stdout
+	var outfp *os.File
+	var outbuf *bufio.Writer
+	var compressor io.WriteCloser
+	var compressed compression
+	if compressFormat != "" {
+		var ok bool
+		if compressed, ok = compressionNamed(compressFormat); !ok {
+			croakUsage("unknown compression format %q", compressFormat)
+		}
+	}
+	if output != "" && flag.Arg(0) != "split" {
+		var err error
+		if outfp, err = os.Create(output); err != nil {
+			croakIO("could not open output file: %v", err)
+		}
+		outbuf = bufio.NewWriter(outfp)
+		out = outbuf
+		if compressFormat == "" {
+			compressed, _ = compressionFor(output)
+		}
+	}
+	if compressed.name != "" && flag.Arg(0) != "split" {
+		compressor = compressOutput(out, compressed)
+		out = compressor
+	}
+	finish := func() {
+		if compressor != nil {
+			if err := compressor.Close(); err != nil {
+				croakIO("could not finish %s output: %v", compressed.name, err)
+			}
+		}
+		if outbuf == nil {
+			return
+		}
+		if err := outbuf.Flush(); err != nil {
+			croakIO("could not write output file: %v", err)
+		}
+		if err := outfp.Close(); err != nil {
+			croakIO("could not close output file: %v", err)
+		}
+	}
+	newSource := func() DumpfileSource {
+		if shapeNeeded && shape == nil {
+			input = prescan(input)
+		}
+		source := NewDumpfileSource(decompress(baton.meter(input)), baton)
+		source.Out = out
+		return source
+	}
+
 	assertNoArgs := func() {
 		if len(flag.Args()) != 1 {
-			croak("extra arguments detected after command keyword!\n")
+			croakUsage("extra arguments detected after command keyword!\n")
 		}
 	}
 
 	assertNoSelection := func() {
-		if rangestr != "" {
-			croak("subcommand does not take a selection!\n")
+		if rangestr != "" || datestr != "" || authorstr != "" {
+			croakUsage("subcommand does not take a selection!\n")
+		}
+	}
+	// Some subcommands use only the ends of the selection, which
+	// a date window or author filter can't supply.
+	assertNoFilters := func() {
+		if datestr != "" || authorstr != "" {
+			croakUsage("subcommand does not take a date window or author filter")
 		}
 	}
 
@@ -2905,19 +8930,109 @@ func main() {
 	// immediately after a Revision-number header.
 
 	switch flag.Arg(0) {
+	case "checksum":
+		assertNoArgs()
+		assertNoSelection()
+		checksum(newSource())
+	case "atomize":
+		assertNoArgs()
+		assertNoSelection()
+		atomize(newSource())
+	case "attribution":
+		if len(flag.Args()) != 2 {
+			croakUsage("attribution requires an author map file")
+		}
+		attribution(newSource(), selection, flag.Args()[1], identityProperty)
+	case "authors":
+		authors(newSource(), selection, flag.Args()[1:])
 	case "closure":
-		closure(NewDumpfileSource(input, baton), selection, flag.Args()[1:])
+		closure(newSource(), selection, fixed, flag.Args()[1:], closureRevisions)
+	case "coalesce":
+		var window time.Duration
+		if len(flag.Args()) > 2 {
+			croakUsage("coalesce takes at most one argument")
+		} else if len(flag.Args()) == 2 {
+			var err error
+			if window, err = time.ParseDuration(flag.Args()[1]); err != nil || window < 0 {
+				croakUsage("coalesce window must be a duration such as 5m, not %q", flag.Args()[1])
+			}
+		}
+		coalesce(newSource(), selection, window)
+	case "dateshift":
+		args := flag.Args()[1:]
+		for i, arg := range args {
+			if fields := strings.SplitN(arg, "=", 2); len(fields) == 2 {
+				args[i] = expandSelection(fields[0], nil) + "=" + fields[1]
+			}
+		}
+		shapeNeeded = shapeNeeded || needsShape(strings.Join(args, " "))
+		dateshift(newSource(), selection, args)
+	case "debranch":
+		if len(flag.Args()) < 2 || len(flag.Args()) > 3 {
+			croakUsage("debranch requires a branch directory and an optional target")
+		}
+		target := "trunk"
+		if len(flag.Args()) == 3 {
+			target = flag.Args()[2]
+		}
+		debranch(newSource(), selection, flag.Args()[1], target)
+	case "dedup":
+		assertNoArgs()
+		dedup(newSource(), selection)
+	case "dekeyword":
+		dekeyword(newSource(), selection, fixed, flag.Args()[1:])
 	case "deselect":
 		assertNoArgs()
-		deselect(NewDumpfileSource(input, baton), selection)
+		deselect(newSource(), selection)
+	case "diff":
+		assertNoSelection()
+		if diff(flag.Args()[1:], skipVolatile, baton, out) > 0 {
+			finish()
+			if baton != nil {
+				baton.End("differences found")
+			}
+			os.Exit(findingsStatus)
+		}
 	case "docgen": // Not documented
 		assertNoArgs()
 		assertNoSelection()
 		dumpDocs()
+	case "emptydrop":
+		assertNoArgs()
+		assertNoSelection()
+		emptydrop(newSource(), foldLogs)
+	case "eol":
+		if len(flag.Args()) < 2 {
+			croakUsage("eol requires a style, lf or crlf")
+		}
+		eol(newSource(), selection, fixed, flag.Args()[1], flag.Args()[2:])
+	case "execfix":
+		if len(flag.Args()) < 2 {
+			croakUsage("execfix requires at least one file pattern")
+		}
+		expandDeltas = true
+		execfix(newSource(), selection, flag.Args()[1:])
+	case "export-git":
+		branch := "master"
+		if len(flag.Args()) > 2 {
+			croakUsage("export-git takes at most one branch name")
+		} else if len(flag.Args()) == 2 {
+			branch = flag.Args()[1]
+		}
+		exportGit(newSource(), selection, branch)
 	case "expunge":
-		expungesift(NewDumpfileSource(input, baton), selection, true, fixed, flag.Args()[1:])
+		expungesift(newSource(), selection, true, fixed, kinds, actions, flag.Args()[1:])
+	case "externals":
+		externals(newSource(), selection, flag.Args()[1:])
 	case "filecopy":
-		filecopy(NewDumpfileSource(input, baton), selection, fixed, flag.Args()[1:])
+		filecopy(newSource(), selection, fixed, flag.Args()[1:])
+	case "flatten":
+		flatten(newSource(), selection, fixed, flag.Args()[1:])
+	case "grep":
+		if len(flag.Args()) < 2 {
+			croakUsage("grep requires a search expression")
+		}
+		grep(newSource(), selection, fixed, namesOnly, flag.Arg(1), flag.Args()[2:])
 	case "help":
 		assertNoSelection()
 		if len(flag.Args()) == 1 {
@@ -2936,77 +9051,337 @@ func main() {
 			os.Stdout.WriteString(cdoc.text)
 			break
 		}
-		croak("no such command\n")
+		croakUsage("no such command\n")
+	case "inject":
+		assertNoSelection()
+		if len(flag.Args()) != 3 {
+			croakUsage("inject requires a revision and a file")
+		}
+		after, err := strconv.Atoi(flag.Args()[1])
+		if err != nil || after < 0 {
+			croakUsage("inject requires a revision number, not %q", flag.Args()[1])
+		}
+		inject(newSource(), after, flag.Args()[2])
+	case "join":
+		assertNoSelection()
+		join(flag.Args()[1:], base, baton, out)
+	case "linkfix":
+		reportOnly := false
+		if len(flag.Args()) > 2 || (len(flag.Args()) == 2 && flag.Arg(1) != "report") {
+			croakUsage("linkfix takes only an optional \"report\" argument")
+		} else if len(flag.Args()) == 2 {
+			reportOnly = true
+		}
+		linkfix(newSource(), selection, reportOnly)
+	case "lint":
+		assertNoArgs()
+		assertNoSelection()
+		if lint(newSource()) > 0 {
+			finish()
+			if baton != nil {
+				baton.End("problems found")
+			}
+			os.Exit(findingsStatus)
+		}
+	case "ls":
+		assertNoFilters()
+		ls(newSource(), selection, flag.Args()[1:])
+	case "lastchange":
+		assertNoFilters()
+		lastchange(newSource(), selection, flag.Args()[1:])
 	case "log":
+		log(newSource(), selection, fixed, reverse, logRenderer(format, logTemplate, verbose), flag.Args()[1:])
+	case "mergeinfo":
 		assertNoArgs()
-		log(NewDumpfileSource(input, baton), selection)
-	case "obscure":
+		mergeinfo(newSource(), selection)
+	case "nodedelete":
 		assertNoArgs()
-		obscure(NewNameSequence(), NewDumpfileSource(input, baton), selection)
+		assertNoFilters()
+		if rangestr == "" {
+			croakUsage("nodedelete requires a -r selection")
+		}
+		for _, interval := range selection.intervals {
+			if interval[0].node == 0 || interval[1].node == 0 {
+				croakUsage("nodedelete requires rev.node endpoints in its selection")
+			}
+		}
+		nodedelete(newSource(), selection)
+	case "obscure":
+		var keepExtensions, keepLengths bool
+		for _, arg := range flag.Args()[1:] {
+			switch arg {
+			case "--keep-extensions", "-keep-extensions":
+				keepExtensions = true
+			case "--keep-lengths", "-keep-lengths":
+				keepLengths = true
+			default:
+				croakUsage("unknown obscure option %s", arg)
+			}
+		}
+		seq := NewNameSequence()
+		if loadMap != "" {
+			fp, err := os.Open(loadMap)
+			if err != nil {
+				croakIO("could not open name map: %v", err)
+			}
+			if err = seq.load(fp); err != nil {
+				croakParse("%s: %v", loadMap, err)
+			}
+			fp.Close()
+		}
+		obscure(seq, newSource(), selection, keepExtensions, keepLengths)
+		if saveMap != "" && !dryRun {
+			fp, err := os.Create(saveMap)
+			if err != nil {
+				croakIO("could not create name map: %v", err)
+			}
+			if err = seq.save(fp); err != nil {
+				croakIO("%s: %v", saveMap, err)
+			}
+			fp.Close()
+		}
 	case "pathlist":
-		pathlist(NewDumpfileSource(input, baton), selection)
+		pathlist(newSource(), selection)
 	case "pathrename":
-		pathrename(NewDumpfileSource(input, baton), selection, flag.Args()[1:])
+		pathrename(newSource(), selection, flag.Args()[1:])
+	case "pathselect":
+		pathselect(newSource(), selection, fixed, flag.Args()[1:])
 	case "pop":
 		assertNoSelection()
-		pop(NewDumpfileSource(input, baton), fixed, flag.Args()[1:])
+		count, patterns := 1, flag.Args()[1:]
+		if len(patterns) > 0 {
+			if n, err := strconv.Atoi(patterns[0]); err == nil {
+				if n < 1 {
+					croakUsage("pop count must be positive")
+				}
+				count, patterns = n, patterns[1:]
+			}
+		}
+		pop(newSource(), fixed, count, patterns)
 	case "propclean":
-		propclean(NewDumpfileSource(input, baton), property, flag.Args()[1:], selection)
+		propclean(newSource(), property, flag.Args()[1:], selection)
 	case "propdel":
-		propdel(NewDumpfileSource(input, baton), flag.Args()[1:], selection)
+		propdel(newSource(), selection, fixed, flag.Args()[1:])
+	case "proplist":
+		step := 0
+		if len(flag.Args()) > 2 {
+			croakUsage("proplist takes at most one argument")
+		} else if len(flag.Args()) == 2 {
+			var err error
+			if step, err = strconv.Atoi(flag.Args()[1]); err != nil || step <= 0 {
+				croakUsage("proplist step must be a positive integer, not %q", flag.Args()[1])
+			}
+		}
+		proplist(newSource(), selection, step)
 	case "propset":
-		propset(NewDumpfileSource(input, baton), flag.Args()[1:], selection)
+		propset(newSource(), selection, fixed, flag.Args()[1:])
 	case "proprename":
-		proprename(NewDumpfileSource(input, baton), flag.Args()[1:], selection)
+		proprename(newSource(), selection, fixed, flag.Args()[1:])
 	case "reduce":
-		assertNoArgs()
-		reduce(NewDumpfileSource(input, baton), selection)
+		if len(flag.Args()) > 2 {
+			croakUsage("reduce takes at most one dump file")
+		}
+		if len(flag.Args()) == 2 && flag.Arg(1) != "-" {
+			fp, err := os.Open(flag.Arg(1))
+			if err != nil {
+				croakIO("reduce could not open %s: %v", flag.Arg(1), err)
+			}
+			input = fp
+		}
+		reduce(newSource(), selection)
+	case "propstrip":
+		propstrip(newSource(), selection, flag.Args()[1:])
 	case "push":
 		assertNoSelection()
-		push(NewDumpfileSource(input, baton), segment, fixed, flag.Args()[1:])
-	case "renumber":
-		assertNoArgs()
+		push(newSource(), segment, fixed, flag.Args()[1:])
+	case "reformat":
 		assertNoSelection()
-		renumber(NewDumpfileSource(input, baton), base)
+		if len(flag.Args()) != 2 {
+			croakUsage("reformat requires a dump format version")
+		}
+		version, err := strconv.Atoi(flag.Args()[1])
+		if err != nil || version < 1 || version > 3 {
+			croakUsage("reformat version must be 1, 2 or 3, not %q", flag.Args()[1])
+		}
+		reformat(newSource(), version)
+	case "renames":
+		assertNoArgs()
+		renames(newSource(), selection)
+	case "renumber":
+		keepGaps := false
+		if len(flag.Args()) == 2 && (flag.Args()[1] == "--keep-gaps" || flag.Args()[1] == "-keep-gaps") {
+			keepGaps = true
+		} else {
+			assertNoArgs()
+		}
+		var revmap map[int]int
+		if loadMap != "" {
+			fp, err := os.Open(loadMap)
+			if err != nil {
+				croakIO("could not open revision map: %v", err)
+			}
+			if revmap, err = loadRevisionMap(fp); err != nil {
+				croakParse("%s: %v", loadMap, err)
+			}
+			fp.Close()
+		}
+		if base != 0 && !selection.whole() {
+			croakUsage("renumber can't take both -b and a selection")
+		}
+		revmap = renumber(newSource(), selection, base, keepGaps, revmap)
+		if saveMap != "" && !dryRun {
+			fp, err := os.Create(saveMap)
+			if err != nil {
+				croakIO("could not create revision map: %v", err)
+			}
+			if err = saveRevisionMap(fp, revmap); err != nil {
+				croakIO("%s: %v", saveMap, err)
+			}
+			fp.Close()
+		}
 	case "replace":
-		replace(NewDumpfileSource(input, baton), selection, flag.Args()[1])
+		if len(flag.Args()) < 2 {
+			croakUsage("replace requires at least one transform specification")
+		}
+		replace(newSource(), selection, fixed, flag.Args()[1:])
+	case "script":
+		var text string
+		if scriptText != "" {
+			assertNoArgs()
+			text = scriptText
+		} else if len(flag.Args()) != 2 {
+			croakUsage("script requires a script file or -E text")
+		} else if name := flag.Args()[1]; strings.HasPrefix(name, "@") {
+			var ok bool
+			if text, ok = pipelines[name[1:]]; !ok {
+				croakUsage("no pipeline named %s is configured", name[1:])
+			}
+		} else {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				croakIO("could not read script: %v", err)
+			}
+			text = string(data)
+		}
+		commands := nameSelections(parseScript(text))
+		if len(commands) == 0 {
+			croakUsage("script is empty")
+		}
+		for _, words := range commands {
+			shapeNeeded = shapeNeeded || needsShape(strings.Join(words, " "))
+		}
+		script(newSource(), selection, fixed, base, commands)
 	case "see":
 		assertNoArgs()
-		see(NewDumpfileSource(input, baton), selection)
+		switch format {
+		case "":
+			if copyChains {
+				croakUsage("copy chains are only shown in JSON format")
+			}
+			see(newSource(), selection)
+		case "json":
+			seeJSON(newSource(), selection, copyChains)
+		default:
+			croakUsage("unknown see format %q", format)
+		}
 	case "select":
 		assertNoArgs()
-		sselect(NewDumpfileSource(input, baton), selection)
+		sselect(newSource(), selection)
 	case "setcopyfrom":
-		setcopyfrom(NewDumpfileSource(input, baton), selection, flag.Args()[1])
+		if len(flag.Args()) < 2 {
+			croakUsage("setcopyfrom requires a new copy source")
+		}
+		setcopyfrom(newSource(), selection, fixed, flag.Args()[1], flag.Args()[2:])
 	case "setlog":
+		if logentries != "" && messageDir != "" {
+			croakUsage("setlog takes a log entries file or a message directory, not both")
+		}
+		if messageDir != "" {
+			setlogdir(newSource(), messageDir, selection)
+			break
+		}
 		if logentries == "" {
-			fmt.Fprintf(os.Stderr, "repocutter: setlog requires a log entries file.\n")
-			os.Exit(1)
+			croakUsage("setlog requires a log entries file")
 		}
-		setlog(NewDumpfileSource(input, baton), logentries, selection)
+		setlog(newSource(), logentries, selection)
 	case "setpath":
-		setpath(NewDumpfileSource(input, baton), selection, flag.Args()[1])
+		setpath(newSource(), selection, flag.Args()[1])
 	case "sift":
-		expungesift(NewDumpfileSource(input, baton), selection, false, fixed, flag.Args()[1:])
+		expungesift(newSource(), selection, false, fixed, kinds, actions, flag.Args()[1:])
+	case "sizes":
+		count := 10
+		if len(flag.Args()) > 2 {
+			croakUsage("sizes takes at most one argument")
+		} else if len(flag.Args()) == 2 {
+			var err error
+			if count, err = strconv.Atoi(flag.Args()[1]); err != nil || count < 1 {
+				croakUsage("sizes needs a positive count, not %q", flag.Args()[1])
+			}
+		}
+		sizes(newSource(), selection, count)
 	case "skipcopy":
-		skipcopy(NewDumpfileSource(input, baton), selection)
+		assertNoFilters()
+		skipcopy(newSource(), selection)
+	case "split":
+		assertNoSelection()
+		if output == "" {
+			output = "%s.svn"
+		}
+		split(newSource(), base, output, flag.Args()[1:])
+	case "squash":
+		assertNoFilters()
+		assertNoArgs()
+		if rangestr == "" {
+			croakUsage("squash requires a -r range")
+		}
+		squash(newSource(), selection)
+	case "stats":
+		assertNoArgs()
+		stats(newSource(), selection)
+	case "stitch":
+		assertNoSelection()
+		stitch(flag.Args()[1:], baton, out)
 	case "strip":
-		strip(NewDumpfileSource(input, baton), selection, fixed, flag.Args()[1:])
+		strip(newSource(), selection, fixed, flag.Args()[1:])
+	case "structure":
+		assertNoArgs()
+		structure(newSource(), selection)
 	case "swap":
-		swap(NewDumpfileSource(input, baton), selection, fixed, flag.Args()[1:], false)
+		swap(newSource(), selection, fixed, flag.Args()[1:], false)
 	case "swapsvn":
-		swap(NewDumpfileSource(input, baton), selection, fixed, flag.Args()[1:], true)
+		swap(newSource(), selection, fixed, flag.Args()[1:], true)
 	case "testify":
-		assertNoArgs()
 		assertNoSelection()
-		testify(NewDumpfileSource(input, baton), base)
+		preserveDeltas := false
+		start := time.Unix(0, 0)
+		for args := flag.Args()[1:]; len(args) > 0; args = args[1:] {
+			switch args[0] {
+			case "--preserve-deltas", "-preserve-deltas":
+				preserveDeltas = true
+			case "--start", "-start":
+				if len(args) < 2 {
+					croakUsage("testify option %s requires a date", args[0])
+				}
+				args = args[1:]
+				var err error
+				if start, err = time.Parse(time.RFC3339Nano, args[0]); err != nil {
+					if start, err = time.Parse("2006-01-02", args[0]); err != nil {
+						croakUsage("testify start must be a day or an RFC3339 timestamp, not %q", args[0])
+					}
+				}
+			default:
+				croakUsage("unknown testify option %s", args[0])
+			}
+		}
+		testify(newSource(), base, preserveDeltas, start)
 	case "version":
 		assertNoArgs()
 		assertNoSelection()
 		fmt.Println(version)
 	default:
-		croak("%q: unknown subcommand", flag.Arg(0))
+		croakUsage("%q: unknown subcommand", flag.Arg(0))
 	}
+	finish()
 	if baton != nil {
 		baton.End("")
 	}
@@ -1,9 +1,12 @@
 package main
 
 import (
-	//"fmt"
-	//"os"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
 	"testing"
+	"time"
 )
 
 func assertEqual(t *testing.T, a string, b string) {
@@ -58,8 +61,23 @@ func TestSubversionRange(t *testing.T) {
 		{"2,2.3", []int{0, 1, 3, 2}, []revnode{{2, 1}, {2, 2}, {2, 3}}},
 		{"2.1,2.3", []int{0, 1, 3, 2}, []revnode{{2, 1}, {2, 3}}},
 		{"2.1,3", []int{0, 1, 3, 2}, []revnode{{2, 1}, {3, 1}, {3, 2}}},
+		{"2.2:2.*", []int{0, 1, 3, 2}, []revnode{{2, 2}, {2, 3}}},
+		{"2.-1", []int{0, 1, 3, 2}, []revnode{{2, 3}}},
+		{"2.-2:3.-2", []int{0, 1, 3, 2}, []revnode{{2, 2}, {2, 3}, {3, 1}}},
+		{"2.-5", []int{0, 1, 3, 2}, []revnode{{2, 1}}},
+		{"2.LAST,LAST", []int{0, 1, 3, 2}, []revnode{{2, 3}, {3, 1}, {3, 2}}},
+		{"1:LAST.1", []int{0, 1, 3, 2}, []revnode{{1, 1}, {2, 1}, {2, 2}, {2, 3}, {3, 1}}},
+		{"HEAD-1:HEAD", []int{0, 1, 3, 2}, []revnode{{2, 1}, {2, 2}, {2, 3}, {3, 1}, {3, 2}}},
+		{"1+1", []int{0, 1, 3, 2}, []revnode{{2, 1}, {2, 2}, {2, 3}}},
+		{"BASE+1.1:LAST-1+1.1", []int{0, 1, 3, 2}, []revnode{{1, 1}, {2, 1}, {2, 2}, {2, 3}, {3, 1}}},
+		{"BASE+3", []int{0, 1, 3, 2}, []revnode{{3, 1}, {3, 2}}},
 	}
+	defer func() { shape = nil }()
 	for _, item := range tests {
+		shape = &streamShape{first: 0, last: len(item.nodecounts) - 1, nodes: make(map[int]int)}
+		for r, nc := range item.nodecounts {
+			shape.nodes[r] = nc
+		}
 		s := NewSubversionRange(item.spec)
 		results := make([]revnode, 0)
 		for r, nc := range item.nodecounts {
@@ -196,3 +214,130 @@ Content-length: 90
 		assertEqual(t, string(after), item.check)
 	}
 }
+
+func TestApplySvndiff(t *testing.T) {
+	// svndiff1 sections carry their original length, then either the
+	// raw bytes or, if shorter, their zlib compression.
+	section := func(data []byte, compress bool) []byte {
+		out := []byte{byte(len(data))}
+		if !compress {
+			return append(out, data...)
+		}
+		var b bytes.Buffer
+		w := zlib.NewWriter(&b)
+		w.Write(data)
+		w.Close()
+		return append(out, b.Bytes()...)
+	}
+	source := []byte("hello world\n")
+	// Copy "hello " from source, add "ab" as new data, extend it with an
+	// overlapping target copy, then copy "world\n" from source.
+	instructions := []byte{0x06, 0x00, 0x82, 0x44, 0x06, 0x06, 0x06}
+	newdata := []byte("ab")
+	expected := "hello abababworld\n"
+	window := func(ins []byte, nd []byte) []byte {
+		return append(append([]byte{0x00, byte(len(source)), byte(len(expected)), byte(len(ins)), byte(len(nd))}, ins...), nd...)
+	}
+	tests := []struct {
+		delta []byte
+		check string
+	}{
+		{[]byte("SVN\x00"), ""},
+		{append([]byte("SVN\x00"), window(instructions, newdata)...), expected},
+		{append([]byte("SVN\x01"), window(section(instructions, false), section(newdata, false))...), expected},
+		{append([]byte("SVN\x01"), window(section(instructions, true), section(newdata, false))...), expected},
+	}
+	for _, item := range tests {
+		target, err := applySvndiff(source, item.delta)
+		if err != nil {
+			t.Fatalf("applySvndiff: %v", err)
+		}
+		assertEqual(t, string(target), item.check)
+	}
+	if _, err := applySvndiff(source, []byte("SVN\x00\x00\x0d\x01\x01\x00\x01\x00")); err == nil {
+		t.Fatal("applySvndiff accepted an out-of-range source view")
+	}
+}
+
+func TestBatonProgress(t *testing.T) {
+	baton := Baton{total: 4 * 1024 * 1024}
+	assertEqual(t, baton.progress(0, 0), "0.0% 0B/4.0MiB")
+	baton.revision = 17
+	assertEqual(t, baton.progress(1024*1024, 90*time.Second),
+		"25.0% 1.0MiB/4.0MiB r17 ETA 4m30s")
+	assertEqual(t, baton.progress(4*1024*1024, 6*time.Minute),
+		"100.0% 4.0MiB/4.0MiB r17")
+	assertEqual(t, humanBytes(1536), "1.5KiB")
+}
+
+func TestBatonRedraw(t *testing.T) {
+	defer func(saved bool) { lineRedraw = saved }(lineRedraw)
+	for _, item := range []struct {
+		lineRedraw bool
+		expect     string
+	}{
+		{false, "12%\b\b\b9% \b\b\b"},
+		{true, "\rwork...12%\rwork...\rwork...9% \rwork..."},
+	} {
+		fp, err := os.CreateTemp("", "baton")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(fp.Name())
+		lineRedraw = item.lineRedraw
+		baton := Baton{stream: fp, line: "work..."}
+		baton.redraw("12%")
+		baton.redraw("9%")
+		fp.Close()
+		out, _ := os.ReadFile(fp.Name())
+		assertEqual(t, string(out), item.expect)
+	}
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	assertEqual(t, globToRegexp("trunk/*.c"), `trunk/[^/]*\.c`)
+	assertEqual(t, globToRegexp("/vendor/**"), `^vendor/.*`)
+	assertEqual(t, globToRegexp("libc++/[!a-c]?/"), `libc\+\+/[^a-c][^/]$`)
+	assertEqual(t, globToRegexp(`a\*b`), `a\*b`)
+}
+
+func TestExpandSelection(t *testing.T) {
+	names := map[string]string{"early": "1:2", "late": "7,9:HEAD"}
+	assertEqual(t, expandSelection("3:4", names), "3:4")
+	assertEqual(t, expandSelection("@early", names), "1:2")
+	assertEqual(t, expandSelection("@early,5,@late", names), "1:2,5,7,9:HEAD")
+}
+
+func TestParseTOML(t *testing.T) {
+	tables := parseTOML("test", `# comment
+quiet = true
+base = 1_000
+compress = "xz"   # trailing comment
+
+[aliases]
+"docs" = 'doc\s'
+[pipelines]
+tidy = ["propdel svn:keywords",
+	"renumber"]
+`)
+	assertEqual(t, fmt.Sprint(tables[""]["quiet"]), "true")
+	assertEqual(t, fmt.Sprint(tables[""]["base"]), "1000")
+	assertEqual(t, fmt.Sprint(tables[""]["compress"]), "xz")
+	assertEqual(t, fmt.Sprint(tables["aliases"]["docs"]), "doc\\s")
+	assertEqual(t, fmt.Sprint(tables["pipelines"]["tidy"]), "[propdel svn:keywords renumber]")
+}
+
+func TestObscureWidth(t *testing.T) {
+	seq := NewNameSequence()
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		name := seq.obscureWidth(fmt.Sprintf("s%d", i), 1)
+		if seen[name] {
+			t.Fatalf("obscureWidth: %q handed out twice", name)
+		}
+		seen[name] = true
+	}
+	assertEqual(t, fitWidth("RedFox", 3), "Red")
+	assertEqual(t, fitWidth("Ox", 5), "Oxoxo")
+	assertEqual(t, seq.obscureWidth("s0", 7), seq.obscureWidth("s0", 1))
+}
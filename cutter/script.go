@@ -0,0 +1,292 @@
+// Running several transformations in a single pass.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// If set, the text of a script rather than the name of a file holding one.
+var scriptText string
+
+// parseScript - split a script into commands, each a list of words.
+// Commands are separated by newlines or semicolons; words may be
+// quoted with single quotes, taken literally, or double quotes,
+// inside which a backslash escapes the next character.  A word
+// beginning with # starts a comment running to the end of the line.
+func parseScript(text string) [][]string {
+	commands := make([][]string, 0)
+	words := make([]string, 0)
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = make([]string, 0)
+		}
+	}
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\n' || c == ';':
+			endCommand()
+		case c == ' ' || c == '\t' || c == '\r':
+			endWord()
+		case c == '#' && !inWord:
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			endCommand()
+		case c == '\'':
+			inWord = true
+			end := strings.IndexByte(text[i+1:], '\'')
+			if end == -1 {
+				croakUsage("unterminated single quote in script")
+			}
+			word.WriteString(text[i+1 : i+1+end])
+			i += end + 1
+		case c == '"':
+			inWord = true
+			for i++; ; i++ {
+				if i >= len(text) {
+					croakUsage("unterminated double quote in script")
+				}
+				if text[i] == '"' {
+					break
+				}
+				if text[i] == '\\' && i+1 < len(text) {
+					i++
+				}
+				word.WriteByte(text[i])
+			}
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+	endCommand()
+	return commands
+}
+
+// nameSelections - carry out the define commands of a script, which
+// name selections, and expand the @ references in the selections of
+// the other commands, which are returned.
+func nameSelections(commands [][]string) [][]string {
+	names := make(map[string]string)
+	kept := make([][]string, 0, len(commands))
+	for _, words := range commands {
+		if words[0] == "define" {
+			if len(words) != 3 {
+				croakUsage("define in script needs a name and a selection")
+			}
+			if !validSelectionName.MatchString(words[1]) {
+				croakUsage("ill-formed selection name %q", words[1])
+			}
+			names[words[1]] = expandSelection(words[2], names)
+			continue
+		}
+		for i := 0; i+1 < len(words) && strings.HasPrefix(words[i], "-"); i++ {
+			if words[i] == "-r" || words[i] == "--range" {
+				words[i+1] = expandSelection(words[i+1], names)
+			}
+			if words[i] == "-r" || words[i] == "--range" || words[i] == "-b" || words[i] == "--base" {
+				i++
+			}
+		}
+		kept = append(kept, words)
+	}
+	return kept
+}
+
+var validSelectionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// composeHooks - chain the hooks of several transformations so each
+// sees the stream as the ones before it left it.  A member is left
+// nil when no stage has it, so no stage forces delta expansion
+// unless one has a content hook.  Content jobs are composed into a
+// job unless some stage has a plain content hook, which can only run
+// in stream order.
+func composeHooks(stages []Hooks) Hooks {
+	var revhooks, headerhooks []func(StreamSection) []byte
+	var prophooks []func(*Properties)
+	var contentstages []Hooks
+	hasHooks := false
+	for _, stage := range stages {
+		if stage.revhook != nil {
+			revhooks = append(revhooks, stage.revhook)
+		}
+		if stage.prophook != nil {
+			prophooks = append(prophooks, stage.prophook)
+		}
+		if stage.headerhook != nil {
+			headerhooks = append(headerhooks, stage.headerhook)
+		}
+		if stage.contenthook != nil || stage.contentjob != nil {
+			contentstages = append(contentstages, stage)
+			hasHooks = hasHooks || stage.contenthook != nil
+		}
+	}
+	// The content transformations for the current node, in order
+	transforms := func() []func([]byte) []byte {
+		fns := make([]func([]byte) []byte, 0, len(contentstages))
+		for _, stage := range contentstages {
+			if stage.contenthook != nil {
+				fns = append(fns, stage.contenthook)
+			} else if fn := stage.contentjob(); fn != nil {
+				fns = append(fns, fn)
+			}
+		}
+		return fns
+	}
+	chain := func(fns []func([]byte) []byte, content []byte) []byte {
+		for _, fn := range fns {
+			content = fn(content)
+		}
+		return content
+	}
+	var composed Hooks
+	if len(revhooks) > 0 {
+		composed.revhook = func(header StreamSection) []byte {
+			for _, hook := range revhooks {
+				header = hook(header)
+			}
+			return header
+		}
+	}
+	if len(prophooks) > 0 {
+		composed.prophook = func(properties *Properties) {
+			for _, hook := range prophooks {
+				hook(properties)
+			}
+		}
+	}
+	if len(headerhooks) > 0 {
+		// A nil header drops the node and an empty one passes
+		// through only the whitespace around it; either way later
+		// stages have nothing to act on.
+		composed.headerhook = func(header StreamSection) []byte {
+			for _, hook := range headerhooks {
+				out := hook(header)
+				if len(out) == 0 {
+					return out
+				}
+				header = StreamSection(out)
+			}
+			return []byte(header)
+		}
+	}
+	if hasHooks {
+		composed.contenthook = func(content []byte) []byte {
+			return chain(transforms(), content)
+		}
+	} else if len(contentstages) > 0 {
+		composed.contentjob = func() func([]byte) []byte {
+			fns := transforms()
+			if len(fns) == 0 {
+				return nil
+			}
+			return func(content []byte) []byte {
+				return chain(fns, content)
+			}
+		}
+	}
+	return composed
+}
+
+// scriptStage - the hooks for one command of a script.  A command may
+// begin with its own -r selection, -f, or -b base, as on the command
+// line; otherwise those given to the script apply.
+func scriptStage(source *DumpfileSource, words []string, selection SubversionRange, fixed bool, base int) Hooks {
+	for len(words) > 0 && strings.HasPrefix(words[0], "-") {
+		option := words[0]
+		words = words[1:]
+		switch option {
+		case "-f", "--fixed":
+			fixed = true
+		case "-r", "--range", "-b", "--base":
+			if len(words) == 0 {
+				croakUsage("script option %s requires an argument", option)
+			}
+			if option == "-r" || option == "--range" {
+				selection = NewSubversionRange(words[0])
+			} else {
+				n, err := strconv.Atoi(words[0])
+				if err != nil {
+					croakUsage("script option %s requires a number, not %q", option, words[0])
+				}
+				base = n
+			}
+			words = words[1:]
+		default:
+			croakUsage("unknown script option %s", option)
+		}
+	}
+	if len(words) == 0 {
+		croakUsage("script command has options but no subcommand")
+	}
+	command, args := words[0], words[1:]
+	needArgs := func(min int, max int) {
+		if len(args) < min || (max >= 0 && len(args) > max) {
+			croakUsage("wrong number of arguments to %s in script", command)
+		}
+	}
+	switch command {
+	case "deselect", "select":
+		needArgs(0, 0)
+		return doSelectHooks(source, selection, command == "deselect")
+	case "expunge", "sift":
+		needArgs(1, -1)
+		return expungesiftHooks(source, selection, command == "expunge", fixed, nil, nil, args)
+	case "pathrename":
+		needArgs(2, -1)
+		return pathrenameHooks(source, selection, args)
+	case "propdel":
+		needArgs(1, -1)
+		return propdelHooks(source, selection, fixed, args)
+	case "proprename":
+		needArgs(1, -1)
+		return proprenameHooks(source, selection, fixed, args)
+	case "propset":
+		needArgs(1, -1)
+		return propsetHooks(source, selection, fixed, args)
+	case "renumber":
+		needArgs(0, 1)
+		keepGaps := len(args) == 1 && (args[0] == "--keep-gaps" || args[0] == "-keep-gaps")
+		if len(args) == 1 && !keepGaps {
+			croakUsage("renumber in script takes only --keep-gaps, not %q", args[0])
+		}
+		if base != 0 && !selection.whole() {
+			croakUsage("renumber in script can't take both -b and a selection")
+		}
+		hooks, _ := renumberHooks(source, selection, base, keepGaps, nil)
+		return hooks
+	case "replace":
+		needArgs(1, -1)
+		return replaceHooks(source, selection, fixed, args)
+	case "strip":
+		return stripHooks(source, selection, fixed, args)
+	}
+	croakUsage("%s can't be used in a script", command)
+	return Hooks{}
+}
+
+// Run the commands of a script over the stream in one pass.
+func script(source DumpfileSource, selection SubversionRange, fixed bool, base int, commands [][]string) {
+	stages := make([]Hooks, 0, len(commands))
+	for _, words := range commands {
+		stages = append(stages, scriptStage(&source, words, selection, fixed, base))
+	}
+	source.apply(composeHooks(stages))
+}
@@ -0,0 +1,103 @@
+// Selections read from files or named earlier in a script.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// expandSelection - replace each @REFERENCE among the comma-separated
+// ranges of a selection with the ranges it stands for.  A reference is
+// a name defined earlier in a script, if names has it, or else a file.
+func expandSelection(spec string, names map[string]string) string {
+	if !strings.Contains(spec, "@") {
+		return spec
+	}
+	items := strings.Split(spec, ",")
+	for i, item := range items {
+		if !strings.HasPrefix(item, "@") {
+			continue
+		}
+		ref := item[1:]
+		if expansion, ok := names[ref]; ok {
+			items[i] = expansion
+		} else {
+			items[i] = readSelection(ref)
+		}
+		if items[i] == "" {
+			croakUsage("selection %s is empty", item)
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// readSelection - the selection a file holds.  A Subversion dump,
+// such as the output of reduce or pathselect, stands for the
+// revisions it contains; anything else is a list of ranges separated
+// by commas or whitespace, such as the output of closure -R, in which
+// a # begins a comment.
+func readSelection(filename string) string {
+	fp, err := os.Open(filename)
+	if err != nil {
+		croakIO("could not open selection file: %v", err)
+	}
+	defer fp.Close()
+	rd := bufio.NewReader(decompress(fp))
+	// A dump cut down by a selection may have lost its preamble.
+	for _, magic := range []string{"SVN-fs-dump-format-version:", "Revision-number:"} {
+		if head, _ := rd.Peek(len(magic)); string(head) == magic {
+			return dumpRevisions(rd)
+		}
+	}
+	text, err := ioutil.ReadAll(rd)
+	if err != nil {
+		croakIO("could not read selection file: %v", err)
+	}
+	ranges := make([]string, 0)
+	for _, line := range strings.Split(string(text), "\n") {
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		ranges = append(ranges, strings.FieldsFunc(line, func(c rune) bool {
+			return c == ',' || c == ' ' || c == '\t' || c == '\r'
+		})...)
+	}
+	return strings.Join(ranges, ",")
+}
+
+// dumpRevisions - the revisions of a dump as a selection, with runs
+// of consecutive revisions made into ranges
+func dumpRevisions(rd *bufio.Reader) string {
+	source := NewDumpfileSource(rd, nil)
+	source.Out = ioutil.Discard
+	revisions := make([]int, 0)
+	prophook := func(props *Properties) {
+		if source.Index == 0 {
+			revisions = append(revisions, source.Revision)
+		}
+	}
+	wasDry := dryRun
+	dryRun = false
+	source.Report(nil, prophook, nil, nil)
+	dryRun = wasDry
+	ranges := make([]string, 0)
+	for i := 0; i < len(revisions); {
+		j := i
+		for j+1 < len(revisions) && revisions[j+1] == revisions[j]+1 {
+			j++
+		}
+		if j == i {
+			ranges = append(ranges, fmt.Sprintf("%d", revisions[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d:%d", revisions[i], revisions[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ",")
+}
@@ -0,0 +1,374 @@
+// Delta expansion for dumps made with svnadmin dump --deltas or svnrdump.
+package main
+
+// Copyright by Eric S. Raymond
+// SPDX-License-Identifier: BSD-2-Clause
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// If set, delta nodes are expanded to full text even when no content
+// transformation is requested.
+var expandDeltas bool
+
+// svndiffVarint - decode one of svndiff's big-endian base-128 integers
+func svndiffVarint(data []byte, pos *int) (int, error) {
+	n := 0
+	for *pos < len(data) {
+		c := data[*pos]
+		*pos++
+		n = n<<7 | int(c&0x7f)
+		if c&0x80 == 0 {
+			return n, nil
+		}
+	}
+	return 0, errors.New("truncated integer")
+}
+
+// svndiffSection - unpack an svndiff1 instruction or new-data section,
+// which is zlib-compressed only when that made it shorter.
+func svndiffSection(data []byte) ([]byte, error) {
+	pos := 0
+	size, err := svndiffVarint(data, &pos)
+	if err != nil {
+		return nil, err
+	}
+	data = data[pos:]
+	if len(data) == size {
+		return data, nil
+	}
+	rd, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(rd)
+	if err != nil {
+		return nil, err
+	}
+	if len(out) != size {
+		return nil, fmt.Errorf("section inflated to %d bytes, expected %d", len(out), size)
+	}
+	return out, nil
+}
+
+// applySvndiff - apply an svndiff0 or svndiff1 delta to a source text
+func applySvndiff(source []byte, delta []byte) ([]byte, error) {
+	if len(delta) < 4 || !bytes.HasPrefix(delta, []byte("SVN")) {
+		return nil, errors.New("missing svndiff header")
+	}
+	version := delta[3]
+	if version > 1 {
+		return nil, fmt.Errorf("unsupported svndiff version %d", version)
+	}
+	target := []byte{}
+	pos := 4
+	for pos < len(delta) {
+		var fields [5]int
+		for i := range fields {
+			n, err := svndiffVarint(delta, &pos)
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = n
+		}
+		sviewOffset, sviewLen, tviewLen, insLen, newLen := fields[0], fields[1], fields[2], fields[3], fields[4]
+		if pos+insLen+newLen > len(delta) {
+			return nil, errors.New("truncated window")
+		}
+		if sviewOffset+sviewLen > len(source) {
+			return nil, errors.New("source view out of range")
+		}
+		instructions := delta[pos : pos+insLen]
+		pos += insLen
+		newdata := delta[pos : pos+newLen]
+		pos += newLen
+		if version == 1 {
+			var err error
+			if instructions, err = svndiffSection(instructions); err != nil {
+				return nil, err
+			}
+			if newdata, err = svndiffSection(newdata); err != nil {
+				return nil, err
+			}
+		}
+		sview := source[sviewOffset : sviewOffset+sviewLen]
+		tview := make([]byte, 0, tviewLen)
+		ip, np := 0, 0
+		for ip < len(instructions) {
+			opcode := instructions[ip] >> 6
+			length := int(instructions[ip] & 0x3f)
+			ip++
+			var err error
+			if length == 0 {
+				if length, err = svndiffVarint(instructions, &ip); err != nil {
+					return nil, err
+				}
+			}
+			switch opcode {
+			case 0: // copy from source view
+				offset, err := svndiffVarint(instructions, &ip)
+				if err != nil {
+					return nil, err
+				}
+				if offset+length > len(sview) {
+					return nil, errors.New("source copy out of range")
+				}
+				tview = append(tview, sview[offset:offset+length]...)
+			case 1: // copy from target view; may overlap what it produces
+				offset, err := svndiffVarint(instructions, &ip)
+				if err != nil {
+					return nil, err
+				}
+				for i := 0; i < length; i++ {
+					if offset+i >= len(tview) {
+						return nil, errors.New("target copy out of range")
+					}
+					tview = append(tview, tview[offset+i])
+				}
+			case 2: // copy from new data
+				if np+length > len(newdata) {
+					return nil, errors.New("new data out of range")
+				}
+				tview = append(tview, newdata[np:np+length]...)
+				np += length
+			default:
+				return nil, errors.New("invalid instruction")
+			}
+		}
+		if len(tview) != tviewLen {
+			return nil, fmt.Errorf("window produced %d bytes, expected %d", len(tview), tviewLen)
+		}
+		target = append(target, tview...)
+	}
+	return target, nil
+}
+
+// pathState is one event in the content history of a path
+type pathState struct {
+	rev     int
+	sum     [md5.Size]byte
+	present bool
+}
+
+// propState is one event in the property history of a path; props
+// is nil once the path has been deleted.
+type propState struct {
+	rev   int
+	props map[string]string
+}
+
+// DeltaHistory keeps enough of the history of file content to find
+// the base text of any delta.  Content is stored once per distinct
+// text, so the memory cost is about that of the repository's blobs.
+// Node properties are kept too, as the base of property deltas.
+type DeltaHistory struct {
+	blobs map[[md5.Size]byte][]byte
+	paths map[string][]pathState
+	props map[string][]propState
+}
+
+// NewDeltaHistory - create an empty content history
+func NewDeltaHistory() *DeltaHistory {
+	return &DeltaHistory{
+		blobs: make(map[[md5.Size]byte][]byte),
+		paths: make(map[string][]pathState),
+		props: make(map[string][]propState),
+	}
+}
+
+// lookupProps - node properties of a path as of a revision
+func (dh *DeltaHistory) lookupProps(path string, rev int) map[string]string {
+	states := dh.props[path]
+	for i := len(states) - 1; i >= 0; i-- {
+		if states[i].rev <= rev {
+			return states[i].props
+		}
+	}
+	return nil
+}
+
+// recordProps - note the node properties of a path at a revision
+func (dh *DeltaHistory) recordProps(path string, rev int, props map[string]string) {
+	if props == nil {
+		props = make(map[string]string)
+	}
+	dh.props[path] = append(dh.props[path], propState{rev, props})
+}
+
+// lookup - content of a path as of a revision
+func (dh *DeltaHistory) lookup(path string, rev int) ([]byte, bool) {
+	states := dh.paths[path]
+	for i := len(states) - 1; i >= 0; i-- {
+		if states[i].rev <= rev {
+			if !states[i].present {
+				return nil, false
+			}
+			return dh.blobs[states[i].sum], true
+		}
+	}
+	return nil, false
+}
+
+// record - note the content of a path at a revision
+func (dh *DeltaHistory) record(path string, rev int, content []byte) {
+	sum := md5.Sum(content)
+	if _, ok := dh.blobs[sum]; !ok {
+		dh.blobs[sum] = content
+	}
+	dh.paths[path] = append(dh.paths[path], pathState{rev, sum, true})
+}
+
+// remove - note the deletion of a path and everything beneath it
+func (dh *DeltaHistory) remove(path string, rev int) {
+	for p := range dh.paths {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			if _, ok := dh.lookup(p, rev); ok {
+				dh.paths[p] = append(dh.paths[p], pathState{rev: rev})
+			}
+		}
+	}
+	for p := range dh.props {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			if dh.lookupProps(p, rev) != nil {
+				dh.props[p] = append(dh.props[p], propState{rev: rev})
+			}
+		}
+	}
+}
+
+// copyTree - note a directory copy, carrying over the content of every file beneath it
+func (dh *DeltaHistory) copyTree(from string, fromrev int, to string, rev int) {
+	copies := make(map[string][]byte)
+	for p := range dh.paths {
+		if strings.HasPrefix(p, from+"/") {
+			if content, ok := dh.lookup(p, fromrev); ok {
+				copies[to+p[len(from):]] = content
+			}
+		}
+	}
+	for p, content := range copies {
+		dh.record(p, rev, content)
+	}
+	propcopies := make(map[string]map[string]string)
+	for p := range dh.props {
+		if p == from || strings.HasPrefix(p, from+"/") {
+			if props := dh.lookupProps(p, fromrev); props != nil {
+				propcopies[to+p[len(from):]] = props
+			}
+		}
+	}
+	for p, props := range propcopies {
+		dh.recordProps(p, rev, props)
+	}
+}
+
+// expand - track one node through the history, returning its full text if it
+// carries a delta.  Must see every node from the first delta onward.
+func (dh *DeltaHistory) expand(ds *DumpfileSource, header StreamSection, content []byte) ([]byte, error) {
+	path := string(header.payload("Node-path"))
+	action := string(header.payload("Node-action"))
+	if action == "delete" || action == "replace" {
+		dh.remove(path, ds.Revision)
+		if action == "delete" {
+			return content, nil
+		}
+	}
+	if frompath := header.payload("Node-copyfrom-path"); frompath != nil {
+		var fromrev int
+		fmt.Sscanf(string(header.payload("Node-copyfrom-rev")), "%d", &fromrev)
+		if header.isDir(*ds) {
+			dh.copyTree(string(frompath), fromrev, path, ds.Revision)
+		} else {
+			if props := dh.lookupProps(string(frompath), fromrev); props != nil {
+				dh.recordProps(path, ds.Revision, props)
+			}
+			if base, ok := dh.lookup(string(frompath), fromrev); ok {
+				dh.record(path, ds.Revision, base)
+			} else if string(header.payload("Text-delta")) == "true" {
+				return nil, fmt.Errorf("no base text for copy from %s@%d", frompath, fromrev)
+			}
+		}
+	}
+	if !header.hasContent() {
+		return content, nil
+	}
+	if string(header.payload("Text-delta")) == "true" {
+		base, ok := dh.lookup(path, ds.Revision)
+		if !ok {
+			if action == "change" {
+				return nil, fmt.Errorf("no base text for %s", path)
+			}
+			base = []byte{}
+		}
+		if want := header.payload("Text-delta-base-md5"); want != nil && fmt.Sprintf("%x", md5.Sum(base)) != string(want) {
+			return nil, fmt.Errorf("base text checksum mismatch for %s", path)
+		}
+		var err error
+		if content, err = applySvndiff(base, content); err != nil {
+			return nil, err
+		}
+	}
+	dh.record(path, ds.Revision, content)
+	return content, nil
+}
+
+// expandProps - track the node properties of one node through the
+// history, turning a property delta into the full property list.
+// Must be called after expand on the same node.
+func (dh *DeltaHistory) expandProps(ds *DumpfileSource, header StreamSection) bool {
+	path := string(header.payload("Node-path"))
+	if string(header.payload("Node-action")) == "delete" || header.payload("Prop-content-length") == nil {
+		return false
+	}
+	if string(header.payload("Prop-delta")) != "true" {
+		props := make(map[string]string)
+		for _, key := range ds.NodeProps.propkeys {
+			props[key] = ds.NodeProps.properties[key]
+		}
+		dh.recordProps(path, ds.Revision, props)
+		return false
+	}
+	// A delta is against the copy source, already recorded by expand,
+	// or the previous properties of the path; an add without a copy
+	// source starts from nothing.
+	base := map[string]string{}
+	if action := string(header.payload("Node-action")); action == "change" || header.payload("Node-copyfrom-path") != nil {
+		base = dh.lookupProps(path, ds.Revision)
+	}
+	var full Properties
+	full.properties = make(map[string]string)
+	for key, value := range base {
+		full.properties[key] = value
+		full.propkeys = append(full.propkeys, key)
+	}
+	sort.Strings(full.propkeys)
+	for _, key := range ds.NodeProps.propdelkeys {
+		full.Delete(key)
+	}
+	for _, key := range ds.NodeProps.propkeys {
+		if !full.Contains(key) {
+			full.propkeys = append(full.propkeys, key)
+		}
+		full.properties[key] = ds.NodeProps.properties[key]
+	}
+	ds.NodeProps = full
+	dh.recordProps(path, ds.Revision, full.properties)
+	return true
+}
+
+// fullText - turn the header of a delta node into one for its full text
+func (ss StreamSection) fullText(proplen int, textlen int) StreamSection {
+	for _, htype := range []string{"Text-delta", "Text-delta-base-md5", "Text-delta-base-sha1"} {
+		ss = ss.delete(htype + ":")
+	}
+	header := ss.setLength("Text-content", textlen)
+	return StreamSection(SetLength("Content", header, proplen+textlen))
+}
@@ -6,11 +6,17 @@ package main
 
 import (
 	"bufio"
+	"encoding/base64"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net/http"
 	"net/mail"
+	"net/url"
 	"os"
+	"os/exec"
 	"regexp"
 	"sort"
 	"strings"
@@ -95,6 +101,78 @@ func (cm *ContribMap) Suffix(addr string) {
 	}
 }
 
+// merge folds an entry from a supplementary source into the map.
+// Unknown usernames are added.  For known ones, placeholder fields
+// (a fullname that is just the username, an email without an @) are
+// filled in.  When both sides have real values that differ, the
+// earlier source wins unless -l was given, and the conflict is
+// reported.
+func (cm *ContribMap) merge(cand Contributor, source string) {
+	item, ok := (*cm)[cand.name]
+	if !ok {
+		(*cm)[cand.name] = cand
+		return
+	}
+	resolve := func(have string, offered string, placeholder func(string) bool) string {
+		if placeholder(offered) || offered == have {
+			return have
+		}
+		if placeholder(have) || laterWins {
+			return offered
+		}
+		fmt.Fprintf(os.Stderr, "repomapper: %s: keeping %s, ignoring %s from %s.\n",
+			cand.name, have, offered, source)
+		return have
+	}
+	item.fullname = resolve(item.fullname, cand.fullname, func(s string) bool {
+		return s == "" || s == cand.name
+	})
+	item.email = resolve(item.email, cand.email, func(s string) bool {
+		return !strings.Contains(s, "@")
+	})
+	if item.tz == "" || (laterWins && cand.tz != "") {
+		item.tz = cand.tz
+	}
+	item.definite = strings.Contains(item.email, "@")
+	(*cm)[cand.name] = item
+}
+
+// A .mailmap line has one or two addresses, each in angle brackets,
+// and optionally a name before each.
+var mailmapRE = regexp.MustCompile(`^\s*([^<#]*?)\s*<([^>]*)>\s*(?:([^<]*?)\s*<([^>]*)>)?\s*(#.*)?$`)
+
+// A CVSROOT/passwd line is a username, a password hash, and
+// optionally the system account the CVS user acts as.
+var cvsPasswdRE = regexp.MustCompile(`^([^\s:#]+):[^\s:]*(:[^\s:]*)?$`)
+
+// parseMailmapLine extracts an entry from a git .mailmap line.  The
+// username is taken from the commit address - the second one if there
+// are two - which is what a conversion from a centralized VCS leaves
+// in commits that have not been mapped.
+func parseMailmapLine(line string) (Contributor, bool) {
+	m := mailmapRE.FindStringSubmatch(line)
+	if m == nil || strings.TrimSpace(line) == "" || strings.HasPrefix(strings.TrimSpace(line), "#") {
+		return Contributor{}, false
+	}
+	commit := m[2]
+	if m[4] != "" {
+		commit = m[4]
+	}
+	name := strings.Split(commit, "@")[0]
+	cb := Contributor{name: name, fullname: m[1], email: m[2]}
+	if cb.fullname == "" {
+		cb.fullname = name
+	}
+	cb.definite = strings.Contains(cb.email, "@")
+	return cb, true
+}
+
+// Mailmap renders a Contributor as a git .mailmap line, mapping the
+// identity a converted commit carries to the full one.
+func (cb *Contributor) Mailmap() string {
+	return fmt.Sprintf("%s <%s> %s <%s>\n", cb.fullname, cb.email, cb.name, cb.name)
+}
+
 /* Write the current state of this contrib map. */
 func (cm *ContribMap) Write(fp *os.File, incomplete bool) {
 	keys := make([]string, 0)
@@ -107,22 +185,288 @@ func (cm *ContribMap) Write(fp *os.File, incomplete bool) {
 		if incomplete && !item.incomplete() {
 			continue
 		}
-		fmt.Print(item.Stringer())
+		if mailmap {
+			fmt.Print(item.Mailmap())
+		} else {
+			fmt.Print(item.Stringer())
+		}
 	}
 }
 
+// restLookup asks a REST endpoint about a username.  The endpoint URL
+// has %s where the username goes, and must return a JSON object (or
+// an array whose first element is one) with name and email fields
+// under any of the names commonly used for them.  If RTOKEN is set in
+// the environment it is sent as a bearer token.
+func restLookup(endpoint string, name string) (Contributor, error) {
+	req, err := http.NewRequest("GET", strings.Replace(endpoint, "%s", url.PathEscape(name), -1), nil)
+	if err != nil {
+		return Contributor{}, err
+	}
+	if token := os.Getenv("RTOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := lookupClient(req.URL).Do(req)
+	if err != nil {
+		return Contributor{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return Contributor{}, errNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Contributor{}, fmt.Errorf("%s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Contributor{}, err
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(body, &record); err != nil {
+		var records []map[string]interface{}
+		if err2 := json.Unmarshal(body, &records); err2 != nil {
+			return Contributor{}, err
+		}
+		if len(records) == 0 {
+			return Contributor{}, errNotFound
+		}
+		record = records[0]
+	}
+	pick := func(keys ...string) string {
+		for _, key := range keys {
+			if value, ok := record[key].(string); ok && value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	return Contributor{
+		name:     name,
+		fullname: pick("name", "fullname", "full_name", "displayName", "display_name", "cn"),
+		email:    pick("email", "mail", "public_email", "emailAddress"),
+	}, nil
+}
+
+// ldapLookup asks an LDAP or Active Directory server about a username,
+// using ldapsearch(1).  The URL has the RFC 4516 form
+// ldap://host/base??scope?filter with %s in the filter standing for
+// the username; the filter defaults to (uid=%s) and the scope to sub.
+// RBINDDN and RBINDPW in the environment, if set, are the bind DN
+// and password.
+func ldapLookup(directory string, name string) (Contributor, error) {
+	u, err := url.Parse(directory)
+	if err != nil {
+		return Contributor{}, err
+	}
+	base := strings.TrimPrefix(u.Path, "/")
+	parts := strings.Split(u.RawQuery, "?")
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	scope, filter := parts[1], parts[2]
+	if scope == "" {
+		scope = "sub"
+	}
+	if filter == "" {
+		filter = "(uid=%s)"
+	} else if filter, err = url.QueryUnescape(filter); err != nil {
+		return Contributor{}, err
+	}
+	filter = strings.Replace(filter, "%s", ldapEscape(name), -1)
+	args := []string{"-x", "-LLL", "-H", u.Scheme + "://" + u.Host, "-s", scope}
+	if base != "" {
+		args = append(args, "-b", base)
+	}
+	if binddn := os.Getenv("RBINDDN"); binddn != "" {
+		args = append(args, "-D", binddn)
+		if password := os.Getenv("RBINDPW"); password != "" {
+			// Keep the password off the command line, where
+			// ps(1) would show it.
+			fp, err := ioutil.TempFile("", "repomapper")
+			if err != nil {
+				return Contributor{}, err
+			}
+			defer os.Remove(fp.Name())
+			fp.WriteString(password)
+			fp.Close()
+			args = append(args, "-y", fp.Name())
+		}
+	}
+	args = append(args, filter, "displayName", "cn", "mail")
+	out, err := exec.Command("ldapsearch", args...).Output()
+	if err != nil {
+		return Contributor{}, err
+	}
+	attrs := make(map[string]string)
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "" && len(attrs) > 0 {
+			break // Only the first matching entry is used
+		}
+		fields := strings.SplitN(line, ":", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		key, value := fields[0], strings.TrimSpace(fields[1])
+		if strings.HasPrefix(fields[1], ":") {
+			// Non-ASCII values are base64-encoded
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(fields[1][1:]))
+			if err != nil {
+				return Contributor{}, err
+			}
+			value = string(decoded)
+		}
+		if _, ok := attrs[key]; !ok {
+			attrs[key] = value
+		}
+	}
+	if len(attrs) == 0 {
+		return Contributor{}, errNotFound
+	}
+	fullname := attrs["displayName"]
+	if fullname == "" {
+		fullname = attrs["cn"]
+	}
+	return Contributor{name: name, fullname: fullname, email: attrs["mail"]}, nil
+}
+
+// ldapEscape quotes the characters that are special in an LDAP filter.
+func ldapEscape(s string) string {
+	return strings.NewReplacer(`\`, `\5c`, `*`, `\2a`, `(`, `\28`, `)`, `\29`, "\x00", `\00`).Replace(s)
+}
+
+var errNotFound = fmt.Errorf("not found")
+
+// lookupClient returns the client for a REST lookup.  A file: URL
+// gets one that reads local files, so a directory of exported records
+// can stand in for a live service; anything else gets one that cannot,
+// so a server can't redirect a lookup into the local filesystem.
+func lookupClient(u *url.URL) *http.Client {
+	if u.Scheme == "file" {
+		transport := &http.Transport{}
+		transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+		return &http.Client{Transport: transport}
+	}
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment}}
+}
+
+// Lookup fills in incomplete entries from a directory service.
+// Each entry's placeholders are replaced by what the service reports,
+// following the same precedence rules as file sources.
+func (cm *ContribMap) Lookup(service string, lookup func(string, string) (Contributor, error)) {
+	names := make([]string, 0)
+	for name, item := range *cm {
+		if item.incomplete() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cand, err := lookup(service, name)
+		if err == errNotFound {
+			fmt.Fprintf(os.Stderr, "repomapper: %s not found at %s.\n", name, service)
+			continue
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "repomapper: looking up %s at %s: %v\n", name, service, err)
+			os.Exit(1)
+		}
+		if cand.fullname == "" {
+			cand.fullname = name
+		}
+		if cand.email == "" {
+			cand.email = name
+		}
+		cand.definite = strings.Contains(cand.email, "@")
+		cm.merge(cand, service)
+	}
+}
+
+// committers gets the set of usernames that commit in a dump file,
+// stream file, or repository directory, by having reposurgeon read it
+// and write a stub author map.
+func committers(source string) []string {
+	readcmd := "read <" + source
+	if info, err := os.Stat(source); err != nil {
+		log.Fatal(err)
+	} else if info.IsDir() {
+		readcmd = "read " + source
+	}
+	out, err := exec.Command("reposurgeon", readcmd, "authors write").Output()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "repomapper: reading %s: %v\n", source, err)
+		os.Exit(1)
+	}
+	names := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if fields := strings.Fields(line); len(fields) > 1 && fields[1] == "=" {
+			names = append(names, fields[0])
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check reports how well the map covers a set of committers:
+// committers with no entry, committers whose entry is incomplete, and
+// entries nobody commits under.  It returns the percentage of
+// committers with complete entries.
+func (cm *ContribMap) Check(names []string) float64 {
+	committing := make(map[string]bool)
+	covered := 0
+	for _, name := range names {
+		committing[name] = true
+		if item, ok := (*cm)[name]; !ok {
+			fmt.Printf("unmatched: %s\n", name)
+		} else if item.incomplete() {
+			fmt.Printf("incomplete: %s\n", name)
+		} else {
+			covered++
+		}
+	}
+	keys := make([]string, 0)
+	for k := range *cm {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, name := range keys {
+		if !committing[name] {
+			fmt.Printf("unused: %s\n", name)
+		}
+	}
+	coverage := 100.0
+	if len(names) > 0 {
+		coverage = float64(covered) * 100 / float64(len(names))
+	}
+	fmt.Printf("%d of %d committers mapped (%.1f%%)\n", covered, len(names), coverage)
+	return coverage
+}
+
 // Manifest constants describing the Unix password DSV format
 const pwdFLDSEP = ":" // field separator
 const pwdNAME = 0     // field index of username
 const pwdGECOS = 4    // field index of fullname
 const pwdFLDCOUNT = 7 // required number of fields
 
+// Options that affect merging and output
+var laterWins bool
+var mailmap bool
+
 func main() {
 	var host string
+	var check string
+	var threshold float64
+	var directory string
+	var endpoint string
 	var incomplete bool
 
+	flag.StringVar(&check, "c", "", "check the map against the committers of a dump, stream, or repository")
+	flag.StringVar(&directory, "d", "", "look up incomplete entries in an LDAP directory")
 	flag.StringVar(&host, "h", "", "set host for suffixing")
 	flag.BoolVar(&incomplete, "i", false, "dump incomplete entries")
+	flag.BoolVar(&laterWins, "l", false, "later sources take precedence over earlier ones")
+	flag.BoolVar(&mailmap, "m", false, "write git .mailmap format")
+	flag.StringVar(&endpoint, "r", "", "look up incomplete entries at a REST endpoint")
+	flag.Float64Var(&threshold, "t", 0, "with -c, fail if coverage is below this percentage")
 	flag.Parse()
 
 	if flag.NArg() == 0 {
@@ -140,28 +484,30 @@ func main() {
 	}
 
 	for i := 1; i < flag.NArg(); i++ {
-		file, err := os.Open(flag.Arg(i))
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer file.Close()
-
-		scanner := bufio.NewScanner(file)
+		source := flag.Arg(i)
+		lines := make([]string, 0)
+		bylines(source, func(line string) { lines = append(lines, line) })
 
-		scanner.Scan()
-		firstline := scanner.Text()
-		if err := scanner.Err(); err != nil {
-			log.Fatal(err)
+		// Classify the file by its first line that isn't blank
+		// or a comment.
+		firstline, first := "", 0
+		for n, line := range lines {
+			if trimmed := strings.TrimSpace(line); trimmed != "" && trimmed[0] != '#' {
+				firstline, first = line, n
+				break
+			}
 		}
 
 		// Is this a map file?
-		if strings.Contains(firstline, "=") || firstline[0] == '#' {
-			updatemap := NewContribMap(flag.Arg(i))
-			for name, obj := range updatemap {
-				_, ok := contribmap[name]
-				if !ok {
-					contribmap[name] = obj
-				}
+		if firstline == "" || strings.Contains(firstline, "=") {
+			updatemap := NewContribMap(source)
+			names := make([]string, 0, len(updatemap))
+			for name := range updatemap {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				contribmap.merge(updatemap[name], source)
 			}
 			continue
 		}
@@ -170,7 +516,7 @@ func main() {
 		if strings.Count(firstline, ":") > 3 {
 			passwd := make(map[string]string)
 
-			passwdline := func(line string) {
+			for _, line := range lines {
 				fields := strings.Split(line, pwdFLDSEP)
 				if len(fields) != pwdFLDCOUNT {
 					fmt.Fprintf(os.Stderr,
@@ -185,26 +531,18 @@ func main() {
 				passwd[name] = gecos
 			}
 
-			passwdline(firstline)
-			for scanner.Scan() {
-				passwdline(scanner.Text())
-			}
-			if err := scanner.Err(); err != nil {
-				log.Fatal(err)
-			}
-
 			// Attempt to fill in the contribmap
 			for name, obj := range contribmap {
 				_, ok := passwd[name]
 				if !ok {
 					fmt.Fprintf(os.Stderr,
 						"repomapper: %s not in password file.\n", name)
-				} else if obj.fullname == name {
+				} else if obj.fullname == name || (laterWins && obj.fullname != passwd[name]) {
 					item := contribmap[name]
 					item.fullname = passwd[name]
 					item.definite = true
 					contribmap[name] = item
-				} else {
+				} else if obj.fullname != passwd[name] {
 					fmt.Fprintf(os.Stderr,
 						"repomapper: %s -> %s should be %s.\n",
 						name, obj.fullname, passwd[name])
@@ -213,6 +551,17 @@ func main() {
 			continue
 		}
 
+		// Is this a CVSROOT/passwd file?  It tells us nothing but
+		// the usernames.
+		if cvsPasswdRE.MatchString(strings.TrimSpace(firstline)) {
+			for _, line := range lines {
+				if m := cvsPasswdRE.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+					contribmap.merge(Contributor{name: m[1], fullname: m[1], email: m[1]}, source)
+				}
+			}
+			continue
+		}
+
 		// Is this a mailbox file?
 		mineAddresses := func(line string) {
 			for _, fld := range strings.Split(line, ",") {
@@ -220,7 +569,7 @@ func main() {
 				if err == nil {
 					if e.Name != "" && e.Name != e.Address {
 						userid := strings.Split(e.Address, "@")[0]
-						if item, ok := contribmap[userid]; ok && (!strings.Contains(e.Address, "@") || !item.definite) {
+						if item, ok := contribmap[userid]; ok && (!strings.Contains(e.Address, "@") || !item.definite || laterWins) {
 							item.fullname = e.Name
 							item.email = e.Address
 							contribmap[userid] = item
@@ -230,8 +579,7 @@ func main() {
 			}
 		}
 		if strings.HasPrefix(firstline, "From ") {
-			for scanner.Scan() {
-				line := scanner.Text()
+			for _, line := range lines[first+1:] {
 				if strings.Contains(line, ":") {
 					body := strings.Split(line, ":")[1]
 					mineAddresses(body)
@@ -239,11 +587,47 @@ func main() {
 					mineAddresses(strings.TrimSpace(line))
 				}
 			}
+			continue
+		}
 
-			if err := scanner.Err(); err != nil {
-				log.Fatal(err)
+		// Is this a git .mailmap file?
+		if mailmapRE.MatchString(firstline) {
+			for _, line := range lines {
+				if cb, ok := parseMailmapLine(line); ok {
+					contribmap.merge(cb, source)
+				}
+			}
+			continue
+		}
+
+		// Is this a Subversion author list, one username per line?
+		if len(strings.Fields(firstline)) == 1 {
+			for _, line := range lines {
+				if name := strings.TrimSpace(line); name != "" && name[0] != '#' {
+					contribmap.merge(Contributor{name: name, fullname: name, email: name}, source)
+				}
 			}
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "repomapper: can't tell what kind of file %s is.\n", source)
+		os.Exit(1)
+	}
+
+	// Ask directory services about whatever is still incomplete
+	if directory != "" {
+		contribmap.Lookup(directory, ldapLookup)
+	}
+	if endpoint != "" {
+		contribmap.Lookup(endpoint, restLookup)
+	}
+
+	// With -c, report coverage instead of the map
+	if check != "" {
+		if contribmap.Check(committers(check)) < threshold {
+			os.Exit(1)
 		}
+		return
 	}
 
 	// By default, report all entries
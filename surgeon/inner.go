@@ -505,10 +505,11 @@ screen width, and the ID of the invoking user. Use in regression-test loads.
 
 // innerControl is all the control-block stuff used by this module.
 type innerControl struct {
-	lineSep     string
-	blobseq     blobidx
-	flagOptions map[string]bool
-	readLimit   uint64
+	lineSep       string
+	blobseq       blobidx
+	flagOptions   map[string]bool
+	readLimit     uint64
+	propertyRules []PropertyRule
 }
 
 // whoami - ask various programs that keep track of who you are
@@ -1655,7 +1656,7 @@ func (b *Blob) Save(w io.Writer) {
 	content := b.getContentStream()
 	defer closeOrDie(content)
 	fmt.Fprintf(w, "blob\nmark %s\n", b.mark)
-	if b.hash.isValid() {
+	if b.hash.isValid() && (b.repo == nil || !b.repo.writeOptions.Contains("--no-oid")) {
 		fmt.Fprintf(w, "original-oid %s\n", b.hash.hexify())
 	}
 	fmt.Fprintf(w, "data %d\n", b.size)
@@ -1986,7 +1987,7 @@ func (t *Tag) Save(w io.Writer) {
 		fmt.Fprintf(w, "#legacy-id %s\n", t.legacyID)
 	}
 	fmt.Fprintf(w, "from %s\n", t.committish)
-	if t.hash.isValid() {
+	if t.hash.isValid() && !t.repo.writeOptions.Contains("--no-oid") {
 		fmt.Fprintf(w, "original-oid %s\n", t.hash.hexify())
 	}
 	if t.tagger != nil {
@@ -2552,6 +2553,7 @@ type Commit struct {
 	hash           gitHashType   // Git hash of the commit
 	colors         colorSet      // Flag used during deletion operations
 	implicitParent bool          // Whether the first parent was implicit
+	passthroughs   []string      // Importer queries (ls, cat-blob, get-mark) within the commit
 }
 
 func (commit Commit) getMark() string {
@@ -3987,7 +3989,7 @@ func (commit *Commit) Save(w io.Writer) {
 	if commit.mark != "" {
 		fmt.Fprintf(w, "mark %s\n", commit.mark)
 	}
-	if commit.hash.isValid() {
+	if commit.hash.isValid() && !commit.repo.writeOptions.Contains("--no-oid") {
 		fmt.Fprintf(w, "original-oid %s\n", commit.hash.hexify())
 	}
 	if len(commit.authors) > 0 {
@@ -4044,7 +4046,13 @@ func (commit *Commit) Save(w io.Writer) {
 			}
 		}
 	}
-	if vcs != nil && vcs.extensions.Contains("commit-properties") {
+	emitProperties := vcs != nil && vcs.extensions.Contains("commit-properties")
+	if commit.repo.writeOptions.Contains("--properties") {
+		emitProperties = true
+	} else if commit.repo.writeOptions.Contains("--no-properties") {
+		emitProperties = false
+	}
+	if emitProperties {
 		if commit.hasProperties() && len(commit.properties.keys) > 0 {
 			for _, name := range commit.properties.keys {
 				value := commit.properties.get(name)
@@ -4061,6 +4069,9 @@ func (commit *Commit) Save(w io.Writer) {
 	for _, op := range commit.operations() {
 		w.Write([]byte(op.String()))
 	}
+	for _, text := range commit.passthroughs {
+		io.WriteString(w, text)
+	}
 	if !commit.repo.exportStyle().Contains("no-nl-after-commit") {
 		w.Write([]byte{'\n'})
 	}
@@ -4347,6 +4358,36 @@ func (sp *StreamParser) fiReadline() []byte {
 	}
 }
 
+// Stream commands that may appear inside a commit but are queries to
+// the importer rather than part of the commit.
+var fiQueryRE = regexp.MustCompile("^(ls|cat-blob|get-mark) ")
+
+// Lines that begin a top-level stream command or comment.
+var fiCommandRE = regexp.MustCompile(`^(#|(blob|commit|reset|tag|feature|option|progress|checkpoint|done|cat-blob|ls|get-mark|alias)\b)`)
+
+// fiReadExtension reads a command the parser does not understand,
+// together with any continuation lines and data block following it,
+// and returns the raw text.  This lets multi-line extension commands
+// from newer or exotic exporters pass through intact.  It stops at a
+// blank line or at the beginning of another command.
+func (sp *StreamParser) fiReadExtension(line []byte) string {
+	text := string(line)
+	for {
+		line = sp.fiReadline()
+		if len(line) == 0 {
+			return text
+		} else if len(bytes.TrimSpace(line)) == 0 || fiCommandRE.Match(line) {
+			sp.pushback(line)
+			return text
+		} else if bytes.HasPrefix(line, []byte("data")) {
+			d, _ := sp.fiReadData(line)
+			text += fmt.Sprintf("data %d\n%s\n", len(d), d)
+		} else {
+			text += string(line)
+		}
+	}
+}
+
 func (sp *StreamParser) fiReadData(line []byte) ([]byte, int64) {
 	// Read a fast-import data section.
 	if len(line) == 0 {
@@ -4490,8 +4531,10 @@ func (sp *StreamParser) parseFastImport(options stringSet, baton *Baton, filesiz
 					commit.committer = *attrib
 					sp.repo.tzmap[attrib.email] = attrib.date.timestamp.Location()
 				} else if bytes.HasPrefix(line, []byte("property")) {
-					newprops := newOrderedMap()
-					commit.properties = &newprops
+					if commit.properties == nil {
+						newprops := newOrderedMap()
+						commit.properties = &newprops
+					}
 					fields := bytes.Split(line, []byte(" "))
 					if len(fields) < 3 {
 						sp.error("malformed property line")
@@ -4587,6 +4630,11 @@ func (sp *StreamParser) parseFastImport(options stringSet, baton *Baton, filesiz
 					commit.appendOperation(fileop)
 					sp.fiParseFileop(fileop)
 					sp.repo.inlines++
+				} else if fiQueryRE.Match(line) {
+					// Queries to the importer are legal
+					// within a commit; keep them with it
+					// so they round-trip.
+					commit.passthroughs = append(commit.passthroughs, string(line))
 				} else if len(bytes.TrimSpace(line)) == 0 {
 					// This handles slightly broken
 					// exporters like the bzr-fast-export
@@ -4689,8 +4737,8 @@ func (sp *StreamParser) parseFastImport(options stringSet, baton *Baton, filesiz
 			tag.legacyID = legacyID
 			sp.repo.addEvent(tag)
 		} else {
-			// Simply pass through any line we do not understand.
-			sp.repo.addEvent(newPassthrough(sp.repo, string(line)))
+			// Simply pass through anything we do not understand.
+			sp.repo.addEvent(newPassthrough(sp.repo, sp.fiReadExtension(line)))
 		}
 		baton.percentProgress(uint64(sp.ccount))
 		if control.readLimit > 0 && uint64(commitcount) >= control.readLimit {
@@ -5434,6 +5482,21 @@ func (repo *Repository) invalidateObjectMap() {
 	repo.invalidateMarkToIndex()
 }
 
+// compact discards memoized manifests and lookup caches, returning
+// the number of manifests dropped.  Everything is rebuilt on demand.
+func (repo *Repository) compact() int {
+	var dropped int
+	for _, event := range repo.events {
+		if commit, ok := event.(*Commit); ok && commit._manifest != nil {
+			commit._manifest = nil
+			dropped++
+		}
+	}
+	repo.invalidateObjectMap()
+	repo.invalidateNamecache()
+	return dropped
+}
+
 func parseContributionLine(netwide string) (Contributor, *time.Location, error) {
 	// Using parseAttrinutionLine here is a kludge that relies
 	// on the fact that it doesn't interpret its third (timestamp)
@@ -6024,7 +6087,16 @@ func (repo *Repository) fastExport(selection selectionSet,
 			// actually have the extension features their export
 			// streams declare.  Without this check git fast-import
 			// barfs on declarations for unused features.
-			if strings.HasPrefix(passthrough.text, "feature") && !target.extensions.Contains(strings.Fields(passthrough.text)[1]) {
+			if strings.HasPrefix(passthrough.text, "feature") && !target.extensions.Contains(strings.Fields(passthrough.text)[1]) && !options.Contains("--features") {
+				continue
+			}
+			// Write-time feature toggles, for consumers such as
+			// older git versions or third-party importers that
+			// choke on some stream features.
+			if strings.HasPrefix(passthrough.text, "feature") && options.Contains("--no-features") {
+				continue
+			}
+			if (passthrough.text == "done\n" || passthrough.text == "feature done\n") && options.Contains("--no-done") {
 				continue
 			}
 		}
@@ -6408,6 +6480,9 @@ var allPolicies = orderedStringSet{
 	"--tagforward",
 	"--quiet",
 	"--blobs",
+	"--first-comment",
+	"--last-comment",
+	"--dedup-comments",
 }
 
 // scavenge removes deletion-marged blobs
@@ -6434,10 +6509,20 @@ func (repo *Repository) squash(selected selectionSet, policy orderedStringSet, b
 	if logEnable(logDELETE) {
 		logit("Deletion list is %v", selected)
 	}
+	separator := control.lineSep
+	commentTemplate := ""
 	for _, qualifier := range policy {
-		if !allPolicies.Contains(qualifier) {
+		var err error
+		if strings.HasPrefix(qualifier, "--separator=") {
+			separator, err = stringEscape(qualifier[len("--separator="):])
+		} else if strings.HasPrefix(qualifier, "--comment-template=") {
+			commentTemplate, err = stringEscape(qualifier[len("--comment-template="):])
+		} else if !allPolicies.Contains(qualifier) {
 			return errors.New("no such deletion modifier as " + qualifier)
 		}
+		if err != nil {
+			return fmt.Errorf("ill-formed deletion modifier %s: %v", qualifier, err)
+		}
 	}
 	// For --pushback, it is critical that deletions take place
 	// from lowest event number to highest since --pushback often
@@ -6458,6 +6543,15 @@ func (repo *Repository) squash(selected selectionSet, policy orderedStringSet, b
 	pushforward := policy.Contains("--pushforward") || (!delete && !pushback)
 	coalesce := !policy.Contains("--no-coalesce")
 	delblobs := policy.Contains("--blobs")
+	firstComment := policy.Contains("--first-comment")
+	lastComment := policy.Contains("--last-comment")
+	dedupComments := policy.Contains("--dedup-comments")
+	if firstComment && lastComment {
+		return errors.New("--first-comment and --last-comment are mutually exclusive")
+	}
+	if dedupComments && (firstComment || lastComment || commentTemplate != "") {
+		return errors.New("--dedup-comments can't be combined with --first-comment, --last-comment, or --comment-template")
+	}
 	// Sanity checks
 	if !dquiet {
 		for it := selected.Iterator(); it.Next(); {
@@ -6522,6 +6616,61 @@ func (repo *Repository) squash(selected selectionSet, policy orderedStringSet, b
 	if preserveRefs {
 		branchmap = repo.branchmap()
 	}
+	// Concatenate comments, ignoring empty-log-message markers.
+	// The earlier comment comes first.  With --dedup-comments we
+	// remember which original messages went into each composite
+	// so a message already present is not repeated.
+	commentPieces := make(map[*Commit][]string)
+	composeComment := func(earlier *Commit, later *Commit) string {
+		a, b := earlier.Comment, later.Comment
+		if dedupComments {
+			pieces := func(c *Commit) []string {
+				if p, ok := commentPieces[c]; ok {
+					return p
+				}
+				return []string{c.Comment}
+			}
+			combined := make([]string, 0)
+			seen := newOrderedStringSet()
+			for _, m := range append(pieces(earlier), pieces(later)...) {
+				if emptyComment(m) || seen.Contains(strings.TrimSpace(m)) {
+					continue
+				}
+				seen.Add(strings.TrimSpace(m))
+				combined = append(combined, m)
+			}
+			commentPieces[earlier] = combined
+			commentPieces[later] = combined
+			if len(combined) == 0 {
+				return ""
+			}
+			a = combined[0]
+			for _, m := range combined[1:] {
+				a += separator + m
+			}
+			return a
+		}
+		if a == b {
+			return a
+		}
+		aEmpty := emptyComment(a)
+		bEmpty := emptyComment(b)
+		if aEmpty && bEmpty {
+			return ""
+		} else if aEmpty && !bEmpty {
+			return b
+		} else if !aEmpty && bEmpty {
+			return a
+		}
+		if firstComment {
+			return a
+		} else if lastComment {
+			return b
+		} else if commentTemplate != "" {
+			return strings.NewReplacer("%FIRST%", a, "%LAST%", b, "%SEPARATOR%", separator).Replace(commentTemplate)
+		}
+		return a + separator + b
+	}
 	// Here are the deletions
 	repo.clearColor(colorDELETE)
 	var delCount int
@@ -6564,23 +6713,6 @@ func (repo *Repository) squash(selected selectionSet, policy orderedStringSet, b
 					logit("new target for tags and resets is %s", newTarget.getMark())
 				}
 			}
-			// Reparent each child.  Concatenate comments,
-			// ignoring empty-log-message markers.
-			composeComment := func(a string, b string) string {
-				if a == b {
-					return a
-				}
-				aEmpty := emptyComment(a)
-				bEmpty := emptyComment(b)
-				if aEmpty && bEmpty {
-					return ""
-				} else if aEmpty && !bEmpty {
-					return b
-				} else if !aEmpty && bEmpty {
-					return a
-				}
-				return a + control.lineSep + b
-			}
 			//if logEnable(logDELETE) {logit("deleting %s requires %v to be reparented.", commit.getMark(), commit.childMarks())}
 			for _, cchild := range commit.childMarks() {
 				if isCallout(cchild) {
@@ -6628,7 +6760,7 @@ func (repo *Repository) squash(selected selectionSet, policy orderedStringSet, b
 					if policy.Contains("--empty-only") && !emptyComment(child.Comment) {
 						croak(fmt.Sprintf("--empty is on and %s comment is nonempty", child.idMe()))
 					}
-					child.Comment = composeComment(commit.Comment, child.Comment)
+					child.Comment = composeComment(commit, child)
 					altered = append(altered, child)
 				}
 				// Deduplicate and compact the (sparse) parent
@@ -6694,8 +6826,7 @@ func (repo *Repository) squash(selected selectionSet, policy orderedStringSet, b
 				if policy.Contains("--empty-only") && !emptyComment(parent.Comment) {
 					croak(fmt.Sprintf("--empty is on and %s comment is nonempty", parent.idMe()))
 				}
-				parent.Comment = composeComment(parent.Comment,
-					commit.Comment)
+				parent.Comment = composeComment(parent, commit)
 				altered = append(altered, parent)
 				// We need to ensure all fileop blobs
 				// are defined before the
@@ -7292,6 +7423,129 @@ func (repo *Repository) reorderCommits(v selectionSet, bequiet bool) {
 	repo.resort()
 }
 
+// reorderByDate topologically sorts the selected commits by committer
+// date, subject to the constraint that parents precede their children.
+// The sorted commits fill the event slots the selection occupied, so
+// nothing outside the selection moves except as resort requires.  When
+// redate is set, a commit dated earlier than one of its parents is
+// given the latest parent date plus one second so that dates increase
+// along every ancestry chain.  Returns the counts of commits moved and
+// redated.
+func (repo *Repository) reorderByDate(selection selectionSet, redate bool) (int, int) {
+	slots := make([]int, 0)
+	inSet := make(map[*Commit]int)
+	for it := selection.Iterator(); it.Next(); {
+		if commit, ok := repo.events[it.Value()].(*Commit); ok {
+			inSet[commit] = len(slots)
+			slots = append(slots, it.Value())
+		}
+	}
+	sort.Ints(slots)
+	commits := make([]*Commit, len(slots))
+	for i, n := range slots {
+		commits[i] = repo.events[n].(*Commit)
+		inSet[commits[i]] = i
+	}
+	// Rank commits by date, ties broken by original position, so a
+	// min-heap of ranks yields the earliest ready commit.
+	byDate := make([]int, len(commits))
+	for i := range byDate {
+		byDate[i] = i
+	}
+	sort.SliceStable(byDate, func(i, j int) bool {
+		return commits[byDate[i]].when().Before(commits[byDate[j]].when())
+	})
+	rank := make([]int, len(commits))
+	for r, i := range byDate {
+		rank[i] = r
+	}
+	pending := make([]int, len(commits))
+	for i, commit := range commits {
+		for _, parent := range commit.parents() {
+			if p, ok := parent.(*Commit); ok {
+				if _, ok := inSet[p]; ok {
+					pending[i]++
+				}
+			}
+		}
+	}
+	ready := new(IntHeap)
+	heap.Init(ready)
+	for i := range commits {
+		if pending[i] == 0 {
+			heap.Push(ready, rank[i])
+		}
+	}
+	sorted := make([]*Commit, 0, len(commits))
+	for ready.Len() > 0 {
+		commit := commits[byDate[heap.Pop(ready).(int)]]
+		sorted = append(sorted, commit)
+		for _, child := range commit.children() {
+			if c, ok := child.(*Commit); ok {
+				if i, ok := inSet[c]; ok {
+					pending[i]--
+					if pending[i] == 0 {
+						heap.Push(ready, rank[i])
+					}
+				}
+			}
+		}
+	}
+	redated := 0
+	if redate {
+		for _, commit := range sorted {
+			var latest time.Time
+			for _, parent := range commit.parents() {
+				if p, ok := parent.(*Commit); ok && p.when().After(latest) {
+					latest = p.when()
+				}
+			}
+			if commit.when().Before(latest) {
+				commit.committer.date.timestamp = latest.Add(time.Second).In(commit.committer.date.timestamp.Location())
+				commit.hash.invalidate()
+				redated++
+			}
+		}
+	}
+	moved := 0
+	for i, commit := range sorted {
+		if commit != commits[i] {
+			moved++
+		}
+	}
+	if moved == 0 {
+		return 0, redated
+	}
+	// Fill the slots with the sorted commits.  A commit moved earlier
+	// may now precede a blob it uses, so pull blobs forward to just
+	// before their first user.
+	newEvents := make([]Event, 0, len(repo.events))
+	emitted := make(map[Event]bool)
+	k := 0
+	for n, event := range repo.events {
+		if k < len(slots) && n == slots[k] {
+			commit := sorted[k]
+			k++
+			for _, op := range commit.operations() {
+				if op.op == opM && op.ref != "inline" {
+					if blob, ok := repo.markToEvent(op.ref).(*Blob); ok && !emitted[blob] {
+						newEvents = append(newEvents, blob)
+						emitted[blob] = true
+					}
+				}
+			}
+			newEvents = append(newEvents, commit)
+		} else if !emitted[event] {
+			newEvents = append(newEvents, event)
+			emitted[event] = true
+		}
+	}
+	repo.events = newEvents
+	repo.declareSequenceMutation("reorder")
+	repo.resort()
+	return moved, redated
+}
+
 // Renumber the marks in a repo starting from a specified origin.
 func (repo *Repository) renumber(origin int, baton *Baton) {
 	markmap := make(map[string]int)
@@ -8784,37 +9038,84 @@ func (repo *Repository) accumulateCommits(subarg selectionSet,
 	return result
 }
 
-// pathRename performs batch path renames by regular expression
-func (repo *Repository) pathRename(selection selectionSet, sourceRE *regexp.Regexp, targetPattern string, force bool) {
+// pathRename performs batch path renames by regular expression.
+// In dry-run mode nothing is modified; instead each rename that would
+// be performed, and each collision that would block or damage the
+// operation, is reported to the writer.
+func (repo *Repository) pathRename(selection selectionSet, sourceRE *regexp.Regexp, targetPattern string, force bool, dryrun bool, w io.Writer) {
 	actions := make([]pathAction, 0)
+	collisions := 0
+	complain := func(msg string, args ...interface{}) {
+		collisions++
+		if dryrun {
+			fmt.Fprintf(w, "collision: "+msg+"\n", args...)
+		} else if logEnable(logWARN) {
+			logit(msg, args...)
+		}
+	}
+	renamed := newOrderedStringSet()
 	repo.clearColor(colorQSET)
 	for it := repo.commitIterator(selection); it.Next(); {
-		it.commit().removeColor(colorQSET)
-		for idx := range it.commit().fileops {
+		commit := it.commit()
+		commit.removeColor(colorQSET)
+		targets := make(map[string]string)
+		for idx := range commit.fileops {
 			for _, attr := range []string{"Path", "Source", "Target"} {
-				fileop := it.commit().fileops[idx]
+				fileop := commit.fileops[idx]
 				if oldpath, ok := getAttr(fileop, attr); ok {
 					if ok && oldpath != "" && sourceRE.MatchString(oldpath) {
 						newpath := GoReplacer(sourceRE, oldpath, targetPattern)
-						if !force && it.commit().visible(newpath) != nil {
-							if logEnable(logWARN) {
-								logit("rename of %s at %s failed, %s visible in ancestry", oldpath, it.commit().idMe(), newpath)
-							}
-							return
-						} else if !force && it.commit().paths(nil).Contains(newpath) {
-							if logEnable(logWARN) {
-								logit("rename of %s at %s failed, %s exists there", oldpath, it.commit().idMe(), newpath)
-							}
-							return
+						if !force && commit.visible(newpath) != nil {
+							complain("rename of %s at %s failed, %s visible in ancestry", oldpath, commit.idMe(), newpath)
+						} else if !force && commit.paths(nil).Contains(newpath) {
+							complain("rename of %s at %s failed, %s exists there", oldpath, commit.idMe(), newpath)
+						} else if other, ok := targets[newpath]; !force && ok && other != oldpath {
+							complain("rename of %s at %s failed, %s also maps to %s", oldpath, commit.idMe(), other, newpath)
 						} else {
-							actions = append(actions, pathAction{fileop, it.commit(), attr, newpath})
-							it.commit().addColor(colorQSET)
+							targets[newpath] = oldpath
+							renamed.Add(oldpath)
+							actions = append(actions, pathAction{fileop, commit, attr, newpath})
+							commit.addColor(colorQSET)
+						}
+						if !dryrun && collisions > 0 {
+							return
 						}
 					}
 				}
 			}
 		}
 	}
+	// Fileops outside the selection that still refer to a renamed
+	// path after it has gone away would be orphaned.  Commits before
+	// the first selected one can't be.
+	if !force || dryrun {
+		first := selection.Min()
+		for i, event := range repo.events {
+			commit, ok := event.(*Commit)
+			if !ok || i <= first || selection.Contains(i) {
+				continue
+			}
+			for _, fileop := range commit.operations() {
+				if (fileop.op == opD && renamed.Contains(fileop.Path)) ||
+					((fileop.op == opR || fileop.op == opC) && renamed.Contains(fileop.Source)) {
+					complain("%s at %s would be orphaned by the rename", fileop.Path, commit.idMe())
+				}
+			}
+		}
+	}
+	if dryrun {
+		for _, action := range actions {
+			oldpath, _ := getAttr(action.fileop, action.attr)
+			fmt.Fprintf(w, "%s %s: %s -> %s\n", action.commit.idMe(), action.attr, oldpath, action.newpath)
+		}
+		fmt.Fprintf(w, "%d renames, %d collisions.\n", len(actions), collisions)
+		repo.clearColor(colorQSET)
+		return
+	}
+	if collisions > 0 {
+		repo.clearColor(colorQSET)
+		return
+	}
 	// All checks must pass before any renames
 	for _, action := range actions {
 		setAttr(action.fileop, action.attr, action.newpath)
@@ -9957,4 +10258,161 @@ func (rl *RepositoryList) unite(factors []*Repository, options stringSet) {
 	rl.choose(union)
 }
 
+// Assemble multiple repos, typically per-project Subversion dumps split
+// out of a common mother repository, into one.  Each factor's refs are
+// moved into a namespace named after it; with subdirectories, its
+// content is instead moved into a subdirectory named after it and
+// commits on like-named branches are chained together in time order.
+// Either way, commits are interleaved by committer date (without
+// reordering any factor's own commits) and marks are renumbered.
+func (rl *RepositoryList) assemble(factors []*Repository, subdirectories bool) {
+	uname := ""
+	for _, x := range factors {
+		uname += "+" + x.name
+	}
+	union := newRepository(uname[1:])
+	os.Mkdir(union.subdir(""), userReadWriteSearchMode)
+
+	// Move each factor into its own namespace or subdirectory.
+	namespaced := func(ref string, name string) string {
+		parts := strings.SplitN(ref, "/", 3)
+		if len(parts) < 3 || parts[0] != "refs" {
+			return ref
+		}
+		if parts[1] == "heads" && subdirectories {
+			return ref
+		}
+		return "refs/" + parts[1] + "/" + name + "/" + parts[2]
+	}
+	sequences := make([][]*Commit, 0, len(factors))
+	for _, factor := range factors {
+		for _, event := range factor.events {
+			switch event.(type) {
+			case *Commit:
+				commit := event.(*Commit)
+				commit.Branch = namespaced(commit.Branch, factor.name)
+				if !subdirectories {
+					continue
+				}
+				for _, fileop := range commit.operations() {
+					switch fileop.op {
+					case deleteall:
+						// Must not clobber the other factors
+						fileop.op = opD
+						fileop.Path = factor.name
+					case opM, opD:
+						fileop.Path = factor.name + "/" + fileop.Path
+					case opR, opC:
+						fileop.Source = factor.name + "/" + fileop.Source
+						fileop.Path = factor.name + "/" + fileop.Path
+					}
+				}
+				if !commit.hasParents() {
+					commit.invalidateManifests()
+				}
+			case *Reset:
+				reset := event.(*Reset)
+				reset.ref = namespaced(reset.ref, factor.name)
+			case *Tag:
+				tag := event.(*Tag)
+				tag.tagname = factor.name + "/" + tag.tagname
+			}
+		}
+		// Names are now disjoint except for shared branches,
+		// so a fresh map only makes the marks unique.
+		factor.uniquify(factor.name, make(map[string]string))
+		sequences = append(sequences, factor.commits(undefinedSelectionSet))
+	}
+
+	// Merge the commit sequences by date.  Each factor's own
+	// order is kept, so no parent can follow its child.
+	merged := make([]*Commit, 0)
+	for {
+		best := -1
+		for i, seq := range sequences {
+			if len(seq) > 0 && (best == -1 || seq[0].when().Before(sequences[best][0].when())) {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		merged = append(merged, sequences[best][0])
+		sequences[best] = sequences[best][1:]
+	}
+
+	for _, factor := range factors {
+		union.absorb(factor)
+		rl.removeByName(factor.name)
+	}
+	union.vcs = factors[0].vcs
+	for _, factor := range factors {
+		if factor.vcs != union.vcs {
+			union.vcs = nil
+		}
+	}
+
+	// With subdirectories, commits on a shared branch become
+	// one line of development.  Branch creation points (first
+	// parent on another branch) are left alone.
+	if subdirectories {
+		lastOnBranch := make(map[string]*Commit)
+		for _, commit := range merged {
+			prev := lastOnBranch[commit.Branch]
+			lastOnBranch[commit.Branch] = commit
+			if prev == nil {
+				continue
+			}
+			parents := commit.parents()
+			if len(parents) == 0 {
+				commit.setParents([]CommitLike{prev})
+			} else if first, ok := parents[0].(*Commit); ok && first != prev && first.Branch == commit.Branch {
+				commit.setParents(append([]CommitLike{prev}, parents[1:]...))
+			}
+		}
+	}
+
+	// Lay out the events in merged order, each commit preceded
+	// by the blobs it is first to use.
+	blobs := make(map[string]*Blob)
+	for _, event := range union.events {
+		if blob, ok := event.(*Blob); ok {
+			blobs[blob.mark] = blob
+		}
+	}
+	// Identical front passthroughs, such as sourcetype
+	// declarations, are kept only once.
+	placed := make(map[Event]bool)
+	events := make([]Event, 0, len(union.events))
+	seen := newOrderedStringSet()
+	for _, event := range union.frontEvents() {
+		placed[event] = true
+		if text := event.(*Passthrough).text; !seen.Contains(text) {
+			seen.Add(text)
+			events = append(events, event)
+		}
+	}
+	for _, commit := range merged {
+		for _, fileop := range commit.operations() {
+			if blob, ok := blobs[fileop.ref]; ok && fileop.op == opM && !placed[blob] {
+				events = append(events, blob)
+				placed[blob] = true
+			}
+		}
+		events = append(events, commit)
+		placed[commit] = true
+	}
+	for _, event := range union.events {
+		if !placed[event] {
+			events = append(events, event)
+		}
+	}
+	union.events = events
+	union.declareSequenceMutation("assemble")
+	union.resort()
+	union.renumber(1, nil)
+	rl.repolist = append(rl.repolist, union)
+	rl.choose(union)
+}
+
 // end
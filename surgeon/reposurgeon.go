@@ -368,11 +368,10 @@ func (lp *LineParse) Tokens() []string {
 func (lp *LineParse) OptVal(opt string) (val string, present bool) {
 	for _, option := range lp.options {
 		if strings.Contains(option, "=") {
-			parts := strings.SplitN(option, "=", 3)
-			if len(parts) > 1 && parts[0] == opt {
+			parts := strings.SplitN(option, "=", 2)
+			if parts[0] == opt {
 				return parts[1], true
 			}
-			return "", true
 
 		} else if option == opt {
 			return "", true
@@ -1230,7 +1229,9 @@ Corresponding subcommands are these:
 
 	Runs a garbage-collect before reporting so the figure will
 	better reflect storage currently held in loaded repositories;
-	this will not affect the reported high-water mark.
+	this will not affect the reported high-water marks. The last
+	field is the peak resident set size of the process, where the
+	platform reports it.
 	For a list of available profile subjects, call the profile
 	command without arguments. The list is in part extracted from the
 	Go runtime and is subject to change.
@@ -1314,9 +1315,10 @@ func (rs *Reposurgeon) DoProfile(line string) bool {
 			debug.FreeOSMemory()
 			runtime.ReadMemStats(&memStats)
 			const MB = 1e6
-			fmt.Printf("%d %.2f %.2f %.2f\n",
+			fmt.Printf("%d %.2f %.2f %.2f %.2f\n",
 				control.readLimit, time.Since(control.startTime).Seconds(),
-				float64(memStats.HeapAlloc)/MB, float64(memStats.TotalAlloc)/MB)
+				float64(memStats.HeapAlloc)/MB, float64(memStats.TotalAlloc)/MB,
+				float64(peakRSS())/MB)
 		default:
 			croak("I don't know how to %s. Possible verbs are [live, start, save].", verb)
 		}
@@ -1351,24 +1353,116 @@ func (rs *Reposurgeon) DoTiming(line string) bool {
 // HelpMemory says "Shut up, golint!"
 func (rs *Reposurgeon) HelpMemory() {
 	rs.helpOutput(`
-memory [>OUTFILE]
+memory [--compact] [>OUTFILE]
 
 Report memory usage.  Runs a garbage-collect before reporting so the
 figure will better reflect storage currently held in loaded repositories;
-this will not affect the reported high-water mark.
+this will not affect the reported high-water mark.  The peak resident
+set size is also reported where the operating system makes it
+available.
+
+For each loaded repository, a breakdown by subsystem follows: blobs
+(with the amount of content spooled to disk or left in a dump file,
+which does not occupy memory), commits and their fileops, comments,
+memoized manifests, and lookup indexes.  Object sizes are estimates
+computed from structure layouts and string lengths; they omit
+allocator overhead.
+
+With --compact, memoized manifests and lookup caches in all loaded
+repositories are discarded before the report.  They are rebuilt on
+demand, so this trades later computation for memory now.
 `)
 }
 
+// peakRSS returns the peak resident set size in bytes, or 0 if unknown.
+func peakRSS() uint64 {
+	data, err := ioutil.ReadFile("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "VmHWM:") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				if kb, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+					return kb * 1024
+				}
+			}
+		}
+	}
+	return 0
+}
+
 // DoMemory is the handler for the "memory" command.
 func (rs *Reposurgeon) DoMemory(line string) bool {
 	parse := rs.newLineParse(line, parseNOSELECT, orderedStringSet{"stdout"})
 	defer parse.Closem()
+	if parse.options.Contains("--compact") {
+		var dropped int
+		for _, repo := range rs.repolist {
+			dropped += repo.compact()
+		}
+		respond("%d memoized manifests dropped", dropped)
+	}
 	var memStats runtime.MemStats
 	debug.FreeOSMemory()
 	runtime.ReadMemStats(&memStats)
 	const MB = 1e6
-	fmt.Fprintf(parse.stdout, "Heap: %.2fMB  High water: %.2fMB\n",
+	fmt.Fprintf(parse.stdout, "Heap: %.2fMB  High water: %.2fMB",
 		float64(memStats.HeapAlloc)/MB, float64(memStats.TotalAlloc)/MB)
+	if rss := peakRSS(); rss > 0 {
+		fmt.Fprintf(parse.stdout, "  Peak RSS: %.2fMB", float64(rss)/MB)
+	}
+	fmt.Fprintf(parse.stdout, "\n")
+	for _, repo := range rs.repolist {
+		var blobs, spooled, dumped, commits, fileops, manifests, others int
+		var blobMeta, commitMeta, comments, spooledBytes, dumpedBytes uintptr
+		for _, event := range repo.events {
+			switch event.(type) {
+			case *Blob:
+				blob := event.(*Blob)
+				blobs++
+				blobMeta += unsafe.Sizeof(*blob) + uintptr(len(blob.mark)+len(blob.abspath))
+				if blob.hasfile() {
+					spooled++
+					if st, err := os.Stat(blob.getBlobfile(false)); err == nil {
+						spooledBytes += uintptr(st.Size())
+					}
+				} else {
+					dumped++
+					dumpedBytes += uintptr(blob.size)
+				}
+			case *Commit:
+				commit := event.(*Commit)
+				commits++
+				commitMeta += unsafe.Sizeof(*commit) + uintptr(len(commit.mark)+len(commit.Branch)+len(commit.legacyID))
+				commitMeta += uintptr(len(commit.authors)+1) * unsafe.Sizeof(Attribution{})
+				comments += uintptr(len(commit.Comment))
+				for _, fileop := range commit.fileops {
+					fileops++
+					commitMeta += unsafe.Sizeof(*fileop) + uintptr(len(fileop.Path)+len(fileop.Source)+len(fileop.inline))
+				}
+				if commit._manifest != nil {
+					manifests++
+				}
+			case *Tag:
+				comments += uintptr(len(event.(*Tag).Comment))
+				others++
+			default:
+				others++
+			}
+		}
+		fmt.Fprintf(parse.stdout, "%s:\n", repo.name)
+		fmt.Fprintf(parse.stdout, "  blobs:     %d objects, %.2fMB; %d spooled to disk (%.2fMB), %d in dump (%.2fMB)\n",
+			blobs, float64(blobMeta)/MB, spooled, float64(spooledBytes)/MB, dumped, float64(dumpedBytes)/MB)
+		fmt.Fprintf(parse.stdout, "  commits:   %d objects, %d fileops, %.2fMB\n",
+			commits, fileops, float64(commitMeta)/MB)
+		fmt.Fprintf(parse.stdout, "  comments:  %.2fMB\n", float64(comments)/MB)
+		fmt.Fprintf(parse.stdout, "  other:     %d events\n", others)
+		fmt.Fprintf(parse.stdout, "  manifests: %d memoized\n", manifests)
+		fmt.Fprintf(parse.stdout, "  indexes:   %d marks, %d names, %d legacy IDs, %d assignments\n",
+			len(repo._markToIndex), len(repo._namecache), len(repo.legacyMap), len(repo.assignments))
+	}
 	return false
 }
 
@@ -2314,10 +2408,82 @@ func (rs *Reposurgeon) DoRead(line string) bool {
 	return false
 }
 
+// HelpPropmap says "Shut up, golint!"
+func (rs *Reposurgeon) HelpPropmap() {
+	rs.helpOutput(`
+propmap [--clear] [PROPERTY-PATTERN {trailer|note|attribute} [NAME]]
+
+Declare a rule for keeping Subversion properties that would otherwise
+be discarded when a dump is read.  Rules apply to subsequent reads; the
+first rule whose pattern matches a property name wins.  PROPERTY-PATTERN
+is a property name or a delimited regular expression.
+
+A "trailer" rule appends a "NAME: value" line to the commit comment. A
+"note" rule attaches the same line to the commit as a git note on
+refs/notes/commits; node properties are prefixed with their path.  Node
+properties are reported only in the revision where their value changes.
+An "attribute" rule records NAME=value in a .gitattributes file next to
+each file carrying the property.
+
+NAME defaults to the property name and may refer to parenthesized
+subexpressions of a regular-expression pattern as \1, \2, etc.
+
+Rules act when a dump is read rather than when a repository is
+written, because that is the last point at which node properties, and
+revision properties no rule maps, still exist.  Revision properties
+a rule maps are also kept as commit properties, which export formats
+that support them (such as bzr's) write out.
+
+With no arguments, list the rules.  The --clear option discards all
+rules before adding any given on the command line.
+
+Example:
+
+----
+propmap bugtraq:issue trailer Issue
+propmap /^svn:eol-style$/ attribute eol
+----
+`)
+}
+
+// DoPropmap declares rules for mapping Subversion properties.
+func (rs *Reposurgeon) DoPropmap(line string) bool {
+	parse := rs.newLineParse(line, parseNOSELECT, orderedStringSet{"stdout"})
+	defer parse.Closem()
+	if parse.options.Contains("--clear") {
+		control.propertyRules = nil
+	}
+	if parse.line == "" {
+		if !parse.options.Contains("--clear") {
+			for _, rule := range control.propertyRules {
+				fmt.Fprintln(parse.stdout, rule.String())
+			}
+		}
+		return false
+	}
+	fields := strings.Fields(parse.line)
+	if len(fields) < 2 || len(fields) > 3 {
+		croak("propmap requires a property pattern, an action, and an optional name")
+		return false
+	}
+	if fields[1] != "trailer" && fields[1] != "note" && fields[1] != "attribute" {
+		croak("unknown propmap action %q", fields[1])
+		return false
+	}
+	rule := PropertyRule{source: fields[0], pattern: getPattern(fields[0]), action: fields[1]}
+	if len(fields) == 3 {
+		rule.name = fields[2]
+	}
+	control.propertyRules = append(control.propertyRules, rule)
+	return false
+}
+
 // HelpWrite says "Shut up, golint!"
 func (rs *Reposurgeon) HelpWrite() {
 	rs.helpOutput(`
-[SELECTION] write [--legacy] [--format=fossil] [--noincremental] [--callout] [>OUTFILE|-|DIRECTORY]
+[SELECTION] write [--legacy] [--format=fossil] [--noincremental] [--callout]
+    [--no-oid] [--no-done] [--features|--no-features] [--properties|--no-properties]
+    [>OUTFILE|-|DIRECTORY]
 
 Dump a fast-import stream representing selected events to standard
 output (if second argument is empty or '-') or via > redirect to a file.
@@ -2331,7 +2497,20 @@ If the argument ends with a '/' and does not exist, that
 directory is created and the repository written into it.
 
 Property extensions will be omitted if the importer for the
-preferred repository type cannot digest them.
+preferred repository type cannot digest them. The --properties and
+--no-properties options force them on or off regardless.  The
+--no-oid, --no-done, and --no-features options suppress original-oid
+lines, the "done" trailer, and feature declarations respectively.
+Feature declarations the preferred type's importer is not known to
+support are normally dropped; --features passes them all through.
+There is no option to turn off mark reuse: the stream carries the
+marks the repository already has, each defined once, and changing
+them is an edit rather than a matter of stream format.  Use renumber
+before writing if an importer needs them dense and in order.
+
+Commands in the input stream that reposurgeon does not understand,
+such as importer queries or exporter-specific extensions, are
+preserved and written back out in place.
 
 Various options and special features of this command are described in
 the long-form manual.
@@ -3286,6 +3465,18 @@ Requires an explicit selection set.  Blobs cannot be
 directly affected by this command; they move or are deleted only when
 removal of fileops associated with commits requires this.
 
+When comments of combined commits are merged, they are normally
+concatenated with a line separator between them.  The option
+--separator=TEXT changes the separator; --first-comment or
+--last-comment keep only the earlier or later comment;
+--dedup-comments drops messages identical (ignoring leading and
+trailing whitespace) to one already present; and
+--comment-template=TEXT builds the new comment by substituting the
+earlier comment for %FIRST%, the later for %LAST%, and the separator
+for %SEPARATOR% in TEXT.  C-style escapes in TEXT are interpreted.
+--dedup-comments keeps every distinct message, so it can't be combined
+with the options that choose among them.
+
 Sets Q bits: true on commits that get fileops pushed to them, false 
 oytherwise.
 `)
@@ -3294,21 +3485,25 @@ oytherwise.
 // DoSquash squashes events in the specified selection set.
 func (rs *Reposurgeon) DoSquash(line string) bool {
 	parse := rs.newLineParse(line, parseREPO|parseNEEDSELECT, nil)
-	rs.chosen().squash(rs.selection, parse.options, control.baton)
+	if err := rs.chosen().squash(rs.selection, parse.options, control.baton); err != nil {
+		croak(err.Error())
+	}
 	return false
 }
 
 // HelpDelete says "Shut up, golint!"
 func (rs *Reposurgeon) HelpDelete() {
 	rs.helpOutput(`
-{SELECTION} delete
+{SELECTION} delete [--POLICY...]
 
 Delete a selection set of events.  Requires an explicit selection set.
 Tags, resets, and passthroughs are deleted with no side effects.  Blobs
 cannot be directly deleted with this command; they are removed only when
 removal of fileops associated with commits requires this.
 
-A delete is equivalent to a squash with the --delete flag.
+A delete is equivalent to a squash with the --delete flag; the other
+squash policy flags, including those controlling how comments are
+combined, may also be given.
 
 Clears all Q bits.
 `)
@@ -3318,7 +3513,9 @@ Clears all Q bits.
 func (rs *Reposurgeon) DoDelete(line string) bool {
 	parse := rs.newLineParse(line, parseREPO|parseNEEDSELECT, nil)
 	parse.options.Add("--delete")
-	rs.chosen().squash(rs.selection, parse.options, control.baton)
+	if err := rs.chosen().squash(rs.selection, parse.options, control.baton); err != nil {
+		croak(err.Error())
+	}
 	return false
 }
 
@@ -4254,6 +4451,91 @@ func (rs *Reposurgeon) DoUnite(line string) bool {
 	return false
 }
 
+// HelpAssemble says "Shut up, golint!"
+func (rs *Reposurgeon) HelpAssemble() {
+	rs.helpOutput(`
+assemble [--subdirectories] {REPO-NAME|FILE}...
+
+Assemble several repositories into one in a single operation.  This
+is meant for per-project Subversion dumps split out of a common mother
+repository, but any streams will do.  Each argument is either the name
+of a loaded repo or an import-stream or Subversion dump file to be
+read; a repository read from a file is named after the file's basename
+without extension.  The factors are removed from the load list and the
+result is selected.
+
+By default each factor's branches and tags are moved into a namespace
+named after it, so that refs/heads/master in the factor "foo" becomes
+refs/heads/foo/master and the tag 1.0 becomes foo/1.0.
+
+With --subdirectories, the content of each factor is instead moved into
+a subdirectory named after it and branch names are kept; commits on
+branches with the same name are chained together in time order, so
+each of them sees the latest state of every factor.  A deleteall in
+a factor becomes a delete of its subdirectory.  Tags are namespaced as
+in the default mode.  Commits creating a branch from another branch
+keep their parent.
+
+In both modes commits are interleaved by committer date without
+reordering any factor's own commits, and all marks are renumbered.
+
+The name of the new repo is composed from the names of the factors
+joined by '+'.
+`)
+}
+
+// DoAssemble reads and melds several repositories.
+func (rs *Reposurgeon) DoAssemble(line string) bool {
+	rs.unchoose()
+	parse := rs.newLineParse(line, parseNOSELECT, nil)
+	// Don't close anything here; dump content is read lazily.
+	factors := make([]*Repository, 0)
+	// Repos read from files go on the load list only once the
+	// factors are known to be good, so a failure leaves none behind.
+	loaded := make([]*Repository, 0)
+	for _, name := range parse.Tokens() {
+		var repo *Repository
+		if rs.reponames().Contains(name) {
+			repo = rs.repoByName(name)
+		} else if !isfile(name) {
+			croak("no such repo or file as %s", name)
+			return false
+		} else {
+			fp, err := os.Open(name)
+			if err != nil {
+				croak(err.Error())
+				return false
+			}
+			repo = newRepository("")
+			repo.fastImport(context.TODO(), fp, parse.options.toStringSet(), "", control.baton)
+			// Named at once, as the next file loaded would
+			// otherwise share its storage; unique among both the
+			// repos already loaded and those still pending.
+			pending := RepositoryList{repolist: append(append([]*Repository{}, rs.repolist...), loaded...)}
+			base := filepath.Base(name)
+			repo.rename(pending.uniquify(strings.TrimSuffix(base, filepath.Ext(base))))
+			loaded = append(loaded, repo)
+		}
+		factors = append(factors, repo)
+	}
+	if len(factors) < 2 {
+		croak("assemble requires two or more repo name or file arguments")
+		return false
+	}
+	for _, x := range factors {
+		if len(x.commits(undefinedSelectionSet)) == 0 {
+			croak("empty factor %s", x.name)
+			return false
+		}
+	}
+	rs.repolist = append(rs.repolist, loaded...)
+	rs.assemble(factors, parse.options.Contains("--subdirectories"))
+	if control.isInteractive() && !control.flagOptions["quiet"] {
+		rs.DoChoose("")
+	}
+	return false
+}
+
 // HelpGraft says "Shut up, golint!"
 func (rs *Reposurgeon) HelpGraft() {
 	rs.helpOutput(`
@@ -4425,7 +4707,7 @@ func (rs *Reposurgeon) DoDebranch(line string) bool {
 // HelpPath says "Shut up, golint!"
 func (rs *Reposurgeon) HelpPath() {
 	rs.helpOutput(`
-[SELECTION] path [list [>OUTFILE] | rename PATTERN [--force] TARGET]]
+[SELECTION] path [list [>OUTFILE] | rename PATTERN [--force] [--dry-run] TARGET [>OUTFILE]]
 
 With the verb "list", list all paths touched by fileops in the selection
 set (which defaults to the entire repo). This command does > redirection.
@@ -4437,8 +4719,16 @@ contain back-reference syntax (\1 etc.). See "help regexp" for more
 information about regular expressions.
 
 Ordinarily, if the target path already exists in the fileops, or is visible
-in the ancestry of the commit, this command throws an error.  With the
---force option, these checks are skipped.
+in the ancestry of the commit, or two source paths in the same commit
+would be renamed to the same target, or a later fileop outside the
+selection set (a delete, or the source of a rename or copy) would be
+orphaned because it refers to a path that has been renamed away, this
+command throws an error and nothing is renamed.  With the --force
+option, these checks are skipped.
+
+With the --dry-run option nothing is modified. Instead, every rename
+that would be performed is reported, along with every collision that
+would block it.
 
 Example:
 
@@ -4492,7 +4782,8 @@ func (rs *Reposurgeon) DoPath(line string) bool {
 			croak("no target specified in path rename")
 			return false
 		}
-		repo.pathRename(rs.selection, sourceRE, targetPattern, force)
+		dryrun := parse.options.Contains("--dry-run")
+		repo.pathRename(rs.selection, sourceRE, targetPattern, force, dryrun, parse.stdout)
 	} else if fields[0] == "list" {
 		allpaths := newOrderedStringSet()
 		for it := repo.commitIterator(rs.selection); it.Next(); {
@@ -4866,8 +5157,9 @@ func (rs *Reposurgeon) DoReparent(line string) bool {
 func (rs *Reposurgeon) HelpReorder() {
 	rs.helpOutput(`
 [SELECTION] reorder [--quiet]
+[SELECTION] reorder --date [--redate]
 
-Re-order a contiguous range of commits.
+Re-order a contiguous range of commits, or sort commits by date.
 
 Older revision control systems tracked change history on a per-file basis,
 rather than as a series of atomic "changesets", which often made it difficult
@@ -4911,18 +5203,38 @@ also re-orders the underlying events since ancestors must appear before
 descendants, and blobs must appear before commits which reference them. This
 means that events within the specified range will have different event numbers
 after the operation.
+
+With --date, the selected commits (all commits if there is no
+selection) are instead sorted by committer date, within the constraint
+that every commit follows its parents; parent links are not changed.
+This repairs imports that produced an interleaved, non-chronological
+commit sequence.  Commits dated earlier than a parent cannot be put in
+date order; with --redate, each such commit is given its latest
+parent's date plus one second so dates increase along every line of
+descent.  Reports the number of commits moved and redated.
 `)
 }
 
 // DoReorder re-orders a contiguous range of commits.
 func (rs *Reposurgeon) DoReorder(line string) bool {
-	parse := rs.newLineParse(line, parseREPO|parseNEEDSELECT, nil)
+	parse := rs.newLineParse(line, parseREPO, nil)
 	defer parse.Closem()
 	repo := rs.chosen()
 	if parse.line != "" {
 		croak("'reorder' takes no arguments")
 		return false
 	}
+	if parse.options.Contains("--date") {
+		if !rs.selection.isDefined() {
+			rs.selection = repo.all()
+		}
+		moved, redated := repo.reorderByDate(rs.selection, parse.options.Contains("--redate"))
+		respond("%d commits moved, %d redated", moved, redated)
+		return false
+	} else if !rs.selection.isDefined() {
+		croak("command requires an explicit selection")
+		return false
+	}
 	commits := repo.commits(rs.selection)
 	if len(commits) == 0 {
 		croak("no commits in selection")
@@ -5121,7 +5433,7 @@ func (rs *Reposurgeon) DoBranch(line string) bool {
 // HelpTag says "Shut up, golint!"
 func (rs *Reposurgeon) HelpTag() {
 	rs.helpOutput(`
-[SELECTION] tag {create|move|rename|delete} [TAG-PATTERN] [--not] [NEW-NAME|SINGLETON]
+[SELECTION] tag {create|move|rename|delete} [TAG-PATTERN] [--not] [--before=DATE] [--after=DATE] [NEW-NAME|SINGLETON]
 
 Create, move, rename, or delete annotated tags.
 
@@ -5141,7 +5453,10 @@ For a 'move', a second argument must be a singleton selection set. For
 a 'rename', the third argument may be any token that is a syntactically
 valid tag name (but not the name of an existing tag).  When TAG-PATTERN
 is a regexp, NEW-NAME may contain references to portions of the match.
-Errors are thrown for wildcarding that would produce name collisions
+Errors are thrown for wildcarding that would produce name collisions,
+either among the renamed tags or with tags left alone.  Resets and
+commit branch fields referring to refs/tags/ under an old tag name are
+renamed with it.
 
 For a 'delete', no second argument is required.  Annotated tags with names
 matching the pattern are deleted.  Giving a regular expression rather than
@@ -5149,6 +5464,15 @@ a plain string is useful for mass deletion of junk tags such as those derived
 from CVS branch-root tags. Such deletions can be restricted by a selection
 set in the normal way.
 
+The options --before=DATE and --after=DATE further restrict the matched
+tags to those with a tagger date strictly before or after DATE, which
+may be in RFC3339 or Git format.  This makes it easy to prune old
+build-robot tags in one operation:
+
+----
+tag delete /^build-[0-9]+$/ --before=2015-01-01T00:00:00Z
+----
+
 All Q bits are cleared; then any tags made by create or touched by move or
 rename, get their Q bit set.
 `)
@@ -5158,6 +5482,7 @@ rename, get their Q bit set.
 func (rs *Reposurgeon) DoTag(line string) bool {
 	parse := rs.newLineParse(line, parseALLREPO, nil)
 	repo := rs.chosen()
+	line = parse.line
 	var verb string
 	verb, line = popToken(line)
 	if verb == "" {
@@ -5231,11 +5556,37 @@ func (rs *Reposurgeon) DoTag(line string) bool {
 		return false
 	}
 
+	// Optional date bounds
+	var before, after Date
+	if val, ok := parse.OptVal("--before"); ok {
+		if before, err = newDate(val); err != nil {
+			croak(err.Error())
+			return false
+		}
+	}
+	if val, ok := parse.OptVal("--after"); ok {
+		if after, err = newDate(val); err != nil {
+			croak(err.Error())
+			return false
+		}
+	}
+	inDateRange := func(tag *Tag) bool {
+		if before.isZero() && after.isZero() {
+			return true
+		}
+		if tag.tagger == nil {
+			return false
+		}
+		stamp := tag.tagger.date.timestamp
+		return (before.isZero() || stamp.Before(before.timestamp)) &&
+			(after.isZero() || stamp.After(after.timestamp))
+	}
+
 	// Collect all matching tags in the selection set
 	tags := make([]*Tag, 0)
 	for it := rs.selection.Iterator(); it.Next(); {
 		event := repo.events[it.Value()]
-		if tag, ok := event.(*Tag); ok && sourceRE.MatchString(tag.tagname) == !parse.options.Contains("--not") {
+		if tag, ok := event.(*Tag); ok && sourceRE.MatchString(tag.tagname) == !parse.options.Contains("--not") && inDateRange(tag) {
 			tags = append(tags, tag)
 		}
 	}
@@ -5272,21 +5623,55 @@ func (rs *Reposurgeon) DoTag(line string) bool {
 		return false
 	}
 
+	// Compute all new names up front so that a collision
+	// leaves the repository untouched.
+	renames := make(map[*Tag]string)
+	if verb == "rename" {
+		claimed := make(map[string]*Tag)
+		for _, tag := range tags {
+			possible := GoReplacer(sourceRE, tag.tagname, newname)
+			if other, ok := claimed[possible]; ok {
+				croak("tag name collision: %s and %s would both become %s, not renaming.",
+					other.tagname, tag.tagname, possible)
+				return false
+			}
+			claimed[possible] = tag
+			renames[tag] = possible
+		}
+		for _, event := range repo.events {
+			if tag, ok := event.(*Tag); ok {
+				if _, renamed := renames[tag]; !renamed && claimed[tag.tagname] != nil {
+					croak("tag name collision with existing %s, not renaming.", tag.tagname)
+					return false
+				}
+			}
+		}
+	}
+
 	// Do it
 	control.baton.startProcess("tag"+verb, "")
-	for i, tag := range tags {
+	for _, tag := range tags {
 		if verb == "move" {
 			tag.forget()
 			tag.remember(repo, target.mark)
 			tag.addColor(colorQSET)
 		} else if verb == "rename" {
-			possible := GoReplacer(sourceRE, tag.tagname, newname)
-			if i > 0 && possible == tags[i-1].tagname {
-				croak("tag name collision, not renaming.")
-				return false
-			}
-			tag.tagname = possible
+			oldref := "refs/tags/" + tag.tagname
+			newref := "refs/tags/" + renames[tag]
+			tag.tagname = renames[tag]
 			tag.addColor(colorQSET)
+			for _, event := range repo.events {
+				switch event.(type) {
+				case *Commit:
+					if commit := event.(*Commit); commit.Branch == oldref {
+						commit.Branch = newref
+					}
+				case *Reset:
+					if reset := event.(*Reset); reset.ref == oldref {
+						reset.ref = newref
+					}
+				}
+			}
 		} else if verb == "delete" {
 			// the order here in important
 			repo.delete(newSelectionSet(tag.index()), nil, control.baton)
@@ -5340,7 +5725,10 @@ The default selection is all events.
 For a 'move', a SINGLETON argument must be a singleton selection set. For
 a 'rename', the third argument may be any token that can be interpreted
 as a valid reset name (but not the name of an existing
-reset). For a 'delete', no third argument is required.
+reset). When RESET-PATTERN is a regexp, NEW-NAME may contain references
+to portions of the match, so many resets can be renamed in one
+operation; errors are thrown for renames that would produce
+collisions. For a 'delete', no third argument is required.
 
 When a reset is renamed, commit branch fields matching the tag are
 renamed with it to match.  When a reset is deleted, matching branch
@@ -5465,31 +5853,50 @@ func (rs *Reposurgeon) DoReset(line string) bool {
 		if !strings.HasPrefix(newname, "refs/") {
 			newname = "refs/" + newname
 		}
+		// When the pattern is a regexp the new name may refer
+		// to portions of the match, so each reset may get a
+		// different name.
+		rename := func(ref string) string {
+			if isRe {
+				return GoReplacer(sourceRE, ref, newname)
+			}
+			return newname
+		}
+		claimed := make(map[string]string)
+		for _, reset := range resets {
+			possible := rename(reset.ref)
+			if other, ok := claimed[possible]; ok && other != reset.ref {
+				croak("reset reference collision: %s and %s would both become %s, not renaming.",
+					other, reset.ref, possible)
+				return false
+			}
+			claimed[possible] = reset.ref
+		}
 		selection := rs.selection
 		if !selection.isDefined() {
 			selection = repo.all()
 		}
 		for it := selection.Iterator(); it.Next(); {
 			reset, ok := repo.events[it.Value()].(*Reset)
-			if ok && reset.ref == newname {
+			if ok && claimed[reset.ref] != "" && !sourceRE.MatchString(reset.ref) {
 				croak("reset reference collision, not renaming.")
 				return false
 			}
 		}
 		for _, commit := range repo.commits(undefinedSelectionSet) {
-			if commit.Branch == newname {
+			if claimed[commit.Branch] != "" && !sourceRE.MatchString(commit.Branch) {
 				croak("commit branch collision, not renaming.")
 				return false
 			}
 		}
 
 		for _, reset := range resets {
-			reset.ref = newname
+			reset.ref = rename(reset.ref)
 			reset.addColor(colorQSET)
 		}
 		for _, commit := range repo.commits(undefinedSelectionSet) {
 			if sourceRE.MatchString(commit.Branch) {
-				commit.Branch = newname
+				commit.Branch = rename(commit.Branch)
 				commit.addColor(colorQSET)
 			}
 		}
@@ -6370,6 +6777,114 @@ func (rs *Reposurgeon) DoDiff(line string) bool {
 	return false
 }
 
+// HelpGrep says "Shut up, golint!"
+func (rs *Reposurgeon) HelpGrep() {
+	rs.helpOutput(`
+[SELECTION] grep [--commits] [--comments] [--list] PATTERN [>OUTFILE]
+
+Search the content of blobs in the selection set (default: all) for
+PATTERN, which is a regular expression if delimited by a punctuation
+character and otherwise a literal string. Each matching line is
+reported as MARK:LINENO:TEXT; the content of an inline fileop is
+reported under the mark of its commit.
+
+With --commits, also report the commits with fileops referencing a
+matching blob; this is how to find every commit that introduced a
+leaked secret.  With --comments, commit and tag comments are searched
+as well.  With --list, only the marks (or tag names) of matching
+events are reported, each once.
+
+This command sets Q bits: true on each matching blob, commit, or tag,
+false otherwise. Use =Q to select the matches for further surgery.
+`)
+}
+
+// DoGrep searches blob content, and optionally comments, for a pattern.
+func (rs *Reposurgeon) DoGrep(line string) bool {
+	parse := rs.newLineParse(line, parseALLREPO, orderedStringSet{"stdout"})
+	defer parse.Closem()
+	if parse.line == "" {
+		croak("grep requires a pattern argument")
+		return false
+	}
+	pattern, isRe := delimitedRegexp(parse.line)
+	if !isRe {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	searchRE, err := regexp.Compile(pattern)
+	if err != nil {
+		croak("grep: %v", err)
+		return false
+	}
+	withCommits := parse.options.Contains("--commits")
+	withComments := parse.options.Contains("--comments")
+	listOnly := parse.options.Contains("--list")
+	repo := rs.chosen()
+	// Report matching lines of a text, unless only the matching
+	// events are to be listed; return true if there were any.
+	search := func(id string, text []byte) bool {
+		if !searchRE.Match(text) {
+			return false
+		}
+		if !listOnly {
+			for i, txtline := range bytes.Split(text, []byte("\n")) {
+				if searchRE.Match(txtline) {
+					fmt.Fprintf(parse.stdout, "%s:%d:%s\n", id, i+1, txtline)
+				}
+			}
+		}
+		return true
+	}
+	hit := func(event Event, id string) {
+		event.addColor(colorQSET)
+		if listOnly {
+			fmt.Fprintln(parse.stdout, id)
+		}
+	}
+	repo.clearColor(colorQSET)
+	matched := newOrderedStringSet()
+	for it := rs.selection.Iterator(); it.Next(); {
+		if blob, ok := repo.events[it.Value()].(*Blob); ok {
+			if search(blob.mark, blob.getContent()) {
+				hit(blob, blob.mark)
+				matched.Add(blob.mark)
+			}
+		}
+		control.baton.twirl()
+	}
+	for it := rs.selection.Iterator(); it.Next(); {
+		switch event := repo.events[it.Value()].(type) {
+		case *Commit:
+			found := withComments && search(event.mark, []byte(event.Comment))
+			for _, fileop := range event.operations() {
+				if fileop.op != opM {
+					continue
+				}
+				// Inline content is searched as a blob's would be,
+				// and reported under the mark of its commit.
+				refers := matched.Contains(fileop.ref)
+				if fileop.ref == "inline" && search(event.mark, fileop.inline) {
+					found, refers = true, true
+				}
+				if withCommits && refers {
+					found = true
+					if !listOnly {
+						fmt.Fprintf(parse.stdout, "%s %s %s\n", event.mark, fileop.ref, fileop.Path)
+					}
+				}
+			}
+			if found {
+				hit(event, event.mark)
+			}
+		case *Tag:
+			if withComments && search(event.tagname, []byte(event.Comment)) {
+				hit(event, event.tagname)
+			}
+		}
+	}
+	return false
+}
+
 //
 // Setting options
 //
@@ -105,9 +105,11 @@ type svnReader struct {
 	flat        bool
 	noSimplify  bool
 	firstnode   *NodeAction
+	notes       map[*Commit]string // Note text from mapped properties
 }
 
 func (sp *svnReader) initialize() {
+	sp.notes = make(map[*Commit]string)
 	// Parse branchify to speed up things later
 	sp.branchify = make(map[int][][]string)
 	for _, trial := range []string{"trunk", "tags/*", "branches/*", "*"} {
@@ -354,6 +356,44 @@ var preserveProperties = map[string]bool{
 	"svn:special":        true,
 }
 
+// PropertyRule maps Subversion properties with names matching a
+// pattern onto something git can represent: a commit-message trailer,
+// a note, or a .gitattributes entry.  Rules are set with the propmap
+// command and consulted when a Subversion dump is read.
+type PropertyRule struct {
+	source  string // Pattern as the user gave it
+	pattern *regexp.Regexp
+	action  string // "trailer", "note", or "attribute"
+	name    string // Replacement for the property name, may use \1 etc.
+}
+
+// key returns the trailer or attribute name for a property.
+func (rule *PropertyRule) key(prop string) string {
+	if rule.name == "" {
+		return prop
+	}
+	return GoReplacer(rule.pattern, prop, rule.name)
+}
+
+// String renders the rule the way propmap takes it.
+func (rule *PropertyRule) String() string {
+	out := rule.source + " " + rule.action
+	if rule.name != "" {
+		out += " " + rule.name
+	}
+	return out
+}
+
+// propertyRule returns the first rule matching a property, or nil.
+func propertyRule(prop string) *PropertyRule {
+	for i := range control.propertyRules {
+		if control.propertyRules[i].pattern.MatchString(prop) {
+			return &control.propertyRules[i]
+		}
+	}
+	return nil
+}
+
 // Helpers for Subversion dumpfiles
 
 func sdBody(line []byte) []byte {
@@ -1047,6 +1087,7 @@ func (sp *StreamParser) svnProcess(ctx context.Context, options stringSet, baton
 	timeit("dejunk")
 	svnProcessRenumber(ctx, sp, options, baton)
 	timeit("renumbering")
+	svnAttachNotes(sp)
 
 	// Treat this in-core state as though it was read from an SVN repo
 	sp.repo.hint("svn", "", true)
@@ -1072,7 +1113,9 @@ func svnFilterProperties(ctx context.Context, sp *StreamParser, options stringSe
 		if node.hasProperties() {
 			// Some properties should be quietly ignored
 			for k := range ignoreProperties {
-				node.props.delete(k)
+				if propertyRule(k) == nil {
+					node.props.delete(k)
+				}
 			}
 			// Remove blank lines from ignore property values.
 			if node.props.has("svn:ignore") {
@@ -1089,7 +1132,7 @@ func svnFilterProperties(ctx context.Context, sp *StreamParser, options stringSe
 			for prop, val := range node.props.dict {
 				// Pass through the properties that can't be processed until we're ready to
 				// generate commits. Delete the rest.
-				if !preserveProperties[prop] && !((prop == "svn:mergeinfo" || prop == "svnmerge-integrated") && node.kind == sdDIR) {
+				if !preserveProperties[prop] && propertyRule(prop) == nil && !((prop == "svn:mergeinfo" || prop == "svnmerge-integrated") && node.kind == sdDIR) {
 					tossThese = append(tossThese, [2]string{prop, val})
 					node.props.delete(prop)
 				}
@@ -1476,6 +1519,49 @@ func svnGenerateCommits(ctx context.Context, sp *StreamParser, options stringSet
 	// a string for the .gitignore patterns stored in tree at this path.
 	gitIgnores := make(map[string]*[]string)
 
+	// gitAttributes maps directory paths to the attributes set by
+	// mapped properties on the files in them, by basename.
+	// lastPropValues remembers node property values already
+	// reported as trailers or notes, so they are not repeated
+	// each time the node changes.
+	gitAttributes := make(map[string]map[string]map[string]string)
+	lastPropValues := make(map[string]string)
+	attributesOp := func(dir string) *FileOp {
+		var buf bytes.Buffer
+		files := make([]string, 0, len(gitAttributes[dir]))
+		for base := range gitAttributes[dir] {
+			files = append(files, base)
+		}
+		sort.Strings(files)
+		for _, base := range files {
+			attrs := gitAttributes[dir][base]
+			keys := make([]string, 0, len(attrs))
+			for k := range attrs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			buf.WriteString(base)
+			for _, k := range keys {
+				// Boolean Subversion properties have the value "*".
+				if v := strings.Join(strings.Fields(attrs[k]), "_"); v == "" || v == "*" {
+					buf.WriteString(" " + k)
+				} else {
+					buf.WriteString(" " + k + "=" + v)
+				}
+			}
+			buf.WriteString(control.lineSep)
+		}
+		op := newFileOp(sp.repo)
+		path := filepath.Join(dir, ".gitattributes")
+		if buf.Len() == 0 {
+			op.construct(opD, path)
+		} else {
+			op.construct(opM, "100644", "inline", path)
+			op.inline = buf.Bytes()
+		}
+		return op
+	}
+
 	var lastcommit *Commit
 	for ri, record := range sp.revisions {
 		// Zero revision is almost never interesting - no operations, no
@@ -1537,8 +1623,29 @@ func svnGenerateCommits(ctx context.Context, sp *StreamParser, options stringSet
 			commit.committer.date.timestamp = time.Unix(int64(ri*360), 0)
 			commit.committer.date.setTZ("UTC")
 		}
+		attrDirty := newOrderedStringSet()
+		trailers := make([]string, 0)
+		notes := make([]string, 0)
+		for _, prop := range record.props.keys {
+			if rule := propertyRule(prop); rule != nil {
+				line := rule.key(prop) + ": " + strings.TrimSpace(record.props.get(prop))
+				if rule.action == "trailer" {
+					trailers = append(trailers, line)
+				} else if rule.action == "note" {
+					notes = append(notes, line)
+				}
+			}
+		}
 		if record.props.Len() > 0 {
-			commit.properties = &record.props
+			// Of the other revision properties, only those a
+			// rule maps are kept on the commit.
+			props := newOrderedMap()
+			for _, prop := range record.props.keys {
+				if propertyRule(prop) != nil {
+					props.set(prop, record.props.get(prop))
+				}
+			}
+			commit.properties = &props
 			record.props.Clear()
 		}
 
@@ -1578,6 +1685,56 @@ func svnGenerateCommits(ctx context.Context, sp *StreamParser, options stringSet
 					node.props.delete("cvs2svn:cvs-rev")
 				}
 			}
+			// Mapped node properties
+			dir, base := filepath.Split(trimSep(node.path))
+			dir = trimSep(dir)
+			if node.action == sdDELETE || node.action == sdNUKE {
+				if _, ok := gitAttributes[dir][base]; ok {
+					delete(gitAttributes[dir], base)
+					attrDirty.Add(dir)
+				}
+				for d := range gitAttributes {
+					if strings.HasPrefix(d+svnSep, trimSep(node.path)+svnSep) {
+						delete(gitAttributes, d)
+					}
+				}
+			} else if node.hasProperties() {
+				newattrs := make(map[string]string)
+				for _, prop := range node.props.keys {
+					rule := propertyRule(prop)
+					if rule == nil {
+						continue
+					}
+					value := node.props.get(prop)
+					if rule.action == "attribute" {
+						if node.kind == sdFILE {
+							newattrs[rule.key(prop)] = value
+						}
+						continue
+					}
+					if old, ok := lastPropValues[node.path+"\x00"+prop]; ok && old == value {
+						continue
+					}
+					lastPropValues[node.path+"\x00"+prop] = value
+					line := rule.key(prop) + ": " + strings.TrimSpace(value)
+					if rule.action == "trailer" {
+						trailers = append(trailers, line)
+					} else if rule.action == "note" {
+						notes = append(notes, trimSep(node.path)+": "+line)
+					}
+				}
+				if node.kind == sdFILE && fmt.Sprint(newattrs) != fmt.Sprint(gitAttributes[dir][base]) {
+					if len(newattrs) == 0 {
+						delete(gitAttributes[dir], base)
+					} else {
+						if gitAttributes[dir] == nil {
+							gitAttributes[dir] = make(map[string]map[string]string)
+						}
+						gitAttributes[dir][base] = newattrs
+					}
+					attrDirty.Add(dir)
+				}
+			}
 			var ancestor *NodeAction
 			if node.action == sdNUKE {
 				if logEnable(logEXTRACT) {
@@ -1805,6 +1962,22 @@ func svnGenerateCommits(ctx context.Context, sp *StreamParser, options stringSet
 			baton.twirl()
 		}
 
+		for _, dir := range attrDirty {
+			commit.appendOperation(attributesOp(dir))
+			if len(gitAttributes[dir]) == 0 {
+				delete(gitAttributes, dir)
+			}
+		}
+		if len(trailers) > 0 {
+			if commit.Comment != "" {
+				commit.Comment += control.lineSep
+			}
+			commit.Comment += strings.Join(trailers, control.lineSep) + control.lineSep
+		}
+		if len(notes) > 0 {
+			sp.notes[commit] = strings.Join(notes, control.lineSep) + control.lineSep
+		}
+
 		// This early in processing, a commit with zero
 		// fileops can only represent a dumpfile revision with
 		// no nodes. This can happen if the corresponding
@@ -3152,4 +3325,43 @@ func svnProcessRenumber(ctx context.Context, sp *StreamParser, options stringSet
 	sp.repo.events = append(sp.repo.events, newPassthrough(sp.repo, "done\n"))
 }
 
+// svnAttachNotes gathers the notes generated from mapped properties
+// into a single commit on refs/notes/commits.  It runs after renumbering
+// so the note targets are the final marks.
+func svnAttachNotes(sp *StreamParser) {
+	if len(sp.notes) == 0 {
+		return
+	}
+	var last *Commit
+	note := newCommit(sp.repo)
+	for _, event := range sp.repo.events {
+		commit, ok := event.(*Commit)
+		if !ok {
+			continue
+		}
+		last = commit
+		text, ok := sp.notes[commit]
+		if !ok || commit.repo == nil {
+			continue
+		}
+		op := newFileOp(sp.repo)
+		op.op = opN
+		op.ref = "inline"
+		op.Path = commit.mark
+		op.inline = []byte(text)
+		note.appendOperation(op)
+		sp.repo.inlines++
+	}
+	if last == nil || len(note.operations()) == 0 {
+		return
+	}
+	note.committer = *last.committer.clone()
+	note.Comment = "Notes converted from Subversion properties" + control.lineSep
+	note.setBranch("refs/notes/commits")
+	note.setMark(sp.repo.newmark())
+	// Insert before the trailing done passthrough.
+	sp.repo.events = append(sp.repo.events[:len(sp.repo.events)-1], note, sp.repo.events[len(sp.repo.events)-1])
+	sp.repo.declareSequenceMutation("note attachment")
+}
+
 // end
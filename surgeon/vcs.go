@@ -34,28 +34,43 @@ import (
 //
 // ${pwd} is replaced with the name of the present working directory.
 
+// toolRequirement describes an external program that reading from or
+// writing to a VCS depends on.  The probe command must succeed for the
+// tool to be usable; if there is a minimum version, the first dotted
+// number in the probe's output is checked against it.
+type toolRequirement struct {
+	role    string // "export", "import", or "" for both
+	program string // Program to look for on $PATH
+	probe   string // Command to check it, or "" if presence is enough
+	minimum string // Oldest usable version, or ""
+	hint    string // How to get it
+}
+
 // VCS is a class representing a version-control system.
 type VCS struct {
-	name         string           // Name of the VCS
-	subdirectory string           // Name of its metadata subdirectory
-	exporter     string           // Import/export style flags.
-	quieter      string           // How to make exporter quieter
-	styleflags   orderedStringSet // fast-export style flags
-	extensions   orderedStringSet // Format extension flags
-	initializer  string           // Command to initualize a repo
-	pathlister   string           // Command to list registered files
-	taglister    string           // Command to list tag names
-	branchlister string           // Command to list branch names
-	importer     string           // Command to import from stream format
-	checkout     string           // Command to check out working copy
-	preserve     orderedStringSet // Config and hook stuff to be preserved
-	prenuke      orderedStringSet // Things to be removed from staging
-	authormap    string           // Where importer might drop an authormap
-	ignorename   string           // Where the ignore patterns live
-	dfltignores  string           // Default ignore patterns
-	cookies      []regexp.Regexp  // How to recogbnize a commit reference
-	project      string           // VCS project URL
-	notes        string           // Notes and caveats
+	name         string            // Name of the VCS
+	subdirectory string            // Name of its metadata subdirectory
+	exporter     string            // Import/export style flags.
+	quieter      string            // How to make exporter quieter
+	styleflags   orderedStringSet  // fast-export style flags
+	extensions   orderedStringSet  // Format extension flags
+	initializer  string            // Command to initualize a repo
+	pathlister   string            // Command to list registered files
+	taglister    string            // Command to list tag names
+	branchlister string            // Command to list branch names
+	importer     string            // Command to import from stream format
+	checkout     string            // Command to check out working copy
+	switcher     string            // Command to switch working copy in place
+	dfltbranch   string            // Branch switcher selects by default
+	preserve     orderedStringSet  // Config and hook stuff to be preserved
+	prenuke      orderedStringSet  // Things to be removed from staging
+	authormap    string            // Where importer might drop an authormap
+	ignorename   string            // Where the ignore patterns live
+	dfltignores  string            // Default ignore patterns
+	cookies      []regexp.Regexp   // How to recogbnize a commit reference
+	project      string            // VCS project URL
+	notes        string            // Notes and caveats
+	requires     []toolRequirement // External tools needed
 	// Hidden members
 	checkignore string // how to tell if directory is a checkout
 }
@@ -98,6 +113,14 @@ func (vcs VCS) String() string {
 		}
 	}
 	notes := strings.Trim(vcs.notes, "\t ")
+	requires := newOrderedStringSet()
+	for _, req := range vcs.requires {
+		if req.minimum != "" {
+			requires.Add(req.program + ">=" + req.minimum)
+		} else {
+			requires.Add(req.program)
+		}
+	}
 
 	return fmt.Sprintf("         Name: %s\n", vcs.name) +
 		fmt.Sprintf(" Subdirectory: %s\n", vcs.subdirectory) +
@@ -110,11 +133,14 @@ func (vcs VCS) String() string {
 		fmt.Sprintf(" Branchlister: %s\n", vcs.branchlister) +
 		fmt.Sprintf("     Importer: %s\n", vcs.importer) +
 		fmt.Sprintf("     Checkout: %s\n", vcs.checkout) +
+		fmt.Sprintf("     Switcher: %s\n", vcs.switcher) +
+		fmt.Sprintf("   Dfltbranch: %s\n", vcs.dfltbranch) +
 		fmt.Sprintf("      Prenuke: %s\n", vcs.prenuke.String()) +
 		fmt.Sprintf("     Preserve: %s\n", vcs.preserve.String()) +
 		fmt.Sprintf("    Authormap: %s\n", vcs.authormap) +
 		fmt.Sprintf("   Ignorename: %s\n", vcs.ignorename) +
 		fmt.Sprintf("      Ignores: %s\n", realignores.String()) +
+		fmt.Sprintf("     Requires: %s\n", requires.String()) +
 		fmt.Sprintf("      Project: %s\n", vcs.project) +
 		fmt.Sprintf("        Notes: %s\n", notes)
 }
@@ -174,6 +200,8 @@ func vcsInit() {
 			initializer:  "git init --quiet",
 			importer:     "git fast-import --quiet --export-marks=.git/marks",
 			checkout:     "git checkout",
+			switcher:     "git checkout",
+			dfltbranch:   "master",
 			pathlister:   "git ls-files",
 			taglister:    "git tag -l",
 			branchlister: "git branch -q --list 2>&1 | cut -c 3- | egrep -v 'detached|^master$' || exit 0",
@@ -185,6 +213,9 @@ func vcsInit() {
 			cookies:      reMake(`\b[0-9a-f]{6}\b`, `\b[0-9a-f]{40}\b`),
 			project:      "http://git-scm.com/",
 			notes:        "The authormap is not required, but will be used if present.",
+			requires: []toolRequirement{
+				{"", "git", "git --version", "2.19.2", "install git from your distribution or http://git-scm.com/"},
+			},
 		},
 		{
 			name:         "bzr",
@@ -225,6 +256,9 @@ bzr-orphans
 `,
 			cookies: reMake(tokenNumeric),
 			notes:   "Requires the bzr-fast-import plugin.",
+			requires: []toolRequirement{
+				{"", "bzr", "bzr fast-export --help", "", "install bzr and the bzr-fast-import plugin from your distribution"},
+			},
 		},
 		{
 			name:         "hg",
@@ -241,6 +275,8 @@ bzr-orphans
 			branchlister: "hg branches --closed --template '{branch}\n' | grep -v '^default$'",
 			importer:     "hg-git-fast-import",
 			checkout:     "hg checkout",
+			switcher:     "hg checkout",
+			dfltbranch:   "default",
 			prenuke:      newOrderedStringSet(".hg/hgrc"),
 			preserve:     newOrderedStringSet(".hg/hgrc"),
 			authormap:    "",
@@ -253,6 +289,10 @@ bzr-orphans
 If there is no branch named 'master' in a repo when it is read, the hg 'default'
 branch is renamed to 'master'.
 `,
+			requires: []toolRequirement{
+				{"", "hg", "hg --version", "", "install Mercurial from your distribution or https://www.mercurial-scm.org/"},
+				{"import", "hg-git-fast-import", "", "", "install hg-git-fast-import from https://github.com/kilork/hg-git-fast-import"},
+			},
 		},
 		{
 			// Styleflags may need tweaking for round-tripping
@@ -375,6 +415,9 @@ core
 			cookies: reMake(),
 			project: "http://darcs.net/",
 			notes:   "Assumes no boringfile preference has been set.",
+			requires: []toolRequirement{
+				{"", "darcs", "darcs --version", "", "install darcs and darcs-fastconvert from http://darcs.net/"},
+			},
 		},
 		{
 			name:         "mtn",
@@ -434,6 +477,9 @@ _darcs
 			cookies: reMake(),
 			project: "http://www.monotone.ca/",
 			notes:   "Exporter is buggy, occasionally emitting negative timestamps.",
+			requires: []toolRequirement{
+				{"export", "mtn", "mtn --version", "", "install monotone from http://www.monotone.ca/"},
+			},
 		},
 		{
 			name:         "svn",
@@ -457,6 +503,11 @@ _darcs
 			project:      "http://subversion.apache.org/",
 			notes:        "Run from the repository, not a checkout directory.",
 			checkignore:  ".svn",
+			requires: []toolRequirement{
+				{"export", "svnadmin", "svnadmin --version --quiet", "", "install Subversion from your distribution or http://subversion.apache.org/"},
+				{"export", "svnsync", "svnsync --version --quiet", "", "install Subversion from your distribution or http://subversion.apache.org/"},
+				{"export", "svn", "svn --version --quiet", "", "install Subversion from your distribution or http://subversion.apache.org/"},
+			},
 		},
 		{
 			name:         "cvs",
@@ -512,6 +563,10 @@ core
 			project:     "http://www.catb.org/~esr/cvs-fast-export",
 			notes:       "Requires cvs-fast-export.",
 			checkignore: "CVS",
+			requires: []toolRequirement{
+				{"export", "cvs-fast-export", "cvs-fast-export --version", "", "install cvs-fast-export from http://www.catb.org/~esr/cvs-fast-export"},
+				{"export", "cvssync", "", "", "cvssync is distributed with cvs-fast-export"},
+			},
 		},
 		{
 			name:         "rcs",
@@ -531,6 +586,9 @@ core
 			cookies:      reMake(dottedNumeric),
 			project:      "http://www.catb.org/~esr/cvs-fast-export",
 			notes:        "Requires cvs-fast-export.",
+			requires: []toolRequirement{
+				{"export", "cvs-fast-export", "cvs-fast-export --version", "", "install cvs-fast-export from http://www.catb.org/~esr/cvs-fast-export"},
+			},
 		},
 		{
 			name:         "src",
@@ -551,6 +609,9 @@ core
 			cookies:      reMake(tokenNumeric),
 			project:      "http://catb.org/~esr/src",
 			notes:        "",
+			requires: []toolRequirement{
+				{"export", "src", "src version", "", "install src from http://catb.org/~esr/src"},
+			},
 		},
 		{
 			// Styleflags may need tweaking for round-tripping
@@ -575,6 +636,9 @@ core
 			project:      "https://www.bitkeeper.com/",
 			// No tag support, and a tendency to core-dump
 			notes: "Bitkeeper's importer is flaky and incomplete as of 7.3.1ce.",
+			requires: []toolRequirement{
+				{"", "bk", "bk version", "", "install BitKeeper from https://www.bitkeeper.com/"},
+			},
 		},
 	}
 
@@ -0,0 +1,7 @@
+## Assemble two Subversion dumps into one repository
+print Namespaced:
+assemble tagsimple.svn blob-id.svn
+write -
+print Subdirectories:
+assemble --subdirectories tagsimple.svn blob-id.svn
+write -
@@ -0,0 +1,50 @@
+## Test grep command on blob content and comments
+read <<EOF
+blob
+mark :1
+data 31
+First line.
+password=hunter2
+End.
+
+commit refs/heads/master
+mark :2
+committer Ralf Schlatterbeck <rsc@runtux.com> 0 +0000
+data 14
+First commit.
+M 100644 :1 README
+
+blob
+mark :3
+data 12
+First line.
+
+commit refs/heads/master
+mark :4
+committer Ralf Schlatterbeck <rsc@runtux.com> 10 +0000
+data 24
+Remove hunter2 password.
+from :2
+M 100644 :3 README
+
+commit refs/heads/master
+mark :5
+committer Ralf Schlatterbeck <rsc@runtux.com> 20 +0000
+data 14
+Inline config.
+from :4
+M 100644 inline config
+data 16
+secret=hunter3
+
+EOF
+grep /hunter[0-9]/
+=Q list
+grep --commits hunter2
+=Q list
+grep --comments --list /hunter/
+=Q list
+grep /hunter3/
+=Q list
+grep --commits --list /hunter/
+=Q list
@@ -0,0 +1,33 @@
+## Round-trip of unrecognized stream extensions
+read <<EOF
+feature exotic-extension
+blob
+mark :1
+data 4
+one
+
+commit refs/heads/master
+mark :2
+committer J. Random Hacker <jrh@example.com> 0 +0000
+property branch-nick 6 master
+property rebase-of 3 abc
+data 7
+First.
+M 100644 :1 a.txt
+ls :2 a.txt
+cat-blob :1
+
+x-vendor-annotation :2
+data 11
+hello world
+
+commit refs/heads/master
+mark :4
+committer J. Random Hacker <jrh@example.com> 10 +0000
+data 8
+Second.
+from :2
+D a.txt
+
+EOF
+write --properties --features -
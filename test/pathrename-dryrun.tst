@@ -0,0 +1,48 @@
+## Test path rename dry run with collision detection
+read <<EOF
+blob
+mark :1
+data 4
+one
+
+blob
+mark :2
+data 4
+two
+
+commit refs/heads/master
+mark :3
+committer Ralf Schlatterbeck <rsc@runtux.com> 0 +0000
+data 7
+First.
+M 100644 :1 src/a.txt
+M 100644 :2 lib/a.txt
+
+commit refs/heads/master
+mark :4
+committer Ralf Schlatterbeck <rsc@runtux.com> 10 +0000
+data 8
+Second.
+from :3
+D lib/a.txt
+
+commit refs/heads/master
+mark :5
+committer Ralf Schlatterbeck <rsc@runtux.com> 20 +0000
+data 7
+Third.
+from :4
+M 100644 :2 lib/a.txt
+
+EOF
+print Intra-commit collision:
+path rename /^(src|lib)\/a.txt$/ a.txt --dry-run
+print Orphaned fileop:
+:3 path rename /^lib\/a.txt$/ lib/b.txt --dry-run
+print Deletions before the selection are not orphaned:
+:5 path rename /^lib\/a.txt$/ lib/c.txt --dry-run
+print Dry run leaves repository untouched:
+write -
+print Renames that would orphan fileops are refused:
+:3 path rename /^lib\/a.txt$/ lib/b.txt
+path list
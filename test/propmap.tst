@@ -0,0 +1,232 @@
+## Test mapping of Subversion properties to trailers, notes, and attributes
+propmap bugtraq:issue trailer Issue
+propmap /^review:(.*)/ note Review-\1
+propmap /^svn:(eol-style|mime-type)$/ attribute \1
+propmap
+read <<SVNDUMP-EOF
+SVN-fs-dump-format-version: 2
+
+UUID: 9a3d2a5e-7f0e-4c5e-9d3e-2f3e6c5a1b7d
+
+Revision-number: 0
+Prop-content-length: 56
+Content-length: 56
+
+K 8
+svn:date
+V 27
+2020-01-01T10:00:00.000000Z
+PROPS-END
+
+Revision-number: 1
+Prop-content-length: 115
+Content-length: 115
+
+K 7
+svn:log
+V 16
+Initial layout.
+
+K 10
+svn:author
+V 4
+fred
+K 8
+svn:date
+V 27
+2020-01-02T10:00:00.000000Z
+PROPS-END
+
+Node-path: branches
+Node-kind: dir
+Node-action: add
+Prop-content-length: 10
+Content-length: 10
+
+PROPS-END
+
+
+Node-path: tags
+Node-kind: dir
+Node-action: add
+Prop-content-length: 10
+Content-length: 10
+
+PROPS-END
+
+
+Node-path: trunk
+Node-kind: dir
+Node-action: add
+Prop-content-length: 64
+Content-length: 64
+
+K 11
+bugtraq:url
+V 31
+http://bugs.example.com/%BUGID%
+PROPS-END
+
+
+Revision-number: 2
+Prop-content-length: 139
+Content-length: 139
+
+K 7
+svn:log
+V 12
+Add a file.
+
+K 10
+svn:author
+V 4
+fred
+K 8
+svn:date
+V 27
+2020-01-03T10:00:00.000000Z
+K 13
+bugtraq:issue
+V 4
+1234
+PROPS-END
+
+Node-path: trunk/README
+Node-kind: file
+Node-action: add
+Prop-content-length: 107
+Text-content-length: 6
+Content-length: 113
+
+K 13
+svn:eol-style
+V 6
+native
+K 13
+svn:mime-type
+V 10
+text/plain
+K 13
+review:status
+V 8
+approved
+PROPS-END
+Hello
+
+
+Node-path: trunk/foo.c
+Node-kind: file
+Node-action: add
+Prop-content-length: 36
+Text-content-length: 7
+Content-length: 43
+
+K 13
+svn:eol-style
+V 2
+LF
+PROPS-END
+int x;
+
+
+Revision-number: 3
+Prop-content-length: 144
+Content-length: 144
+
+K 7
+svn:log
+V 17
+Modify the file.
+
+K 10
+svn:author
+V 4
+fred
+K 8
+svn:date
+V 27
+2020-01-04T10:00:00.000000Z
+K 13
+bugtraq:issue
+V 4
+1235
+PROPS-END
+
+Node-path: trunk/README
+Node-kind: file
+Node-action: change
+Text-content-length: 13
+Content-length: 13
+
+Hello, world
+
+
+Revision-number: 4
+Prop-content-length: 118
+Content-length: 118
+
+K 7
+svn:log
+V 19
+Change properties.
+
+K 10
+svn:author
+V 4
+fred
+K 8
+svn:date
+V 27
+2020-01-05T10:00:00.000000Z
+PROPS-END
+
+Node-path: trunk/README
+Node-kind: file
+Node-action: change
+Prop-content-length: 77
+Content-length: 77
+
+K 13
+svn:mime-type
+V 10
+text/plain
+K 13
+review:status
+V 8
+rejected
+PROPS-END
+
+
+Revision-number: 5
+Prop-content-length: 114
+Content-length: 114
+
+K 7
+svn:log
+V 15
+Delete a file.
+
+K 10
+svn:author
+V 4
+fred
+K 8
+svn:date
+V 27
+2020-01-06T10:00:00.000000Z
+PROPS-END
+
+Node-path: trunk/foo.c
+Node-kind: file
+Node-action: delete
+Content-length: 0
+
+
+SVNDUMP-EOF
+prefer git
+write -
+# Of the revision properties, only the mapped ones are kept on commits
+prefer bzr
+write -
+propmap --clear
+propmap
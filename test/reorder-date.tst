@@ -0,0 +1,64 @@
+## Test sorting commits by committer date
+set relax
+read <<EOF
+blob
+mark :1
+data 2
+a
+
+commit refs/heads/master
+mark :2
+committer A U Thor <author@example.com> 1000 +0000
+data 7
+first.
+M 100644 :1 a
+
+blob
+mark :3
+data 2
+b
+
+commit refs/heads/master
+mark :4
+committer A U Thor <author@example.com> 3000 +0000
+data 7
+third.
+from :2
+M 100644 :3 a
+
+commit refs/heads/master
+mark :5
+committer A U Thor <author@example.com> 2500 +0000
+data 25
+dated before its parent.
+from :4
+M 100644 :1 a
+
+blob
+mark :6
+data 2
+c
+
+commit refs/heads/topic
+mark :7
+committer A U Thor <author@example.com> 2000 +0000
+data 8
+second.
+from :2
+M 100644 :6 b
+
+commit refs/heads/topic
+mark :8
+committer A U Thor <author@example.com> 4000 +0000
+data 8
+fourth.
+from :7
+M 100644 :1 b
+
+EOF
+reorder
+reorder --date
+list commits
+reorder --date --redate
+list commits
+write -
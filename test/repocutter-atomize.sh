@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test splitting revisions into single-node revisions
+${REPOCUTTER:-repocutter} -q atomize <mergeinfo-combine.svn | ${REPOCUTTER:-repocutter} -q see
+${REPOCUTTER:-repocutter} -q atomize <simpletag.svn | ${REPOCUTTER:-repocutter} -q -r 2:3 log
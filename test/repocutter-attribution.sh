@@ -0,0 +1,12 @@
+#!/bin/sh
+## Test author remapping from an author map
+cat >/tmp/authormap$$ <<EOM
+# Test map
+aquette = Arnaud Quette <aquette@example.com> Europe/Paris
+CLEPPLE-GUEST = Charles Lepple <clepple@example.com>
++ Charles Lepple <clepple@example.org>
+EOM
+${REPOCUTTER:-repocutter} -q -r 1:12 -I reposurgeon:identity attribution /tmp/authormap$$ <branchreplace.svn >/tmp/attribution$$.svn
+${REPOCUTTER:-repocutter} -q log </tmp/attribution$$.svn | grep '^r[0-9]'
+grep -a -A3 'reposurgeon:identity' /tmp/attribution$$.svn | head -4
+rm -f /tmp/authormap$$ /tmp/attribution$$.svn
@@ -0,0 +1,5 @@
+#!/bin/sh
+## Test selection by author
+${REPOCUTTER:-repocutter} -q -A 'guest$' log <branchreplace.svn | grep '^r[0-9]'
+${REPOCUTTER:-repocutter} -q -r 1:12 --author '^aquette$' log <branchreplace.svn | grep '^r[0-9]'
+${REPOCUTTER:-repocutter} -q -A '^selinger' select <branchreplace.svn | ${REPOCUTTER:-repocutter} -q see
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test author activity report
+${REPOCUTTER:-repocutter} -q authors trunk branches <branchreplace.svn
+${REPOCUTTER:-repocutter} -q -r 1:5 authors <branchreplace.svn
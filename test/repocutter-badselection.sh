@@ -0,0 +1,6 @@
+#!/bin/sh
+## Test that ill-formed selections are usage errors
+for range in x 1:2:3 1.x 1: 1+x; do
+    ${REPOCUTTER:-repocutter} -q -r "$range" see <vanilla.svn
+    echo "exit status $?"
+done
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test recomputation of text checksums
+sed '/^Text-content-\(md5\|sha1\)/d' <attrws.svn | ${REPOCUTTER:-repocutter} -q checksum | grep -a '^Text-content'
+${REPOCUTTER:-repocutter} -q -H replace /fox/cat/ <pangram.svn | grep -a '^Text-content'
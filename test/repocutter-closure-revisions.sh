@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test closure with copy revision reporting
+${REPOCUTTER:-repocutter} -q closure trunk <branchreplace.svn
+${REPOCUTTER:-repocutter} -q -R closure trunk <branchreplace.svn
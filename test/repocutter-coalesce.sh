@@ -0,0 +1,5 @@
+#!/bin/sh
+## Test merging runs of revisions by one author
+# r12 and r13 stay apart because r13 copies from r12
+${REPOCUTTER:-repocutter} -q coalesce 1h <branchreplace.svn | ${REPOCUTTER:-repocutter} -q -r 11:16 see
+${REPOCUTTER:-repocutter} -q coalesce 1h <branchreplace.svn | ${REPOCUTTER:-repocutter} -q -r 16 log
@@ -0,0 +1,7 @@
+#!/bin/sh
+## Test repocutter compressed output and transparent decompression of input
+trap 'rm -f /tmp/compress$$.svn.gz /tmp/compress$$.z' EXIT HUP INT QUIT TERM
+${REPOCUTTER:-repocutter} -q -o /tmp/compress$$.svn.gz -r 2:3 select <dircopyprop.svn
+${REPOCUTTER:-repocutter} -q see </tmp/compress$$.svn.gz
+${REPOCUTTER:-repocutter} -q -z gzip -r 4 select <dircopyprop.svn >/tmp/compress$$.z
+${REPOCUTTER:-repocutter} -q see </tmp/compress$$.z
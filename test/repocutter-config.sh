@@ -0,0 +1,31 @@
+#!/bin/sh
+## Test defaults, pattern aliases and pipelines from a configuration file
+XDG_CONFIG_HOME=/tmp/config$$; export XDG_CONFIG_HOME
+unset REPOCUTTER_NOCONFIG
+trap 'rm -fr /tmp/config$$' EXIT HUP INT QUIT TERM
+mkdir /tmp/config$$
+cat >/tmp/config$$/repocutter.toml <<'END'
+# Defaults are long option names
+quiet = true
+
+[aliases]
+resources = 'branches/resources'
+
+[pipelines]
+tidy = [
+    "sift @resources",     # an alias works here too
+    "pathrename ^branches/resources stuff",
+    "renumber",
+]
+END
+${REPOCUTTER:-repocutter} -r 10:12 see <debranch.svn
+echo "--"
+${REPOCUTTER:-repocutter} -r 1:HEAD script @tidy <debranch.svn | ${REPOCUTTER:-repocutter} -r 0:HEAD see
+echo "--"
+# What a run reads, writes or selects can't be defaulted
+echo 'range = "10:12"' >/tmp/config$$/repocutter.toml
+${REPOCUTTER:-repocutter} see <debranch.svn 2>/tmp/config$$/err
+echo "exit status $?"
+sed "s/config[0-9]*/config/" </tmp/config$$/err
+# unless the configuration is ignored altogether
+REPOCUTTER_NOCONFIG=1 ${REPOCUTTER:-repocutter} -q -r 10:11 see <debranch.svn
@@ -0,0 +1,5 @@
+#!/bin/sh
+## Test selection by date window
+${REPOCUTTER:-repocutter} -q -D 2005-02-01:2005-06-01 log <branchreplace.svn | grep '^r[0-9]'
+${REPOCUTTER:-repocutter} -q -r 1:6 --dates 2005-01-27T14:33:20Z: log <branchreplace.svn | grep '^r[0-9]'
+${REPOCUTTER:-repocutter} -q -D 2005-02-01:2005-06-01 select <branchreplace.svn | ${REPOCUTTER:-repocutter} -q see
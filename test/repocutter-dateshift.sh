@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test date shifting, constant and per-range
+${REPOCUTTER:-repocutter} -q -r 3:5 dateshift -2h <branchreplace.svn | ${REPOCUTTER:-repocutter} -q -r 1:6 log | grep '^r[0-9]'
+${REPOCUTTER:-repocutter} -q dateshift 1:2=+1h 4=-90m30s <branchreplace.svn | ${REPOCUTTER:-repocutter} -q -r 1:5 log | grep '^r[0-9]'
@@ -0,0 +1,8 @@
+#! /bin/sh
+## Test repocutter debranch
+# The branch copy from an unchanged trunk disappears and the branch
+# property change lands on trunk
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+seecompare debranch branches/automake <branchreplace.svn
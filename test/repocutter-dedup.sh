@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test duplicate blob report
+${REPOCUTTER:-repocutter} -q dedup <no-merge.svn
+${REPOCUTTER:-repocutter} -q -r 1:3 dedup <no-merge.svn
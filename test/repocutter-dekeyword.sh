@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test collapsing of expanded keywords
+${REPOCUTTER:-repocutter} -q dekeyword <dekeyword.svn | grep -a -v "^UUID"
+${REPOCUTTER:-repocutter} -q dekeyword nomatch <dekeyword.svn | ${REPOCUTTER:-repocutter} -q lint
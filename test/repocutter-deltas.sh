@@ -0,0 +1,157 @@
+#!/bin/sh
+## Test expansion of a dump with svndiff0 deltas
+# The dump is what svnadmin dump --deltas would make of a file that is
+# added, changed, branched, and changed again on the branch.
+dump=/tmp/deltas$$.svn
+trap 'rm -f $dump' EXIT HUP INT QUIT TERM
+{
+printf 'SVN-fs-dump-format-version: 2\n'
+printf '\n'
+printf 'UUID: 6b5bca3c-7a4c-4c6f-9d64-2d3c5c1c7a11\n'
+printf '\n'
+printf 'Revision-number: 0\n'
+printf 'Prop-content-length: 56\n'
+printf 'Content-length: 56\n'
+printf '\n'
+printf 'K 8\n'
+printf 'svn:date\n'
+printf 'V 27\n'
+printf '2024-01-01T00:00:00.000000Z\n'
+printf 'PROPS-END\n'
+printf '\n'
+printf 'Revision-number: 1\n'
+printf 'Prop-content-length: 114\n'
+printf 'Content-length: 114\n'
+printf '\n'
+printf 'K 7\n'
+printf 'svn:log\n'
+printf 'V 15\n'
+printf 'Initial content\n'
+printf 'K 10\n'
+printf 'svn:author\n'
+printf 'V 4\n'
+printf 'fred\n'
+printf 'K 8\n'
+printf 'svn:date\n'
+printf 'V 27\n'
+printf '2024-01-01T00:00:10.000000Z\n'
+printf 'PROPS-END\n'
+printf '\n'
+printf 'Node-path: trunk\n'
+printf 'Node-kind: dir\n'
+printf 'Node-action: add\n'
+printf 'Prop-content-length: 10\n'
+printf 'Content-length: 10\n'
+printf '\n'
+printf 'PROPS-END\n'
+printf '\n'
+printf '\n'
+printf 'Node-path: branches\n'
+printf 'Node-kind: dir\n'
+printf 'Node-action: add\n'
+printf 'Prop-content-length: 10\n'
+printf 'Content-length: 10\n'
+printf '\n'
+printf 'PROPS-END\n'
+printf '\n'
+printf '\n'
+printf 'Node-path: trunk/a.txt\n'
+printf 'Node-kind: file\n'
+printf 'Node-action: add\n'
+printf 'Text-delta: true\n'
+printf 'Prop-content-length: 10\n'
+printf 'Text-content-length: 22\n'
+printf 'Text-content-md5: 6f5902ac237024bdd0c176cb93063dc4\n'
+printf 'Content-length: 32\n'
+printf '\n'
+printf 'PROPS-END\n'
+printf 'SVN\000\000\000\014\001\014\214hello world\n'
+printf '\n'
+printf '\n'
+printf 'Revision-number: 2\n'
+printf 'Prop-content-length: 110\n'
+printf 'Content-length: 110\n'
+printf '\n'
+printf 'K 7\n'
+printf 'svn:log\n'
+printf 'V 11\n'
+printf 'Second line\n'
+printf 'K 10\n'
+printf 'svn:author\n'
+printf 'V 4\n'
+printf 'fred\n'
+printf 'K 8\n'
+printf 'svn:date\n'
+printf 'V 27\n'
+printf '2024-01-01T00:00:20.000000Z\n'
+printf 'PROPS-END\n'
+printf '\n'
+printf 'Node-path: trunk/a.txt\n'
+printf 'Node-kind: file\n'
+printf 'Node-action: change\n'
+printf 'Text-delta: true\n'
+printf 'Text-delta-base-md5: 6f5902ac237024bdd0c176cb93063dc4\n'
+printf 'Text-content-length: 24\n'
+printf 'Text-content-md5: b7dddf722cfdc51710087d369f8d9e6b\n'
+printf 'Content-length: 24\n'
+printf '\n'
+printf 'SVN\000\000\014\030\003\014\014\000\214second line\n'
+printf '\n'
+printf '\n'
+printf 'Revision-number: 3\n'
+printf 'Prop-content-length: 104\n'
+printf 'Content-length: 104\n'
+printf '\n'
+printf 'K 7\n'
+printf 'svn:log\n'
+printf 'V 6\n'
+printf 'Branch\n'
+printf 'K 10\n'
+printf 'svn:author\n'
+printf 'V 4\n'
+printf 'fred\n'
+printf 'K 8\n'
+printf 'svn:date\n'
+printf 'V 27\n'
+printf '2024-01-01T00:00:30.000000Z\n'
+printf 'PROPS-END\n'
+printf '\n'
+printf 'Node-path: branches/b\n'
+printf 'Node-kind: dir\n'
+printf 'Node-action: add\n'
+printf 'Node-copyfrom-rev: 2\n'
+printf 'Node-copyfrom-path: trunk\n'
+printf '\n'
+printf '\n'
+printf 'Revision-number: 4\n'
+printf 'Prop-content-length: 112\n'
+printf 'Content-length: 112\n'
+printf '\n'
+printf 'K 7\n'
+printf 'svn:log\n'
+printf 'V 13\n'
+printf 'Branch change\n'
+printf 'K 10\n'
+printf 'svn:author\n'
+printf 'V 4\n'
+printf 'fred\n'
+printf 'K 8\n'
+printf 'svn:date\n'
+printf 'V 27\n'
+printf '2024-01-01T00:00:40.000000Z\n'
+printf 'PROPS-END\n'
+printf '\n'
+printf 'Node-path: branches/b/a.txt\n'
+printf 'Node-kind: file\n'
+printf 'Node-action: change\n'
+printf 'Text-delta: true\n'
+printf 'Text-delta-base-md5: b7dddf722cfdc51710087d369f8d9e6b\n'
+printf 'Text-content-length: 16\n'
+printf 'Text-content-md5: 8038ef84efaa01085e2add5c2923ca1d\n'
+printf 'Content-length: 16\n'
+printf '\n'
+printf 'SVN\000\000\030\036\005\002\202D\000\030\000ab\n'
+printf '\n'
+} >$dump
+${REPOCUTTER:-repocutter} -q select <$dump | cmp -s - $dump && echo "deltas passed through unaltered"
+${REPOCUTTER:-repocutter} -q -x select <$dump
@@ -0,0 +1,12 @@
+#!/bin/sh
+## Test structural comparison of dumps
+trap 'rm -f /tmp/diff$$-*.svn' EXIT HUP INT QUIT TERM
+${REPOCUTTER:-repocutter} -q diff branchreplace.svn branchreplace.svn; echo "identical: $?"
+${REPOCUTTER:-repocutter} -q -r 7 propset svn:log=changed <branchreplace.svn \
+    | ${REPOCUTTER:-repocutter} -q -r 5.1 setpath trunk/elsewhere \
+    | ${REPOCUTTER:-repocutter} -q -r 8:9 deselect >/tmp/diff$$-edited.svn
+${REPOCUTTER:-repocutter} -q diff branchreplace.svn /tmp/diff$$-edited.svn; echo "edited: $?"
+${REPOCUTTER:-repocutter} -q replace /fox/cat/ <pangram.svn >/tmp/diff$$-replaced.svn
+${REPOCUTTER:-repocutter} -q diff pangram.svn /tmp/diff$$-replaced.svn; echo "replaced: $?"
+${REPOCUTTER:-repocutter} -q -V diff pangram.svn /tmp/diff$$-replaced.svn; echo "replaced, skipping volatile: $?"
+${REPOCUTTER:-repocutter} -q diff pangram.svn /tmp/diff$$-missing.svn 2>/dev/null; echo "missing file: $?"
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test counting what expunge and propdel would change with -N
+${REPOCUTTER:-repocutter} -q -N expunge trunk <debranch.svn
+${REPOCUTTER:-repocutter} -q --dry-run propdel svn:log <debranch.svn
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test dropping of empty revisions with renumbering
+${REPOCUTTER:-repocutter} -q expunge 'branches/second' <mergeinfo-manual.svn | ${REPOCUTTER:-repocutter} -q emptydrop | ${REPOCUTTER:-repocutter} -q see
+${REPOCUTTER:-repocutter} -q sift branches/Testing <branchreplace.svn | ${REPOCUTTER:-repocutter} -q -F emptydrop | ${REPOCUTTER:-repocutter} -q -r 1 log
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test line-ending normalization
+${REPOCUTTER:-repocutter} -q eol lf <eol.svn | grep -a -v '^UUID'
+${REPOCUTTER:-repocutter} -q eol crlf mac <eol.svn | ${REPOCUTTER:-repocutter} -q eol crlf mac | ${REPOCUTTER:-repocutter} -q lint
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test setting and clearing the executable bit by file name
+${REPOCUTTER:-repocutter} -q execfix README branches/testbranch/copysource <filecopy.svn | ${REPOCUTTER:-repocutter} -q see
+${REPOCUTTER:-repocutter} -q execfix '!file' <permcopy1.svn | ${REPOCUTTER:-repocutter} -q see
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test repocutter export-git conversion
+${REPOCUTTER:-repocutter} -q export-git <dircopyprop.svn
+${REPOCUTTER:-repocutter} -q export-git trunk <linkfix.svn
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test reporting and rewriting svn:externals
+${REPOCUTTER:-repocutter} -q externals <externals.svn
+${REPOCUTTER:-repocutter} -q externals vendor=third-party <externals.svn | ${REPOCUTTER:-repocutter} -q -r 1:2 see
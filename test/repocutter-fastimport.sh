@@ -0,0 +1,12 @@
+#!/bin/sh
+## Test repocutter selection subcommands on fast-import streams
+echo "=== see ==="
+${REPOCUTTER:-repocutter} -q see <commit-expunge.fi
+echo "=== deselect ==="
+${REPOCUTTER:-repocutter} -q -r 2 deselect <commit-expunge.fi
+echo "=== expunge ==="
+${REPOCUTTER:-repocutter} -q expunge gitpacker <commit-expunge.fi
+echo "=== sift ==="
+${REPOCUTTER:-repocutter} -q -r 2 sift nomatch <inline-simple.fi
+echo "=== log ==="
+${REPOCUTTER:-repocutter} -q -v log <commit-expunge.fi
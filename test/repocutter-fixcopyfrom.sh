@@ -0,0 +1,5 @@
+#!/bin/sh
+## Test repair of copies from deselected revisions
+${REPOCUTTER:-repocutter} -q -r 4:5 -C deselect <branchreplace.svn | ${REPOCUTTER:-repocutter} -q see
+echo "Source never emitted:"
+${REPOCUTTER:-repocutter} -q -r 1:2 -C deselect <branchreplace.svn | ${REPOCUTTER:-repocutter} -q see
@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test flattening copies into explicit adds
+${REPOCUTTER:-repocutter} -q flatten <dircopyprop.svn
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test shell glob path patterns with -g
+${REPOCUTTER:-repocutter} -q -g expunge 'branches/*' <debranch.svn | ${REPOCUTTER:-repocutter} -q see
+${REPOCUTTER:-repocutter} -q --glob sift '/trunk/' '**/R?ADME' <debranch.svn | ${REPOCUTTER:-repocutter} -q see
@@ -0,0 +1,5 @@
+#!/bin/sh
+## Test searching file content across history
+${REPOCUTTER:-repocutter} -q grep "Revision is [0-9]," <branchreplace.svn
+echo "Names only:"
+${REPOCUTTER:-repocutter} -q -n -r 5:10 grep usb drivers <branchreplace.svn
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test case-insensitive path patterns with -y
+${REPOCUTTER:-repocutter} -q -y sift 'TRUNK/readme' <debranch.svn | ${REPOCUTTER:-repocutter} -q see
+${REPOCUTTER:-repocutter} -q --ignore-case pathrename '^TRUNK' Trunk <debranch.svn | ${REPOCUTTER:-repocutter} -q -r 1:2 see
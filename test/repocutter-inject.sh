@@ -0,0 +1,32 @@
+#!/bin/sh
+## Test splicing a synthetic revision into a dump
+cat >/tmp/inject$$ <<'END'
+Revision-number: 1
+Prop-content-length: 120
+Content-length: 120
+
+K 7
+svn:log
+V 22
+Recreate lost branch.
+
+K 10
+svn:author
+V 3
+esr
+K 8
+svn:date
+V 27
+2011-11-30T17:00:00.000000Z
+PROPS-END
+
+Node-path: branches/lost
+Node-kind: dir
+Node-action: add
+Node-copyfrom-rev: 3
+Node-copyfrom-path: trunk
+
+
+END
+${REPOCUTTER:-repocutter} -q inject 3 /tmp/inject$$ <simpletag.svn
+rm -f /tmp/inject$$
@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test joining dumps with renumbering and project prefixes
+${REPOCUTTER:-repocutter} -q join left=branchreplace.svn right=branchreplace.svn | ${REPOCUTTER:-repocutter} -q see
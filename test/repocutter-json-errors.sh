@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test JSON error records and exit status on a dump cut off in a node header
+head -n 38 debranch.svn | ${REPOCUTTER:-repocutter} -q -J see 2>&1
+echo "exit status $?"
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test repocutter lastchange report
+${REPOCUTTER:-repocutter} -q lastchange <branchreplace.svn
+${REPOCUTTER:-repocutter} -q -r 9 lastchange branches/Testing <branchreplace.svn
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test repair of symlinks that disagree with svn:special
+${REPOCUTTER:-repocutter} -q linkfix report <linkfix.svn
+${REPOCUTTER:-repocutter} -q linkfix <linkfix.svn | ${REPOCUTTER:-repocutter} -q see
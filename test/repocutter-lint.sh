@@ -0,0 +1,6 @@
+#!/bin/sh
+## Test structural checking of dumps
+${REPOCUTTER:-repocutter} -q lint <multiprojectmerge.svn; echo "clean: $?"
+sed -e 's/^Revision-number: 4$/Revision-number: 2/' -e 's/^Node-copyfrom-rev: 3$/Node-copyfrom-rev: 7/' <multiprojectmerge.svn \
+    | ${REPOCUTTER:-repocutter} -q lint; echo "renumbered: $?"
+${REPOCUTTER:-repocutter} -q lint <binary.svn; echo "bad property length: $?"
@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test log in reverse order, restricted to paths, with changed paths
+${REPOCUTTER:-repocutter} -q -e -v log branches/Testing <branchreplace.svn
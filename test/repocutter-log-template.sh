@@ -0,0 +1,7 @@
+#!/bin/sh
+## Test log entries rendered as JSON and through a template
+${REPOCUTTER:-repocutter} -q -r 2:4 -T json log <vanilla.svn
+${REPOCUTTER:-repocutter} -q -e -u '{{.rev}} {{.date.Format "2006-01-02"}} {{.author}}: {{firstline .logentry}} [{{join .paths ", "}}]' log <vanilla.svn
+# A misspelled field is an error, not "<no value>"
+${REPOCUTTER:-repocutter} -q -u '{{.Rev}}' log <vanilla.svn 2>&1
+echo "exit status $?"
@@ -0,0 +1,5 @@
+#!/bin/sh
+## Test tree listing at a revision
+${REPOCUTTER:-repocutter} -q -r 12 ls <branchreplace.svn
+echo "=== HEAD, trunk only"
+${REPOCUTTER:-repocutter} -q ls trunk <branchreplace.svn
@@ -0,0 +1,113 @@
+#!/bin/sh
+## Test mergeinfo canonicalization
+${REPOCUTTER:-repocutter} -q mergeinfo <<EOF | ${REPOCUTTER:-repocutter} -q -r 3 see
+SVN-fs-dump-format-version: 2
+
+UUID: 7a7f4d26-e363-49a8-afdf-ef5f249c7278
+
+Revision-number: 0
+Prop-content-length: 56
+Content-length: 56
+
+K 8
+svn:date
+V 27
+2012-11-06T12:57:02.495463Z
+PROPS-END
+
+Revision-number: 1
+Prop-content-length: 103
+Content-length: 103
+
+K 7
+svn:log
+V 6
+layout
+K 10
+svn:author
+V 3
+esr
+K 8
+svn:date
+V 27
+2012-11-06T12:57:03.000000Z
+PROPS-END
+
+Node-path: trunk
+Node-kind: dir
+Node-action: add
+Prop-content-length: 10
+Content-length: 10
+
+PROPS-END
+
+
+Node-path: branches
+Node-kind: dir
+Node-action: add
+Prop-content-length: 10
+Content-length: 10
+
+PROPS-END
+
+
+Revision-number: 2
+Prop-content-length: 103
+Content-length: 103
+
+K 7
+svn:log
+V 6
+branch
+K 10
+svn:author
+V 3
+esr
+K 8
+svn:date
+V 27
+2012-11-06T12:57:04.000000Z
+PROPS-END
+
+Node-path: branches/stable
+Node-kind: dir
+Node-action: add
+Node-copyfrom-rev: 1
+Node-copyfrom-path: trunk
+
+
+Revision-number: 3
+Prop-content-length: 109
+Content-length: 109
+
+K 7
+svn:log
+V 11
+messy merge
+K 10
+svn:author
+V 3
+esr
+K 8
+svn:date
+V 27
+2012-11-06T12:57:05.000000Z
+PROPS-END
+
+Node-path: trunk
+Node-kind: dir
+Node-action: change
+Prop-content-length: 124
+Content-length: 124
+
+K 13
+svn:mergeinfo
+V 89
+/branches/stable:2,4-5*,1
+/branches/ghost:2
+/branches/stable/sub:2
+/branches/stable:2-3,7
+PROPS-END
+
+
+EOF
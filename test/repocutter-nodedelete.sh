@@ -0,0 +1,7 @@
+#! /bin/sh
+## Test repocutter nodedelete
+# Output should reveal removal of the first tag copy and its revision
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+seecompare -r 4.1 nodedelete <simpletag.svn
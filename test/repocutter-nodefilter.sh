@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test expunging nodes by kind and action
+${REPOCUTTER:-repocutter} -q -r 6:12 -k dir -a delete expunge <branchreplace.svn | ${REPOCUTTER:-repocutter} -q see
@@ -1,6 +1,6 @@
 #!/bin/sh
 ## Test node deselection
-${REPOCUTTER:-repocutter} -q -r 3339.1,4431.11:4431:16 deselect <<EOF
+${REPOCUTTER:-repocutter} -q -r 3339.1,4431.11:4431 deselect <<EOF
 SVN-fs-dump-format-version: 2
 
 UUID: c97812fc-d253-487b-8882-a03e205d4398
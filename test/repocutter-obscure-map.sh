@@ -0,0 +1,8 @@
+#!/bin/sh
+## Test saving and reloading the obscure name mapping
+${REPOCUTTER:-repocutter} -q -r 3:6 -M /tmp/obscuremap$$ obscure <nut.svn >/dev/null
+echo "Saved map:"
+cat /tmp/obscuremap$$
+echo "Reloaded:"
+${REPOCUTTER:-repocutter} -q -r 3:6 -m /tmp/obscuremap$$ obscure <nut.svn | ${REPOCUTTER:-repocutter} -q -r 3:6 pathlist
+rm -f /tmp/obscuremap$$
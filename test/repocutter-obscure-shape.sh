@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test obscuring of filenames keeping extensions and segment lengths
+${REPOCUTTER:-repocutter} -q obscure --keep-extensions --keep-lengths <multigen.svn | ${REPOCUTTER:-repocutter} -q pathlist
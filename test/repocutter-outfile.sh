@@ -0,0 +1,7 @@
+#!/bin/sh
+## Test repocutter -o sending output to a file
+trap 'rm -f /tmp/outfile$$' EXIT HUP INT QUIT TERM
+${REPOCUTTER:-repocutter} -q -o /tmp/outfile$$ -r 2:3 select <dircopyprop.svn
+cat /tmp/outfile$$
+${REPOCUTTER:-repocutter} -q --outfile /tmp/outfile$$ see <dircopyprop.svn
+cat /tmp/outfile$$
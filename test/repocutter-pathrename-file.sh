@@ -0,0 +1,9 @@
+#!/bin/sh
+## Test path rename with rules read from a file as well as the command line
+trap 'rm -f /tmp/renames$$' EXIT HUP INT QUIT TERM
+cat >/tmp/renames$$ <<'END'
+# Rules are applied in order, before the command-line pairs
+^trunk 'main line'
+^branches/(.*) features/${1}
+END
+${REPOCUTTER:-repocutter} -q pathrename --file /tmp/renames$$ features/second features/two <mergeinfo-manual.svn | ${REPOCUTTER:-repocutter} -q see
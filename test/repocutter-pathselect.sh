@@ -0,0 +1,7 @@
+#! /bin/sh
+## Test repocutter pathselect
+# Output should show only whole revisions touching branches, with mergeinfo patched
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+seecompare pathselect branches <mergeinfo-combine.svn
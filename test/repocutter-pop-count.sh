@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test popping several segments off matching paths, dropping emptied nodes
+${REPOCUTTER:-repocutter} -q pop 2 ^project2/trunk <multigen.svn | ${REPOCUTTER:-repocutter} -q see
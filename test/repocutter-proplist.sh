@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test the property-name report, with and without a step
+${REPOCUTTER:-repocutter} -q proplist <nut.svn
+${REPOCUTTER:-repocutter} -q proplist 5 <mergeinfo-combine.svn
@@ -0,0 +1,6 @@
+#!/bin/sh
+## Test propset taking multi-line values from files, and a literal @
+trap 'rm -f /tmp/ignore$$ /tmp/motd$$' EXIT HUP INT QUIT TERM
+printf '*.o\r\n*.a' >/tmp/ignore$$
+printf 'Welcome.\nNo trailing newline here.' >/tmp/motd$$
+${REPOCUTTER:-repocutter} -q -r 1.3 propset svn:ignore=@/tmp/ignore$$ motd=@/tmp/motd$$ equation=a=b handle=@@esr <vanilla.svn | ${REPOCUTTER:-repocutter} -q -r 1 see
@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test editing of node properties by path, including nodes without a property section
+${REPOCUTTER:-repocutter} -q propset --path testdir2 mark=copied <dircopyprop.svn | ${REPOCUTTER:-repocutter} -q proprename --nodes 'someprop->renamed'
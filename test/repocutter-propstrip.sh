@@ -0,0 +1,109 @@
+#!/bin/sh
+## Test bulk stripping of housekeeping properties
+cat >/tmp/propstrip$$ <<EOF
+SVN-fs-dump-format-version: 2
+
+UUID: 7a7f4d26-e363-49a8-afdf-ef5f249c7278
+
+Revision-number: 0
+Prop-content-length: 56
+Content-length: 56
+
+K 8
+svn:date
+V 27
+2012-11-06T12:57:02.495463Z
+PROPS-END
+
+Revision-number: 1
+Prop-content-length: 138
+Content-length: 138
+
+K 7
+svn:log
+V 6
+import
+K 10
+svn:author
+V 3
+esr
+K 8
+svn:date
+V 27
+2012-11-06T12:57:03.000000Z
+K 18
+cvs2svn:rev-origin
+V 6
+import
+PROPS-END
+
+Node-path: trunk
+Node-kind: dir
+Node-action: add
+Prop-content-length: 68
+Content-length: 68
+
+K 25
+svn:wc:ra_dav:version-url
+V 21
+/svn/!svn/ver/1/trunk
+PROPS-END
+
+
+Node-path: trunk/README
+Node-kind: file
+Node-action: add
+Prop-content-length: 69
+Text-content-length: 6
+Content-length: 75
+
+K 15
+cvs2svn:cvs-rev
+V 3
+1.1
+K 13
+svn:eol-style
+V 6
+native
+PROPS-END
+hello
+
+
+Revision-number: 2
+Prop-content-length: 108
+Content-length: 108
+
+K 7
+svn:log
+V 10
+props only
+K 10
+svn:author
+V 3
+esr
+K 8
+svn:date
+V 27
+2012-11-06T12:57:04.000000Z
+PROPS-END
+
+Node-path: trunk/README
+Node-kind: file
+Node-action: change
+Prop-content-length: 45
+Content-length: 45
+
+K 23
+svn:entry:committed-rev
+V 1
+1
+PROPS-END
+
+
+EOF
+${REPOCUTTER:-repocutter} -q propstrip </tmp/propstrip$$ | ${REPOCUTTER:-repocutter} -q see
+echo "--"
+${REPOCUTTER:-repocutter} -q propstrip 'svn:*' '!svn:eol-style' '!svn:log' '!svn:date' </tmp/propstrip$$ | ${REPOCUTTER:-repocutter} -q see
+echo "--"
+${REPOCUTTER:-repocutter} -q propstrip '!cvs2svn:cvs-rev' </tmp/propstrip$$ | ${REPOCUTTER:-repocutter} -q see
+rm -f /tmp/propstrip$$
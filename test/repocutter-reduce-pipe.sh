@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test reduce reading a dump from a pipe named by -
+cat debranch.svn | ${REPOCUTTER:-repocutter} -q reduce -
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test dump format conversion with text and property deltas
+${REPOCUTTER:-repocutter} -q reformat 2 <propdelta.svn
+${REPOCUTTER:-repocutter} -q reformat 1 <propdelta.svn | sed -n '1,4p'
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test the report of probable renames
+${REPOCUTTER:-repocutter} -q renames <renames.svn
+${REPOCUTTER:-repocutter} -q renames <branchreplace.svn
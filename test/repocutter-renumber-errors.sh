@@ -0,0 +1,12 @@
+#!/bin/sh
+## Test renumbering requests that would make the numbering go backwards
+trap 'rm -f /tmp/revmap$$' EXIT HUP INT QUIT TERM
+# A selection already fixes where the numbering stands
+${REPOCUTTER:-repocutter} -q -b 1 -r 2:3 renumber <debranch.svn
+echo "exit status $?"
+echo "3 1" >/tmp/revmap$$
+${REPOCUTTER:-repocutter} -q -m /tmp/revmap$$ renumber <debranch.svn 2>&1 >/dev/null
+echo "exit status $?"
+echo "1 10" >/tmp/revmap$$
+${REPOCUTTER:-repocutter} -q -r 0:2 -m /tmp/revmap$$ renumber <debranch.svn 2>&1 >/dev/null
+echo "exit status $?"
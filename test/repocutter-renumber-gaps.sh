@@ -0,0 +1,7 @@
+#!/bin/sh
+## Test renumber keeping gaps, and renumbering only a selection
+trap 'rm -f /tmp/gaps$$.svn' EXIT HUP INT QUIT TERM
+${REPOCUTTER:-repocutter} -q -r 2:4,8:10 select <debranch.svn >/tmp/gaps$$.svn
+${REPOCUTTER:-repocutter} -q -b 20 renumber --keep-gaps </tmp/gaps$$.svn | ${REPOCUTTER:-repocutter} -q see
+echo "--"
+${REPOCUTTER:-repocutter} -q -r 8:10 renumber </tmp/gaps$$.svn | ${REPOCUTTER:-repocutter} -q see
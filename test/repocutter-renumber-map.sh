@@ -0,0 +1,10 @@
+#!/bin/sh
+## Test renumbering from an explicit revision map, saving the result
+cat >/tmp/revmap$$ <<END
+3 10
+5 20
+END
+${REPOCUTTER:-repocutter} -q -m /tmp/revmap$$ -M /tmp/revmapout$$ renumber <branchreplace.svn | ${REPOCUTTER:-repocutter} -q see
+echo "Applied map:"
+cat /tmp/revmapout$$
+rm -f /tmp/revmap$$ /tmp/revmapout$$
@@ -0,0 +1,5 @@
+#!/bin/sh
+## Test replace with several transforms, flags, and replacement text from a file
+trap 'rm -f /tmp/replacement$$' EXIT HUP INT QUIT TERM
+printf 'cat, $1 and all,' >/tmp/replacement$$
+${REPOCUTTER:-repocutter} -q replace '/QUICK (\w+)/slow $1/i' "|slow brown fox|@/tmp/replacement$$|" '/^the/A/mi' <pangram.svn | grep -a "lazy dog"
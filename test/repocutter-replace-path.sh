@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test replace restricted to nodes with matching paths
+${REPOCUTTER:-repocutter} -q replace --path random --path alternate '/^This/THIS/m' <debranch.svn | ${REPOCUTTER:-repocutter} -q -r 9:12 grep .
@@ -0,0 +1,12 @@
+#!/bin/sh
+## Test repocutter script running several transformations in one pass
+${REPOCUTTER:-repocutter} -q -E '-r 2.2 propset svn:eol-style=native; pathrename ^trunk "main line"; -r 2:3 strip' script <dircopyprop.svn
+cat >/tmp/script$$ <<'END'
+# Drop the second directory copy and renumber from 10
+expunge testdir3
+-b 10 renumber
+END
+${REPOCUTTER:-repocutter} -q script /tmp/script$$ <dircopyprop.svn
+# Renumbering closes the gaps left by revisions an earlier command dropped
+${REPOCUTTER:-repocutter} -q -E '-r 3:4 deselect; renumber' script <vanilla.svn | ${REPOCUTTER:-repocutter} -q see
+rm -f /tmp/script$$
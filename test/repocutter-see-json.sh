@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test JSON output of see with copy chains
+${REPOCUTTER:-repocutter} -q -r 40:47 -T json -c see <multigen.svn
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test node selections counting from the end of a revision and of the dump
+cat debranch.svn | ${REPOCUTTER:-repocutter} -q -r 1.-2:1.*,LAST see
+${REPOCUTTER:-repocutter} -q -r 14.LAST:LAST see <debranch.svn
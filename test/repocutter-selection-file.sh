@@ -0,0 +1,10 @@
+#!/bin/sh
+## Test selections read from files and named in scripts
+trap 'rm -f /tmp/selection$$ /tmp/selection$$.svn.gz' EXIT HUP INT QUIT TERM
+printf '3 # a comment\n5, 7:8\n' >/tmp/selection$$
+${REPOCUTTER:-repocutter} -q -r @/tmp/selection$$ see <debranch.svn
+echo "--"
+${REPOCUTTER:-repocutter} -q -z gzip -r 10:12 select <debranch.svn >/tmp/selection$$.svn.gz
+${REPOCUTTER:-repocutter} -q -r @/tmp/selection$$.svn.gz,14 see <debranch.svn
+echo "--"
+${REPOCUTTER:-repocutter} -q -E "define early 1:2; define both @early,@/tmp/selection$$; -r @both select" script <debranch.svn | ${REPOCUTTER:-repocutter} -q see
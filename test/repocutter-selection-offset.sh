@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test revision selections relative to either end of the dump
+cat debranch.svn | ${REPOCUTTER:-repocutter} -q -r HEAD-2:HEAD see
+${REPOCUTTER:-repocutter} -q -r BASE+1,3+2 see <debranch.svn
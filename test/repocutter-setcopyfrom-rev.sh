@@ -0,0 +1,7 @@
+#! /bin/sh
+## Test repocutter setcopyfrom changing revision by path match
+# Output should reveal alteration of the copyfrom revision on both tags
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+seecompare setcopyfrom @2 'tags/tag.*' <simpletag.svn
@@ -0,0 +1,9 @@
+#! /bin/sh
+## Test repocutter setlog from a directory of message files
+trap 'rm -fr /tmp/messages$$' EXIT HUP INT QUIT TERM
+mkdir /tmp/messages$$
+printf 'Early comment tweak\n' >/tmp/messages$$/2.txt
+printf 'Late comment tweak\n\n------------------------------------------------------------------------\nwith a delimiter line inside\n' >/tmp/messages$$/4
+echo "If you see this in the output, the range restriction failed." >/tmp/messages$$/5.txt
+echo "Not a revision." >/tmp/messages$$/README
+${REPOCUTTER:-repocutter} -q -r 2:4 --message-dir=/tmp/messages$$ setlog <vanilla.svn | ${REPOCUTTER:-repocutter} -q log
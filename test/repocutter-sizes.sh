@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test largest blob and revision report
+${REPOCUTTER:-repocutter} -q sizes 4 <branchreplace.svn
+${REPOCUTTER:-repocutter} -q sizes <binary.svn
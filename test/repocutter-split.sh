@@ -0,0 +1,9 @@
+#!/bin/sh
+## Test splitting a multiproject dump into per-project dumps
+trap 'rm -f /tmp/split$$-*.svn' EXIT HUP INT QUIT TERM
+${REPOCUTTER:-repocutter} -q -o "/tmp/split$$-%s.svn" split docs firmware software <multiprojectmerge.svn
+for project in docs firmware software
+do
+    echo "=== ${project}"
+    ${REPOCUTTER:-repocutter} -q see </tmp/split$$-${project}.svn
+done
@@ -0,0 +1,6 @@
+#!/bin/sh
+## Test squashing a revision range
+${REPOCUTTER:-repocutter} -q -r 7:9 squash <branchreplace.svn >/tmp/squash$$.svn
+${REPOCUTTER:-repocutter} -q see </tmp/squash$$.svn
+${REPOCUTTER:-repocutter} -q -r 7 log </tmp/squash$$.svn
+rm -f /tmp/squash$$.svn
@@ -0,0 +1,4 @@
+#!/bin/sh
+## Test summary statistics, whole dump and restricted by selection
+${REPOCUTTER:-repocutter} -q stats <branchreplace.svn
+${REPOCUTTER:-repocutter} -q -r 3:5 stats <branchreplace.svn
@@ -0,0 +1,11 @@
+#!/bin/sh
+## Test appending incremental dumps to a base dump
+base=/tmp/stitchbase$$
+incr=/tmp/stitchincr$$
+trap 'rm -f $base $incr' EXIT HUP INT QUIT TERM
+${REPOCUTTER:-repocutter} -q -r 0:4 select <simpletag.svn >$base
+{ sed -n 1,4p simpletag.svn; ${REPOCUTTER:-repocutter} -q -r 5:7 select <simpletag.svn; } >$incr
+${REPOCUTTER:-repocutter} -q stitch $base $incr | cmp -s - simpletag.svn && echo "stitched dump matches the original"
+# An increment renumbered from 1 is moved to follow the base
+{ sed -n 1,4p simpletag.svn; ${REPOCUTTER:-repocutter} -q -r 5:7 select <simpletag.svn | ${REPOCUTTER:-repocutter} -q renumber; } >$incr
+${REPOCUTTER:-repocutter} -q stitch $base $incr | ${REPOCUTTER:-repocutter} -q see
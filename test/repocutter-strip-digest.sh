@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test strip with fixed-width content digests as cookies
+${REPOCUTTER:-repocutter} -q strip --digest README <debranch.svn | ${REPOCUTTER:-repocutter} -q grep .
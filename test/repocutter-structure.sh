@@ -0,0 +1,5 @@
+#!/bin/sh
+## Test branch structure report
+${REPOCUTTER:-repocutter} -q structure <branchreplace.svn
+${REPOCUTTER:-repocutter} -q structure <multiprojectmerge.svn
+${REPOCUTTER:-repocutter} -q structure <swap.svn
@@ -0,0 +1,3 @@
+#!/bin/sh
+## Test testification keeping the intervals between commits
+${REPOCUTTER:-repocutter} -q testify --preserve-deltas --start 2020-01-01 <simpletag.svn | grep -a '^20[0-9][0-9]-\|^fred$'
@@ -1,7 +1,7 @@
 #!/bin/sh
 ## Test mailbox analysis in repomapper
 
-trap 'rm -f /tmp/contrib$$ /tmp/mailbox$$' EXIT HUP INT QUIT TERM
+trap 'rm -f /tmp/contrib$$ /tmp/mailbox$$ /tmp/mailbox$$-padded' EXIT HUP INT QUIT TERM
 
 cat >/tmp/contrib$$ <<EOF
 esr = esr <esr>
@@ -28,4 +28,8 @@ EOF
 # The esr line should be filled in with a fullname
 ${REPOMAPPER:-repomapper} /tmp/contrib$$ /tmp/mailbox$$
 
+# Likewise when blank lines come before the envelope line
+(echo; cat /tmp/mailbox$$) >/tmp/mailbox$$-padded
+${REPOMAPPER:-repomapper} /tmp/contrib$$ /tmp/mailbox$$-padded
+
 #end
@@ -0,0 +1,35 @@
+#!/bin/sh
+## Test merging of .mailmap and author-list sources and .mailmap output in repomapper
+
+trap 'rm -f /tmp/contrib$$ /tmp/mailmap$$ /tmp/authors$$ /tmp/update$$' EXIT HUP INT QUIT TERM
+
+cat >/tmp/contrib$$ <<EOF
+fubar = J. Random Fubar <j@random.net>
+foonly = foonly <foonly>
+EOF
+
+cat >/tmp/authors$$ <<EOF
+foonly
+fubar
+zed
+EOF
+
+cat >/tmp/mailmap$$ <<EOF
+# Identities collected from the old project site
+Fred Foonly <fred@foonly.net> <foonly>
+Zed Zedson <zed@example.org> zed <zed@svn.example.org>
+EOF
+
+cat >/tmp/update$$ <<EOF
+fubar = J. Random Fubar <jrf@newhost.net>
+EOF
+
+# The author list adds zed; the mailmap completes foonly and zed.
+${REPOMAPPER:-repomapper} /tmp/contrib$$ /tmp/authors$$ /tmp/mailmap$$
+echo "--"
+${REPOMAPPER:-repomapper} -m /tmp/contrib$$ /tmp/authors$$ /tmp/mailmap$$
+echo "--"
+# With -l, the later source's address for fubar wins.
+${REPOMAPPER:-repomapper} -l /tmp/contrib$$ /tmp/update$$
+
+#end
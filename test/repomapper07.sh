@@ -0,0 +1,29 @@
+#!/bin/sh
+## Test filling in repomapper entries from a REST directory service
+
+trap 'rm -rf /tmp/contrib$$ /tmp/users$$' EXIT HUP INT QUIT TERM
+
+cat >/tmp/contrib$$ <<EOF2
+fubar = J. Random Fubar <j@random.net>
+foonly = foonly <foonly>
+nobody = nobody <nobody>
+zed = zed <zed>
+EOF2
+
+# A file: URL stands in for a live service.  One record is a plain
+# object, the other a search result array with different field names.
+mkdir /tmp/users$$
+cat >/tmp/users$$/foonly <<EOF2
+{"username": "foonly", "name": "Fred Foonly", "email": "fred@foonly.net"}
+EOF2
+cat >/tmp/users$$/zed <<EOF2
+[{"display_name": "Zed Zedson", "mail": "zed@example.org"}]
+EOF2
+cat >/tmp/users$$/fubar <<EOF2
+{"name": "Someone Else", "email": "else@example.org"}
+EOF2
+
+# Complete entries are not looked up; nobody is reported missing.
+${REPOMAPPER:-repomapper} -r "file:///tmp/users$$/%s" /tmp/contrib$$ 2>&1 | sed "s/users[0-9]*/users/"
+
+#end
@@ -0,0 +1,18 @@
+#!/bin/sh
+## Test checking repomapper coverage against the committers of a dump
+
+trap 'rm -f /tmp/contrib$$' EXIT HUP INT QUIT TERM
+
+cat >/tmp/contrib$$ <<EOF
+aquette = Aquette <aquette@example.org>
+fubar = J. Random Fubar <j@random.net>
+EOF
+
+${REPOMAPPER:-repomapper} -c nut.svn /tmp/contrib$$
+echo "exit status $?"
+echo "--"
+# no-author has no entry, so the coverage is short of the threshold
+${REPOMAPPER:-repomapper} -c nut.svn -t 75 /tmp/contrib$$
+echo "exit status $?"
+
+#end
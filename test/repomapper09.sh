@@ -0,0 +1,19 @@
+#!/bin/sh
+## Test reading usernames from a CVSROOT/passwd file
+
+trap 'rm -f /tmp/contrib$$ /tmp/passwd$$' EXIT HUP INT QUIT TERM
+
+cat >/tmp/contrib$$ <<EOF
+foo = Foo Bar <foo@example.org>
+EOF
+
+# Entries with and without a system user, and one already mapped
+cat >/tmp/passwd$$ <<EOF
+bar:qQq:cvs
+baz:xYzzy
+foo:aBc:cvs
+EOF
+
+${REPOMAPPER:-repomapper} /tmp/contrib$$ /tmp/passwd$$
+
+#end
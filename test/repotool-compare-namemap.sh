@@ -0,0 +1,32 @@
+#!/bin/sh
+## Test repotool compare-tags with a tag name-mapping file
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+
+need git
+
+trap 'rm -rf /tmp/test-repo$$-a /tmp/test-repo$$-b /tmp/namemap$$ /tmp/out$$' EXIT HUP INT QUIT TERM
+
+./fi-to-fi -n /tmp/test-repo$$-a < simple.fi
+./fi-to-fi -n /tmp/test-repo$$-b < simple.fi
+# Rename the tags in the second repository, as a conversion might
+(tapcd /tmp/test-repo$$-b; git tag release-annotated annotated-sample; git tag lw lightweight-sample; git tag -d annotated-sample lightweight-sample) >/dev/null 2>&1
+cat >/tmp/namemap$$ <<'EOF'
+# One literal rename and one pattern
+lightweight-sample lw
+/(.*)-sample/ release-${1}
+EOF
+# Without the map the tags can't be paired
+${REPOTOOL:-repotool} compare-tags /tmp/test-repo$$-a /tmp/test-repo$$-b >/tmp/out$$ 2>&1
+echo "exit status $?" >>/tmp/out$$
+${REPOTOOL:-repotool} compare-tags -m /tmp/namemap$$ /tmp/test-repo$$-a /tmp/test-repo$$-b >>/tmp/out$$ 2>&1
+echo "exit status $?" >>/tmp/out$$
+${REPOTOOL:-repotool} compare-tags -j 2 -m /tmp/namemap$$ /tmp/test-repo$$-a /tmp/test-repo$$-b >>/tmp/out$$ 2>&1
+echo "exit status $?" >>/tmp/out$$
+${REPOTOOL:-repotool} compare -t annotated-sample -m /tmp/namemap$$ /tmp/test-repo$$-a /tmp/test-repo$$-b >>/tmp/out$$ 2>&1
+echo "exit status $?" >>/tmp/out$$
+
+toolmeta "$1" /tmp/out$$
+
+# end
@@ -0,0 +1,27 @@
+#!/bin/sh
+## Test repotool compare normalization filters
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+
+need git
+
+trap 'rm -rf /tmp/test-repo$$-a /tmp/test-repo$$-b /tmp/out$$' EXIT HUP INT QUIT TERM
+
+./fi-to-fi -n /tmp/test-repo$$-a < simple.fi
+./fi-to-fi -n /tmp/test-repo$$-b < simple.fi
+# Give each repository a file differing only cosmetically
+(tapcd /tmp/test-repo$$-a; git checkout -q master; printf 'line one\n$Id$\nline three\n' >cosmetic; git add cosmetic; git -c user.name=Tester -c user.email=tester@example.com commit -q -m "Cosmetic file.") >/dev/null 2>&1
+(tapcd /tmp/test-repo$$-b; git checkout -q master; printf 'line one\r\n$Id: cosmetic,v 1.2 2020/01/01 tester Exp $\r\nline three\r\n' >cosmetic; chmod +x cosmetic; git add cosmetic; git -c user.name=Tester -c user.email=tester@example.com commit -q -m "Cosmetic file.") >/dev/null 2>&1
+{
+    echo "Unfiltered:"
+    ${REPOTOOL:-repotool} compare /tmp/test-repo$$-a /tmp/test-repo$$-b | sed -e '/^---/d' -e '/^+++/d'
+    echo "Line endings normalized:"
+    ${REPOTOOL:-repotool} compare -l /tmp/test-repo$$-a /tmp/test-repo$$-b | sed -e '/^---/d' -e '/^+++/d'
+    echo "All filters:"
+    ${REPOTOOL:-repotool} compare -l -k -p /tmp/test-repo$$-a /tmp/test-repo$$-b
+} >/tmp/out$$ 2>&1
+
+toolmeta "$1" /tmp/out$$
+
+# end
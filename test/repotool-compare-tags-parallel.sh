@@ -0,0 +1,20 @@
+#!/bin/sh
+## Test parallel comparison of git repositories at all tags
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+
+need git
+
+trap 'rm -rf /tmp/test-repo$$-a /tmp/test-repo$$-b /tmp/out$$' EXIT HUP INT QUIT TERM
+
+./fi-to-fi -n /tmp/test-repo$$-a < simple.fi
+./fi-to-fi -n /tmp/test-repo$$-b < simple.fi
+# Move one tag in the second repository so exactly one comparison differs
+(tapcd /tmp/test-repo$$-b; git checkout -q lightweight-sample; echo "extra" >extra; git add extra; git -c user.name=Tester -c user.email=tester@example.com commit -q -m "Extra file."; git tag -f lightweight-sample; git checkout -q master) >/dev/null 2>&1
+${REPOTOOL:-repotool} compare-tags -j 2 /tmp/test-repo$$-a /tmp/test-repo$$-b >/tmp/out$$ 2>&1
+echo "exit status $?" >>/tmp/out$$
+
+toolmeta "$1" /tmp/out$$
+
+# end
@@ -0,0 +1,26 @@
+#!/bin/sh
+## Test repotool doctor against a controlled set of tools
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+
+mode=${1:---regress}
+
+trap 'rm -rf /tmp/fakebin$$ /tmp/out$$' EXIT HUP INT QUIT TERM
+
+# Stand-ins for the tools, so the report doesn't depend on what is
+# installed here: git is too old, svnsync fails, svn is absent.
+repotool=$(command -v "${REPOTOOL:-repotool}")
+mkdir /tmp/fakebin$$
+printf '#!/bin/sh\necho "reposurgeon 4.32"\n' >/tmp/fakebin$$/reposurgeon
+printf '#!/bin/sh\necho "git version 2.17.1"\n' >/tmp/fakebin$$/git
+printf '#!/bin/sh\necho "1.14.1"\n' >/tmp/fakebin$$/svnadmin
+printf '#!/bin/sh\nexit 1\n' >/tmp/fakebin$$/svnsync
+chmod +x /tmp/fakebin$$/*
+
+PATH=/tmp/fakebin$$ "${repotool}" doctor svn git >/tmp/out$$ 2>&1
+echo "exit status $?" >>/tmp/out$$
+
+toolmeta "$mode" /tmp/out$$
+
+# end
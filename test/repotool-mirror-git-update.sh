@@ -0,0 +1,27 @@
+#!/bin/sh
+## Test incremental repotool mirror update of git repo
+
+# shellcheck disable=SC1091
+. ./common-setup.sh
+
+need git
+
+mode=${1:---regress}
+
+trap 'rm -rf /tmp/test-mirror-repo$$ /tmp/mirror$$ /tmp/out$$' EXIT HUP INT QUIT TERM
+
+# Build an example repo and mirror it
+./fi-to-fi -n /tmp/test-mirror-repo$$ < simple.fi
+${REPOTOOL:-repotool} mirror -q "file://tmp/test-mirror-repo$$" /tmp/mirror$$
+# Add a commit upstream; the update should fetch it
+(tapcd /tmp/test-mirror-repo$$; git checkout -q master; echo "new content" >newfile; git add newfile; git -c user.name=Tester -c user.email=tester@example.com commit -q -m "Upstream addition.") >/dev/null
+${REPOTOOL:-repotool} mirror -q "file://tmp/test-mirror-repo$$" /tmp/mirror$$ >/tmp/out$$ 2>&1
+(tapcd /tmp/mirror$$; git log --format=%s -2 master) >>/tmp/out$$ 2>&1
+# Rewrite upstream history; the update should demand a re-mirror
+(tapcd /tmp/test-mirror-repo$$; git -c user.name=Tester -c user.email=tester@example.com commit -q --amend -m "Rewritten addition.") >/dev/null
+${REPOTOOL:-repotool} mirror -q "file://tmp/test-mirror-repo$$" /tmp/mirror$$ >>/tmp/out$$ 2>&1
+echo "exit status $?" >>/tmp/out$$
+
+toolmeta "$mode" /tmp/out$$
+
+# end
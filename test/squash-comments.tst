@@ -0,0 +1,228 @@
+## Test comment-combination policies of squash
+set relax
+read <<EOF
+blob
+mark :1
+data 4
+one
+
+commit refs/heads/master
+mark :2
+committer J. Random Hacker <jrh@example.com> 0 +0000
+data 5
+Fix.
+M 100644 :1 a.txt
+
+blob
+mark :3
+data 4
+two
+
+commit refs/heads/master
+mark :4
+committer J. Random Hacker <jrh@example.com> 10 +0000
+data 5
+Fix.
+from :2
+M 100644 :3 a.txt
+
+blob
+mark :5
+data 6
+three
+
+commit refs/heads/master
+mark :6
+committer J. Random Hacker <jrh@example.com> 20 +0000
+data 7
+Other.
+from :4
+M 100644 :5 a.txt
+
+blob
+mark :7
+data 5
+four
+
+commit refs/heads/master
+mark :8
+committer J. Random Hacker <jrh@example.com> 30 +0000
+data 6
+Last.
+from :6
+M 100644 :7 a.txt
+
+EOF
+print Default concatenation:
+:2..:6 squash
+=C msgout
+read <<EOF
+blob
+mark :1
+data 4
+one
+
+commit refs/heads/master
+mark :2
+committer J. Random Hacker <jrh@example.com> 0 +0000
+data 5
+Fix.
+M 100644 :1 a.txt
+
+blob
+mark :3
+data 4
+two
+
+commit refs/heads/master
+mark :4
+committer J. Random Hacker <jrh@example.com> 10 +0000
+data 5
+Fix.
+from :2
+M 100644 :3 a.txt
+
+blob
+mark :5
+data 6
+three
+
+commit refs/heads/master
+mark :6
+committer J. Random Hacker <jrh@example.com> 20 +0000
+data 7
+Other.
+from :4
+M 100644 :5 a.txt
+
+blob
+mark :7
+data 5
+four
+
+commit refs/heads/master
+mark :8
+committer J. Random Hacker <jrh@example.com> 30 +0000
+data 6
+Last.
+from :6
+M 100644 :7 a.txt
+
+EOF
+print Deduplicated with custom separator:
+:2..:6 squash --dedup-comments --separator=\n--\n
+=C msgout
+read <<EOF
+blob
+mark :1
+data 4
+one
+
+commit refs/heads/master
+mark :2
+committer J. Random Hacker <jrh@example.com> 0 +0000
+data 5
+Fix.
+M 100644 :1 a.txt
+
+blob
+mark :3
+data 4
+two
+
+commit refs/heads/master
+mark :4
+committer J. Random Hacker <jrh@example.com> 10 +0000
+data 5
+Fix.
+from :2
+M 100644 :3 a.txt
+
+blob
+mark :5
+data 6
+three
+
+commit refs/heads/master
+mark :6
+committer J. Random Hacker <jrh@example.com> 20 +0000
+data 7
+Other.
+from :4
+M 100644 :5 a.txt
+
+blob
+mark :7
+data 5
+four
+
+commit refs/heads/master
+mark :8
+committer J. Random Hacker <jrh@example.com> 30 +0000
+data 6
+Last.
+from :6
+M 100644 :7 a.txt
+
+EOF
+print Later comment only:
+:2..:6 squash --last-comment
+=C msgout
+read <<EOF
+blob
+mark :1
+data 4
+one
+
+commit refs/heads/master
+mark :2
+committer J. Random Hacker <jrh@example.com> 0 +0000
+data 5
+Fix.
+M 100644 :1 a.txt
+
+blob
+mark :3
+data 4
+two
+
+commit refs/heads/master
+mark :4
+committer J. Random Hacker <jrh@example.com> 10 +0000
+data 5
+Fix.
+from :2
+M 100644 :3 a.txt
+
+blob
+mark :5
+data 6
+three
+
+commit refs/heads/master
+mark :6
+committer J. Random Hacker <jrh@example.com> 20 +0000
+data 7
+Other.
+from :4
+M 100644 :5 a.txt
+
+blob
+mark :7
+data 5
+four
+
+commit refs/heads/master
+mark :8
+committer J. Random Hacker <jrh@example.com> 30 +0000
+data 6
+Last.
+from :6
+M 100644 :7 a.txt
+
+EOF
+print Template:
+:2..:6 squash --comment-template=%LAST%[squashed:\x20%FIRST%]\n
+=C msgout
+print Deduplication with a choice of comment is refused:
+:8 squash --dedup-comments --last-comment
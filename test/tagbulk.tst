@@ -0,0 +1,67 @@
+## Bulk tag rename and prune
+set relax
+read <<EOF
+blob
+mark :1
+data 4
+one
+
+reset refs/heads/master
+commit refs/heads/master
+mark :2
+committer J. Random Hacker <jrh@example.com> 100 +0000
+data 7
+First.
+M 100644 :1 a.txt
+
+blob
+mark :3
+data 4
+two
+
+commit refs/heads/master
+mark :4
+committer J. Random Hacker <jrh@example.com> 200 +0000
+data 8
+Second.
+from :2
+M 100644 :3 a.txt
+
+commit refs/tags/build-3
+mark :5
+committer J. Random Hacker <jrh@example.com> 300 +0000
+data 7
+Third.
+from :4
+
+tag build-1
+from :2
+tagger J. Random Hacker <jrh@example.com> 100 +0000
+data 8
+Build 1
+
+tag build-2
+from :4
+tagger J. Random Hacker <jrh@example.com> 200 +0000
+data 8
+Build 2
+
+tag release-2
+from :4
+tagger J. Random Hacker <jrh@example.com> 200 +0000
+data 10
+Release 2
+
+reset refs/tags/build-3
+from :5
+
+EOF
+print Collision is refused:
+tag rename /^(build|release)-([0-9]+)$/ v\2
+print Prune by date:
+tag delete /^build-/ --before=1970-01-01T00:02:30Z
+print Rename with capture groups:
+tag rename /^(build|release)-([0-9]+)$/ \1/v\2
+print Lightweight tags:
+reset rename /^refs\/tags\/build-([0-9]+)$/ tags/robot/\1
+write -
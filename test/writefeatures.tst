@@ -0,0 +1,27 @@
+## Test write-time stream feature toggles
+read <<EOF
+feature done
+feature commit-properties
+blob
+mark :1
+data 20
+1234567890123456789
+
+commit refs/heads/master
+mark :2
+committer Ralf Schlatterbeck <rsc@runtux.com> 0 +0000
+data 14
+First commit.
+property branch-nick 5 trunk
+M 100644 :1 README
+
+done
+EOF
+prefer git
+print Git write, property extensions forced on:
+write --properties -
+prefer bzr
+print Bzr write suppressing done:
+write --no-done -
+print Bzr write suppressing features and properties:
+write --no-features --no-properties -
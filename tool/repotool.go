@@ -12,20 +12,23 @@ import (
 	"io"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
 
-	//"sort"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	readline "github.com/chzyer/readline"
 	difflib "github.com/ianbruene/go-difflib/difflib"
+	shellquote "github.com/kballard/go-shellquote"
 )
 
 // Define a couplee of partial capability tables for querying
@@ -45,6 +48,10 @@ var svnCheckout = VCS{
 	branchlister: "ls branches 2>/dev/null || exit 0",
 }
 
+// VCSes with no native exporter that reposurgeon can nevertheless
+// read through its extractor classes.
+var extractable = newStringSet("hg")
+
 func init() {
 	setInit()
 	vcsInit()
@@ -53,9 +60,87 @@ func init() {
 }
 
 type squishyParts struct {
-	Project   string
-	SourceVCS string
-	TargetVCS string
+	Project    string
+	SourceVCS  string
+	TargetVCS  string
+	DumpFilter string
+	Variables  string
+}
+
+// A projectLayout describes the shape of a Subversion source
+// repository and supplies the parts of a generated conversion setup
+// that depend on it.  In the variables and stubs text, %s is
+// replaced by the project name.
+type projectLayout struct {
+	name       string
+	dumpfilter string
+	variables  string
+	lift       string
+	stubs      map[string]string // extension -> stub file contents
+}
+
+var layouts = []projectLayout{
+	{
+		name:       "standard",
+		dumpfilter: "cat",
+		lift: `#
+# The repository has the standard trunk/branches/tags layout, so
+# branches and tags should come through without remapping.  Common
+# cleanups, uncomment as required:
+#
+# Turn Subversion revision references in comments into action stamps
+#references lift
+# Turn empty commits left by branch and tag deletions into tags
+#tagify --tipdeletes
+`,
+	},
+	{
+		name:       "multiproject",
+		dumpfilter: "repocutter -q sift '^$(SUBPROJECT)/' | repocutter -q pop",
+		variables:  "SUBPROJECT = %s\n",
+		lift: `#
+# The repository holds several projects, each with its own
+# trunk/branches/tags; DUMPFILTER extracts SUBPROJECT and pops its
+# directory so it converts as a standard layout.  If files were ever
+# copied between projects those copies will be missing.
+#
+# Turn Subversion revision references in comments into action stamps
+#references lift
+# Turn empty commits left by branch and tag deletions into tags
+#tagify --tipdeletes
+`,
+	},
+	{
+		name:       "monorepo-with-subtrees",
+		dumpfilter: "$(if $(SUBTREES),repocutter -q sift $(SUBTREES) |) repocutter -q swapsvn",
+		variables:  "SUBTREES = $(shell sed -e '/^#/d' -e \"s|.*|'^&/'|\" %s.subtrees)\n",
+		lift: `#
+# The repository holds several projects, each with its own
+# trunk/branches/tags; DUMPFILTER swaps them into one repository in
+# which each project is a subtree of trunk and of every branch and tag.
+# Branches and tags that existed in only one project are promoted to
+# the whole repository, so prune the ones that are not wanted:
+#
+#branch delete refs/heads/UNWANTED
+#tag delete UNWANTED
+# Turn Subversion revision references in comments into action stamps
+#references lift
+`,
+		stubs: map[string]string{
+			".subtrees": `# Project directories of %s to keep as subtrees, one per line.
+# If none are listed, all of them are kept.
+`,
+		},
+	},
+}
+
+func findLayout(name string) *projectLayout {
+	for i := range layouts {
+		if layouts[i].name == name {
+			return &layouts[i]
+		}
+	}
+	return nil
 }
 
 var makefileTemplate = `# Makefile for {{.Project}} conversion using reposurgeon
@@ -85,6 +170,14 @@ var makefileTemplate = `# Makefile for {{.Project}} conversion using reposurgeon
 # 6. Run 'make stubmap' to create a stub author map.
 # 7. Run 'make' to build a converted repository.
 #
+# Settings can also be overridden in {{.Project}}.conf, which is read
+# after the configuration section below.  That file is never
+# regenerated, so it is the place for extra pipeline stages: set
+# EXTRA_FILTERS to further dump filters, each introduced by "|"
+# (for example "| repocutter -q sift trunk"), and POSTCHECKS to
+# shell commands that are run inside the converted repository after
+# it is built and fail the build if they fail.
+#
 # For a production-quality conversion you will need to edit the map
 # file and the lift script.  During the process you can set EXTRAS to
 # name extra metadata such as a comments message-box that the final.
@@ -102,28 +195,38 @@ CVS_MODULE = {{.Project}}
 #REMOTE_URL = cvs://$(CVS_HOST)/{{.Project}}\#$(CVS_MODULE)
 READ_OPTIONS =
 #CHECKOUT_OPTIONS = --ignore-externals
-DUMPFILTER = cat
-VERBOSITY = "set progress"
+DUMPFILTER = {{.DumpFilter}}
+{{.Variables}}VERBOSITY = "set progress"
 REPOSURGEON = reposurgeon
 LOGFILE = conversion.log
+EXTRA_FILTERS =
+POSTCHECKS =
 
-# Set and uncomment these if remote access tio Subversion needs credentials.
+# Set and uncomment these if remote access needs credentials. RUSERNAME
+# and RPASSWORD are a login and password, RTOKEN is an HTTP bearer token
+# for git, and RSSH_IDENTITY is an ssh private key file.  They may
+# instead be set in the environment or in {{.Project}}.conf.
 #export RUSERNAME=
 #export RPASSWORD=
+#export RTOKEN=
+#export RSSH_IDENTITY=
+
+-include {{.Project}}.conf
 
 # Configuration ends here
 
-.PHONY: local-clobber remote-clobber gitk gc compare clean stubmap
+.PHONY: local-clobber remote-clobber gitk gc verify compare clean stubmap
 
 default: {{.Project}}-{{.TargetVCS}}
 
 # Build the repository from the stream dump
 {{.Project}}-{{.TargetVCS}}: {{.Project}}.{{.SourceVCS}} {{.Project}}.opts {{.Project}}.lift {{.Project}}.map $(EXTRAS)
-	$(REPOSURGEON) $(VERBOSITY) 'logfile $(LOGFILE)' 'script {{.Project}}.opts' "read $(READ_OPTIONS) <{{.Project}}.{{.SourceVCS}}" 'authors read <{{.Project}}.map' 'sourcetype {{.SourceVCS}}' 'prefer git' 'script {{.Project}}.lift' 'legacy write >{{.Project}}.fo' 'rebuild {{.Project}}-{{.TargetVCS}}'
+	$(REPOSURGEON) $(VERBOSITY) 'logfile $(LOGFILE)' 'script {{.Project}}.opts' "read $(READ_OPTIONS) <{{.Project}}.{{.SourceVCS}}" 'authors read <{{.Project}}.map' 'sourcetype {{.SourceVCS}}' 'prefer {{.TargetVCS}}' 'script {{.Project}}.lift' 'legacy write >{{.Project}}.fo' 'rebuild {{.Project}}-{{.TargetVCS}}'
+	$(if $(POSTCHECKS),cd {{.Project}}-{{.TargetVCS}} && $(POSTCHECKS))
 
 # Build a stream dump from the local mirror
 {{.Project}}.{{.SourceVCS}}: {{.Project}}-mirror
-	(cd {{.Project}}-mirror/ >/dev/null; repotool export) | $(DUMPFILTER) >{{.Project}}.{{.SourceVCS}}
+	(cd {{.Project}}-mirror/ >/dev/null; repotool export) | $(DUMPFILTER) $(EXTRA_FILTERS) >{{.Project}}.{{.SourceVCS}}
 
 # Build a local mirror of the remote repository
 {{.Project}}-mirror:
@@ -177,8 +280,35 @@ gc: {{.Project}}-git
 	cd {{.Project}}-git; time git -c pack.threads=1 repack -AdF --window=1250 --depth=250
 `
 
+var hgTemplateAdditions = `
+#
+# The following productions are hg-specific
+#
+
+# Check the integrity of the generated hg repository
+verify: {{.Project}}-hg
+	cd {{.Project}}-hg; hg verify
+`
+
+var bzrTemplateAdditions = `
+#
+# The following productions are bzr-specific
+#
+
+# Check the integrity of the generated bzr repository
+verify: {{.Project}}-bzr
+	cd {{.Project}}-bzr; bzr check
+
+# Pack the generated bzr repository.  Import doesn't.
+gc: {{.Project}}-bzr
+	cd {{.Project}}-bzr; bzr pack --clean-obsolete-packs
+`
+
 var acceptMissing bool
 var context bool
+var normalizeEOL bool
+var stripKeywords bool
+var ignorePerms bool
 var nobranch bool
 var seeignores bool
 var quiet bool
@@ -186,9 +316,12 @@ var same bool
 var unified bool
 var verbose bool
 
+var jobs int
+
 var branch string
 var comparemode string
 var refexclude string
+var namemap string
 var revision string
 var basedir string
 var tag string
@@ -334,8 +467,7 @@ func initialize(args []string) {
 			ReadSupport.Add(vcs.name)
 		}
 	}
-	// Hacky special case implemented through extractor class
-	ReadSupport.Add("hg")
+	ReadSupport = ReadSupport.Union(extractable)
 	if verbose {
 		fmt.Printf("initialize args: %v\n", args)
 	}
@@ -362,6 +494,21 @@ func initialize(args []string) {
 	if !WriteSupport.Contains(squishy.TargetVCS) {
 		croak("unknown target VCS type %s", squishy.TargetVCS)
 	}
+	layoutName := "standard"
+	if len(args) > 0 {
+		layoutName = args[0]
+	}
+	layout := findLayout(layoutName)
+	if layout == nil {
+		croak("unknown project layout %s", layoutName)
+	}
+	if layout.name != "standard" && squishy.SourceVCS != "svn" {
+		croak("the %s layout requires a Subversion source", layout.name)
+	}
+	squishy.DumpFilter = layout.dumpfilter
+	if layout.variables != "" {
+		squishy.Variables = fmt.Sprintf(layout.variables, project)
+	}
 	if exists("Makefile") {
 		complain("a Makefile already exists here.")
 	} else {
@@ -369,8 +516,13 @@ func initialize(args []string) {
 			fmt.Printf("repotool: generating Makefile, some variables in it need to be set.\n")
 		}
 		instructions := makefileTemplate
-		if squishy.TargetVCS == "git" {
+		switch squishy.TargetVCS {
+		case "git":
 			instructions += gitTemplateAdditions
+		case "hg":
+			instructions += hgTemplateAdditions
+		case "bzr":
+			instructions += bzrTemplateAdditions
 		}
 		// Create a new template and parse the letter into it.
 		t := template.Must(template.New("Makefile").Parse(instructions))
@@ -392,13 +544,21 @@ func initialize(args []string) {
 		}
 		makeStub(project+".opts", "# Pre-read options for reposurgeon go here.\n")
 	}
+	if exists(project + ".conf") {
+		complain("a project configuration file already exists here.")
+	} else {
+		if !quiet {
+			fmt.Printf("repotool: generating a stub configuration file.\n")
+		}
+		makeStub(project+".conf", fmt.Sprintf("# Makefile settings for %s, overriding the defaults\n", project))
+	}
 	if exists(project + ".lift") {
 		complain("a project lift file already exists here.")
 	} else {
 		if !quiet {
 			fmt.Printf("repotool: generating a stub lift file.\n")
 		}
-		makeStub(project+".lift", fmt.Sprintf("# Lift commands for %s\n", project))
+		makeStub(project+".lift", fmt.Sprintf("# Lift commands for %s\n", project)+layout.lift)
 	}
 	if exists(project + ".map") {
 		complain("a project map file already exists here.")
@@ -408,6 +568,16 @@ func initialize(args []string) {
 		}
 		makeStub(project+".map", fmt.Sprintf("# Author map for %s\n", project))
 	}
+	for ext, stub := range layout.stubs {
+		if exists(project + ext) {
+			complain("a project %s file already exists here.", ext[1:])
+		} else {
+			if !quiet {
+				fmt.Printf("repotool: generating a stub %s file.\n", ext[1:])
+			}
+			makeStub(project+ext, fmt.Sprintf(stub, project))
+		}
+	}
 }
 
 func export() {
@@ -420,19 +590,204 @@ func export() {
 		croak("unknown repository type at %s", pwd)
 	}
 	cmd := rt.exporter
-	if rt.name == "hg" {
-		// Grotty repotool-only special case that takes the long way around
-		// through reposurgeon's extractor classes.  Remove if and when there
-		// is a real exporter for hg
-		cmd = "reposurgeon 'read .' 'prefer git' 'write -'"
+	if cmd != "" && rt.quieter != "" {
+		cmd += " " + rt.quieter
 	}
 	if cmd == "" {
-		croak("can't export from repository of type %s.", rt.name)
-	} else {
-		if rt.quieter != "" {
-			cmd += " " + rt.quieter
+		// No native exporter, so take the long way around through
+		// reposurgeon's extractor classes, which can read some
+		// repositories (hg, for one) that have none.
+		if !extractable.Contains(rt.name) {
+			croak("can't export from repository of type %s.", rt.name)
+		}
+		cmd = "reposurgeon 'read .' 'prefer git' 'write -'"
+	}
+	runShellProcessOrDie(cmd, " export command in "+pwd)
+}
+
+// dottedVersion extracts the first dotted version number from tool output.
+var dottedVersion = regexp.MustCompile(`[0-9]+(\.[0-9]+)+`)
+
+// versionLess compares dotted version numbers numerically.
+func versionLess(a string, b string) bool {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, _ := strconv.Atoi(as[i])
+		bn, _ := strconv.Atoi(bs[i])
+		if an != bn {
+			return an < bn
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// configuredConversion recovers the source and target VCS types from
+// a Makefile generated by initialize.
+func configuredConversion() (string, string) {
+	data, err := ioutil.ReadFile("Makefile")
+	if err != nil {
+		croak("no Makefile here; give the source and target VCS types.")
+	}
+	m := regexp.MustCompile(`(?m)^default: (\S+)-(\w+)$`).FindSubmatch(data)
+	if m == nil {
+		croak("can't find the conversion target in the Makefile.")
+	}
+	project := regexp.QuoteMeta(string(m[1]))
+	n := regexp.MustCompile(`(?m)^` + project + `\.(\w+): ` + project + `-mirror$`).FindSubmatch(data)
+	if n == nil {
+		croak("can't find the conversion source in the Makefile.")
+	}
+	return string(n[1]), string(m[2])
+}
+
+// doctor checks that the external tools a conversion needs are present
+// and new enough, so a conversion fails up front rather than midway.
+func doctor(args []string) {
+	var source, target string
+	switch len(args) {
+	case 0:
+		source, target = configuredConversion()
+	case 2:
+		source, target = args[0], args[1]
+	default:
+		croak("doctor takes either no arguments or source and target VCS types.")
+	}
+	findVCS := func(name string) *VCS {
+		for i := range vcstypes {
+			if vcstypes[i].name == name {
+				return &vcstypes[i]
+			}
+		}
+		croak("unknown VCS type %s", name)
+		return nil
+	}
+	// reposurgeon runs every conversion and is the hg exporter.
+	requires := []toolRequirement{
+		{"", "reposurgeon", "reposurgeon version", "", "reposurgeon is distributed with repotool"},
+	}
+	for _, req := range findVCS(source).requires {
+		if req.role != "import" {
+			requires = append(requires, req)
+		}
+	}
+	for _, req := range findVCS(target).requires {
+		if req.role != "export" {
+			requires = append(requires, req)
+		}
+	}
+	if data, err := ioutil.ReadFile("Makefile"); err == nil && bytes.Contains(data, []byte("conversion using reposurgeon")) && bytes.Contains(data, []byte("repocutter")) {
+		requires = append(requires, toolRequirement{"", "repocutter", "repocutter version", "", "repocutter is distributed with repotool"})
+	}
+
+	announce("checking tools for %s to %s conversion", source, target)
+	problems := 0
+	seen := newStringSet()
+	for _, req := range requires {
+		if seen.Contains(req.program + req.probe) {
+			continue
+		}
+		seen.Add(req.program + req.probe)
+		if _, err := exec.LookPath(req.program); err != nil {
+			fmt.Printf("missing  %s: %s\n", req.program, req.hint)
+			problems++
+			continue
+		}
+		found := ""
+		if req.probe != "" {
+			fields := strings.Fields(req.probe)
+			out, err := exec.Command(fields[0], fields[1:]...).CombinedOutput()
+			if err != nil {
+				fmt.Printf("broken   %s: '%s' failed; %s\n", req.program, req.probe, req.hint)
+				problems++
+				continue
+			}
+			found = dottedVersion.FindString(string(out))
+		}
+		if req.minimum != "" && (found == "" || versionLess(found, req.minimum)) {
+			if found == "" {
+				found = "of unknown version"
+			}
+			fmt.Printf("too old  %s %s, %s or later is required; %s\n", req.program, found, req.minimum, req.hint)
+			problems++
+			continue
+		}
+		if !quiet {
+			fmt.Println(strings.TrimSpace("ok       " + req.program + " " + found))
+		}
+	}
+	if problems > 0 {
+		croak("%d required tool(s) missing or unusable.", problems)
+	}
+}
+
+// Credentials for remote access come from the environment, so
+// that mirroring private upstreams can run unattended.  RUSERNAME and
+// RPASSWORD are a login and password, RTOKEN is an HTTP bearer token,
+// and RSSH_IDENTITY is an ssh private key file.
+
+// svnCredentials returns Subversion client options supplying any
+// credentials. The prefix distinguishes svnsync's --source- options.
+func svnCredentials(prefix string) string {
+	options := "--non-interactive"
+	if username := os.Getenv("RUSERNAME"); username != "" {
+		options += fmt.Sprintf(" --%susername %q", prefix, username)
+	}
+	if password := os.Getenv("RPASSWORD"); password != "" {
+		options += fmt.Sprintf(" --%spassword %q", prefix, password)
+	}
+	return options
+}
+
+// hgCredentials returns hg options supplying any credentials for the
+// given remote.  They are scoped to its scheme and host, so they are
+// not offered to any other server the remote sends hg to.  The
+// password is referred to through the environment rather than being
+// written into the command.
+func hgCredentials(remote string) string {
+	options := "--noninteractive"
+	if u, err := url.Parse(remote); err == nil && u.Host != "" && os.Getenv("RUSERNAME") != "" {
+		options += " --config " + shellquote.Join("auth.repotool.prefix="+u.Scheme+"://"+u.Host)
+		options += ` --config "auth.repotool.username=$RUSERNAME"`
+		if os.Getenv("RPASSWORD") != "" {
+			options += ` --config "auth.repotool.password=$RPASSWORD"`
+		}
+	}
+	if identity := os.Getenv("RSSH_IDENTITY"); identity != "" {
+		options += fmt.Sprintf(" --config ui.ssh=%q", sshCommand(identity))
+	}
+	return options
+}
+
+// sshCommand returns an ssh invocation that uses the given identity and
+// fails rather than prompting.
+func sshCommand(identity string) string {
+	return shellquote.Join("ssh", "-i", identity, "-o", "IdentitiesOnly=yes", "-o", "BatchMode=yes")
+}
+
+// authEnviron sets up the environment of child processes so that git,
+// Subversion over ssh, and rsync find credentials and never prompt.
+// git is configured through GIT_CONFIG_* variables so that neither a
+// token nor a password appears on a command line.
+func authEnviron() {
+	os.Setenv("GIT_TERMINAL_PROMPT", "0")
+	if identity := os.Getenv("RSSH_IDENTITY"); identity != "" {
+		for _, name := range []string{"GIT_SSH_COMMAND", "SVN_SSH", "RSYNC_RSH"} {
+			os.Setenv(name, sshCommand(identity))
+		}
+	}
+	config := make([][2]string, 0)
+	if token := os.Getenv("RTOKEN"); token != "" {
+		config = append(config, [2]string{"http.extraHeader", "Authorization: Bearer " + token})
+	}
+	if os.Getenv("RUSERNAME") != "" {
+		config = append(config, [2]string{"credential.helper", `!f() { echo "username=$RUSERNAME"; test -z "$RPASSWORD" || echo "password=$RPASSWORD"; }; f`})
+	}
+	if len(config) > 0 {
+		os.Setenv("GIT_CONFIG_COUNT", strconv.Itoa(len(config)))
+		for i, kv := range config {
+			os.Setenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", i), kv[0])
+			os.Setenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i), kv[1])
 		}
-		runShellProcessOrDie(cmd, " export command in "+pwd)
 	}
 }
 
@@ -457,8 +812,7 @@ func mirror(args []string) {
 		vtype := identifyRepo(operand[len(prefix)-1:])
 		return vtype != nil && vtype.name == vcs
 	}
-	username := os.Getenv("RUSERNAME")
-	password := os.Getenv("RPASSWORD")
+	authEnviron()
 	plausibleSVNPrefix := func(operand string) bool {
 		return strings.HasPrefix(operand, "svn://") || strings.HasPrefix(operand, "svn+ssh://") || strings.HasPrefix(operand, "file://") || strings.HasPrefix(operand, "https://") || strings.HasPrefix(operand, "http://")
 	}
@@ -468,17 +822,56 @@ func mirror(args []string) {
 		if !plausibleSVNPrefix(operand) {
 			operand = "file://" + operand
 		}
-		infoCredentials := ""
-		if username != "" {
-			infoCredentials = fmt.Sprintf("--username %q", username)
-		}
-		if password != "" {
-			infoCredentials += fmt.Sprintf(" --password %q", password)
-		}
+		infoCredentials := svnCredentials("")
 		s := captureFromProcess(fmt.Sprintf("svn info --show-item=revision %s %s", infoCredentials, operand), "info")
 		revs, _ := strconv.Atoi(strings.Trim(s, "\n"))
 		return revs
 	}
+	// Gets the date of a revision, as a fingerprint of its identity.
+	revdate := func(operand string, rev int) string {
+		if !plausibleSVNPrefix(operand) {
+			operand = "file://" + operand
+		}
+		infoCredentials := svnCredentials("")
+		return strings.TrimSpace(captureFromProcess(fmt.Sprintf("svn propget --revprop -r %d svn:date %s %s", rev, infoCredentials, operand), "date"))
+	}
+	// Incrementally updates an existing Subversion mirror.
+	svnUpdate := func(locald string) {
+		mirrorCredentials := svnCredentials("source-")
+		getremote := fmt.Sprintf("svnlook pg %s -r 0 --revprop svn:sync-from-url", locald)
+		cmd := fmt.Sprintf("svnsync synchronize -q --steal-lock %s file://%s", mirrorCredentials, locald)
+		if remote := strings.TrimSpace(captureFromProcess(getremote, "getting remote URL")); !plausibleSVNPrefix(remote) {
+			// Without the remote size we can't progress-meter.
+			// Might happen if we rsynced this.
+			runShellProcessOrDie(cmd, "mirroring")
+		} else {
+			// Have remote size, we can progress-meter,
+			// this makes long resyncs more bearable.
+			baton := newBaton(!quiet, func(s string) {})
+			remotesize := reposize(remote)
+			localsize := reposize(locald)
+			// svnsync can only append revisions.  If the
+			// upstream has fewer revisions than we do, or
+			// our youngest revision has a different date
+			// there, the upstream was reloaded or rolled
+			// back and the mirror must be rebuilt.
+			if remotesize < localsize || revdate(remote, localsize) != revdate(locald, localsize) {
+				croak("upstream history of %s was rewritten at or before r%d; a full re-mirror is required.", remote, localsize)
+			}
+			baton.startProgress("Mirroring", uint64(remotesize-localsize))
+			ind := 0
+			runMonitoredProcessOrDie(cmd, "mirroring", func(line string) {
+				if strings.Contains(line, "Committed revision") {
+					ind++
+					baton.percentProgress(uint64(ind))
+				}
+			})
+			if !quiet {
+				baton.Write([]byte{'\n'})
+			}
+			baton.endProgress()
+		}
+	}
 	var locald string
 	tillHash := regexp.MustCompile("^.*#")
 	isFullURL, badre := regexp.Match("svn://|svn\\+ssh://|https://|http://", []byte(operand))
@@ -490,13 +883,11 @@ func mirror(args []string) {
 		} else {
 			locald = filepath.Join(pwd, mirrordir)
 		}
-		mirrorCredentials := ""
-		if username != "" {
-			mirrorCredentials = fmt.Sprintf("--source-username %q", username)
-		}
-		if password != "" {
-			mirrorCredentials += fmt.Sprintf(" --source-password %q", password)
+		if isdir(filepath.Join(locald, "locks")) {
+			svnUpdate(locald)
+			return
 		}
+		mirrorCredentials := svnCredentials("source-")
 		runShellProcessOrDie("svnadmin create "+locald, "mirror creation")
 		makeStub(locald+"/hooks/pre-revprop-change", "#!/bin/sh\nexit 0;\n")
 		os.Remove(locald + "/hooks/post-revprop-change")
@@ -528,38 +919,7 @@ func mirror(args []string) {
 		} else {
 			locald = filepath.Join(pwd, operand)
 		}
-		mirrorCredentials := ""
-		if username != "" {
-			mirrorCredentials = fmt.Sprintf("--source-username %q", username)
-		}
-		if password != "" {
-			mirrorCredentials += fmt.Sprintf(" --source-password %q", password)
-		}
-		getremote := fmt.Sprintf("svnlook pg %s -r 0 --revprop svn:sync-from-url", operand)
-		cmd := fmt.Sprintf("svnsync synchronize -q --steal-lock %s file://%s", mirrorCredentials, locald)
-		if remote := captureFromProcess(getremote, "getting remote URL"); !plausibleSVNPrefix(remote) {
-			// Without the remote size we can't progress-meter.
-			// Might happen if we rsynced this.
-			runShellProcessOrDie(cmd, "mirroring")
-		} else {
-			// Have remote size, we can progress-meter,
-			// this makes long resyncs more bearable.
-			baton := newBaton(!quiet, func(s string) {})
-			remotesize := reposize(remote)
-			localsize := reposize(locald)
-			baton.startProgress("Mirroring", uint64(remotesize-localsize))
-			ind := 0
-			runMonitoredProcessOrDie(cmd, "mirroring", func(line string) {
-				if strings.Contains(line, "Committed revision") {
-					ind++
-					baton.percentProgress(uint64(ind))
-				}
-			})
-			if !quiet {
-				baton.Write([]byte{'\n'})
-			}
-			baton.endProgress()
-		}
+		svnUpdate(locald)
 	} else if strings.HasPrefix(operand, "rsync://") {
 		if mirrordir == "" {
 			locald = filepath.Join(pwd, filepath.Base(operand)+"-mirror")
@@ -598,10 +958,22 @@ func mirror(args []string) {
 		} else {
 			locald = tillHash.ReplaceAllString(filepath.Base(operand), pwd)
 		}
+		if isdir(filepath.Join(locald, ".git")) {
+			gitUpdate(locald)
+			return
+		}
 		runShellProcessOrDie(fmt.Sprintf("git clone -q %s %s", operand, locald), "mirroring")
+		under(locald, gitRecord)
 	} else if isdir(operand + "/.git") {
-		under(operand, func() { runShellProcessOrDie("git pull", "mirroring") })
-		runShellProcessOrDie(fmt.Sprintf("git clone %s %s", operand, mirrordir), "mirroring")
+		if mirrordir == "" {
+			gitUpdate(operand)
+		} else if isdir(filepath.Join(mirrordir, ".git")) {
+			gitUpdate(mirrordir)
+		} else {
+			under(operand, func() { runShellProcessOrDie("git pull", "mirroring") })
+			runShellProcessOrDie(fmt.Sprintf("git clone %s %s", operand, mirrordir), "mirroring")
+			under(mirrordir, gitRecord)
+		}
 	} else if strings.HasPrefix(operand, "hg://") || localrepo(operand, "file://", "hg") {
 		if strings.HasPrefix(operand, "file://") {
 			operand = operand[6:]
@@ -611,15 +983,95 @@ func mirror(args []string) {
 		} else {
 			locald = tillHash.ReplaceAllString(filepath.Base(operand), pwd)
 		}
-		runShellProcessOrDie(fmt.Sprintf("hg clone -q %s %s", operand, locald), "mirroring")
+		if isdir(filepath.Join(locald, ".hg")) {
+			hgUpdate(locald)
+			return
+		}
+		runShellProcessOrDie(fmt.Sprintf("hg clone -q %s %s %s", hgCredentials(operand), operand, locald), "mirroring")
+		under(locald, hgRecord)
 	} else if isdir(operand + "/.hg") {
-		under(operand, func() { runShellProcessOrDie("hg update", "mirroring") })
-		runShellProcessOrDie(fmt.Sprintf("hg clone %s %s", operand, mirrordir), "mirroring")
+		if mirrordir == "" {
+			hgUpdate(operand)
+		} else if isdir(filepath.Join(mirrordir, ".hg")) {
+			hgUpdate(mirrordir)
+		} else {
+			under(operand, func() { runShellProcessOrDie("hg update", "mirroring") })
+			runShellProcessOrDie(fmt.Sprintf("hg clone %s %s", operand, mirrordir), "mirroring")
+			under(mirrordir, hgRecord)
+		}
 	} else {
 		croak("%s does not look like a repository mirror.", operand)
 	}
 }
 
+// mirrorState is the name of the file, kept in the metadata directory
+// of a DVCS mirror, recording what the upstream refs pointed at after
+// the last fetch.  It is used to detect rewritten upstream history.
+const mirrorState = "repotool-mirror"
+
+// gitRecord saves the state of the git mirror in the current directory.
+func gitRecord() {
+	refs := captureFromProcess("git for-each-ref --format='%(objectname) %(refname)' refs/heads refs/tags", "recording mirror state")
+	if err := ioutil.WriteFile(filepath.Join(".git", mirrorState), []byte(refs), 0644); err != nil {
+		croak("recording mirror state: %v", err)
+	}
+}
+
+// gitUpdate fetches new history into an existing git mirror, checking
+// that every ref recorded last time is still an ancestor of its new value.
+func gitUpdate(locald string) {
+	under(locald, func() {
+		old, _ := ioutil.ReadFile(filepath.Join(".git", mirrorState))
+		runShellProcessOrDie("git fetch -q --prune --update-head-ok origin '+refs/heads/*:refs/heads/*' '+refs/tags/*:refs/tags/*'", "mirroring")
+		runShellProcessOrDie("git reset -q --hard", "mirroring")
+		rewritten := make([]string, 0)
+		for _, line := range strings.Split(strings.TrimSpace(string(old)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			check := fmt.Sprintf("git rev-parse -q --verify %s >/dev/null || exit 0; git merge-base --is-ancestor %s^{commit} %s^{commit} || echo no", fields[1], fields[0], fields[1])
+			if captureFromProcess(check, "checking "+fields[1]) != "" {
+				rewritten = append(rewritten, fields[1])
+			}
+		}
+		// Recording now would make the rewritten state the baseline,
+		// and the next update would pass silently.
+		if len(rewritten) > 0 {
+			croak("upstream history was rewritten at %s; a full re-mirror is required.", strings.Join(rewritten, ", "))
+		}
+		gitRecord()
+	})
+}
+
+// hgRecord saves the state of the hg mirror in the current directory.
+func hgRecord() {
+	tip := captureFromProcess("hg log -r tip --template '{rev} {node}'", "recording mirror state")
+	if err := ioutil.WriteFile(filepath.Join(".hg", mirrorState), []byte(tip), 0644); err != nil {
+		croak("recording mirror state: %v", err)
+	}
+}
+
+// hgUpdate pulls new history into an existing hg mirror, first checking
+// that every changeset up to the one that was tip last time is still
+// upstream.  A pull only ever adds changesets, so a rewrite would
+// otherwise go unnoticed.
+func hgUpdate(locald string) {
+	under(locald, func() {
+		credentials := hgCredentials(strings.TrimSpace(captureFromProcess("hg paths default", "finding upstream")))
+		old, _ := ioutil.ReadFile(filepath.Join(".hg", mirrorState))
+		if fields := strings.Fields(string(old)); len(fields) == 2 {
+			// hg outgoing exits 1 when it finds nothing.
+			check := fmt.Sprintf("hg outgoing -q %s -r %s --template '{rev} '; test $? -le 1", credentials, fields[1])
+			if dropped := strings.TrimSpace(captureFromProcess(check, "checking upstream")); dropped != "" {
+				croak("upstream history was rewritten; revisions %s are no longer upstream and a full re-mirror is required.", dropped)
+			}
+		}
+		runShellProcessOrDie(fmt.Sprintf("hg pull -q %s && hg update -q", credentials), "mirroring")
+		hgRecord()
+	})
+}
+
 func tags() string {
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -695,15 +1147,7 @@ func checkout(outdir string, rev string) string {
 		if rev != "" {
 			rev = "-r " + rev
 		}
-		/* These options aren't actually documnted */
-		username := os.Getenv("RUSERNAME")
-		password := os.Getenv("RPASSWORD")
-		if username != "" {
-			rev += fmt.Sprintf("--username %q", username)
-		}
-		if password != "" {
-			rev += fmt.Sprintf(" --password %q", password)
-		}
+		rev += " " + svnCredentials("")
 		// The reason for checkout's odd calling signature -
 		// pass it a checkout directory, get back a symlink
 		// to what you actually wanted - is here. The problem
@@ -772,77 +1216,68 @@ func checkout(outdir string, rev string) string {
 			fmt.Printf("Subversion inward link %s -> %s\n", outdir, part)
 		}
 		return outdir
-	} else if vcs.name == "git" {
-		// Only one rev should be given to git checkout
-		// Use the passed-in arguments, in some order of specificity.
-		handleMissing := false
-		if rev == "" {
-			if tag != "" {
-				rev = tag
-			} else if branch != "" {
-				rev = branch
-			} else {
-				rev = "master"
-			}
-			handleMissing = acceptMissing &&
-				(captureFromProcess(fmt.Sprintf("git rev-parse --verify -q %s >/dev/null || echo no", rev), "checkout") != "")
-		}
-		var path string
-		if handleMissing {
-			path = pwd + ".git/this/path/does/not/exist"
-		} else {
-			runShellProcessOrDie(fmt.Sprintf("git checkout --quiet %s %s", passthrough, rev), "checkout")
-			path = pwd
+	} else if vcs.switcher != "" {
+		// Any VCS whose capability table says how to switch the
+		// working tree in place: bring it to the most specific
+		// revision given and pass back a link to it.
+		spec := rev
+		if spec == "" {
+			spec = tag
 		}
-		if exists(outdir) {
-			if islink(outdir) {
-				os.Remove(outdir)
-			}
+		if spec == "" {
+			spec = branch
 		}
-		err := os.Symlink(path, outdir) // to, from
-		if err != nil {
-			log.Fatal(err)
+		if spec == "" {
+			spec = vcs.dfltbranch
 		}
+		cmd := strings.Join(strings.Fields(fmt.Sprintf("%s %s %s", vcs.switcher, passthrough, spec)), " ")
 		if verbose {
-			fmt.Printf("Git inward link %s -> %s\n", outdir, path)
-		}
-		return outdir
-	} else if vcs.name == "bzr" {
-		croak("checkout is not yet supported in bzr.")
-	} else if vcs.name == "hg" {
-		spec := ""
-		if rev != "" {
-			spec = "-r " + rev
-		} else if tag != "" {
-			spec = "-r " + tag
-		} else if branch != "" {
-			spec = "-r " + branch
+			announce("executing '%s' checkout", cmd)
+		}
+		// Checkout chatter would land in comparison reports, so
+		// it is only shown on failure.
+		path := pwd
+		if out, err := exec.Command("sh", "-c", cmd).CombinedOutput(); err != nil {
+			if acceptMissing && rev == "" {
+				path = filepath.Join(pwd, vcs.subdirectory, "this/path/does/not/exist")
+			} else {
+				os.Stderr.Write(out)
+				croak("executing %q: %v", cmd, err)
+			}
 		}
-		runShellProcessOrDie(fmt.Sprintf("hg update %s -q %s", passthrough, spec), "checkout")
 		if outdir == "." {
-			return pwd
+			return path
 		} else if exists(outdir) {
 			if islink(outdir) {
 				os.Remove(outdir)
 			}
 		}
-		err = os.Symlink(pwd, outdir)
+		err := os.Symlink(path, outdir) // to, from
 		if err != nil {
 			log.Fatal(err)
 		}
 		if verbose {
-			fmt.Printf("Hg inward link %s -> %s\n", outdir, pwd)
+			fmt.Printf("%s inward link %s -> %s\n", vcs.name, outdir, path)
 		}
 		return outdir
-	} else if vcs.name == "darcs" {
-		croak("checkout is not yet supported for darcs.")
 	} else {
-		croak("checkout not supported for this repository type.")
+		croak("checkout is not supported for %s.", vcs.name)
 	}
 	// Empty return indicates error
 	return ""
 }
 
+// sorted returns the members of a set in lexical order, so reports
+// come out the same from run to run.
+func sorted(set stringSet) []string {
+	members := make([]string, 0, set.Len())
+	for member := range set.Iterate() {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
 // dirlist lists all files and directories under a sprcfief directory.
 func dirlist(top string) stringSet {
 	outset := newStringSet()
@@ -873,6 +1308,22 @@ func ignorable(filepath string, vcs *VCS) bool {
 	return false
 }
 
+// keywordRE matches expanded RCS/CVS and Subversion keywords.
+var keywordRE = regexp.MustCompile(`\$(Author|Date|Header|Id|Locker|Log|Name|RCSfile|Revision|Source|State|LastChangedDate|LastChangedRevision|LastChangedBy|Rev|HeadURL|URL):[^$\n]*\$`)
+
+// normalize applies the comparison filters selected by options to file
+// content, so cosmetic differences don't show up as mismatches.
+func normalize(text []byte) []byte {
+	if normalizeEOL {
+		text = bytes.ReplaceAll(text, []byte("\r\n"), []byte("\n"))
+		text = bytes.ReplaceAll(text, []byte("\r"), []byte("\n"))
+	}
+	if stripKeywords {
+		text = keywordRE.ReplaceAll(text, []byte("$$$1$$"))
+	}
+	return text
+}
+
 // Compare two repositories at a specified revision, defaulting to mainline tip.
 func compareRevision(args []string, rev string) string {
 	if verbose {
@@ -923,6 +1374,14 @@ func compareRevision(args []string, rev string) string {
 		}
 	})
 	under(target, func() {
+		savetag, savebranch := tag, branch
+		if tag != "" {
+			tag = mapRefName(tag)
+		}
+		if branch != "" {
+			branch = mapRefName(branch)
+		}
+		defer func() { tag, branch = savetag, savebranch }()
 		targetdir = checkout(rtarget, targetRev)
 		if targetdir == "" {
 			panic("sourcedir unexpectedly nil")
@@ -955,7 +1414,7 @@ func compareRevision(args []string, rev string) string {
 	}
 	sourcefiles := dirlist(sourcedir)
 	targetfiles := dirlist(targetdir)
-	for _, path := range sourcefiles.Union(targetfiles).Ordered() {
+	for _, path := range sorted(sourcefiles.Union(targetfiles)) {
 		sourcepath := filepath.Join(sourcedir, path)
 		targetpath := filepath.Join(targetdir, path)
 		if isdir(sourcepath) || isdir(targetpath) || ignorable(path, sourcetype) || ignorable(path, targettype) {
@@ -983,6 +1442,7 @@ func compareRevision(args []string, rev string) string {
 		// --ignore-matching-lines='$Header.*$'
 		// --ignore-matching-lines='$Log.*$'
 
+		sourceText, targetText = normalize(sourceText), normalize(targetText)
 		if !bytes.Equal(sourceText, targetText) {
 			lines0 := difflib.SplitLines(string(sourceText))
 			lines1 := difflib.SplitLines(string(targetText))
@@ -1022,7 +1482,7 @@ func compareRevision(args []string, rev string) string {
 			complain("target path stat: %s", err2)
 			continue
 		}
-		if sstat.Mode() != tstat.Mode() {
+		if !ignorePerms && sstat.Mode() != tstat.Mode() {
 			diff += fmt.Sprintf("%s: %0o -> %0o\n", path, sstat.Mode(), tstat.Mode())
 		}
 	}
@@ -1031,7 +1491,138 @@ func compareRevision(args []string, rev string) string {
 	return diff
 }
 
-func compareEngine(_singular string, plural string, lister func() string, args []string) string {
+// A refRename relates a tag or branch name in the source repository
+// to the name it was given in the conversion.
+type refRename struct {
+	pattern *regexp.Regexp // nil for a literal name
+	source  string
+	target  string
+}
+
+var refRenames []refRename
+
+// loadNameMap reads a compare name-mapping file.  Each line holds a
+// source name and a target name separated by whitespace; a source of
+// the form /regexp/ matches whole names, and the target may then use
+// ${1}-style references to its groups.  Blank lines and #-comments
+// are ignored.
+func loadNameMap(path string) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		croak("reading name map: %v", err)
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			croak("%s:%d: name map lines need a source and a target name.", path, i+1)
+		}
+		rename := refRename{source: fields[0], target: fields[1]}
+		if len(rename.source) > 2 && strings.HasPrefix(rename.source, "/") && strings.HasSuffix(rename.source, "/") {
+			rename.pattern, err = regexp.Compile("^(?:" + rename.source[1:len(rename.source)-1] + ")$")
+			if err != nil {
+				croak("%s:%d: %v", path, i+1, err)
+			}
+		}
+		refRenames = append(refRenames, rename)
+	}
+}
+
+// mapRefName returns the name a source tag or branch should have in
+// the target.  The first matching line of the name map wins; names no
+// line matches are unchanged.
+func mapRefName(name string) string {
+	for _, rename := range refRenames {
+		if rename.pattern == nil {
+			if rename.source == name {
+				return rename.target
+			}
+		} else if m := rename.pattern.FindStringSubmatchIndex(name); m != nil {
+			return string(rename.pattern.ExpandString(nil, rename.target, name, m))
+		}
+	}
+	return name
+}
+
+// compareFlags reconstructs the command-line options that affect a
+// single comparison, for passing to a parallel worker.
+func compareFlags() []string {
+	flags := make([]string, 0)
+	for _, opt := range []struct {
+		set  bool
+		flag string
+	}{{acceptMissing, "-a"}, {context, "-c"}, {seeignores, "-i"}, {stripKeywords, "-k"}, {normalizeEOL, "-l"},
+		{nobranch, "-n"}, {ignorePerms, "-p"}, {quiet, "-q"}, {same, "-s"}} {
+		if opt.set {
+			flags = append(flags, opt.flag)
+		}
+	}
+	if !unified {
+		flags = append(flags, "-u=false")
+	}
+	if revision != "" {
+		flags = append(flags, "-r", revision)
+	}
+	if passthrough != "" {
+		flags = append(flags, "-o", passthrough)
+	}
+	if namemap != "" {
+		flags = append(flags, "-m", namemap)
+	}
+	return flags
+}
+
+// compareParallel compares two repositories at each of a list of
+// refs, spreading the comparisons across a pool of worker processes.
+// Checkouts modify the repositories they are run in, so each worker
+// gets private copies of both.  Reports are returned in ref order.
+func compareParallel(singular string, refs []string, source string, target string) string {
+	self, err := os.Executable()
+	if err != nil {
+		croak("finding repotool executable: %v", err)
+	}
+	refflag := "-b"
+	if singular == "Tag" {
+		refflag = "-t"
+	}
+	reports := make([]string, len(refs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < len(refs); w++ {
+		workdir, err := ioutil.TempDir(os.Getenv("TMPDIR"), "comparejob")
+		if err != nil {
+			croak("making worker directory: %v", err)
+		}
+		defer os.RemoveAll(workdir)
+		wsource := filepath.Join(workdir, "source")
+		wtarget := filepath.Join(workdir, "target")
+		runShellProcessOrDie(fmt.Sprintf("cp -a %q %q && cp -a %q %q", source, wsource, target, wtarget), "copying for worker")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				cmdargs := append([]string{"compare"}, compareFlags()...)
+				cmdargs = append(cmdargs, refflag, refs[i], wsource, wtarget)
+				if verbose {
+					announce("worker comparing %s %s", singular, refs[i])
+				}
+				out, _ := exec.Command(self, cmdargs...).CombinedOutput()
+				reports[i] = string(out)
+			}
+		}()
+	}
+	for i := range refs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+	return strings.Join(reports, "")
+}
+
+func compareEngine(singular string, plural string, lister func() string, args []string) string {
 	// Compare two repositories at all revisions implied by a specified command.
 	if len(args) != 2 {
 		croak("compareEngine requires exactly two repository-name arguments, but there are %d %v.", len(args), args)
@@ -1048,9 +1639,22 @@ func compareEngine(_singular string, plural string, lister func() string, args [
 	under(target, func() {
 		targetrefs = strings.Fields(strings.TrimSpace(lister()))
 	})
-	common := newStringSet(sourcerefs...).Intersection(newStringSet(targetrefs...))
-	sourceonly := newStringSet(sourcerefs...).Subtract(common)
-	targetonly := newStringSet(targetrefs...).Subtract(common)
+	// Refs are paired by their names in the target, so that
+	// refs renamed in the conversion are compared with their
+	// originals.  Comparisons are run under the source names.
+	targetset := newStringSet(targetrefs...)
+	common := newStringSet()
+	sourceonly := newStringSet()
+	mapped := newStringSet()
+	for _, ref := range sourcerefs {
+		if targetset.Contains(mapRefName(ref)) {
+			common.Add(ref)
+			mapped.Add(mapRefName(ref))
+		} else {
+			sourceonly.Add(ref)
+		}
+	}
+	targetonly := targetset.Subtract(mapped)
 	if refexclude != "" {
 		re := regexp.MustCompile(refexclude)
 		for k := range sourceonly.store {
@@ -1069,14 +1673,14 @@ func compareEngine(_singular string, plural string, lister func() string, args [
 	if sourceonly.Len() > 0 {
 		compareResult += "----------------------------------------------------------------\n"
 		compareResult += fmt.Sprintf("%s only in source:\n", plural)
-		for _, item := range sourceonly.Ordered() {
+		for _, item := range sorted(sourceonly) {
 			compareResult += item + "\n"
 		}
 	}
 	if targetonly.Len() > 0 {
 		compareResult += "----------------------------------------------------------------\n"
 		compareResult += fmt.Sprintf("%s only in target:\n", plural)
-		for _, item := range targetonly.Ordered() {
+		for _, item := range sorted(targetonly) {
 			compareResult += item + "\n"
 		}
 	}
@@ -1084,11 +1688,22 @@ func compareEngine(_singular string, plural string, lister func() string, args [
 		croak(compareResult)
 	}
 	report := ""
-	if !common.Empty() {
-		for _, ref := range common.Ordered() {
-			report += compareRevision([]string{source, target}, ref)
+	if common.Empty() {
+		return report
+	}
+	if jobs > 1 {
+		return compareParallel(singular, sorted(common), source, target)
+	}
+	savetag, savebranch := tag, branch
+	for _, ref := range sorted(common) {
+		if singular == "Tag" {
+			tag, branch = ref, ""
+		} else {
+			tag, branch = "", ref
 		}
+		report += compareRevision([]string{source, target}, ref)
 	}
+	tag, branch = savetag, savebranch
 	return report
 }
 
@@ -1133,11 +1748,10 @@ func compareAll(args []string) {
 	if verbose {
 		fmt.Print("Comparing tags...")
 	}
-	diff += compareEngine("Branch", "Branches", branches, args)
+	diff += compareEngine("Tag", "Tags", tags, args)
 	if verbose {
 		fmt.Print("Comparing branches...")
 	}
-	compareBranches(args)
 	diff += compareEngine("Branch", "Branches", branches, args)
 	if diff != "" {
 		fmt.Print(diff)
@@ -1153,15 +1767,21 @@ func main() {
 	flags.BoolVar(&acceptMissing, "a", false, "accept missing trunk directory")
 	flags.BoolVar(&context, "c", false, "emit context diff")
 	flags.BoolVar(&seeignores, "i", false, "do not suppress comparison of normally ignored directories")
+	flags.BoolVar(&stripKeywords, "k", false, "collapse expanded RCS and Subversion keywords before comparing")
+	flags.BoolVar(&normalizeEOL, "l", false, "normalize line endings to LF before comparing")
+	flags.BoolVar(&ignorePerms, "p", false, "ignore permission differences")
 	flags.BoolVar(&nobranch, "n", false, "compare raw structure, ignore SVN branching")
 	flags.BoolVar(&quiet, "q", false, "run as quietly as possible")
 	flags.BoolVar(&same, "s", false, "show same files")
 	flags.BoolVar(&unified, "u", true, "emit unified diff")
 	flags.BoolVar(&verbose, "v", false, "show subcommands and diagnostics")
 
+	flags.IntVar(&jobs, "j", 1, "number of parallel comparison jobs")
+
 	flags.StringVar(&branch, "b", "", "select branch for checkout or comparison")
 	flags.StringVar(&basedir, "d", "", "chdir to the argument repository path before doing checkout")
 	flags.StringVar(&refexclude, "e", "", "exclude pattern for tag and branch names.")
+	flags.StringVar(&namemap, "m", "", "map source tag and branch names to target names for comparison")
 	flags.StringVar(&revision, "r", "", "select revision for checkout or comparison")
 	flags.StringVar(&tag, "t", "", "select tag for checkout or comparison")
 	flags.StringVar(&passthrough, "o", "", "option passthrough")
@@ -1169,18 +1789,24 @@ func main() {
 	explain := func() {
 		print(`
 commands:
-  initialize    - create Makefile and stub files for standard conversion workflow
+  initialize project [source [target [layout]]]
+                - create Makefile and stub files for standard conversion workflow
+  doctor [source target]
+                - check that the tools a conversion needs are installed
   export        - export a stream dump of the source repository
   mirror [URL] localdir
                 - create or update a mirror of the source repository
   branches      - list repository branch names
   checkout [-r rev] [-t tag] [-b branch] [-o option]
                 - check out a working copy of the repo
-  compare [-r rev] [-t tag] [-b branch]
+  compare [-r rev] [-t tag] [-b branch] [-k] [-l] [-p] [-m namemap]
                 - compare head content of two repositories
-  compare-tags  - compare source and target repo content at all tags
-  compare-branches - compare source and target repo content at all branches
-  compare-all   - compare repositories at head, all tags, and all branches
+  compare-tags [-j jobs] [-m namemap]
+                - compare source and target repo content at all tags
+  compare-branches [-j jobs] [-m namemap]
+                - compare source and target repo content at all branches
+  compare-all [-j jobs] [-m namemap]
+                - compare repositories at head, all tags, and all branches
   version       - report software version
 
 options:
@@ -1198,7 +1824,7 @@ options:
 
 	flags.Parse(os.Args[2:])
 
-	if !strings.HasPrefix(operation, "compare") && (acceptMissing || context || seeignores || same) {
+	if !strings.HasPrefix(operation, "compare") && (acceptMissing || context || seeignores || same || jobs != 1 || stripKeywords || normalizeEOL || ignorePerms || namemap != "") {
 		croak("compare option with non-compare operation, bailing out.")
 	}
 	if operation != "tag" && operation != "branches" && operation != "checkout" && !strings.HasPrefix(operation, "compare") && refexclude != "" {
@@ -1208,6 +1834,12 @@ options:
 		croak("selection option with an operation that is not checkout or compare")
 	}
 
+	if namemap != "" {
+		// Parallel workers may run elsewhere
+		namemap, _ = filepath.Abs(namemap)
+		loadNameMap(namemap)
+	}
+
 	if basedir != "" {
 		if err := os.Chdir(basedir); err != nil {
 			croak("changing directory: %v", err)
@@ -1219,6 +1851,8 @@ options:
 		explain()
 	} else if operation == "initialize" {
 		initialize(args)
+	} else if operation == "doctor" {
+		doctor(args)
 	} else if operation == "export" {
 		export()
 	} else if operation == "mirror" {